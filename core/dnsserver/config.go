@@ -40,6 +40,14 @@ type Config struct {
 	// TLSConfig when listening for encrypted connections (gRPC, DNS-over-TLS).
 	TLSConfig *tls.Config
 
+	// TsigKeys are the TSIG keys, keyed by their name, that plugins can use to sign and verify messages.
+	// Incoming queries are verified with the keys of all configs that share a server.
+	TsigKeys map[string]*TsigKey
+
+	// Updates is set by plugins that handle dynamic updates (RFC 2136). Updates are rejected with NOTIMP
+	// unless one of the configs sharing a server has it set.
+	Updates bool
+
 	// Plugin stack.
 	Plugin []plugin.Plugin
 
@@ -56,6 +64,13 @@ type Config struct {
 	firstConfigInBlock *Config
 }
 
+// TsigKey is a key for transaction signatures (RFC 8945).
+type TsigKey struct {
+	Name      string // name of the key, lowercased and fully qualified
+	Algorithm string // algorithm of the key, such as dns.HmacSHA256
+	Secret    string // base64 encoded secret
+}
+
 // keyForConfig builds a key for identifying the configs during setup time
 func keyForConfig(blocIndex int, blocKeyIndex int) string {
 	return fmt.Sprintf("%d:%d", blocIndex, blocKeyIndex)
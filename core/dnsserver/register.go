@@ -146,7 +146,7 @@ func (h *dnsContext) MakeServers() ([]caddy.Server, error) {
 		return nil, errValid
 	}
 
-	// Copy the Plugin, ListenHosts and Debug from first config in the block
+	// Copy the Plugin, ListenHosts, Debug, TLSConfig, TsigKeys and Updates from first config in the block
 	// to all other config in the same block . Doing this results in zones
 	// sharing the same plugin instances and settings as other zones in
 	// the same block.
@@ -155,6 +155,8 @@ func (h *dnsContext) MakeServers() ([]caddy.Server, error) {
 		c.ListenHosts = c.firstConfigInBlock.ListenHosts
 		c.Debug = c.firstConfigInBlock.Debug
 		c.TLSConfig = c.firstConfigInBlock.TLSConfig
+		c.TsigKeys = c.firstConfigInBlock.TsigKeys
+		c.Updates = c.firstConfigInBlock.Updates
 	}
 
 	// we must map (group) each config to a bind address
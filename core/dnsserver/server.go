@@ -3,6 +3,7 @@ package dnsserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"runtime"
@@ -42,6 +43,8 @@ type Server struct {
 	trace        trace.Trace        // the trace plugin for the server
 	debug        bool               // disable recover()
 	classChaos   bool               // allow non-INET class queries
+	tsigSecret   map[string]string  // secrets of the TSIG keys, keyed by name
+	updates      bool               // accept dynamic updates
 }
 
 // NewServer returns a new CoreDNS server and compiles all plugins in to it. By default CH class
@@ -70,6 +73,21 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 		// set the config per zone
 		s.zones[site.Zone] = site
 
+		if site.Updates {
+			s.updates = true
+		}
+
+		// gather the TSIG keys, the DNS server verifies queries with them
+		for name, key := range site.TsigKeys {
+			if s.tsigSecret == nil {
+				s.tsigSecret = make(map[string]string)
+			}
+			if secret, ok := s.tsigSecret[name]; ok && secret != key.Secret {
+				return nil, fmt.Errorf("TSIG key %q is defined with different secrets on %s", name, addr)
+			}
+			s.tsigSecret[name] = key.Secret
+		}
+
 		// compile custom plugin for everything
 		var stack plugin.Handler
 		for i := len(site.Plugin) - 1; i >= 0; i-- {
@@ -108,7 +126,7 @@ var _ caddy.GracefulServer = &Server{}
 // This implements caddy.TCPServer interface.
 func (s *Server) Serve(l net.Listener) error {
 	s.m.Lock()
-	s.server[tcp] = &dns.Server{Listener: l, Net: "tcp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+	s.server[tcp] = &dns.Server{Listener: l, Net: "tcp", TsigSecret: s.tsigSecret, MsgAcceptFunc: s.msgAcceptFunc(), Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		ctx = context.WithValue(ctx, LoopKey{}, 0)
 		s.ServeDNS(ctx, w, r)
@@ -122,7 +140,7 @@ func (s *Server) Serve(l net.Listener) error {
 // This implements caddy.UDPServer interface.
 func (s *Server) ServePacket(p net.PacketConn) error {
 	s.m.Lock()
-	s.server[udp] = &dns.Server{PacketConn: p, Net: "udp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+	s.server[udp] = &dns.Server{PacketConn: p, Net: "udp", TsigSecret: s.tsigSecret, MsgAcceptFunc: s.msgAcceptFunc(), Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		ctx = context.WithValue(ctx, LoopKey{}, 0)
 		s.ServeDNS(ctx, w, r)
@@ -132,6 +150,24 @@ func (s *Server) ServePacket(p net.PacketConn) error {
 	return s.server[udp].ActivateAndServe()
 }
 
+// msgAcceptFunc returns the function that accepts messages for the DNS server. When dynamic updates are
+// enabled, updates are accepted as well.
+func (s *Server) msgAcceptFunc() dns.MsgAcceptFunc {
+	if !s.updates {
+		return dns.DefaultMsgAcceptFunc
+	}
+	return func(dh dns.Header) dns.MsgAcceptAction {
+		// Bit 15 of the flags is set for responses, the opcode is in bits 11 to 14.
+		if dh.Bits&(1<<15) == 0 && int(dh.Bits>>11)&0xF == dns.OpcodeUpdate {
+			if dh.Qdcount != 1 {
+				return dns.MsgReject
+			}
+			return dns.MsgAccept
+		}
+		return dns.DefaultMsgAcceptFunc(dh)
+	}
+}
+
 // Listen implements caddy.TCPServer interface.
 func (s *Server) Listen() (net.Listener, error) {
 	l, err := reuseport.Listen("tcp", s.Addr[len(transport.DNS+"://"):])
@@ -247,9 +283,9 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 				return
 			}
 			if r.Question[0].Qtype != dns.TypeDS {
-				rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
+				rcode, err := h.pluginChain.ServeDNS(ctx, w, r)
 				if !plugin.ClientWrite(rcode) {
-					errorFunc(s.Addr, w, r, rcode)
+					errorFunc(s.Addr, w, r, rcode, err)
 				}
 				return
 			}
@@ -268,18 +304,18 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 	if r.Question[0].Qtype == dns.TypeDS && dshandler != nil && dshandler.pluginChain != nil {
 		// DS request, and we found a zone, use the handler for the query.
-		rcode, _ := dshandler.pluginChain.ServeDNS(ctx, w, r)
+		rcode, err := dshandler.pluginChain.ServeDNS(ctx, w, r)
 		if !plugin.ClientWrite(rcode) {
-			errorFunc(s.Addr, w, r, rcode)
+			errorFunc(s.Addr, w, r, rcode, err)
 		}
 		return
 	}
 
 	// Wildcard match, if we have found nothing try the root zone as a last resort.
 	if h, ok := s.zones["."]; ok && h.pluginChain != nil {
-		rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
+		rcode, err := h.pluginChain.ServeDNS(ctx, w, r)
 		if !plugin.ClientWrite(rcode) {
-			errorFunc(s.Addr, w, r, rcode)
+			errorFunc(s.Addr, w, r, rcode, err)
 		}
 		return
 	}
@@ -311,13 +347,18 @@ func (s *Server) Tracer() ot.Tracer {
 }
 
 // errorFunc responds to an DNS request with an error.
-func errorFunc(server string, w dns.ResponseWriter, r *dns.Msg, rc int) {
+func errorFunc(server string, w dns.ResponseWriter, r *dns.Msg, rc int, err error) {
 	state := request.Request{W: w, Req: r}
 
 	answer := new(dns.Msg)
 	answer.SetRcode(r, rc)
 	state.SizeAndDo(answer)
 
+	var ede *edns.ExtendedError
+	if errors.As(err, &ede) {
+		edns.SetExtendedError(r, answer, ede.Code, ede.Text)
+	}
+
 	w.WriteMsg(answer)
 }
 
@@ -2,9 +2,12 @@ package dnsserver
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/test"
 
@@ -93,3 +96,61 @@ func BenchmarkCoreServeDNS(b *testing.B) {
 		s.ServeDNS(ctx, w, m)
 	}
 }
+
+func TestUpdates(t *testing.T) {
+	update := dns.Header{Bits: uint16(dns.OpcodeUpdate) << 11, Qdcount: 1, Nscount: 2}
+
+	s1, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", testPlugin{})})
+	if err != nil {
+		t.Errorf("Expected no error for NewServer, got %s", err)
+	}
+	if action := s1.msgAcceptFunc()(update); action != dns.MsgRejectNotImplemented {
+		t.Errorf("Expected update to be rejected with NOTIMP, got %d", action)
+	}
+
+	configUpdates := testConfig("dns", testPlugin{})
+	configUpdates.Updates = true
+	s2, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", testPlugin{}), configUpdates})
+	if err != nil {
+		t.Errorf("Expected no error for NewServer, got %s", err)
+	}
+	if action := s2.msgAcceptFunc()(update); action != dns.MsgAccept {
+		t.Errorf("Expected update to be accepted, got %d", action)
+	}
+	update.Qdcount = 2
+	if action := s2.msgAcceptFunc()(update); action != dns.MsgReject {
+		t.Errorf("Expected update with two zones to be rejected, got %d", action)
+	}
+}
+
+func TestServeDNSExtendedError(t *testing.T) {
+	p := plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		err := &edns.ExtendedError{Code: dns.ExtendedErrorCodeNetworkError, Err: errors.New("no upstream")}
+		return dns.RcodeServerFailure, plugin.Error("testplugin", err)
+	})
+	s, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", p)})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	s.ServeDNS(context.TODO(), rec, m)
+
+	if rec.Msg.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	o := rec.Msg.IsEdns0()
+	if o == nil || len(o.Option) != 1 {
+		t.Fatalf("Expected an extended error in the reply")
+	}
+	if ede, ok := o.Option[0].(*dns.EDNS0_EDE); !ok || ede.InfoCode != dns.ExtendedErrorCodeNetworkError {
+		t.Errorf("Expected extended error %d, got %v", dns.ExtendedErrorCodeNetworkError, o.Option[0])
+	}
+	// The request is left as the client sent it, for the plugins that look at it after the reply.
+	if o := m.IsEdns0(); len(o.Option) != 0 {
+		t.Errorf("Expected no options in the request, got %v", o.Option)
+	}
+}
@@ -30,7 +30,12 @@ var Directives = []string{
 	"dnstap",
 	"local",
 	"dns64",
+	"rrl",
+	"ratelimit",
+	"tsig",
 	"acl",
+	"rpz",
+	"blocklist",
 	"any",
 	"chaos",
 	"loadbalance",
@@ -53,6 +58,7 @@ var Directives = []string{
 	"secondary",
 	"etcd",
 	"loop",
+	"validate",
 	"forward",
 	"grpc",
 	"erratic",
@@ -3,9 +3,13 @@ package acl
 import (
 	"context"
 	"net"
+	"regexp"
+	"strings"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/request"
 
 	"github.com/infobloxopen/go-trees/iptree"
@@ -31,11 +35,25 @@ type action int
 
 // policy defines the ACL policy for DNS queries.
 // A policy performs the specified action (block/allow) on all DNS queries
-// matched by source IP or QTYPE.
+// matched by source IP, QTYPE, QNAME and metadata. A policy with a file
+// instead holds the policies read from that file.
 type policy struct {
-	action action
-	qtypes map[uint16]struct{}
-	filter *iptree.Tree
+	action   action
+	name     string // name of the rule, for the hit counter
+	qtypes   map[uint16]struct{}
+	filter   *iptree.Tree
+	qnames   map[string]struct{}
+	suffixes []string
+	regexps  []*regexp.Regexp
+	metadata []metadataMatch
+
+	file *policyFile
+}
+
+// metadataMatch matches a query when the metadata label has one of the values.
+type metadataMatch struct {
+	label  string
+	values map[string]struct{}
 }
 
 const (
@@ -61,12 +79,16 @@ RulesCheckLoop:
 			continue
 		}
 
-		action := matchWithPolicies(rule.policies, w, r)
+		action, name := matchWithPolicies(ctx, rule.policies, w, r)
+		if name != "" {
+			RuleHitCount.WithLabelValues(metrics.WithServer(ctx), name).Inc()
+		}
 		switch action {
 		case actionBlock:
 			{
 				m := new(dns.Msg)
 				m.SetRcode(r, dns.RcodeRefused)
+				edns.SetExtendedError(r, m, dns.ExtendedErrorCodeProhibited, "")
 				w.WriteMsg(m)
 				RequestBlockCount.WithLabelValues(metrics.WithServer(ctx), zone).Inc()
 				return dns.RcodeSuccess, nil
@@ -79,6 +101,7 @@ RulesCheckLoop:
 			{
 				m := new(dns.Msg)
 				m.SetRcode(r, dns.RcodeSuccess)
+				edns.SetExtendedError(r, m, dns.ExtendedErrorCodeFiltered, "")
 				w.WriteMsg(m)
 				RequestFilterCount.WithLabelValues(metrics.WithServer(ctx), zone).Inc()
 				return dns.RcodeSuccess, nil
@@ -92,29 +115,96 @@ RulesCheckLoop:
 }
 
 // matchWithPolicies matches the DNS query with a list of ACL polices and returns suitable
-// action against the query.
-func matchWithPolicies(policies []policy, w dns.ResponseWriter, r *dns.Msg) action {
+// action against the query, together with the name of the matching rule.
+func matchWithPolicies(ctx context.Context, policies []policy, w dns.ResponseWriter, r *dns.Msg) (action, string) {
 	state := request.Request{W: w, Req: r}
 
 	ip := net.ParseIP(state.IP())
 	qtype := state.QType()
+	qname := strings.ToLower(state.Name())
 	for _, policy := range policies {
-		// dns.TypeNone matches all query types.
-		_, matchAll := policy.qtypes[dns.TypeNone]
-		_, match := policy.qtypes[qtype]
-		if !matchAll && !match {
+		if policy.file != nil {
+			if action, name := policy.file.match(ctx, ip, qtype, qname); action != actionNone {
+				return action, name
+			}
 			continue
 		}
+		if policy.matches(ctx, ip, qtype, qname) {
+			return policy.action, policy.name
+		}
+	}
+	return actionNone, ""
+}
 
-		_, contained := policy.filter.GetByIP(ip)
-		if !contained {
-			continue
+// matches returns true if the query matches all sections of the policy.
+func (p policy) matches(ctx context.Context, ip net.IP, qtype uint16, qname string) bool {
+	// dns.TypeNone matches all query types.
+	_, matchAll := p.qtypes[dns.TypeNone]
+	_, match := p.qtypes[qtype]
+	if !matchAll && !match {
+		return false
+	}
+
+	if _, contained := p.filter.GetByIP(ip); !contained {
+		return false
+	}
+
+	if p.qnames != nil {
+		if _, ok := p.qnames[qname]; !ok {
+			return false
 		}
+	}
+
+	if p.suffixes != nil && !matchSuffix(p.suffixes, qname) {
+		return false
+	}
+
+	if p.regexps != nil && !matchRegexp(p.regexps, qname) {
+		return false
+	}
 
-		// matched.
-		return policy.action
+	for _, m := range p.metadata {
+		f := metadata.ValueFunc(ctx, m.label)
+		if f == nil {
+			return false
+		}
+		if _, ok := m.values[f()]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchSuffix(suffixes []string, qname string) bool {
+	for _, s := range suffixes {
+		if dns.IsSubDomain(s, qname) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegexp(regexps []*regexp.Regexp, qname string) bool {
+	for _, re := range regexps {
+		if re.MatchString(qname) {
+			return true
+		}
+	}
+	return false
+}
+
+// files returns the policy files of all rules.
+func (a ACL) files() []*policyFile {
+	var files []*policyFile
+	for _, r := range a.Rules {
+		for _, p := range r.policies {
+			if p.file != nil {
+				files = append(files, p.file)
+			}
+		}
 	}
-	return actionNone
+	return files
 }
 
 // Name implements the plugin.Handler interface.
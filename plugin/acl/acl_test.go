@@ -2,9 +2,13 @@ package acl
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/test"
 
 	"github.com/miekg/dns"
@@ -392,6 +396,120 @@ func TestACLServeDNS(t *testing.T) {
 			dns.RcodeSuccess,
 			false,
 		},
+		// QNAME tests.
+		{
+			"QNAME 1 BLOCKED",
+			`acl example.org {
+				block qname WWW.example.org
+			}`,
+			[]string{},
+			args{
+				"www.example.org.",
+				"192.168.0.2",
+				dns.TypeA,
+			},
+			dns.RcodeRefused,
+			false,
+		},
+		{
+			"QNAME 1 ALLOWED",
+			`acl example.org {
+				block qname www.example.org
+			}`,
+			[]string{},
+			args{
+				"a.www.example.org.",
+				"192.168.0.2",
+				dns.TypeA,
+			},
+			dns.RcodeSuccess,
+			false,
+		},
+		{
+			"Suffix 1 FILTERED",
+			`acl example.org {
+				filter suffix ads.example.org tracker.example.org
+			}`,
+			[]string{},
+			args{
+				"a.tracker.example.org.",
+				"192.168.0.2",
+				dns.TypeA,
+			},
+			dns.RcodeSuccess,
+			false,
+		},
+		{
+			"Suffix 2 BLOCKED",
+			`acl example.org {
+				block suffix ads.example.org type AAAA net 192.168.0.0/16
+			}`,
+			[]string{},
+			args{
+				"ads.example.org.",
+				"192.168.0.2",
+				dns.TypeAAAA,
+			},
+			dns.RcodeRefused,
+			false,
+		},
+		{
+			"Suffix 2 ALLOWED",
+			`acl example.org {
+				block suffix ads.example.org type AAAA net 192.168.0.0/16
+			}`,
+			[]string{},
+			args{
+				"ads.example.org.",
+				"10.0.0.2",
+				dns.TypeAAAA,
+			},
+			dns.RcodeSuccess,
+			false,
+		},
+		{
+			"Regex 1 BLOCKED",
+			`acl {
+				block regex ^[0-9a-f]{16}\.
+			}`,
+			[]string{"."},
+			args{
+				"0123456789abcdef.example.org.",
+				"192.168.0.2",
+				dns.TypeTXT,
+			},
+			dns.RcodeRefused,
+			false,
+		},
+		{
+			"Regex 1 ALLOWED",
+			`acl {
+				block regex ^[0-9a-f]{16}\.
+			}`,
+			[]string{"."},
+			args{
+				"www.example.org.",
+				"192.168.0.2",
+				dns.TypeTXT,
+			},
+			dns.RcodeSuccess,
+			false,
+		},
+		{
+			"Allow before block QNAME",
+			`acl example.org {
+				allow qname www.example.org
+				block suffix example.org
+			}`,
+			[]string{},
+			args{
+				"www.example.org.",
+				"192.168.0.2",
+				dns.TypeA,
+			},
+			dns.RcodeSuccess,
+			false,
+		},
 	}
 
 	ctx := context.Background()
@@ -420,3 +538,157 @@ func TestACLServeDNS(t *testing.T) {
 		})
 	}
 }
+
+func TestACLExtendedError(t *testing.T) {
+	tests := []struct {
+		config  string
+		edns    bool
+		wantEDE int // -1 means no extended error
+	}{
+		{"acl example.org {\nblock net 192.168.0.0/16\n}", true, int(dns.ExtendedErrorCodeProhibited)},
+		{"acl example.org {\nfilter net 192.168.0.0/16\n}", true, int(dns.ExtendedErrorCodeFiltered)},
+		{"acl example.org {\nblock net 192.168.0.0/16\n}", false, -1},
+	}
+
+	for i, tt := range tests {
+		a, err := parse(NewTestControllerWithZones(tt.config, nil))
+		if err != nil {
+			t.Fatalf("Test %d: cannot parse acl from config: %v", i, err)
+		}
+		a.Next = test.NextHandler(dns.RcodeSuccess, nil)
+
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.org.", dns.TypeA)
+		if tt.edns {
+			m.SetEdns0(4096, false)
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: "192.168.0.2"})
+		if _, err := a.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+
+		got := -1
+		if o := rec.Msg.IsEdns0(); o != nil {
+			for _, opt := range o.Option {
+				if ede, ok := opt.(*dns.EDNS0_EDE); ok {
+					got = int(ede.InfoCode)
+				}
+			}
+		}
+		if got != tt.wantEDE {
+			t.Errorf("Test %d: expected extended error %d, got %d", i, tt.wantEDE, got)
+		}
+	}
+}
+
+func TestACLMetadata(t *testing.T) {
+	tests := []struct {
+		config    string
+		country   string
+		wantRcode int
+	}{
+		{"acl {\nblock metadata geoip/country/code RU KP\n}", "RU", dns.RcodeRefused},
+		{"acl {\nblock metadata geoip/country/code RU KP\n}", "NL", dns.RcodeSuccess},
+		{"acl {\nblock metadata geoip/country/code RU KP\n}", "", dns.RcodeSuccess},
+		{"acl {\nblock metadata geoip/country/code NL metadata test/other x\n}", "NL", dns.RcodeSuccess},
+	}
+
+	for i, tt := range tests {
+		a, err := parse(NewTestControllerWithZones(tt.config, []string{"."}))
+		if err != nil {
+			t.Fatalf("Test %d: cannot parse acl from config: %v", i, err)
+		}
+		a.Next = test.NextHandler(dns.RcodeSuccess, nil)
+
+		ctx := context.Background()
+		if tt.country != "" {
+			ctx = metadata.ContextWithMetadata(ctx)
+			country := tt.country
+			metadata.SetValueFunc(ctx, "geoip/country/code", func() string { return country })
+		}
+
+		w := &testResponseWriter{}
+		w.setRemoteIP("192.168.0.2")
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.org.", dns.TypeA)
+		if _, err := a.ServeDNS(ctx, w, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+		if w.Rcode != tt.wantRcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tt.wantRcode, w.Rcode)
+		}
+	}
+}
+
+func TestACLPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies")
+	if err := os.WriteFile(path, []byte(policies), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := parse(NewTestControllerWithZones("acl {\nallow net 10.0.0.0/8\nfile "+path+"\nreload 0\n}", []string{"."}))
+	if err != nil {
+		t.Fatalf("Cannot parse acl from config: %v", err)
+	}
+	a.Next = test.NextHandler(dns.RcodeSuccess, nil)
+
+	tests := []struct {
+		qname     string
+		sourceIP  string
+		wantRcode int
+	}{
+		{"a.ads.example.org.", "192.168.0.2", dns.RcodeRefused},
+		{"a.ads.example.org.", "10.0.0.2", dns.RcodeSuccess}, // allowed before the file
+		{"www.example.net.", "192.168.0.2", dns.RcodeRefused},
+		{"www.example.com.", "192.168.0.2", dns.RcodeSuccess},
+	}
+	check := func() {
+		t.Helper()
+		for _, tt := range tests {
+			w := &testResponseWriter{}
+			w.setRemoteIP(tt.sourceIP)
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, dns.TypeA)
+			if _, err := a.ServeDNS(context.Background(), w, m); err != nil {
+				t.Fatalf("Expected no error for %s, got %v", tt.qname, err)
+			}
+			if w.Rcode != tt.wantRcode {
+				t.Errorf("Expected rcode %d for %s from %s, got %d", tt.wantRcode, tt.qname, tt.sourceIP, w.Rcode)
+			}
+		}
+	}
+	check()
+
+	f := a.files()[0]
+
+	// A file that doesn't parse keeps the current policies.
+	if err := os.WriteFile(path, []byte("block qname\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.read(); err == nil {
+		t.Errorf("Expected error reading invalid policy file")
+	}
+	check()
+
+	if err := os.WriteFile(path, []byte("block suffix example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.read(); err != nil {
+		t.Fatalf("Expected no error reading policy file, got %v", err)
+	}
+	tests = []struct {
+		qname     string
+		sourceIP  string
+		wantRcode int
+	}{
+		{"a.ads.example.org.", "192.168.0.2", dns.RcodeSuccess},
+		{"www.example.com.", "192.168.0.2", dns.RcodeRefused},
+	}
+	check()
+}
+
+const policies = `# block ads and example.net
+block suffix ads.example.org rule ads
+
+block qname www.example.net rule example-net # trailing comment
+`
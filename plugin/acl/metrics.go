@@ -29,4 +29,11 @@ var (
 		Name:      "allowed_requests_total",
 		Help:      "Counter of DNS requests being allowed.",
 	}, []string{"server"})
+	// RuleHitCount is the number of DNS requests matching a named rule.
+	RuleHitCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "rule_hits_total",
+		Help:      "Counter of DNS requests matching a named rule.",
+	}, []string{"server", "rule"})
 )
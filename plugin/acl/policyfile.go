@@ -0,0 +1,221 @@
+package acl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin(pluginName)
+
+// policyFile holds the policies read from a file, which is reloaded when it changes.
+type policyFile struct {
+	path   string
+	reload time.Duration
+
+	sync.RWMutex
+	index *policyIndex
+	mtime time.Time
+	size  int64
+}
+
+// match matches the query with the policies of the file and returns the action and rule
+// name of the first matching policy.
+func (f *policyFile) match(ctx context.Context, ip net.IP, qtype uint16, qname string) (action, string) {
+	f.RLock()
+	index := f.index
+	f.RUnlock()
+	if index == nil {
+		return actionNone, ""
+	}
+	return index.match(ctx, ip, qtype, qname)
+}
+
+// read reads the policies from the file when it has changed since it was last read. When the file
+// doesn't parse, the current policies are kept.
+func (f *policyFile) read() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	f.RLock()
+	unchanged := f.mtime.Equal(stat.ModTime()) && f.size == stat.Size()
+	f.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	policies, err := parsePolicies(file)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Parsed policy file %q into %d policies", f.path, len(policies))
+
+	index := newPolicyIndex(policies)
+
+	f.Lock()
+	f.index = index
+	f.mtime = stat.ModTime()
+	f.size = stat.Size()
+	f.Unlock()
+	return nil
+}
+
+// periodicUpdate rereads the file every reload interval until stop is closed.
+func (f *policyFile) periodicUpdate(stop chan struct{}) {
+	if f.reload == 0 {
+		return
+	}
+	ticker := time.NewTicker(f.reload)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := f.read(); err != nil {
+				log.Errorf("Failed to reload policy file %q: %s", f.path, err)
+			}
+		}
+	}
+}
+
+// parsePolicies parses a policy file, which has a policy per line in the same syntax as
+// in the Corefile. Empty lines and comments are skipped. As in the Corefile, a comment starts
+// with a token that starts with '#', so a '#' inside a regex is kept.
+func parsePolicies(r io.Reader) ([]policy, error) {
+	var policies []policy
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		tokens := strings.Fields(scanner.Text())
+		for i, t := range tokens {
+			if strings.HasPrefix(t, "#") {
+				tokens = tokens[:i]
+				break
+			}
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		p, err := parsePolicy(tokens[0], tokens[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, scanner.Err()
+}
+
+// policyIndex finds the first policy of a file that matches a query, without trying every policy
+// of a large file. Policies with a qname section are found by the qname of the query, and those
+// with a suffix section by the qname and its parents. Policies that only match on the source
+// address are merged into one tree, which holds the first of them for each network. The other
+// policies are tried in order.
+type policyIndex struct {
+	policies []policy
+	qnames   map[string][]int // positions of the policies, ascending
+	suffixes map[string][]int
+	nets     *iptree.Tree // position of the first policy that matches a network
+	other    []int
+}
+
+func newPolicyIndex(policies []policy) *policyIndex {
+	x := &policyIndex{
+		policies: policies,
+		qnames:   make(map[string][]int),
+		suffixes: make(map[string][]int),
+		nets:     iptree.NewTree(),
+	}
+
+	type netPolicy struct {
+		n *net.IPNet
+		i int
+	}
+	var nets []netPolicy
+	for i, p := range policies {
+		_, allTypes := p.qtypes[dns.TypeNone]
+		switch {
+		case p.qnames != nil:
+			for q := range p.qnames {
+				x.qnames[q] = append(x.qnames[q], i)
+			}
+		case p.suffixes != nil:
+			for _, s := range p.suffixes {
+				x.suffixes[s] = append(x.suffixes[s], i)
+			}
+		case allTypes && p.regexps == nil && p.metadata == nil:
+			for pair := range p.filter.Enumerate() {
+				nets = append(nets, netPolicy{pair.Key, i})
+			}
+		default:
+			x.other = append(x.other, i)
+		}
+	}
+
+	// Networks are inserted from short to long prefixes, so that a network holds the first policy
+	// of all the networks that contain it.
+	sort.SliceStable(nets, func(i, j int) bool {
+		a, _ := nets[i].n.Mask.Size()
+		b, _ := nets[j].n.Mask.Size()
+		return a < b
+	})
+	for _, np := range nets {
+		i := np.i
+		if v, ok := x.nets.GetByNet(np.n); ok && v.(int) < i {
+			i = v.(int)
+		}
+		x.nets.InplaceInsertNet(np.n, i)
+	}
+	return x
+}
+
+// match returns the action and rule name of the first policy that matches the query.
+func (x *policyIndex) match(ctx context.Context, ip net.IP, qtype uint16, qname string) (action, string) {
+	first := len(x.policies)
+	try := func(positions []int) {
+		for _, i := range positions {
+			if i >= first {
+				return
+			}
+			if x.policies[i].matches(ctx, ip, qtype, qname) {
+				first = i
+				return
+			}
+		}
+	}
+
+	try(x.qnames[qname])
+	for off, end := 0, false; !end; off, end = dns.NextLabel(qname, off) {
+		try(x.suffixes[qname[off:]])
+	}
+	try(x.suffixes["."])
+	if v, ok := x.nets.GetByIP(ip); ok {
+		try([]int{v.(int)})
+	}
+	try(x.other)
+
+	if first == len(x.policies) {
+		return actionNone, ""
+	}
+	return x.policies[first].action, x.policies[first].name
+}
@@ -0,0 +1,64 @@
+package acl
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestPolicyIndex(t *testing.T) {
+	policies, err := parsePolicies(strings.NewReader(`
+allow net 10.1.0.0/16 rule local
+block net 10.0.0.0/8 rule ten
+block qname www.example.org rule www
+allow suffix example.org net 192.168.0.0/16 rule example-local
+filter suffix example.org rule example
+block type AAAA net 192.168.1.0/24 rule aaaa
+block net 192.168.1.0/24 rule late
+allow net 192.168.1.7/32 rule host
+block regex ^x#[0-9]+\. rule hash # the regex contains a '#'
+block suffix . rule all
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := newPolicyIndex(policies)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		ip    string
+		rule  string
+	}{
+		{"a.example.net.", dns.TypeA, "10.1.2.3", "local"},
+		{"a.example.net.", dns.TypeA, "10.2.3.4", "ten"},
+		{"www.example.org.", dns.TypeA, "10.1.2.3", "local"},
+		{"www.example.org.", dns.TypeA, "172.16.0.1", "www"},
+		{"a.example.org.", dns.TypeA, "192.168.1.7", "example-local"},
+		{"a.example.org.", dns.TypeA, "172.16.0.1", "example"},
+		{"example.org.", dns.TypeA, "172.16.0.1", "example"},
+		{"a.example.net.", dns.TypeAAAA, "192.168.1.7", "aaaa"},
+		{"a.example.net.", dns.TypeA, "192.168.1.7", "late"}, // the network of host is contained in that of late
+		{"x#1.example.net.", dns.TypeA, "172.16.0.1", "hash"},
+		{"a.example.net.", dns.TypeA, "172.16.0.1", "all"},
+	}
+	for i, tc := range tests {
+		ip := net.ParseIP(tc.ip)
+		_, rule := x.match(context.TODO(), ip, tc.qtype, tc.qname)
+		if rule != tc.rule {
+			t.Errorf("Test %d: expected rule %q, got %q", i, tc.rule, rule)
+		}
+		// The index finds the same policy as trying them in order.
+		for _, p := range policies {
+			if p.matches(context.TODO(), ip, tc.qtype, tc.qname) {
+				if p.name != rule {
+					t.Errorf("Test %d: expected the first matching rule %q, got %q", i, p.name, rule)
+				}
+				break
+			}
+		}
+	}
+}
@@ -1,18 +1,28 @@
 package acl
 
 import (
+	"fmt"
 	"net"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
 
 	"github.com/infobloxopen/go-trees/iptree"
 	"github.com/miekg/dns"
 )
 
-const pluginName = "acl"
+const (
+	pluginName = "acl"
+
+	// defaultReload is the default interval at which policy files are checked for changes.
+	defaultReload = 5 * time.Second
+)
 
 func init() { plugin.Register(pluginName, setup) }
 
@@ -31,6 +41,19 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error(pluginName, err)
 	}
 
+	for _, f := range a.files() {
+		f := f
+		stop := make(chan struct{})
+		c.OnStartup(func() error {
+			go f.periodicUpdate(stop)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			close(stop)
+			return nil
+		})
+	}
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		a.Next = next
 		return a
@@ -41,102 +64,185 @@ func setup(c *caddy.Controller) error {
 
 func parse(c *caddy.Controller) (ACL, error) {
 	a := ACL{}
+	config := dnsserver.GetConfig(c)
 	for c.Next() {
 		r := rule{}
 		args := c.RemainingArgs()
 		r.zones = plugin.OriginsFromArgsOrServerBlock(args, c.ServerBlockKeys)
 
+		reload := defaultReload
+		var files []*policyFile
 		for c.NextBlock() {
-			p := policy{}
-
-			action := strings.ToLower(c.Val())
-			if action == "allow" {
-				p.action = actionAllow
-			} else if action == "block" {
-				p.action = actionBlock
-			} else if action == "filter" {
-				p.action = actionFilter
-			} else {
-				return a, c.Errf("unexpected token %q; expect 'allow', 'block', or 'filter'", c.Val())
+			switch strings.ToLower(c.Val()) {
+			case "file":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return a, c.ArgErr()
+				}
+				path := args[0]
+				if !filepath.IsAbs(path) && config.Root != "" {
+					path = filepath.Join(config.Root, path)
+				}
+				f := &policyFile{path: path}
+				if err := f.read(); err != nil {
+					return a, c.Errf("failed to read policy file %q: %s", path, err)
+				}
+				files = append(files, f)
+				r.policies = append(r.policies, policy{file: f})
+				continue
+			case "reload":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return a, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < 0 {
+					return a, c.Errf("invalid reload duration: %s", args[0])
+				}
+				reload = d
+				continue
 			}
 
-			p.qtypes = make(map[uint16]struct{})
-			p.filter = iptree.NewTree()
+			p, err := parsePolicy(c.Val(), c.RemainingArgs())
+			if err != nil {
+				return a, c.Err(err.Error())
+			}
+			r.policies = append(r.policies, p)
+		}
+		for _, f := range files {
+			f.reload = reload
+		}
+		a.Rules = append(a.Rules, r)
+	}
+	return a, nil
+}
 
-			hasTypeSection := false
-			hasNetSection := false
+// parsePolicy parses a policy, the action and the sections that select the queries it applies to.
+func parsePolicy(act string, remainingTokens []string) (policy, error) {
+	p := policy{}
 
-			remainingTokens := c.RemainingArgs()
-			for len(remainingTokens) > 0 {
-				if !isPreservedIdentifier(remainingTokens[0]) {
-					return a, c.Errf("unexpected token %q; expect 'type | net'", remainingTokens[0])
-				}
-				section := strings.ToLower(remainingTokens[0])
+	action := strings.ToLower(act)
+	if action == "allow" {
+		p.action = actionAllow
+	} else if action == "block" {
+		p.action = actionBlock
+	} else if action == "filter" {
+		p.action = actionFilter
+	} else {
+		return p, fmt.Errorf("unexpected token %q; expect 'allow', 'block', 'filter', 'file' or 'reload'", act)
+	}
 
-				i := 1
-				var tokens []string
-				for ; i < len(remainingTokens) && !isPreservedIdentifier(remainingTokens[i]); i++ {
-					tokens = append(tokens, remainingTokens[i])
-				}
-				remainingTokens = remainingTokens[i:]
+	p.qtypes = make(map[uint16]struct{})
+	p.filter = iptree.NewTree()
 
-				if len(tokens) == 0 {
-					return a, c.Errf("no token specified in %q section", section)
-				}
+	hasTypeSection := false
+	hasNetSection := false
+
+	for len(remainingTokens) > 0 {
+		if !isPreservedIdentifier(remainingTokens[0]) {
+			return p, fmt.Errorf("unexpected token %q; expect 'type | net | qname | suffix | regex | metadata | rule'", remainingTokens[0])
+		}
+		section := strings.ToLower(remainingTokens[0])
+
+		i := 1
+		var tokens []string
+		for ; i < len(remainingTokens) && !isPreservedIdentifier(remainingTokens[i]); i++ {
+			tokens = append(tokens, remainingTokens[i])
+		}
+		remainingTokens = remainingTokens[i:]
 
-				switch section {
-				case "type":
-					hasTypeSection = true
-					for _, token := range tokens {
-						if token == "*" {
-							p.qtypes[dns.TypeNone] = struct{}{}
-							break
-						}
-						qtype, ok := dns.StringToType[token]
-						if !ok {
-							return a, c.Errf("unexpected token %q; expect legal QTYPE", token)
-						}
-						p.qtypes[qtype] = struct{}{}
-					}
-				case "net":
-					hasNetSection = true
-					for _, token := range tokens {
-						if token == "*" {
-							p.filter = newDefaultFilter()
-							break
-						}
-						token = normalize(token)
-						_, source, err := net.ParseCIDR(token)
-						if err != nil {
-							return a, c.Errf("illegal CIDR notation %q", token)
-						}
-						p.filter.InplaceInsertNet(source, struct{}{})
-					}
-				default:
-					return a, c.Errf("unexpected token %q; expect 'type | net'", section)
+		if len(tokens) == 0 {
+			return p, fmt.Errorf("no token specified in %q section", section)
+		}
+
+		switch section {
+		case "type":
+			hasTypeSection = true
+			for _, token := range tokens {
+				if token == "*" {
+					p.qtypes[dns.TypeNone] = struct{}{}
+					break
 				}
+				qtype, ok := dns.StringToType[token]
+				if !ok {
+					return p, fmt.Errorf("unexpected token %q; expect legal QTYPE", token)
+				}
+				p.qtypes[qtype] = struct{}{}
 			}
-
-			// optional `type` section means all record types.
-			if !hasTypeSection {
-				p.qtypes[dns.TypeNone] = struct{}{}
+		case "net":
+			hasNetSection = true
+			for _, token := range tokens {
+				if token == "*" {
+					p.filter = newDefaultFilter()
+					break
+				}
+				token = normalize(token)
+				_, source, err := net.ParseCIDR(token)
+				if err != nil {
+					return p, fmt.Errorf("illegal CIDR notation %q", token)
+				}
+				p.filter.InplaceInsertNet(source, struct{}{})
 			}
-
-			// optional `net` means all ip addresses.
-			if !hasNetSection {
-				p.filter = newDefaultFilter()
+		case "qname":
+			if p.qnames == nil {
+				p.qnames = make(map[string]struct{})
 			}
-
-			r.policies = append(r.policies, p)
+			for _, token := range tokens {
+				p.qnames[strings.ToLower(dns.Fqdn(token))] = struct{}{}
+			}
+		case "suffix":
+			for _, token := range tokens {
+				p.suffixes = append(p.suffixes, strings.ToLower(dns.Fqdn(token)))
+			}
+		case "regex":
+			for _, token := range tokens {
+				re, err := regexp.Compile(token)
+				if err != nil {
+					return p, fmt.Errorf("invalid regex %q: %s", token, err)
+				}
+				p.regexps = append(p.regexps, re)
+			}
+		case "metadata":
+			if !metadata.IsLabel(tokens[0]) {
+				return p, fmt.Errorf("invalid metadata label %q", tokens[0])
+			}
+			if len(tokens) < 2 {
+				return p, fmt.Errorf("no value specified for metadata label %q", tokens[0])
+			}
+			m := metadataMatch{label: tokens[0], values: make(map[string]struct{})}
+			for _, token := range tokens[1:] {
+				m.values[token] = struct{}{}
+			}
+			p.metadata = append(p.metadata, m)
+		case "rule":
+			if len(tokens) != 1 {
+				return p, fmt.Errorf("expected a single rule name, got %q", tokens)
+			}
+			p.name = tokens[0]
+		default:
+			return p, fmt.Errorf("unexpected token %q; expect 'type | net | qname | suffix | regex | metadata | rule'", section)
 		}
-		a.Rules = append(a.Rules, r)
 	}
-	return a, nil
+
+	// optional `type` section means all record types.
+	if !hasTypeSection {
+		p.qtypes[dns.TypeNone] = struct{}{}
+	}
+
+	// optional `net` means all ip addresses.
+	if !hasNetSection {
+		p.filter = newDefaultFilter()
+	}
+
+	return p, nil
 }
 
 func isPreservedIdentifier(token string) bool {
-	identifier := strings.ToLower(token)
-	return identifier == "type" || identifier == "net"
+	switch strings.ToLower(token) {
+	case "type", "net", "qname", "suffix", "regex", "metadata", "rule":
+		return true
+	}
+	return false
 }
 
 // normalize appends '/32' for any single IPv4 address and '/128' for IPv6.
@@ -213,6 +213,84 @@ func TestSetup(t *testing.T) {
 			}`,
 			true,
 		},
+		{
+			"QNAME and suffix",
+			`acl {
+				block qname www.example.org suffix example.net type A
+				allow suffix example.org rule example
+			}`,
+			false,
+		},
+		{
+			"Regex",
+			`acl {
+				filter regex ^ads[0-9]*\. net 192.168.0.0/16
+			}`,
+			false,
+		},
+		{
+			"Metadata",
+			`acl {
+				block metadata geoip/country/code RU KP metadata geoip/city/name Moscow
+			}`,
+			false,
+		},
+		{
+			"Illegal regex",
+			`acl {
+				block regex ^ads[
+			}`,
+			true,
+		},
+		{
+			"Illegal metadata label",
+			`acl {
+				block metadata country RU
+			}`,
+			true,
+		},
+		{
+			"Missing metadata value",
+			`acl {
+				block metadata geoip/country/code
+			}`,
+			true,
+		},
+		{
+			"Missing qname",
+			`acl {
+				block qname
+			}`,
+			true,
+		},
+		{
+			"Multiple rule names",
+			`acl {
+				block qname www.example.org rule a b
+			}`,
+			true,
+		},
+		{
+			"Missing policy file",
+			`acl {
+				file /does/not/exist
+			}`,
+			true,
+		},
+		{
+			"Illegal reload",
+			`acl {
+				reload -1s
+			}`,
+			true,
+		},
+		{
+			"Illegal action",
+			`acl {
+				deny qname www.example.org
+			}`,
+			true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
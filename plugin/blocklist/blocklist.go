@@ -0,0 +1,103 @@
+// Package blocklist implements a plugin that blocks queries for names on large block lists.
+package blocklist
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("blocklist")
+
+// Blocklist blocks queries for names on its lists, unless they are allowed.
+type Blocklist struct {
+	Next  plugin.Handler
+	Zones []string
+
+	lists    *lists
+	response response
+	ipv4     []net.IP // for responseAddress
+	ipv6     []net.IP
+	ttl      uint32
+}
+
+// response is the reply to a blocked query.
+type response int
+
+const (
+	responseNXDomain response = iota // NXDOMAIN
+	responseNoData                   // NOERROR without answer
+	responseRefused                  // REFUSED
+	responseNull                     // 0.0.0.0 and :: for A and AAAA queries, NODATA for others
+	responseAddress                  // the configured addresses for A and AAAA queries, NODATA for others
+)
+
+// ServeDNS implements the plugin.Handler interface.
+func (b Blocklist) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	qname := state.Name()
+	zone := plugin.Zones(b.Zones).Matches(qname)
+	if zone == "" || !b.lists.blocked(strings.ToLower(qname)) {
+		return plugin.NextOrFailure(b.Name(), b.Next, ctx, w, r)
+	}
+
+	blockedCount.WithLabelValues(metrics.WithServer(ctx)).Inc()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	switch b.response {
+	case responseNXDomain:
+		m.Rcode = dns.RcodeNameError
+	case responseRefused:
+		m.Rcode = dns.RcodeRefused
+	case responseNull:
+		m.Answer = b.answer(qname, state.QType(), []net.IP{net.IPv4zero}, []net.IP{net.IPv6zero})
+	case responseAddress:
+		m.Answer = b.answer(qname, state.QType(), b.ipv4, b.ipv6)
+	}
+	if len(m.Answer) == 0 && m.Rcode != dns.RcodeRefused {
+		// Negative answers are cached for the TTL (RFC 2308).
+		m.Ns = []dns.RR{b.soa(zone)}
+	}
+	edns.SetExtendedError(r, m, dns.ExtendedErrorCodeBlocked, "")
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the plugin.Handler interface.
+func (b Blocklist) Name() string { return "blocklist" }
+
+// soa returns the SOA record of zone for negative answers, with the TTL of b.
+func (b Blocklist) soa(zone string) dns.RR {
+	hdr := dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: b.ttl}
+	return &dns.SOA{Hdr: hdr, Ns: dnsutil.Join("ns.dns", zone), Mbox: dnsutil.Join("hostmaster", zone), Serial: 1,
+		Refresh: 7200, Retry: 1800, Expire: 86400, Minttl: b.ttl}
+}
+
+// answer returns the A or AAAA records for qname with the addresses ipv4 or ipv6.
+func (b Blocklist) answer(qname string, qtype uint16, ipv4, ipv6 []net.IP) []dns.RR {
+	var answer []dns.RR
+	switch qtype {
+	case dns.TypeA:
+		for _, ip := range ipv4 {
+			hdr := dns.RR_Header{Name: qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: b.ttl}
+			answer = append(answer, &dns.A{Hdr: hdr, A: ip})
+		}
+	case dns.TypeAAAA:
+		for _, ip := range ipv6 {
+			hdr := dns.RR_Header{Name: qname, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: b.ttl}
+			answer = append(answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+	return answer
+}
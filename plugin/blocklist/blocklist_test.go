@@ -0,0 +1,164 @@
+package blocklist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const testList = `0.0.0.0 ads.example.org
+||tracker.example.org^
+*.wild.example.org
+@@||ok.tracker.example.org^
+`
+
+func newTestBlocklist(t *testing.T, input string) (Blocklist, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "list")
+	if err := os.WriteFile(path, []byte(testList), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := caddy.NewTestController("dns", fmt.Sprintf("blocklist example.org {\nfile %s\n%s\n}", path, input))
+	b, err := parse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	b.Next = test.NextHandler(dns.RcodeSuccess, nil)
+	return b, path
+}
+
+func TestBlocklist(t *testing.T) {
+	tests := []struct {
+		input   string
+		qname   string
+		qtype   uint16
+		blocked bool
+		rcode   int
+		answer  []dns.RR
+	}{
+		{"", "ads.example.org.", dns.TypeA, true, dns.RcodeNameError, nil},
+		{"", "www.ads.example.org.", dns.TypeA, false, 0, nil},
+		{"", "Tracker.Example.Org.", dns.TypeA, true, dns.RcodeNameError, nil},
+		{"", "a.tracker.example.org.", dns.TypeA, true, dns.RcodeNameError, nil},
+		{"", "ok.tracker.example.org.", dns.TypeA, false, 0, nil},
+		{"", "a.ok.tracker.example.org.", dns.TypeA, false, 0, nil},
+		{"", "wild.example.org.", dns.TypeA, false, 0, nil},
+		{"", "a.wild.example.org.", dns.TypeA, true, dns.RcodeNameError, nil},
+		{"allow ads.example.org", "ads.example.org.", dns.TypeA, false, 0, nil},
+		{"allow *.wild.example.org", "a.wild.example.org.", dns.TypeA, false, 0, nil},
+		{"block www.example.org", "www.example.org.", dns.TypeA, true, dns.RcodeNameError, nil},
+		{"ttl 60", "ads.example.org.", dns.TypeA, true, dns.RcodeNameError, nil},
+		{"response nodata", "ads.example.org.", dns.TypeA, true, dns.RcodeSuccess, nil},
+		{"response refused", "ads.example.org.", dns.TypeA, true, dns.RcodeRefused, nil},
+		{"response null", "ads.example.org.", dns.TypeA, true, dns.RcodeSuccess,
+			[]dns.RR{test.A("ads.example.org. 3600 IN A 0.0.0.0")}},
+		{"response null", "ads.example.org.", dns.TypeAAAA, true, dns.RcodeSuccess,
+			[]dns.RR{test.AAAA("ads.example.org. 3600 IN AAAA ::")}},
+		{"response null", "ads.example.org.", dns.TypeMX, true, dns.RcodeSuccess, nil},
+		{"response address 192.0.2.1 2001:db8::1\nttl 60", "ads.example.org.", dns.TypeA, true, dns.RcodeSuccess,
+			[]dns.RR{test.A("ads.example.org. 60 IN A 192.0.2.1")}},
+		{"response address 192.0.2.1 2001:db8::1\nttl 60", "ads.example.org.", dns.TypeAAAA, true, dns.RcodeSuccess,
+			[]dns.RR{test.AAAA("ads.example.org. 60 IN AAAA 2001:db8::1")}},
+	}
+
+	for i, tc := range tests {
+		b, _ := newTestBlocklist(t, tc.input)
+
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, false)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := b.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+
+		ede := extendedError(rec.Msg)
+		if blocked := ede == dns.ExtendedErrorCodeBlocked; blocked != tc.blocked {
+			t.Errorf("Test %d: expected blocked %t for %s, got %t", i, tc.blocked, tc.qname, blocked)
+			continue
+		}
+		if !tc.blocked {
+			continue
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, rec.Msg.Rcode)
+		}
+		if err := test.Section(test.Case{Answer: tc.answer}, test.Answer, rec.Msg.Answer); err != nil {
+			t.Errorf("Test %d: %s", i, err)
+		}
+
+		// Negative answers carry the SOA of the zone, with the TTL as its minimum.
+		if len(tc.answer) > 0 || tc.rcode == dns.RcodeRefused {
+			if len(rec.Msg.Ns) != 0 {
+				t.Errorf("Test %d: expected no authority section, got %v", i, rec.Msg.Ns)
+			}
+			continue
+		}
+		if len(rec.Msg.Ns) != 1 {
+			t.Errorf("Test %d: expected SOA in the authority section, got %v", i, rec.Msg.Ns)
+			continue
+		}
+		soa, ok := rec.Msg.Ns[0].(*dns.SOA)
+		if !ok || soa.Hdr.Name != "example.org." || soa.Hdr.Ttl != b.ttl || soa.Minttl != b.ttl {
+			t.Errorf("Test %d: expected SOA of example.org. with TTL %d, got %v", i, b.ttl, rec.Msg.Ns[0])
+		}
+	}
+}
+
+func TestBlocklistReload(t *testing.T) {
+	b, path := newTestBlocklist(t, "")
+
+	if !b.lists.blocked("ads.example.org.") {
+		t.Fatalf("Expected ads.example.org. to be blocked")
+	}
+
+	if err := os.WriteFile(path, []byte("www.example.org\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the modification time differs, in case the file system has a coarse resolution.
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.lists.read(); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if b.lists.blocked("ads.example.org.") {
+		t.Errorf("Expected ads.example.org. not to be blocked after reload")
+	}
+	if !b.lists.blocked("www.example.org.") {
+		t.Errorf("Expected www.example.org. to be blocked after reload")
+	}
+
+	// A list that can't be read keeps the current names.
+	os.Remove(path)
+	if err := b.lists.read(); err == nil {
+		t.Errorf("Expected error reading removed list")
+	}
+	if !b.lists.blocked("www.example.org.") {
+		t.Errorf("Expected www.example.org. to stay blocked")
+	}
+}
+
+func extendedError(m *dns.Msg) uint16 {
+	if m == nil {
+		return 0
+	}
+	if o := m.IsEdns0(); o != nil {
+		for _, opt := range o.Option {
+			if ede, ok := opt.(*dns.EDNS0_EDE); ok {
+				return ede.InfoCode
+			}
+		}
+	}
+	return 0
+}
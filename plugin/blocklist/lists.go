@@ -0,0 +1,133 @@
+package blocklist
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// lists holds the block and allow tries built from the list files and the inline names. The tries are
+// rebuilt when one of the files changes.
+type lists struct {
+	files       []*listFile
+	inlineBlock []string
+	inlineAllow []string
+	reload      time.Duration
+
+	sync.RWMutex
+	block *trie
+	allow *trie
+}
+
+// listFile is a list file and the modification time and size it had when it was last read.
+type listFile struct {
+	path  string
+	allow bool // all names of the file are allowed
+	mtime time.Time
+	size  int64
+}
+
+// blocked returns true when name, in lower case, is blocked and not allowed.
+func (l *lists) blocked(name string) bool {
+	l.RLock()
+	defer l.RUnlock()
+	return l.block.match(name) && !l.allow.match(name)
+}
+
+// blocks returns true when there are names to block: a list file, that is not an allow list, or inline
+// names.
+func (l *lists) blocks() bool {
+	for _, f := range l.files {
+		if !f.allow {
+			return true
+		}
+	}
+	return len(l.inlineBlock) > 0
+}
+
+// read rebuilds the tries when one of the files has changed since it was last read. When a file can't be
+// read, the current tries are kept.
+func (l *lists) read() error {
+	changed := l.block == nil
+	stats := make([]os.FileInfo, len(l.files))
+	for i, f := range l.files {
+		stat, err := os.Stat(f.path)
+		if err != nil {
+			return err
+		}
+		stats[i] = stat
+		if !f.mtime.Equal(stat.ModTime()) || f.size != stat.Size() {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	var block, allow []entry
+	add := func(e entry, a bool) {
+		if a {
+			allow = append(allow, e)
+			return
+		}
+		block = append(block, e)
+	}
+	for _, name := range l.inlineBlock {
+		parseLine(name, add)
+	}
+	for _, name := range l.inlineAllow {
+		parseLine(name, func(e entry, _ bool) { allow = append(allow, e) })
+	}
+
+	for _, f := range l.files {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		n := len(block) + len(allow)
+		fileAdd := add
+		if f.allow {
+			fileAdd = func(e entry, _ bool) { allow = append(allow, e) }
+		}
+		skipped, err := parseList(file, fileAdd)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if skipped > 0 {
+			log.Debugf("Skipped %d lines of list %q that are not understood", skipped, f.path)
+		}
+		listEntries.WithLabelValues(f.path).Set(float64(len(block) + len(allow) - n))
+	}
+
+	bt, at := newTrie(block), newTrie(allow)
+	log.Infof("Loaded %d blocked and %d allowed names", bt.len, at.len)
+
+	l.Lock()
+	l.block, l.allow = bt, at
+	l.Unlock()
+
+	for i, f := range l.files {
+		f.mtime, f.size = stats[i].ModTime(), stats[i].Size()
+	}
+	return nil
+}
+
+// periodicUpdate rereads the lists every reload interval until stop is closed.
+func (l *lists) periodicUpdate(stop chan struct{}) {
+	if l.reload == 0 {
+		return
+	}
+	ticker := time.NewTicker(l.reload)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := l.read(); err != nil {
+				log.Errorf("Failed to reload lists: %s", err)
+			}
+		}
+	}
+}
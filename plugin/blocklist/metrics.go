@@ -0,0 +1,25 @@
+package blocklist
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// blockedCount is the number of queries that were blocked.
+	blockedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "blocklist",
+		Name:      "blocked_requests_total",
+		Help:      "Counter of DNS requests being blocked.",
+	}, []string{"server"})
+	// listEntries is the number of names read from each list file.
+	listEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "blocklist",
+		Name:      "entries",
+		Help:      "The number of names read from a list file.",
+	}, []string{"file"})
+)
@@ -0,0 +1,117 @@
+package blocklist
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// parseList reads a list in hosts, domain or AdBlock format, which may be mixed, and calls add for each
+// name. Exceptions, AdBlock rules starting with "@@", are added with allow set. It returns the number of
+// lines that were skipped because they are not understood.
+func parseList(r io.Reader, add func(e entry, allow bool)) (int, error) {
+	skipped := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if !parseLine(scanner.Text(), add) {
+			skipped++
+		}
+	}
+	return skipped, scanner.Err()
+}
+
+// parseLine parses a single line of a list, see parseList. It returns false when the line isn't understood.
+func parseLine(line string, add func(e entry, allow bool)) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '!' || line[0] == '#' || line[0] == '[' {
+		return true // empty, comment or AdBlock header
+	}
+	if strings.Contains(line, "##") || strings.Contains(line, "#@#") || strings.Contains(line, "#?#") {
+		return false // AdBlock element hiding rule
+	}
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+
+	// AdBlock: ||example.org^ blocks the name and all names below it.
+	if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@||") {
+		allow := strings.HasPrefix(line, "@@")
+		name := strings.TrimPrefix(strings.TrimPrefix(line, "@@"), "||")
+		name = strings.TrimSuffix(name, "|")
+		if !strings.HasSuffix(name, "^") {
+			return false
+		}
+		name = strings.TrimSuffix(name, "^")
+		if !validName(name) {
+			return false
+		}
+		add(newEntry(name, matchName|matchSubdomains), allow)
+		return true
+	}
+
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) > 1 && net.ParseIP(fields[0]) != nil:
+		// Hosts: 0.0.0.0 example.org www.example.org
+		ok := true
+		for _, name := range fields[1:] {
+			if _, local := localNames[strings.ToLower(name)]; local {
+				continue
+			}
+			if !validName(name) {
+				ok = false
+				continue
+			}
+			add(newEntry(name, matchName), false)
+		}
+		return ok
+	case len(fields) == 1:
+		// Domain: example.org, or *.example.org for all names below it.
+		name, flags := fields[0], matchName
+		if strings.HasPrefix(name, "*.") {
+			name, flags = name[2:], matchSubdomains
+		}
+		if !validName(name) {
+			return false
+		}
+		add(newEntry(name, flags), false)
+		return true
+	}
+	return false
+}
+
+// validName returns true when name is a host name, which may have underscores, and not an address.
+func validName(name string) bool {
+	if name == "" || name == "." || net.ParseIP(name) != nil {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	_, ok := dns.IsDomainName(name)
+	return ok
+}
+
+// localNames are names found in hosts files that are not to be blocked.
+var localNames = map[string]struct{}{
+	"localhost":             {},
+	"localhost.localdomain": {},
+	"local":                 {},
+	"broadcasthost":         {},
+	"ip6-localhost":         {},
+	"ip6-loopback":          {},
+	"ip6-localnet":          {},
+	"ip6-mcastprefix":       {},
+	"ip6-allnodes":          {},
+	"ip6-allrouters":        {},
+	"ip6-allhosts":          {},
+	"0.0.0.0":               {},
+}
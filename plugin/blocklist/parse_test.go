@@ -0,0 +1,66 @@
+package blocklist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	const list = `# hosts
+127.0.0.1 localhost
+0.0.0.0 0.0.0.0
+0.0.0.0 ads.example.org www.ads.example.org # comment
+::1 ip6-localhost ip6-loopback
+0.0.0.0 bad_name!.example.org
+
+# domains
+tracker.example.org
+*.wild.example.org
+
+! AdBlock
+[Adblock Plus 2.0]
+||adblock.example.org^
+||pipe.example.org^|
+@@||ok.adblock.example.org^
+||options.example.org^$third-party
+example.org##.banner
+/banner/*/img^
+`
+	type result struct {
+		name  string
+		flags uint8
+		allow bool
+	}
+	want := []result{
+		{"ads.example.org", matchName, false},
+		{"www.ads.example.org", matchName, false},
+		{"tracker.example.org", matchName, false},
+		{"wild.example.org", matchSubdomains, false},
+		{"adblock.example.org", matchName | matchSubdomains, false},
+		{"pipe.example.org", matchName | matchSubdomains, false},
+		{"ok.adblock.example.org", matchName | matchSubdomains, true},
+	}
+
+	var got []result
+	skipped, err := parseList(strings.NewReader(list), func(e entry, allow bool) {
+		labels := make([]string, len(e.labels))
+		for i := range e.labels {
+			labels[len(labels)-1-i] = e.labels[i]
+		}
+		got = append(got, result{strings.Join(labels, "."), e.flags, allow})
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if skipped != 4 {
+		t.Errorf("Expected 4 skipped lines, got %d", skipped)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d names, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package blocklist
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("blocklist", setup) }
+
+func setup(c *caddy.Controller) error {
+	b, err := parse(c)
+	if err != nil {
+		return plugin.Error("blocklist", err)
+	}
+
+	stop := make(chan struct{})
+	c.OnStartup(func() error {
+		go b.lists.periodicUpdate(stop)
+		return nil
+	})
+	c.OnShutdown(func() error {
+		close(stop)
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		b.Next = next
+		return b
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (Blocklist, error) {
+	b := Blocklist{
+		lists: &lists{reload: defaultReload},
+		ttl:   defaultTTL,
+	}
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return b, plugin.ErrOnce
+		}
+		i++
+
+		b.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch v := c.Val(); v {
+			case "file", "allow_file":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return b, c.ArgErr()
+				}
+				for _, path := range args {
+					if !filepath.IsAbs(path) && config.Root != "" {
+						path = filepath.Join(config.Root, path)
+					}
+					b.lists.files = append(b.lists.files, &listFile{path: path, allow: v == "allow_file"})
+				}
+			case "block", "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return b, c.ArgErr()
+				}
+				for _, name := range args {
+					if !parseLine(name, func(entry, bool) {}) {
+						return b, c.Errf("invalid name: %s", name)
+					}
+				}
+				if v == "block" {
+					b.lists.inlineBlock = append(b.lists.inlineBlock, args...)
+				} else {
+					b.lists.inlineAllow = append(b.lists.inlineAllow, args...)
+				}
+			case "reload":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return b, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < 0 {
+					return b, c.Errf("invalid reload duration: %s", args[0])
+				}
+				b.lists.reload = d
+			case "response":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return b, c.ArgErr()
+				}
+				switch args[0] {
+				case "nxdomain":
+					b.response = responseNXDomain
+				case "nodata":
+					b.response = responseNoData
+				case "refused":
+					b.response = responseRefused
+				case "null":
+					b.response = responseNull
+				case "address":
+					b.response = responseAddress
+				default:
+					return b, c.Errf("unknown response: %s", args[0])
+				}
+				if b.response != responseAddress && len(args) > 1 || b.response == responseAddress && len(args) == 1 {
+					return b, c.ArgErr()
+				}
+				for _, a := range args[1:] {
+					ip := net.ParseIP(a)
+					if ip == nil {
+						return b, c.Errf("invalid address: %s", a)
+					}
+					if ip4 := ip.To4(); ip4 != nil {
+						b.ipv4 = append(b.ipv4, ip4)
+					} else {
+						b.ipv6 = append(b.ipv6, ip)
+					}
+				}
+			case "ttl":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return b, c.ArgErr()
+				}
+				ttl, err := strconv.ParseUint(args[0], 10, 32)
+				if err != nil {
+					return b, c.Errf("invalid ttl: %s", args[0])
+				}
+				b.ttl = uint32(ttl)
+			default:
+				return b, c.Errf("unknown property '%s'", v)
+			}
+		}
+	}
+
+	if !b.lists.blocks() {
+		return b, c.Err("no block lists")
+	}
+	if err := b.lists.read(); err != nil {
+		return b, c.Errf("failed to read lists: %s", err)
+	}
+	return b, nil
+}
+
+const (
+	defaultReload = time.Minute
+	defaultTTL    = 3600
+)
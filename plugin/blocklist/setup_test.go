@@ -0,0 +1,83 @@
+package blocklist
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "list")
+	if err := os.WriteFile(path, []byte(testList), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		files     int
+		reload    time.Duration
+		response  response
+		ttl       uint32
+	}{
+		{fmt.Sprintf("file %s", path), false, 1, defaultReload, responseNXDomain, defaultTTL},
+		{fmt.Sprintf("file %s %s\nallow_file %s", path, path, path), false, 3, defaultReload, responseNXDomain, defaultTTL},
+		{"block ads.example.org *.tracker.example.org\nallow ok.tracker.example.org", false, 0, defaultReload, responseNXDomain, defaultTTL},
+		{fmt.Sprintf("file %s\nreload 0", path), false, 1, 0, responseNXDomain, defaultTTL},
+		{fmt.Sprintf("file %s\nreload 1h\nresponse null\nttl 60", path), false, 1, time.Hour, responseNull, 60},
+		{fmt.Sprintf("file %s\nresponse address 192.0.2.1 ::1", path), false, 1, defaultReload, responseAddress, defaultTTL},
+		{fmt.Sprintf("file %s\nresponse refused", path), false, 1, defaultReload, responseRefused, defaultTTL},
+		// fails
+		{"", true, 0, 0, 0, 0},
+		{fmt.Sprintf("allow_file %s", path), true, 0, 0, 0, 0},
+		{"file", true, 0, 0, 0, 0},
+		{"file /does/not/exist", true, 0, 0, 0, 0},
+		{"block bad/name", true, 0, 0, 0, 0},
+		{fmt.Sprintf("file %s\nreload -1s", path), true, 0, 0, 0, 0},
+		{fmt.Sprintf("file %s\nresponse", path), true, 0, 0, 0, 0},
+		{fmt.Sprintf("file %s\nresponse drop", path), true, 0, 0, 0, 0},
+		{fmt.Sprintf("file %s\nresponse address", path), true, 0, 0, 0, 0},
+		{fmt.Sprintf("file %s\nresponse address example.org", path), true, 0, 0, 0, 0},
+		{fmt.Sprintf("file %s\nresponse nxdomain 192.0.2.1", path), true, 0, 0, 0, 0},
+		{fmt.Sprintf("file %s\nttl -1", path), true, 0, 0, 0, 0},
+		{fmt.Sprintf("file %s\nblacklist %s", path, path), true, 0, 0, 0, 0},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("blocklist {\n%s\n}", tc.input))
+		b, err := parse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if len(b.lists.files) != tc.files {
+			t.Errorf("Test %d: expected %d files, got %d", i, tc.files, len(b.lists.files))
+		}
+		if b.lists.reload != tc.reload {
+			t.Errorf("Test %d: expected reload %s, got %s", i, tc.reload, b.lists.reload)
+		}
+		if b.response != tc.response {
+			t.Errorf("Test %d: expected response %d, got %d", i, tc.response, b.response)
+		}
+		if b.ttl != tc.ttl {
+			t.Errorf("Test %d: expected ttl %d, got %d", i, tc.ttl, b.ttl)
+		}
+	}
+}
+
+func TestSetupOnce(t *testing.T) {
+	c := caddy.NewTestController("dns", "blocklist {\nblock example.org\n}\nblocklist {\nblock example.net\n}")
+	if _, err := parse(c); err == nil {
+		t.Errorf("Expected error for second blocklist block")
+	}
+}
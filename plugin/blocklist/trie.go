@@ -0,0 +1,128 @@
+package blocklist
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// trie is a suffix trie of domain names, stored label by label from the root down. Each node keeps its
+// children in a slice sorted by label, which is built once from the sorted names. This takes far less
+// memory than a map entry per name, and lets a name block all names below it.
+type trie struct {
+	root node
+	len  int // number of distinct names
+}
+
+type node struct {
+	label    string
+	flags    uint8
+	children []node
+}
+
+const (
+	matchName       uint8 = 1 << iota // matches the name itself
+	matchSubdomains                   // matches all names below the name
+)
+
+// entry is a name to add to a trie, with its labels in reverse order.
+type entry struct {
+	labels []string
+	flags  uint8
+}
+
+func newEntry(name string, flags uint8) entry {
+	labels := dns.SplitDomainName(strings.ToLower(name))
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return entry{labels: labels, flags: flags}
+}
+
+// newTrie returns a trie holding entries. Entries for the same name are merged. The entries are sorted
+// in place.
+func newTrie(entries []entry) *trie {
+	sort.Slice(entries, func(i, j int) bool { return lessLabels(entries[i].labels, entries[j].labels) })
+
+	t := &trie{}
+	// Entries without labels are the root, which is not blocked as a whole.
+	i := 0
+	for i < len(entries) && len(entries[i].labels) == 0 {
+		i++
+	}
+	t.root.children, t.len = build(entries[i:], 0)
+	return t
+}
+
+// build returns the nodes for the sorted entries at depth, which all have more than depth labels, and the
+// number of names they hold.
+func build(entries []entry, depth int) ([]node, int) {
+	groups := 0
+	for i := 0; i < len(entries); i++ {
+		if i == 0 || entries[i].labels[depth] != entries[i-1].labels[depth] {
+			groups++
+		}
+	}
+
+	nodes := make([]node, 0, groups)
+	total := 0
+	for i := 0; i < len(entries); {
+		n := node{label: entries[i].labels[depth]}
+		j := i
+		for j < len(entries) && entries[j].labels[depth] == n.label {
+			j++
+		}
+		// Entries ending at this node sort before the longer ones.
+		k := i
+		for k < j && len(entries[k].labels) == depth+1 {
+			n.flags |= entries[k].flags
+			k++
+		}
+		if n.flags != 0 {
+			total++
+		}
+		var sub int
+		n.children, sub = build(entries[k:j], depth+1)
+		total += sub
+		nodes = append(nodes, n)
+		i = j
+	}
+	return nodes, total
+}
+
+// match returns true when name, in lower case, is in the trie, or is below a name whose subdomains are.
+func (t *trie) match(name string) bool {
+	if t == nil {
+		return false
+	}
+	name = strings.TrimSuffix(name, ".")
+	children := t.root.children
+	for end := len(name); end > 0; {
+		i := strings.LastIndexByte(name[:end], '.')
+		label := name[i+1 : end]
+		k := sort.Search(len(children), func(j int) bool { return children[j].label >= label })
+		if k == len(children) || children[k].label != label {
+			return false
+		}
+		n := &children[k]
+		if i < 0 {
+			return n.flags&matchName != 0
+		}
+		if n.flags&matchSubdomains != 0 {
+			return true
+		}
+		children = n.children
+		end = i
+	}
+	return false
+}
+
+func lessLabels(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,63 @@
+package blocklist
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTrie(t *testing.T) {
+	tr := newTrie([]entry{
+		newEntry("ads.example.org.", matchName),
+		newEntry("Tracker.example.org", matchName|matchSubdomains),
+		newEntry("example.net.", matchSubdomains),
+		newEntry("ads.example.org", matchName), // duplicate
+		newEntry("a.b.c.example.com", matchName),
+		newEntry(".", matchName|matchSubdomains), // root is ignored
+	})
+	if tr.len != 4 {
+		t.Errorf("Expected 4 names, got %d", tr.len)
+	}
+
+	tests := []struct {
+		name  string
+		match bool
+	}{
+		{"ads.example.org.", true},
+		{"www.ads.example.org.", false},
+		{"example.org.", false},
+		{"org.", false},
+		{"tracker.example.org.", true},
+		{"a.tracker.example.org.", true},
+		{"example.net.", false},
+		{"www.example.net.", true},
+		{"a.b.c.example.com.", true},
+		{"b.c.example.com.", false},
+		{"x.a.b.c.example.com.", false},
+		{"example.com.", false},
+		{".", false},
+		{"", false},
+	}
+	for _, tc := range tests {
+		if got := tr.match(tc.name); got != tc.match {
+			t.Errorf("Expected match %t for %q, got %t", tc.match, tc.name, got)
+		}
+	}
+
+	var empty *trie
+	if empty.match("example.org.") {
+		t.Errorf("Expected no match in nil trie")
+	}
+}
+
+func BenchmarkTrieMatch(b *testing.B) {
+	entries := make([]entry, 0, 100000)
+	for i := 0; i < 100000; i++ {
+		entries = append(entries, newEntry(fmt.Sprintf("host%d.example%d.com.", i, i%1000), matchName))
+	}
+	tr := newTrie(entries)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.match("host12345.example345.com.")
+	}
+}
@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/reuseport"
+
+	"github.com/miekg/dns"
+)
+
+// The admin server is an HTTP endpoint to inspect and purge the caches. The caches of all server blocks
+// that use the same address share one admin server.
+//
+//	GET  /cache/items   lists the cached items, optionally filtered with name, suffix or rcode
+//	POST /cache/purge   removes the items matching name, suffix or rcode
+//	GET  /cache/shards  reports the occupancy of each shard
+//
+// The NSEC and NSEC3 records cached with aggressive_nsec are listed and purged per zone: a zone is
+// selected when its records may be used to answer for the selected names.
+type admin struct {
+	ln     net.Listener
+	caches map[*Cache]struct{}
+}
+
+var (
+	adminMu sync.Mutex
+	admins  = map[string]*admin{}
+)
+
+// startAdmin adds c to the admin server for its address, the server is started if it is not running yet.
+func (c *Cache) startAdmin() error {
+	adminMu.Lock()
+	defer adminMu.Unlock()
+
+	if a, ok := admins[c.adminAddr]; ok {
+		a.caches[c] = struct{}{}
+		return nil
+	}
+
+	ln, err := reuseport.Listen("tcp", c.adminAddr)
+	if err != nil {
+		return err
+	}
+	a := &admin{ln: ln, caches: map[*Cache]struct{}{c: {}}}
+	admins[c.adminAddr] = a
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache/items", a.items)
+	mux.HandleFunc("/cache/purge", a.purge)
+	mux.HandleFunc("/cache/shards", a.shards)
+	go func() { http.Serve(ln, mux) }()
+	return nil
+}
+
+// stopAdmin removes c from its admin server, the server is stopped when no caches are left.
+func (c *Cache) stopAdmin() error {
+	adminMu.Lock()
+	defer adminMu.Unlock()
+
+	a, ok := admins[c.adminAddr]
+	if !ok {
+		return nil
+	}
+	delete(a.caches, c)
+	if len(a.caches) > 0 {
+		return nil
+	}
+	delete(admins, c.adminAddr)
+	return a.ln.Close()
+}
+
+// adminItem is an item as reported by the admin server.
+type adminItem struct {
+	Zones string `json:"zones"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	QType string `json:"qtype"`
+	Rcode string `json:"rcode"`
+	TTL   int    `json:"ttl"`
+}
+
+// adminShards is the shard occupancy of a cache as reported by the admin server.
+type adminShards struct {
+	Zones    string `json:"zones"`
+	Type     string `json:"type"`
+	Capacity int    `json:"capacity"` // of each shard
+	Shards   []int  `json:"shards"`
+}
+
+func (a *admin) items(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := newFilter(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items := []adminItem{}
+	a.walk(func(c *Cache, typ string, ca *cache.Cache) {
+		now := c.now().UTC()
+		ca.Walk(func(m map[uint64]interface{}, key uint64) bool {
+			i, ok := m[key].(*item)
+			if ok && f.item(i) {
+				items = append(items, adminItem{Zones: c.zonesMetricLabel, Type: typ, Name: i.Name,
+					QType: dns.Type(i.QType).String(), Rcode: dns.RcodeToString[i.Rcode], TTL: i.ttl(now)})
+			}
+			return true
+		})
+	})
+	a.walkAggressive(func(c *Cache, ag *aggressive) {
+		now := c.now()
+		ag.walk(func(zone string, e *nsecEntry) {
+			if f.zone(zone) {
+				items = append(items, adminItem{Zones: c.zonesMetricLabel, Type: aggressiveType, Name: e.rr.Header().Name,
+					QType: dns.Type(e.rr.Header().Rrtype).String(), TTL: int(e.expires.Sub(now).Seconds())})
+			}
+		})
+	})
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].QType < items[j].QType
+	})
+	writeJSON(w, items)
+}
+
+func (a *admin) purge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := newFilter(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	purged := 0
+	a.walk(func(c *Cache, _ string, ca *cache.Cache) {
+		ca.Walk(func(m map[uint64]interface{}, key uint64) bool {
+			if i, ok := m[key].(*item); ok && f.item(i) {
+				delete(m, key)
+				purged++
+			}
+			return true
+		})
+	})
+	a.walkAggressive(func(_ *Cache, ag *aggressive) { purged += ag.remove(f.zone) })
+	log.Infof("Purged %d items from the cache for %s", purged, r.URL.RawQuery)
+	writeJSON(w, map[string]int{"purged": purged})
+}
+
+func (a *admin) shards(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	shards := []adminShards{}
+	a.walk(func(c *Cache, typ string, ca *cache.Cache) {
+		shards = append(shards, adminShards{Zones: c.zonesMetricLabel, Type: typ, Capacity: ca.ShardCap(), Shards: ca.Shards()})
+	})
+	writeJSON(w, shards)
+}
+
+// walk calls f for the success and denial cache of each cache registered with a.
+func (a *admin) walk(f func(c *Cache, typ string, ca *cache.Cache)) {
+	for _, c := range a.sorted() {
+		f(c, Success, c.pcache)
+		f(c, Denial, c.ncache)
+	}
+}
+
+// walkAggressive calls f for the aggressive_nsec store of each cache registered with a that has one.
+func (a *admin) walkAggressive(f func(c *Cache, ag *aggressive)) {
+	for _, c := range a.sorted() {
+		if c.aggressive != nil {
+			f(c, c.aggressive)
+		}
+	}
+}
+
+// sorted returns the caches registered with a, sorted on their zones.
+func (a *admin) sorted() []*Cache {
+	adminMu.Lock()
+	caches := make([]*Cache, 0, len(a.caches))
+	for c := range a.caches {
+		caches = append(caches, c)
+	}
+	adminMu.Unlock()
+	sort.Slice(caches, func(i, j int) bool { return caches[i].zonesMetricLabel < caches[j].zonesMetricLabel })
+	return caches
+}
+
+// filter selects items by the name, suffix and rcode query parameters of a request.
+type filter struct {
+	name   string
+	suffix string
+	rcode  int // -1 for any rcode
+}
+
+// newFilter returns the filter for the query parameters of r. When required is true at least one of them
+// must be given.
+func newFilter(r *http.Request, required bool) (*filter, error) {
+	q := r.URL.Query()
+	name, suffix, rcode := q.Get("name"), q.Get("suffix"), q.Get("rcode")
+	if name == "" && suffix == "" && rcode == "" && required {
+		return nil, fmt.Errorf("one of name, suffix or rcode is required")
+	}
+
+	f := &filter{rcode: -1}
+	if rcode != "" {
+		x, ok := dns.StringToRcode[strings.ToUpper(rcode)]
+		if !ok {
+			return nil, fmt.Errorf("invalid rcode: %q", rcode)
+		}
+		f.rcode = x
+	}
+	if name != "" {
+		f.name = dns.CanonicalName(name)
+	}
+	if suffix != "" {
+		f.suffix = dns.CanonicalName(suffix)
+	}
+	return f, nil
+}
+
+// item returns true if i is selected by f.
+func (f *filter) item(i *item) bool {
+	if f.name != "" && i.Name != f.name {
+		return false
+	}
+	if f.suffix != "" && !dns.IsSubDomain(f.suffix, i.Name) {
+		return false
+	}
+	if f.rcode >= 0 && i.Rcode != f.rcode {
+		return false
+	}
+	return true
+}
+
+// zone returns true if the denial records of zone, cached with aggressive_nsec, may be used to answer for
+// the names selected by f. These records are only used for NXDOMAIN and NODATA (NOERROR) replies.
+func (f *filter) zone(zone string) bool {
+	if f.rcode >= 0 && f.rcode != dns.RcodeNameError && f.rcode != dns.RcodeSuccess {
+		return false
+	}
+	if f.name != "" && !dns.IsSubDomain(zone, f.name) {
+		return false
+	}
+	if f.suffix != "" && !dns.IsSubDomain(zone, f.suffix) && !dns.IsSubDomain(f.suffix, zone) {
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warningf("Failed to write admin response: %s", err)
+	}
+}
+
+const (
+	// defaultAdminAddr is the default address of the admin server.
+	defaultAdminAddr = "localhost:9155"
+	// aggressiveType is the type of the NSEC and NSEC3 records cached with aggressive_nsec, as listed by the
+	// admin server.
+	aggressiveType = "aggressive_nsec"
+)
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func newAdminCache(t *testing.T) (*Cache, *admin) {
+	c := New()
+	c.zonesMetricLabel = "."
+	c.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		switch r.Question[0].Name {
+		case "nx.example.org.":
+			m.Rcode = dns.RcodeNameError
+			m.Ns = []dns.RR{test.SOA("example.org. 300 IN SOA ns.example.org. hostmaster.example.org. 1 3600 600 86400 300")}
+		default:
+			m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 127.0.0.1")}
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+	for _, name := range []string{"a.example.org.", "b.example.org.", "nx.example.org.", "example.net."} {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m)
+	}
+	if c.pcache.Len() != 3 || c.ncache.Len() != 1 {
+		t.Fatalf("Expected 3 success and 1 denial items, got %d and %d", c.pcache.Len(), c.ncache.Len())
+	}
+	return c, &admin{caches: map[*Cache]struct{}{c: {}}}
+}
+
+func TestAdminItems(t *testing.T) {
+	_, a := newAdminCache(t)
+
+	tests := []struct {
+		query    string
+		code     int
+		expected []string
+	}{
+		{"", http.StatusOK, []string{"a.example.org.", "b.example.org.", "example.net.", "nx.example.org."}},
+		{"?name=A.example.org", http.StatusOK, []string{"a.example.org."}},
+		{"?suffix=example.org", http.StatusOK, []string{"a.example.org.", "b.example.org.", "nx.example.org."}},
+		{"?rcode=nxdomain", http.StatusOK, []string{"nx.example.org."}},
+		{"?rcode=bla", http.StatusBadRequest, nil},
+	}
+	for i, tc := range tests {
+		rec := httptest.NewRecorder()
+		a.items(rec, httptest.NewRequest(http.MethodGet, "/cache/items"+tc.query, nil))
+		if rec.Code != tc.code {
+			t.Errorf("Test %d: expected status %d, got %d", i, tc.code, rec.Code)
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		items := []adminItem{}
+		if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+			t.Fatalf("Test %d: failed to decode items: %s", i, err)
+		}
+		if len(items) != len(tc.expected) {
+			t.Errorf("Test %d: expected %d items, got %d", i, len(tc.expected), len(items))
+			continue
+		}
+		for j := range items {
+			if items[j].Name != tc.expected[j] {
+				t.Errorf("Test %d: expected item %s, got %s", i, tc.expected[j], items[j].Name)
+			}
+			if items[j].TTL <= 0 || items[j].QType != "A" {
+				t.Errorf("Test %d: expected an A item with a positive TTL, got %v", i, items[j])
+			}
+		}
+	}
+}
+
+func TestAdminPurge(t *testing.T) {
+	c, a := newAdminCache(t)
+
+	tests := []struct {
+		method string
+		query  string
+		code   int
+		purged int
+		left   int
+	}{
+		{http.MethodGet, "?name=a.example.org", http.StatusMethodNotAllowed, 0, 4},
+		{http.MethodPost, "", http.StatusBadRequest, 0, 4},
+		{http.MethodPost, "?name=a.example.org", http.StatusOK, 1, 3},
+		{http.MethodPost, "?rcode=NXDOMAIN", http.StatusOK, 1, 2},
+		{http.MethodDelete, "?suffix=org.", http.StatusOK, 1, 1},
+	}
+	for i, tc := range tests {
+		rec := httptest.NewRecorder()
+		a.purge(rec, httptest.NewRequest(tc.method, "/cache/purge"+tc.query, nil))
+		if rec.Code != tc.code {
+			t.Errorf("Test %d: expected status %d, got %d", i, tc.code, rec.Code)
+			continue
+		}
+		if tc.code == http.StatusOK {
+			resp := map[string]int{}
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if resp["purged"] != tc.purged {
+				t.Errorf("Test %d: expected %d purged items, got %d", i, tc.purged, resp["purged"])
+			}
+		}
+		if left := c.pcache.Len() + c.ncache.Len(); left != tc.left {
+			t.Errorf("Test %d: expected %d items left, got %d", i, tc.left, left)
+		}
+	}
+}
+
+func TestAdminAggressive(t *testing.T) {
+	queries := 0
+	c := New()
+	c.zonesMetricLabel = "."
+	c.aggressive = newAggressive(defaultAggressiveCap)
+	c.Next = nsecBackend(&queries, true)
+	a := &admin{caches: map[*Cache]struct{}{c: {}}}
+
+	query := func(qname string) {
+		m := new(dns.Msg)
+		m.SetQuestion(qname, dns.TypeA)
+		m.SetEdns0(4096, true)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m)
+	}
+	query("b.example.org.")
+
+	rec := httptest.NewRecorder()
+	a.items(rec, httptest.NewRequest(http.MethodGet, "/cache/items?suffix=c.example.org", nil))
+	items := []adminItem{}
+	if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+		t.Fatalf("Failed to decode items: %s", err)
+	}
+	nsec := 0
+	for _, i := range items {
+		if i.Type == aggressiveType && i.QType == "NSEC" && i.TTL > 0 {
+			nsec++
+		}
+	}
+	if nsec != 2 {
+		t.Errorf("Expected 2 NSEC items, got %v", items)
+	}
+
+	tests := []struct {
+		query   string
+		purged  int
+		queries int // total number of queries seen by the backend after asking for c.example.org
+	}{
+		{"?rcode=SERVFAIL", 0, 1},
+		{"?suffix=example.net", 0, 1},
+		{"?name=c.example.org", 2, 2}, // the NSEC records of example.org would deny c.example.org
+	}
+	for i, tc := range tests {
+		rec := httptest.NewRecorder()
+		a.purge(rec, httptest.NewRequest(http.MethodPost, "/cache/purge"+tc.query, nil))
+		resp := map[string]int{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp["purged"] != tc.purged {
+			t.Errorf("Test %d: expected %d purged items, got %d", i, tc.purged, resp["purged"])
+		}
+		query("c.example.org.")
+		if queries != tc.queries {
+			t.Errorf("Test %d: expected %d queries to the backend, got %d", i, tc.queries, queries)
+		}
+	}
+}
+
+func TestAdminServer(t *testing.T) {
+	c, _ := newAdminCache(t)
+	c.adminAddr = "127.0.0.1:0"
+	if err := c.startAdmin(); err != nil {
+		t.Fatalf("Failed to start admin server: %s", err)
+	}
+	addr := admins[c.adminAddr].ln.Addr().String()
+
+	resp, err := http.Get("http://" + addr + "/cache/shards")
+	if err != nil {
+		t.Fatalf("Failed to get shards: %s", err)
+	}
+	shards := []adminShards{}
+	err = json.NewDecoder(resp.Body).Decode(&shards)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode shards: %s", err)
+	}
+	if len(shards) != 2 || shards[0].Type != Success || shards[1].Type != Denial {
+		t.Fatalf("Expected success and denial shards, got %v", shards)
+	}
+	total := 0
+	for _, n := range shards[0].Shards {
+		total += n
+	}
+	if total != 3 {
+		t.Errorf("Expected 3 items in the success shards, got %d", total)
+	}
+
+	if err := c.stopAdmin(); err != nil {
+		t.Fatalf("Failed to stop admin server: %s", err)
+	}
+	if _, ok := admins[c.adminAddr]; ok {
+		t.Errorf("Expected admin server to be removed")
+	}
+}
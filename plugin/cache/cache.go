@@ -38,7 +38,21 @@ type Cache struct {
 	duration   time.Duration
 	percentage int
 
-	staleUpTo time.Duration
+	staleUpTo   time.Duration
+	verifyStale bool // only serve stale items when the plugins after cache fail to resolve the query
+
+	snapshot *snapshot // when set, the cache is saved to and restored from a file
+
+	// ECS, when enabled replies are cached per client subnet.
+	ecs     bool
+	ecsMax  int          // maximum number of subnets per name
+	subnets *cache.Cache // subnets per name
+
+	adminAddr string // when set, the address of the admin server
+
+	policy cache.Policy // eviction policy of pcache and ncache
+
+	aggressive *aggressive // when set, denial records are used to synthesize replies (RFC 8198)
 
 	// Testing.
 	now func() time.Time
@@ -66,8 +80,8 @@ func New() *Cache {
 
 // key returns key under which we store the item, -1 will be returned if we don't store the message.
 // Currently we do not cache Truncated, errors zone transfers or dynamic update messages.
-// qname holds the already lowercased qname.
-func key(qname string, m *dns.Msg, t response.Type) (bool, uint64) {
+// qname holds the already lowercased qname, cd is the CD bit of the request.
+func key(qname string, cd bool, m *dns.Msg, t response.Type) (bool, uint64) {
 	// We don't store truncated responses.
 	if m.Truncated {
 		return false, 0
@@ -77,14 +91,20 @@ func key(qname string, m *dns.Msg, t response.Type) (bool, uint64) {
 		return false, 0
 	}
 
-	return true, hash(qname, m.Question[0].Qtype)
+	return true, hash(qname, m.Question[0].Qtype, cd)
 }
 
-func hash(qname string, qtype uint16) uint64 {
+// hash returns the key for qname and qtype. Responses to queries with the CD bit set are stored under
+// their own key: they are not validated by plugins such as validate, and must not be served to clients
+// that want validated answers.
+func hash(qname string, qtype uint16, cd bool) uint64 {
 	h := fnv.New64()
 	h.Write([]byte{byte(qtype >> 8)})
 	h.Write([]byte{byte(qtype)})
 	h.Write([]byte(qname))
+	if cd {
+		h.Write([]byte{0})
+	}
 	return h.Sum64()
 }
 
@@ -109,6 +129,9 @@ type ResponseWriter struct {
 	do         bool // When true the original request had the DO bit set.
 	prefetch   bool // When true write nothing back to the client.
 	remoteAddr net.Addr
+
+	stale *staleServer // When set a SERVFAIL reply is replaced with this stale answer.
+	scope uint8        // ECS prefix length the reply is cached for, 0 when it is valid for all clients.
 }
 
 // newPrefetchResponseWriter returns a Cache ResponseWriter to be used in
@@ -147,8 +170,23 @@ func (w *ResponseWriter) RemoteAddr() net.Addr {
 func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	mt, _ := response.Typify(res, w.now().UTC())
 
+	// Don't let a failure replace the item we can still serve stale.
+	if mt == response.ServerError && w.stale != nil && w.stale.ServeStale() {
+		return nil
+	}
+
 	// key returns empty string for anything we don't want to cache.
-	hasKey, key := key(w.state.Name(), res, mt)
+	hasKey, key := key(w.state.Name(), w.state.Req.CheckingDisabled, res, mt)
+	w.scope = 0
+	if hasKey && w.ecs {
+		if k, bits, ok := w.ecsKey(w.state, res); ok {
+			key, w.scope = k, bits
+			if !w.addSubnet(w.state, key, bits) {
+				hasKey = false
+				ecsDrops.WithLabelValues(w.server, w.zonesMetricLabel).Inc()
+			}
+		}
+	}
 
 	msgTTL := dnsutil.MinimalTTL(res, mt)
 	var duration time.Duration
@@ -161,6 +199,10 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 		duration = computeTTL(msgTTL, w.minpttl, w.pttl)
 	}
 
+	if w.aggressive != nil && (mt == response.NameError || mt == response.NoData) && w.state.Match(res) && !w.state.Req.CheckingDisabled {
+		w.aggressive.add(res, w.now(), w.nttl)
+	}
+
 	if hasKey && duration > 0 {
 		if w.state.Match(res) {
 			w.set(res, key, mt, duration)
@@ -182,6 +224,9 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	res.Answer = filterRRSlice(res.Answer, ttl, w.do, false)
 	res.Ns = filterRRSlice(res.Ns, ttl, w.do, false)
 	res.Extra = filterRRSlice(res.Extra, ttl, w.do, false)
+	if w.scope > 0 {
+		setSubnet(w.state.Req, res, w.scope)
+	}
 
 	if !w.do {
 		res.AuthenticatedData = false // unset AD bit if client is not OK with DNSSEC
@@ -196,6 +241,7 @@ func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration
 	switch mt {
 	case response.NoError, response.Delegation:
 		i := newItem(m, w.now(), duration)
+		i.scope = w.scope
 		if w.pcache.Add(key, i) {
 			evictions.WithLabelValues(w.server, Success, w.zonesMetricLabel).Inc()
 		}
@@ -206,6 +252,7 @@ func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration
 
 	case response.NameError, response.NoData, response.ServerError:
 		i := newItem(m, w.now(), duration)
+		i.scope = w.scope
 		if w.ncache.Add(key, i) {
 			evictions.WithLabelValues(w.server, Denial, w.zonesMetricLabel).Inc()
 		}
@@ -235,6 +282,8 @@ const (
 
 	defaultCap = 10000 // default capacity of the cache.
 
+	defaultSnapshotInterval = 5 * time.Minute // default interval between cache snapshots.
+
 	// Success is the class for caching positive caching.
 	Success = "success"
 	// Denial is the class defined for negative caching.
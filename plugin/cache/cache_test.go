@@ -9,6 +9,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/plugin/pkg/stale"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/coredns/coredns/request"
 
@@ -198,7 +199,7 @@ func TestCache(t *testing.T) {
 		state := request.Request{W: &test.ResponseWriter{}, Req: m}
 
 		mt, _ := response.Typify(m, utc)
-		valid, k := key(state.Name(), m, mt)
+		valid, k := key(state.Name(), false, m, mt)
 
 		if valid {
 			crr.set(m, k, mt, c.pttl)
@@ -300,6 +301,127 @@ func TestServeFromStaleCache(t *testing.T) {
 	}
 }
 
+func TestServeStaleExtendedError(t *testing.T) {
+	c := New()
+	c.staleUpTo = 1 * time.Hour
+	c.Next = ttlBackend(60)
+
+	req := new(dns.Msg)
+	req.SetQuestion("cached.org.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	ctx := context.TODO()
+
+	c.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	c.now = func() time.Time { return time.Now().Add(30 * time.Minute) }
+	c.Next = plugin.HandlerFunc(func(context.Context, dns.ResponseWriter, *dns.Msg) (int, error) {
+		return dns.RcodeServerFailure, nil
+	})
+
+	// Clients without EDNS0 get the stale answer without extended error.
+	for _, edns := range []bool{true, false} {
+		r := req.Copy()
+		if !edns {
+			r.Extra = nil
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(ctx, rec, r)
+
+		var ede *dns.EDNS0_EDE
+		if o := rec.Msg.IsEdns0(); o != nil {
+			for _, opt := range o.Option {
+				if e, ok := opt.(*dns.EDNS0_EDE); ok {
+					ede = e
+				}
+			}
+		}
+		if edns && (ede == nil || ede.InfoCode != dns.ExtendedErrorCodeStaleAnswer) {
+			t.Errorf("Expected Stale Answer extended error, got %v", ede)
+		}
+		if !edns && ede != nil {
+			t.Errorf("Expected no extended error without EDNS0, got %v", ede)
+		}
+	}
+}
+
+func TestServeStaleVerify(t *testing.T) {
+	c := New()
+	c.staleUpTo = 1 * time.Hour
+	c.verifyStale = true
+	c.Next = ttlBackend(60)
+
+	req := new(dns.Msg)
+	req.SetQuestion("cached.org.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	ctx := context.TODO()
+
+	c.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	if c.pcache.Len() != 1 {
+		t.Fatalf("Msg with > 0 TTL should have been cached")
+	}
+	c.now = func() time.Time { return time.Now().Add(30 * time.Minute) }
+
+	tests := []struct {
+		name     string
+		next     plugin.Handler
+		expected int // expected rcode of the reply
+		stale    bool
+	}{
+		// Upstream writes SERVFAIL, the stale item is served instead.
+		{"servfail reply", plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+			return dns.RcodeServerFailure, nil
+		}), dns.RcodeSuccess, true},
+		// Upstream fails and asks cache for a stale answer.
+		{"stale.Serve", plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			if stale.Serve(ctx) {
+				return dns.RcodeSuccess, nil
+			}
+			return dns.RcodeServerFailure, nil
+		}), dns.RcodeSuccess, true},
+		// Upstream answers, the stale item is refreshed.
+		{"refresh", ttlBackend(120), dns.RcodeSuccess, false},
+	}
+
+	for _, tc := range tests {
+		c.Next = tc.next
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(ctx, rec, req)
+
+		if rec.Msg == nil {
+			t.Fatalf("Test %s: expected a reply", tc.name)
+		}
+		if rec.Msg.Rcode != tc.expected {
+			t.Errorf("Test %s: expected rcode %d, got %d", tc.name, tc.expected, rec.Msg.Rcode)
+		}
+
+		var ede *dns.EDNS0_EDE
+		if o := rec.Msg.IsEdns0(); o != nil {
+			for _, opt := range o.Option {
+				if e, ok := opt.(*dns.EDNS0_EDE); ok {
+					ede = e
+				}
+			}
+		}
+		if tc.stale {
+			if ede == nil || ede.InfoCode != dns.ExtendedErrorCodeStaleAnswer {
+				t.Errorf("Test %s: expected Stale Answer extended error, got %v", tc.name, ede)
+			}
+			if ttl := rec.Msg.Answer[0].Header().Ttl; ttl != 0 {
+				t.Errorf("Test %s: expected TTL 0 for stale answer, got %d", tc.name, ttl)
+			}
+			continue
+		}
+		if ede != nil {
+			t.Errorf("Test %s: expected no extended error, got %v", tc.name, ede)
+		}
+		if ttl := rec.Msg.Answer[0].Header().Ttl; ttl != 120 {
+			t.Errorf("Test %s: expected TTL %d, got %d", tc.name, 120, ttl)
+		}
+	}
+}
+
 func TestNegativeStaleMaskingPositiveCache(t *testing.T) {
 	c := New()
 	c.staleUpTo = time.Minute * 10
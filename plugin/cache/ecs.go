@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"hash/fnv"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// With ecs enabled, responses that carry an EDNS0 Client Subnet (ECS) option with a non-zero scope are
+// only valid for clients in that subnet. They are stored under a key that includes the subnet, see
+// RFC 7871, section 7.3. For each name the prefix lengths used are tracked, so a lookup knows which
+// subnets of the client to try.
+
+// subnets tracks the subnets under which items for a name are cached.
+type subnets struct {
+	sync.Mutex
+	prefixes map[prefix]struct{}
+	keys     map[uint64]struct{}
+}
+
+type prefix struct {
+	family uint16
+	bits   uint8
+}
+
+// subnet returns the ECS option in m, or nil if there is none.
+func subnet(m *dns.Msg) *dns.EDNS0_SUBNET {
+	o := m.IsEdns0()
+	if o == nil {
+		return nil
+	}
+	for _, e := range o.Option {
+		if s, ok := e.(*dns.EDNS0_SUBNET); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// ecsHash returns the key for the item for qname and qtype that is valid for the clients in the subnet
+// of addr with bits as prefix length. As with hash, cd is the CD bit of the request.
+func ecsHash(qname string, qtype uint16, cd bool, family uint16, addr net.IP, bits uint8) uint64 {
+	size := net.IPv4len * 8
+	if family == 2 {
+		size = net.IPv6len * 8
+	} else {
+		addr = addr.To4()
+	}
+	addr = addr.Mask(net.CIDRMask(int(bits), size))
+
+	h := fnv.New64()
+	h.Write([]byte{byte(qtype >> 8), byte(qtype), byte(family), bits})
+	h.Write(addr)
+	h.Write([]byte(qname))
+	if cd {
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// keys returns the keys under which an item for the request in state can be cached, in order of preference.
+func (c *Cache) keys(state request.Request) []uint64 {
+	k := hash(state.Name(), state.QType(), state.Req.CheckingDisabled)
+	if !c.ecs {
+		return []uint64{k}
+	}
+	q := subnet(state.Req)
+	if q == nil || q.SourceNetmask == 0 {
+		return []uint64{k}
+	}
+	el, ok := c.subnets.Get(k)
+	if !ok {
+		return []uint64{k}
+	}
+	s := el.(*subnets)
+
+	s.Lock()
+	bits := []int{}
+	for p := range s.prefixes {
+		if p.family == q.Family && p.bits <= q.SourceNetmask {
+			bits = append(bits, int(p.bits))
+		}
+	}
+	s.Unlock()
+
+	// Most specific subnet first.
+	sort.Sort(sort.Reverse(sort.IntSlice(bits)))
+	keys := make([]uint64, 0, len(bits)+1)
+	for _, b := range bits {
+		keys = append(keys, ecsHash(state.Name(), state.QType(), state.Req.CheckingDisabled, q.Family, q.Address, uint8(b)))
+	}
+	return append(keys, k)
+}
+
+// ecsKey returns the key for res, which is only valid for the subnet of the client. Ok is false if res is
+// valid for all clients. The prefix length of the subnet is returned in bits.
+func (c *Cache) ecsKey(state request.Request, res *dns.Msg) (key uint64, bits uint8, ok bool) {
+	q := subnet(state.Req)
+	if q == nil {
+		return 0, 0, false
+	}
+	r := subnet(res)
+	if r == nil || r.SourceScope == 0 {
+		return 0, 0, false
+	}
+	// The response can't be more specific than the subnet we sent, RFC 7871, section 7.3.1.
+	bits = r.SourceScope
+	if q.SourceNetmask < bits {
+		bits = q.SourceNetmask
+	}
+	if bits == 0 {
+		return 0, 0, false
+	}
+	return ecsHash(state.Name(), state.QType(), state.Req.CheckingDisabled, q.Family, q.Address, bits), bits, true
+}
+
+// addSubnet records that an item for the request in state is cached under key for a subnet with
+// prefix length bits. It returns false if the name has reached the maximum number of subnets.
+func (c *Cache) addSubnet(state request.Request, key uint64, bits uint8) bool {
+	k := hash(state.Name(), state.QType(), state.Req.CheckingDisabled)
+	var s *subnets
+	if el, ok := c.subnets.Get(k); ok {
+		s = el.(*subnets)
+	} else {
+		s = &subnets{prefixes: map[prefix]struct{}{}, keys: map[uint64]struct{}{}}
+		c.subnets.Add(k, s)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.keys[key]; !ok && len(s.keys) >= c.ecsMax {
+		// Forget the subnets whose items have been evicted.
+		for sk := range s.keys {
+			_, pok := c.pcache.Get(sk)
+			_, nok := c.ncache.Get(sk)
+			if !pok && !nok {
+				delete(s.keys, sk)
+			}
+		}
+		if len(s.keys) >= c.ecsMax {
+			return false
+		}
+	}
+	s.keys[key] = struct{}{}
+	s.prefixes[prefix{subnet(state.Req).Family, bits}] = struct{}{}
+	return true
+}
+
+// setSubnet adds an ECS option with scope to m, m is the reply to req. Nothing is added when req has no
+// ECS option.
+func setSubnet(req, m *dns.Msg, scope uint8) {
+	q := subnet(req)
+	if q == nil {
+		return
+	}
+	o := m.IsEdns0()
+	if o == nil {
+		o = &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+		m.Extra = append(m.Extra, o)
+	}
+	o.Option = append(o.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        q.Family,
+		SourceNetmask: q.SourceNetmask,
+		SourceScope:   scope,
+		Address:       q.Address,
+	})
+}
+
+// defaultECSSubnets is the default maximum number of subnets cached per name.
+const defaultECSSubnets = 64
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// ecsBackend answers with the client's subnet in the A record, the reply is valid for the /24 of the client.
+// A client without ECS gets 127.0.0.1 with a scope of 0.
+func ecsBackend(queries *int) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*queries++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Response, m.RecursionAvailable = true, true
+
+		ip := net.ParseIP("127.0.0.1")
+		if s := subnet(r); s != nil {
+			ip = s.Address.Mask(net.CIDRMask(24, 32))
+			m.SetEdns0(4096, false)
+			m.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: s.SourceNetmask, SourceScope: 24, Address: s.Address}}
+		}
+		m.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: ip}}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func ecsQuery(client string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	if client != "" {
+		m.SetEdns0(4096, false)
+		m.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 32, Address: net.ParseIP(client).To4()}}
+	}
+	return m
+}
+
+func TestECS(t *testing.T) {
+	queries := 0
+	c := New()
+	c.ecs, c.ecsMax, c.subnets = true, defaultECSSubnets, cache.New(defaultCap)
+	c.Next = ecsBackend(&queries)
+
+	tests := []struct {
+		client  string
+		answer  string
+		queries int // total number of queries seen by the backend
+		scope   uint8
+	}{
+		{"10.1.1.1", "10.1.1.0", 1, 24},
+		{"10.1.1.2", "10.1.1.0", 1, 24}, // same /24, from the cache
+		{"10.1.2.1", "10.1.2.0", 2, 24},
+		{"", "127.0.0.1", 3, 0},
+		{"", "127.0.0.1", 3, 0},
+		{"10.1.2.200", "10.1.2.0", 3, 24},
+	}
+	for i, tc := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, ecsQuery(tc.client))
+
+		if a := rec.Msg.Answer[0].(*dns.A).A.String(); a != tc.answer {
+			t.Errorf("Test %d: expected answer %s, got %s", i, tc.answer, a)
+		}
+		if queries != tc.queries {
+			t.Errorf("Test %d: expected %d queries to the backend, got %d", i, tc.queries, queries)
+		}
+		s := subnet(rec.Msg)
+		if tc.scope == 0 {
+			if s != nil {
+				t.Errorf("Test %d: expected no ECS option in the reply", i)
+			}
+			continue
+		}
+		if s == nil || s.SourceScope != tc.scope {
+			t.Errorf("Test %d: expected ECS option with scope %d in the reply, got %v", i, tc.scope, s)
+		}
+	}
+}
+
+func TestECSMaxSubnets(t *testing.T) {
+	queries := 0
+	c := New()
+	c.ecs, c.ecsMax, c.subnets = true, 2, cache.New(defaultCap)
+	c.Next = ecsBackend(&queries)
+
+	for _, client := range []string{"10.1.1.1", "10.1.2.1", "10.1.3.1", "10.1.3.1"} {
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), ecsQuery(client))
+	}
+	// The third subnet is over the limit and isn't cached, so it is queried twice.
+	if queries != 4 {
+		t.Errorf("Expected 4 queries to the backend, got %d", queries)
+	}
+	if c.pcache.Len() != 2 {
+		t.Errorf("Expected 2 items in the cache, got %d", c.pcache.Len())
+	}
+}
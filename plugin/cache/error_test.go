@@ -36,3 +36,33 @@ func formErrHandler() plugin.Handler {
 		return dns.RcodeSuccess, nil
 	})
 }
+
+func TestServFailCachedError(t *testing.T) {
+	c := New()
+	c.Next = test.ErrorHandler()
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+	req.SetEdns0(4096, false)
+
+	// First reply comes from the backend, the second one from the cache.
+	for i, cached := range []bool{false, true} {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, req)
+
+		if rec.Msg.Rcode != dns.RcodeServerFailure {
+			t.Fatalf("Test %d: expected SERVFAIL, got %d", i, rec.Msg.Rcode)
+		}
+		ede := false
+		if o := rec.Msg.IsEdns0(); o != nil {
+			for _, opt := range o.Option {
+				if e, ok := opt.(*dns.EDNS0_EDE); ok && e.InfoCode == dns.ExtendedErrorCodeCachedError {
+					ede = true
+				}
+			}
+		}
+		if ede != cached {
+			t.Errorf("Test %d: expected Cached Error extended error to be %t, got %t", i, cached, ede)
+		}
+	}
+}
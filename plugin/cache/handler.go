@@ -7,6 +7,8 @@ import (
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/pkg/stale"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -38,26 +40,69 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	if i != nil {
 		ttl = i.ttl(now)
 	}
+	if i == nil && c.aggressive != nil {
+		if m := c.aggressive.synthesize(state, now, do); m != nil {
+			typ := "nodata"
+			if m.Rcode == dns.RcodeNameError {
+				typ = "nxdomain"
+			}
+			synthesized.WithLabelValues(server, typ, c.zonesMetricLabel).Inc()
+			w.WriteMsg(m)
+			return dns.RcodeSuccess, nil
+		}
+	}
 	if i == nil {
 		crr := &ResponseWriter{ResponseWriter: w, Cache: c, state: state, server: server, do: do}
 		return c.doRefresh(ctx, state, crr)
 	}
 	if ttl < 0 {
-		servedStale.WithLabelValues(server, c.zonesMetricLabel).Inc()
 		// Adjust the time to get a 0 TTL in the reply built from a stale item.
 		now = now.Add(time.Duration(ttl) * time.Second)
+		ss := &staleServer{c: c, w: w, r: r, i: i, now: now, do: do, server: server}
+		if c.verifyStale {
+			// Try to refresh the item first, the stale item is only served when that fails.
+			crr := &ResponseWriter{ResponseWriter: w, Cache: c, state: state, server: server, do: do, stale: ss}
+			return c.doRefresh(stale.NewContext(ctx, ss), state, crr)
+		}
 		cw := newPrefetchResponseWriter(server, state, c)
 		go c.doPrefetch(ctx, state, cw, i, now)
+		ss.ServeStale()
+		return dns.RcodeSuccess, nil
 	} else if c.shouldPrefetch(i, now) {
 		cw := newPrefetchResponseWriter(server, state, c)
 		go c.doPrefetch(ctx, state, cw, i, now)
 	}
 	resp := i.toMsg(r, now, do)
+	if resp.Rcode == dns.RcodeServerFailure {
+		edns.SetExtendedError(r, resp, dns.ExtendedErrorCodeCachedError, "")
+	}
 	w.WriteMsg(resp)
 
 	return dns.RcodeSuccess, nil
 }
 
+// staleServer answers a query with an expired item. It implements stale.Server so that the plugins after
+// cache can fall back to it when they fail to resolve the query.
+type staleServer struct {
+	c      *Cache
+	w      dns.ResponseWriter
+	r      *dns.Msg // original request
+	i      *item
+	now    time.Time // time at which the item has a TTL of 0
+	do     bool
+	server string
+}
+
+// ServeStale implements stale.Server.
+func (s *staleServer) ServeStale() bool {
+	servedStale.WithLabelValues(s.server, s.c.zonesMetricLabel).Inc()
+
+	resp := s.i.toMsg(s.r, s.now, s.do)
+	edns.SetExtendedError(s.r, resp, dns.ExtendedErrorCodeStaleAnswer, "")
+	s.w.WriteMsg(resp)
+	return true
+}
+
 func (c *Cache) doPrefetch(ctx context.Context, state request.Request, cw *ResponseWriter, i *item, now time.Time) {
 	cachePrefetches.WithLabelValues(cw.server, c.zonesMetricLabel).Inc()
 	c.doRefresh(ctx, state, cw)
@@ -90,17 +135,18 @@ func (c *Cache) shouldPrefetch(i *item, now time.Time) bool {
 func (c *Cache) Name() string { return "cache" }
 
 func (c *Cache) get(now time.Time, state request.Request, server string) (*item, bool) {
-	k := hash(state.Name(), state.QType())
 	cacheRequests.WithLabelValues(server, c.zonesMetricLabel).Inc()
 
-	if i, ok := c.ncache.Get(k); ok && i.(*item).ttl(now) > 0 {
-		cacheHits.WithLabelValues(server, Denial, c.zonesMetricLabel).Inc()
-		return i.(*item), true
-	}
+	for _, k := range c.keys(state) {
+		if i, ok := c.ncache.Get(k); ok && i.(*item).ttl(now) > 0 {
+			cacheHits.WithLabelValues(server, Denial, c.zonesMetricLabel).Inc()
+			return i.(*item), true
+		}
 
-	if i, ok := c.pcache.Get(k); ok && i.(*item).ttl(now) > 0 {
-		cacheHits.WithLabelValues(server, Success, c.zonesMetricLabel).Inc()
-		return i.(*item), true
+		if i, ok := c.pcache.Get(k); ok && i.(*item).ttl(now) > 0 {
+			cacheHits.WithLabelValues(server, Success, c.zonesMetricLabel).Inc()
+			return i.(*item), true
+		}
 	}
 	cacheMisses.WithLabelValues(server, c.zonesMetricLabel).Inc()
 	return nil, false
@@ -108,21 +154,22 @@ func (c *Cache) get(now time.Time, state request.Request, server string) (*item,
 
 // getIgnoreTTL unconditionally returns an item if it exists in the cache.
 func (c *Cache) getIgnoreTTL(now time.Time, state request.Request, server string) *item {
-	k := hash(state.Name(), state.QType())
 	cacheRequests.WithLabelValues(server, c.zonesMetricLabel).Inc()
 
-	if i, ok := c.ncache.Get(k); ok {
-		ttl := i.(*item).ttl(now)
-		if ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds())) {
-			cacheHits.WithLabelValues(server, Denial, c.zonesMetricLabel).Inc()
-			return i.(*item)
+	for _, k := range c.keys(state) {
+		if i, ok := c.ncache.Get(k); ok {
+			ttl := i.(*item).ttl(now)
+			if ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds())) {
+				cacheHits.WithLabelValues(server, Denial, c.zonesMetricLabel).Inc()
+				return i.(*item)
+			}
 		}
-	}
-	if i, ok := c.pcache.Get(k); ok {
-		ttl := i.(*item).ttl(now)
-		if ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds())) {
-			cacheHits.WithLabelValues(server, Success, c.zonesMetricLabel).Inc()
-			return i.(*item)
+		if i, ok := c.pcache.Get(k); ok {
+			ttl := i.(*item).ttl(now)
+			if ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds())) {
+				cacheHits.WithLabelValues(server, Success, c.zonesMetricLabel).Inc()
+				return i.(*item)
+			}
 		}
 	}
 	cacheMisses.WithLabelValues(server, c.zonesMetricLabel).Inc()
@@ -130,12 +177,13 @@ func (c *Cache) getIgnoreTTL(now time.Time, state request.Request, server string
 }
 
 func (c *Cache) exists(state request.Request) *item {
-	k := hash(state.Name(), state.QType())
-	if i, ok := c.ncache.Get(k); ok {
-		return i.(*item)
-	}
-	if i, ok := c.pcache.Get(k); ok {
-		return i.(*item)
+	for _, k := range c.keys(state) {
+		if i, ok := c.ncache.Get(k); ok {
+			return i.(*item)
+		}
+		if i, ok := c.pcache.Get(k); ok {
+			return i.(*item)
+		}
 	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/plugin/cache/freq"
@@ -9,6 +10,8 @@ import (
 )
 
 type item struct {
+	Name               string
+	QType              uint16
 	Rcode              int
 	AuthenticatedData  bool
 	RecursionAvailable bool
@@ -18,12 +21,17 @@ type item struct {
 
 	origTTL uint32
 	stored  time.Time
+	scope   uint8 // ECS prefix length of the subnet this item is valid for, 0 when valid for all
 
 	*freq.Freq
 }
 
 func newItem(m *dns.Msg, now time.Time, d time.Duration) *item {
 	i := new(item)
+	if len(m.Question) > 0 {
+		i.Name = strings.ToLower(m.Question[0].Name)
+		i.QType = m.Question[0].Qtype
+	}
 	i.Rcode = m.Rcode
 	i.AuthenticatedData = m.AuthenticatedData
 	i.RecursionAvailable = m.RecursionAvailable
@@ -80,6 +88,10 @@ func (i *item) toMsg(m *dns.Msg, now time.Time, do bool) *dns.Msg {
 	m1.Ns = filterRRSlice(i.Ns, ttl, do, true)
 	m1.Extra = filterRRSlice(i.Extra, ttl, do, true)
 
+	if i.scope > 0 {
+		setSubnet(m, m1, i.scope)
+	}
+
 	return m1
 }
 
@@ -64,4 +64,25 @@ var (
 		Name:      "evictions_total",
 		Help:      "The count of cache evictions.",
 	}, []string{"server", "type", "zones"})
+	// snapshotRestored is the number of items restored from a cache snapshot.
+	snapshotRestored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "snapshot_restored_total",
+		Help:      "The number of items restored from a cache snapshot.",
+	}, []string{"type", "zones"})
+	// ecsDrops is the number of responses not cached, because their name has too many subnets cached.
+	ecsDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "ecs_drops_total",
+		Help:      "The number of responses not cached, because their name has too many subnets cached.",
+	}, []string{"server", "zones"})
+	// synthesized is the number of replies synthesized from cached NSEC and NSEC3 records.
+	synthesized = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "synthesized_total",
+		Help:      "The number of replies synthesized from cached NSEC and NSEC3 records.",
+	}, []string{"server", "type", "zones"})
 )
@@ -0,0 +1,378 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/denial"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// With aggressive_nsec, the NSEC and NSEC3 records of validated denial responses are cached per zone. A
+// query that misses the cache is answered with an NXDOMAIN or NODATA reply synthesized from these records,
+// when they prove the name or type does not exist, see RFC 8198. A flood of queries for random subdomains
+// of a signed zone is then answered from the cache, instead of each query being sent upstream.
+
+// aggressive holds the denial records of each zone.
+type aggressive struct {
+	sync.RWMutex
+	zones map[string]*nsecZone
+	size  int // number of cached NSEC and NSEC3 records
+	max   int
+}
+
+// nsecZone holds the NSEC and NSEC3 records of a zone, and its SOA record that is added to synthesized replies.
+type nsecZone struct {
+	soa   *nsecEntry
+	nsec  []*nsecEntry // sorted in canonical order of their owner names
+	nsec3 []*nsecEntry // sorted on the hash in their owner names
+}
+
+// nsecEntry is a record with its signatures.
+type nsecEntry struct {
+	rr      dns.RR
+	sigs    []dns.RR
+	expires time.Time
+}
+
+func newAggressive(max int) *aggressive {
+	return &aggressive{zones: make(map[string]*nsecZone), max: max}
+}
+
+// add caches the denial records in the authority section of the validated response m. The records are
+// cached for at most the minimum of their TTL, the TTL and minimum of the zone's SOA record and maxTTL.
+func (a *aggressive) add(m *dns.Msg, now time.Time, maxTTL time.Duration) {
+	if !m.AuthenticatedData {
+		return
+	}
+	var soa *dns.SOA
+	for _, r := range m.Ns {
+		if s, ok := r.(*dns.SOA); ok {
+			soa = s
+			break
+		}
+	}
+	if soa == nil {
+		return
+	}
+	zone := strings.ToLower(soa.Hdr.Name)
+
+	ttl := time.Duration(soa.Hdr.Ttl) * time.Second
+	if min := time.Duration(soa.Minttl) * time.Second; min < ttl {
+		ttl = min
+	}
+	if maxTTL < ttl {
+		ttl = maxTTL
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	z, ok := a.zones[zone]
+	if !ok {
+		z = &nsecZone{}
+		a.zones[zone] = z
+	}
+	z.soa = &nsecEntry{rr: dns.Copy(soa), sigs: signatures(m.Ns, soa), expires: now.Add(ttl)}
+
+	for _, r := range m.Ns {
+		switch r := r.(type) {
+		case *dns.NSEC:
+			if !dns.IsSubDomain(zone, r.Hdr.Name) {
+				continue
+			}
+			a.insert(&z.nsec, r, m.Ns, now, ttl, func(i int) bool { return denial.Compare(z.nsec[i].rr.Header().Name, r.Hdr.Name) >= 0 })
+		case *dns.NSEC3:
+			// Opt-out NSEC3 records don't prove anything about the unsigned delegations they cover.
+			if r.Flags&denial.OptOut == denial.OptOut || !dns.IsSubDomain(zone, r.Hdr.Name) {
+				continue
+			}
+			h := hashLabel(r.Hdr.Name)
+			a.insert(&z.nsec3, r, m.Ns, now, ttl, func(i int) bool { return hashLabel(z.nsec3[i].rr.Header().Name) >= h })
+		}
+	}
+	// A purge in insert may have removed the zone.
+	a.zones[zone] = z
+}
+
+// insert adds r to the sorted entries, replacing a record with the same owner name. After is the
+// sort.Search function that finds the position of r.
+func (a *aggressive) insert(entries *[]*nsecEntry, r dns.RR, ns []dns.RR, now time.Time, ttl time.Duration, after func(int) bool) {
+	if t := time.Duration(r.Header().Ttl) * time.Second; t < ttl {
+		ttl = t
+	}
+	e := &nsecEntry{rr: dns.Copy(r), sigs: signatures(ns, r), expires: now.Add(ttl)}
+
+	es := *entries
+	i := sort.Search(len(es), after)
+	if i < len(es) && strings.EqualFold(es[i].rr.Header().Name, r.Header().Name) {
+		es[i] = e
+		return
+	}
+	if a.size >= a.max {
+		a.purge(now)
+		if a.size >= a.max {
+			return
+		}
+		// purge may have shrunk this zone's entries.
+		es = *entries
+		i = sort.Search(len(es), after)
+	}
+	es = append(es, nil)
+	copy(es[i+1:], es[i:])
+	es[i] = e
+	*entries = es
+	a.size++
+}
+
+// purge removes the expired entries and the zones that are left empty.
+func (a *aggressive) purge(now time.Time) {
+	for zone, z := range a.zones {
+		z.nsec = a.unexpired(z.nsec, now)
+		z.nsec3 = a.unexpired(z.nsec3, now)
+		if len(z.nsec) == 0 && len(z.nsec3) == 0 {
+			delete(a.zones, zone)
+		}
+	}
+}
+
+// walk calls f for each cached NSEC and NSEC3 record, together with the zone it belongs to.
+func (a *aggressive) walk(f func(zone string, e *nsecEntry)) {
+	a.RLock()
+	defer a.RUnlock()
+	for zone, z := range a.zones {
+		for _, e := range z.nsec {
+			f(zone, e)
+		}
+		for _, e := range z.nsec3 {
+			f(zone, e)
+		}
+	}
+}
+
+// remove removes the zones for which match returns true, and returns the number of NSEC and NSEC3
+// records that were removed.
+func (a *aggressive) remove(match func(zone string) bool) int {
+	a.Lock()
+	defer a.Unlock()
+	n := 0
+	for zone, z := range a.zones {
+		if !match(zone) {
+			continue
+		}
+		n += len(z.nsec) + len(z.nsec3)
+		delete(a.zones, zone)
+	}
+	a.size -= n
+	return n
+}
+
+func (a *aggressive) unexpired(entries []*nsecEntry, now time.Time) []*nsecEntry {
+	j := 0
+	for _, e := range entries {
+		if e.expires.After(now) {
+			entries[j] = e
+			j++
+			continue
+		}
+		a.size--
+	}
+	for k := j; k < len(entries); k++ {
+		entries[k] = nil
+	}
+	return entries[:j]
+}
+
+// synthesize returns a reply for the request in state, built from the cached denial records. It
+// returns nil if the records don't prove the name or type does not exist.
+func (a *aggressive) synthesize(state request.Request, now time.Time, do bool) *dns.Msg {
+	qname, qtype := state.Name(), state.QType()
+	if qtype == dns.TypeANY || qtype == dns.TypeRRSIG {
+		return nil
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+
+	// DS records live in the parent zone, so start looking for the zone there.
+	name := qname
+	if qtype == dns.TypeDS && name != "." {
+		name = name[dns.Split(name)[1]:]
+	}
+	var z *nsecZone
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if zz, ok := a.zones[name[off:]]; ok {
+			z = zz
+			break
+		}
+	}
+	if z == nil || z.soa == nil || !z.soa.expires.After(now) {
+		return nil
+	}
+
+	var used []*nsecEntry
+	if len(z.nsec) > 0 {
+		used = z.proofNSEC(qname, now)
+	} else {
+		used = z.proofNSEC3(qname, now)
+	}
+	if len(used) == 0 {
+		return nil
+	}
+
+	ns := make([]dns.RR, 0, len(used)+1)
+	for _, e := range used {
+		ns = append(ns, e.rr)
+	}
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	switch {
+	case denial.NameError(qname, ns):
+		m.Rcode = dns.RcodeNameError
+	case denial.NoData(qname, qtype, ns):
+	default:
+		return nil
+	}
+
+	expires := z.soa.expires
+	for _, e := range used {
+		if e.expires.Before(expires) {
+			expires = e.expires
+		}
+	}
+	ttl := uint32(expires.Sub(now).Seconds())
+
+	m.RecursionAvailable = true
+	m.AuthenticatedData = do
+	for _, e := range append([]*nsecEntry{z.soa}, used...) {
+		for _, r := range append([]dns.RR{e.rr}, e.sigs...) {
+			if !do && isDNSSEC(r) {
+				continue
+			}
+			// Copy before setting the TTL, other queries may use the same entries concurrently.
+			r = dns.Copy(r)
+			r.Header().Ttl = ttl
+			m.Ns = append(m.Ns, r)
+		}
+	}
+	return m
+}
+
+// proofNSEC returns the NSEC records that can prove qname, or a type at qname, does not exist: the NSEC
+// record that matches or covers qname, and the one that covers the wildcard at its closest encloser.
+func (z *nsecZone) proofNSEC(qname string, now time.Time) []*nsecEntry {
+	e := z.find(qname)
+	if e == nil || !e.expires.After(now) {
+		return nil
+	}
+	n := e.rr.(*dns.NSEC)
+	if below(qname, n.Hdr.Name, n.TypeBitMap) {
+		return nil
+	}
+	if !denial.Covers(n, qname) {
+		return []*nsecEntry{e}
+	}
+
+	w := z.find(denial.WildcardOf(denial.Encloser(qname, n)))
+	if w == nil || w == e || !w.expires.After(now) {
+		return []*nsecEntry{e}
+	}
+	return []*nsecEntry{e, w}
+}
+
+// find returns the NSEC record with the largest owner name that is not after name. This record matches
+// or covers name.
+func (z *nsecZone) find(name string) *nsecEntry {
+	i := sort.Search(len(z.nsec), func(i int) bool { return denial.Compare(z.nsec[i].rr.Header().Name, name) > 0 })
+	if i == 0 {
+		return nil
+	}
+	return z.nsec[i-1]
+}
+
+// proofNSEC3 returns the NSEC3 records that can prove qname, or a type at qname, does not exist: for
+// qname and each of its ancestors in the zone the records that match or cover it and its wildcard.
+func (z *nsecZone) proofNSEC3(qname string, now time.Time) []*nsecEntry {
+	if len(z.nsec3) == 0 {
+		return nil
+	}
+	p := z.nsec3[0].rr.(*dns.NSEC3)
+	zone := z.soa.rr.Header().Name
+
+	var used []*nsecEntry
+	seen := map[*nsecEntry]bool{}
+	add := func(name string) {
+		e := z.find3(strings.ToLower(dns.HashName(name, p.Hash, p.Iterations, p.Salt)))
+		if e.expires.After(now) && !seen[e] {
+			seen[e] = true
+			used = append(used, e)
+		}
+	}
+
+	for off, end := 0, false; !end; off, end = dns.NextLabel(qname, off) {
+		name := qname[off:]
+		if !dns.IsSubDomain(zone, name) {
+			break
+		}
+		add(name)
+		if name != qname {
+			add(denial.WildcardOf(name))
+		}
+	}
+
+	for _, e := range used {
+		n := e.rr.(*dns.NSEC3)
+		for off, end := dns.NextLabel(qname, 0); !end; off, end = dns.NextLabel(qname, off) {
+			if n.Match(qname[off:]) && below(qname, qname[off:], n.TypeBitMap) {
+				return nil
+			}
+		}
+	}
+	return used
+}
+
+// find3 returns the NSEC3 record with the largest hash that is not after h, or the last record when h is
+// before all of them. This record matches or covers h.
+func (z *nsecZone) find3(h string) *nsecEntry {
+	i := sort.Search(len(z.nsec3), func(i int) bool { return hashLabel(z.nsec3[i].rr.Header().Name) > h })
+	if i == 0 {
+		return z.nsec3[len(z.nsec3)-1]
+	}
+	return z.nsec3[i-1]
+}
+
+// below returns true if qname is below owner, and the bitmap of owner shows it is a delegation or a DNAME.
+// Then the names below owner are in another zone, or are redirected, and the record proves nothing about them.
+func below(qname, owner string, bitmap []uint16) bool {
+	if strings.EqualFold(qname, owner) || !dns.IsSubDomain(owner, qname) {
+		return false
+	}
+	delegation := denial.Has(bitmap, dns.TypeNS) && !denial.Has(bitmap, dns.TypeSOA)
+	return delegation || denial.Has(bitmap, dns.TypeDNAME)
+}
+
+// signatures returns the RRSIG records in rrs that cover r.
+func signatures(rrs []dns.RR, r dns.RR) []dns.RR {
+	var sigs []dns.RR
+	for _, s := range rrs {
+		if sig, ok := s.(*dns.RRSIG); ok && sig.TypeCovered == r.Header().Rrtype && strings.EqualFold(sig.Hdr.Name, r.Header().Name) {
+			sigs = append(sigs, dns.Copy(sig))
+		}
+	}
+	return sigs
+}
+
+// hashLabel returns the lowercased first label of the owner name of an NSEC3 record, the hash.
+func hashLabel(name string) string {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ToLower(name)
+}
+
+// defaultAggressiveCap is the default maximum number of cached NSEC and NSEC3 records.
+const defaultAggressiveCap = 10000
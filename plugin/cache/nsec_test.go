@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// The NSEC chain of example.org, sub.example.org is an unsigned delegation.
+var (
+	nsecSOA  = test.SOA("example.org. 3600 IN SOA ns.example.org. hostmaster.example.org. 1 3600 600 86400 300")
+	nsecApex = test.NSEC("example.org. 3600 IN NSEC a.example.org. NS SOA RRSIG NSEC DNSKEY")
+	nsecA    = test.NSEC("a.example.org. 3600 IN NSEC d.example.org. A RRSIG NSEC")
+	nsecD    = test.NSEC("d.example.org. 3600 IN NSEC sub.example.org. A RRSIG NSEC")
+	nsecSub  = test.NSEC("sub.example.org. 3600 IN NSEC example.org. NS RRSIG NSEC")
+)
+
+// nsecBackend answers like a validating resolver for the signed zone example.org. Its denial responses
+// carry the NSEC records that prove them.
+func nsecBackend(queries *int, ad bool) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*queries++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.RecursionAvailable, m.AuthenticatedData = true, ad
+
+		q := r.Question[0]
+		switch q.Name {
+		case "a.example.org.", "d.example.org.":
+			if q.Qtype == dns.TypeA {
+				m.Answer = []dns.RR{test.A(q.Name + " 3600 IN A 127.0.0.1")}
+				break
+			}
+			n := nsecA
+			if q.Name == "d.example.org." {
+				n = nsecD
+			}
+			m.Ns = []dns.RR{nsecSOA, n}
+		case "x.sub.example.org.":
+			m.AuthenticatedData = false
+			m.Answer = []dns.RR{test.A("x.sub.example.org. 3600 IN A 127.0.0.1")}
+		default:
+			m.Rcode = dns.RcodeNameError
+			m.Ns = []dns.RR{nsecSOA, test.RRSIG("example.org. 3600 IN RRSIG SOA 13 2 3600 20300101000000 20200101000000 12345 example.org. AAAA"),
+				nsecA, test.RRSIG("a.example.org. 3600 IN RRSIG NSEC 13 3 3600 20300101000000 20200101000000 12345 example.org. AAAA"),
+				nsecApex}
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func TestAggressiveNSEC(t *testing.T) {
+	queries := 0
+	c := New()
+	c.aggressive = newAggressive(defaultAggressiveCap)
+	c.Next = nsecBackend(&queries, true)
+
+	tests := []struct {
+		qname   string
+		qtype   uint16
+		do      bool
+		rcode   int
+		ns      int // number of records in the authority section
+		queries int // total number of queries seen by the backend
+	}{
+		{"b.example.org.", dns.TypeA, true, dns.RcodeNameError, 5, 1},
+		{"c.example.org.", dns.TypeA, true, dns.RcodeNameError, 5, 1},   // synthesized from the NSEC records of b
+		{"c.example.org.", dns.TypeMX, false, dns.RcodeNameError, 1, 1}, // without DO only the SOA record
+		{"a.example.org.", dns.TypeAAAA, true, dns.RcodeSuccess, 4, 1},  // no data at a, from its NSEC record
+		{"a.example.org.", dns.TypeA, true, dns.RcodeSuccess, 0, 2},
+		{"d.example.org.", dns.TypeAAAA, true, dns.RcodeSuccess, 2, 3}, // the NSEC record of d is not cached
+		{"x.sub.example.org.", dns.TypeA, true, dns.RcodeSuccess, 0, 4},
+		{"e.example.org.", dns.TypeA, true, dns.RcodeNameError, 3, 4}, // synthesized from the NSEC record of d
+		{"z.example.org.", dns.TypeA, true, dns.RcodeNameError, 5, 5}, // not covered by a cached NSEC record
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		if tc.do {
+			m.SetEdns0(4096, true)
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		seen := queries
+		c.ServeDNS(context.TODO(), rec, m)
+
+		// Replies not from the backend are synthesized, a cache is not authoritative for them.
+		if queries == seen && rec.Msg.Authoritative {
+			t.Errorf("Test %d: expected AA bit not to be set on a synthesized reply", i)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if len(rec.Msg.Ns) != tc.ns {
+			t.Errorf("Test %d: expected %d records in the authority section, got %d", i, tc.ns, len(rec.Msg.Ns))
+		}
+		if queries != tc.queries {
+			t.Errorf("Test %d: expected %d queries to the backend, got %d", i, tc.queries, queries)
+		}
+		if rec.Msg.AuthenticatedData != tc.do && tc.rcode == dns.RcodeNameError {
+			t.Errorf("Test %d: expected AD bit %t", i, tc.do)
+		}
+	}
+}
+
+func TestAggressiveNSECUnvalidated(t *testing.T) {
+	queries := 0
+	c := New()
+	c.aggressive = newAggressive(defaultAggressiveCap)
+	c.Next = nsecBackend(&queries, false)
+
+	for _, qname := range []string{"b.example.org.", "c.example.org."} {
+		m := new(dns.Msg)
+		m.SetQuestion(qname, dns.TypeA)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m)
+	}
+	if queries != 2 {
+		t.Errorf("Expected unvalidated denial records not to be used, got %d queries to the backend", queries)
+	}
+}
+
+func TestAggressiveDelegation(t *testing.T) {
+	now := time.Now()
+	a := newAggressive(defaultAggressiveCap)
+	m := new(dns.Msg)
+	m.AuthenticatedData = true
+	m.Ns = []dns.RR{nsecSOA, nsecApex, nsecA, nsecD, nsecSub}
+	a.add(m, now, maxNTTL)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int // -1 when no reply can be synthesized
+	}{
+		{"sub.example.org.", dns.TypeDS, dns.RcodeSuccess},
+		{"sub.example.org.", dns.TypeA, -1}, // a referral, not no data
+		{"x.sub.example.org.", dns.TypeA, -1},
+		{"b.example.org.", dns.TypeA, dns.RcodeNameError},
+		{"www.example.net.", dns.TypeA, -1},
+	}
+	for i, tc := range tests {
+		m := a.synthesize(nsecRequest(tc.qname, tc.qtype), now, true)
+		switch {
+		case tc.rcode == -1 && m != nil:
+			t.Errorf("Test %d: expected no reply, got %s", i, dns.RcodeToString[m.Rcode])
+		case tc.rcode >= 0 && m == nil:
+			t.Errorf("Test %d: expected %s reply, got none", i, dns.RcodeToString[tc.rcode])
+		case tc.rcode >= 0 && m.Rcode != tc.rcode:
+			t.Errorf("Test %d: expected %s reply, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[m.Rcode])
+		}
+	}
+
+	// The records expire with the SOA minimum.
+	if m := a.synthesize(nsecRequest("b.example.org.", dns.TypeA), now.Add(301*time.Second), true); m != nil {
+		t.Errorf("Expected no reply after the records expired")
+	}
+}
+
+func TestAggressiveNSEC3(t *testing.T) {
+	apex, www := hashName("example.org."), hashName("www.example.org.")
+	nsec3 := func(owner, next string, flags uint8, types ...uint16) *dns.NSEC3 {
+		return &dns.NSEC3{Hdr: dns.RR_Header{Name: owner + ".example.org.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 3600},
+			Hash: dns.SHA1, Flags: flags, NextDomain: next, TypeBitMap: types}
+	}
+
+	now := time.Now()
+	for _, flags := range []uint8{0, 1} {
+		a := newAggressive(defaultAggressiveCap)
+		m := new(dns.Msg)
+		m.AuthenticatedData = true
+		m.Ns = []dns.RR{nsecSOA,
+			nsec3(apex, www, flags, dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM),
+			nsec3(www, apex, flags, dns.TypeA, dns.TypeRRSIG)}
+		a.add(m, now, maxNTTL)
+
+		nx := a.synthesize(nsecRequest("nope.example.org.", dns.TypeA), now, true)
+		nodata := a.synthesize(nsecRequest("www.example.org.", dns.TypeAAAA), now, true)
+		if flags == 1 {
+			if nx != nil || nodata != nil {
+				t.Errorf("Expected opt-out NSEC3 records not to be used")
+			}
+			continue
+		}
+		if nx == nil || nx.Rcode != dns.RcodeNameError || nx.Authoritative {
+			t.Errorf("Expected non authoritative NXDOMAIN for nope.example.org.")
+		}
+		if nodata == nil || nodata.Rcode != dns.RcodeSuccess || len(nodata.Answer) != 0 {
+			t.Errorf("Expected NODATA for www.example.org. AAAA")
+		}
+		if m := a.synthesize(nsecRequest("www.example.org.", dns.TypeA), now, true); m != nil {
+			t.Errorf("Expected no reply for an existing name and type")
+		}
+	}
+}
+
+func TestAggressiveCapacity(t *testing.T) {
+	now := time.Now()
+	a := newAggressive(2)
+	m := new(dns.Msg)
+	m.AuthenticatedData = true
+	m.Ns = []dns.RR{nsecSOA, nsecApex, nsecA, nsecD}
+	a.add(m, now, maxNTTL)
+	if a.size != 2 {
+		t.Fatalf("Expected 2 records, got %d", a.size)
+	}
+
+	// Expired records make room for new ones.
+	m.Ns = []dns.RR{nsecSOA, nsecSub}
+	a.add(m, now.Add(301*time.Second), maxNTTL)
+	if a.size != 1 || len(a.zones["example.org."].nsec) != 1 {
+		t.Errorf("Expected 1 record after the expired ones were purged, got %d", a.size)
+	}
+}
+
+func hashName(name string) string { return dns.HashName(name, dns.SHA1, 0, "") }
+
+func nsecRequest(qname string, qtype uint16) request.Request {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	return request.Request{W: &test.ResponseWriter{}, Req: m}
+}
@@ -3,6 +3,8 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"net"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +25,20 @@ func setup(c *caddy.Controller) error {
 	if err != nil {
 		return plugin.Error("cache", err)
 	}
+	if ca.snapshot != nil {
+		c.OnStartup(func() error {
+			ca.startSnapshot()
+			return nil
+		})
+		c.OnShutdown(func() error {
+			ca.stopSnapshot()
+			return nil
+		})
+	}
+	if ca.adminAddr != "" {
+		c.OnStartup(ca.startAdmin)
+		c.OnShutdown(ca.stopAdmin)
+	}
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		ca.Next = next
 		return ca
@@ -166,11 +182,11 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 
 			case "serve_stale":
 				args := c.RemainingArgs()
-				if len(args) > 1 {
+				if len(args) > 2 {
 					return nil, c.ArgErr()
 				}
 				ca.staleUpTo = 1 * time.Hour
-				if len(args) == 1 {
+				if len(args) > 0 {
 					d, err := time.ParseDuration(args[0])
 					if err != nil {
 						return nil, err
@@ -180,6 +196,91 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 					}
 					ca.staleUpTo = d
 				}
+				ca.verifyStale = false
+				if len(args) > 1 {
+					switch mode := args[1]; mode {
+					case "immediate":
+					case "verify":
+						ca.verifyStale = true
+					default:
+						return nil, fmt.Errorf("invalid refresh mode '%s' for serve_stale", mode)
+					}
+				}
+			case "snapshot":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ca.snapshot = &snapshot{path: args[0], interval: defaultSnapshotInterval}
+				if !filepath.IsAbs(ca.snapshot.path) && dnsserver.GetConfig(c).Root != "" {
+					ca.snapshot.path = filepath.Join(dnsserver.GetConfig(c).Root, ca.snapshot.path)
+				}
+				if len(args) > 1 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if d < 0 {
+						return nil, errors.New("invalid negative interval for snapshot")
+					}
+					ca.snapshot.interval = d
+				}
+			case "ecs":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				ca.ecs = true
+				ca.ecsMax = defaultECSSubnets
+				if len(args) > 0 {
+					max, err := strconv.Atoi(args[0])
+					if err != nil {
+						return nil, err
+					}
+					if max <= 0 {
+						return nil, fmt.Errorf("ecs maximum subnets should be positive: %d", max)
+					}
+					ca.ecsMax = max
+				}
+			case "admin":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				ca.adminAddr = defaultAdminAddr
+				if len(args) > 0 {
+					if _, _, err := net.SplitHostPort(args[0]); err != nil {
+						return nil, err
+					}
+					ca.adminAddr = args[0]
+				}
+			case "eviction":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				policy, err := cache.ParsePolicy(args[0])
+				if err != nil {
+					return nil, err
+				}
+				ca.policy = policy
+			case "aggressive_nsec":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				max := defaultAggressiveCap
+				if len(args) > 0 {
+					n, err := strconv.Atoi(args[0])
+					if err != nil {
+						return nil, err
+					}
+					if n <= 0 {
+						return nil, fmt.Errorf("aggressive_nsec capacity should be positive: %d", n)
+					}
+					max = n
+				}
+				ca.aggressive = newAggressive(max)
 			default:
 				return nil, c.ArgErr()
 			}
@@ -187,8 +288,11 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 
 		ca.Zones = origins
 		ca.zonesMetricLabel = strings.Join(origins, ",")
-		ca.pcache = cache.New(ca.pcap)
-		ca.ncache = cache.New(ca.ncap)
+		ca.pcache = cache.NewWithPolicy(ca.pcap, ca.policy)
+		ca.ncache = cache.NewWithPolicy(ca.ncap, ca.policy)
+		if ca.ecs {
+			ca.subnets = cache.New(ca.pcap)
+		}
 	}
 
 	return ca, nil
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/cache"
 )
 
 func TestSetup(t *testing.T) {
@@ -117,20 +118,24 @@ func TestSetup(t *testing.T) {
 
 func TestServeStale(t *testing.T) {
 	tests := []struct {
-		input     string
-		shouldErr bool
-		staleUpTo time.Duration
+		input       string
+		shouldErr   bool
+		staleUpTo   time.Duration
+		verifyStale bool
 	}{
-		{"serve_stale", false, 1 * time.Hour},
-		{"serve_stale 20m", false, 20 * time.Minute},
-		{"serve_stale 1h20m", false, 80 * time.Minute},
-		{"serve_stale 0m", false, 0},
-		{"serve_stale 0", false, 0},
+		{"serve_stale", false, 1 * time.Hour, false},
+		{"serve_stale 20m", false, 20 * time.Minute, false},
+		{"serve_stale 1h20m", false, 80 * time.Minute, false},
+		{"serve_stale 0m", false, 0, false},
+		{"serve_stale 0", false, 0, false},
+		{"serve_stale 1m immediate", false, time.Minute, false},
+		{"serve_stale 1m verify", false, time.Minute, true},
 		// fails
-		{"serve_stale 20", true, 0},
-		{"serve_stale -20m", true, 0},
-		{"serve_stale aa", true, 0},
-		{"serve_stale 1m nono", true, 0},
+		{"serve_stale 20", true, 0, false},
+		{"serve_stale -20m", true, 0, false},
+		{"serve_stale aa", true, 0, false},
+		{"serve_stale 1m nono", true, 0, false},
+		{"serve_stale 1m verify 2", true, 0, false},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
@@ -148,5 +153,185 @@ func TestServeStale(t *testing.T) {
 		if ca.staleUpTo != test.staleUpTo {
 			t.Errorf("Test %v: Expected stale %v but found: %v", i, test.staleUpTo, ca.staleUpTo)
 		}
+		if ca.verifyStale != test.verifyStale {
+			t.Errorf("Test %v: Expected verify stale %t but found: %t", i, test.verifyStale, ca.verifyStale)
+		}
+	}
+}
+
+func TestSetupSnapshot(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		path      string
+		interval  time.Duration
+	}{
+		{"snapshot /var/lib/coredns/cache", false, "/var/lib/coredns/cache", defaultSnapshotInterval},
+		{"snapshot /var/lib/coredns/cache 1m", false, "/var/lib/coredns/cache", time.Minute},
+		{"snapshot /var/lib/coredns/cache 0", false, "/var/lib/coredns/cache", 0},
+		// fails
+		{"snapshot", true, "", 0},
+		{"snapshot /var/lib/coredns/cache 1", true, "", 0},
+		{"snapshot /var/lib/coredns/cache -1m", true, "", 0},
+		{"snapshot /var/lib/coredns/cache 1m 2", true, "", 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if ca.snapshot.path != test.path {
+			t.Errorf("Test %v: Expected snapshot path %s but found: %s", i, test.path, ca.snapshot.path)
+		}
+		if ca.snapshot.interval != test.interval {
+			t.Errorf("Test %v: Expected snapshot interval %v but found: %v", i, test.interval, ca.snapshot.interval)
+		}
+	}
+}
+
+func TestSetupECS(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		ecsMax    int
+	}{
+		{"ecs", false, defaultECSSubnets},
+		{"ecs 10", false, 10},
+		// fails
+		{"ecs 0", true, 0},
+		{"ecs x", true, 0},
+		{"ecs 10 20", true, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if !ca.ecs || ca.subnets == nil {
+			t.Errorf("Test %v: Expected ecs to be enabled", i)
+		}
+		if ca.ecsMax != test.ecsMax {
+			t.Errorf("Test %v: Expected ecs maximum %d but found: %d", i, test.ecsMax, ca.ecsMax)
+		}
+	}
+}
+
+func TestSetupAdmin(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		addr      string
+	}{
+		{"admin", false, defaultAdminAddr},
+		{"admin localhost:8080", false, "localhost:8080"},
+		// fails
+		{"admin localhost", true, ""},
+		{"admin localhost:8080 localhost:8081", true, ""},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if ca.adminAddr != test.addr {
+			t.Errorf("Test %v: Expected admin address %s but found: %s", i, test.addr, ca.adminAddr)
+		}
+	}
+}
+
+func TestSetupEviction(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		policy    cache.Policy
+	}{
+		{"", false, cache.Random},
+		{"eviction random", false, cache.Random},
+		{"eviction lru", false, cache.LRU},
+		{"eviction tinylfu", false, cache.TinyLFU},
+		// fails
+		{"eviction", true, cache.Random},
+		{"eviction fifo", true, cache.Random},
+		{"eviction lru tinylfu", true, cache.Random},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if ca.policy != test.policy {
+			t.Errorf("Test %v: Expected policy %s but found: %s", i, test.policy, ca.policy)
+		}
+	}
+}
+
+func TestSetupAggressiveNSEC(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		max       int
+	}{
+		{"", false, 0},
+		{"aggressive_nsec", false, defaultAggressiveCap},
+		{"aggressive_nsec 500", false, 500},
+		// fails
+		{"aggressive_nsec 0", true, 0},
+		{"aggressive_nsec many", true, 0},
+		{"aggressive_nsec 500 600", true, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if test.max == 0 {
+			if ca.aggressive != nil {
+				t.Errorf("Test %v: Expected aggressive_nsec to be disabled", i)
+			}
+			continue
+		}
+		if ca.aggressive == nil || ca.aggressive.max != test.max {
+			t.Errorf("Test %v: Expected aggressive_nsec with capacity %d", i, test.max)
+		}
 	}
 }
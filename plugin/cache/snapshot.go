@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+// snapshot periodically saves the items in the cache to a file, so that a restarted server starts
+// with a warm cache.
+type snapshot struct {
+	path     string
+	interval time.Duration // when zero, a snapshot is only saved on shutdown
+	stop     chan struct{}
+}
+
+// snapshotItem is how an item is stored in the snapshot file.
+type snapshotItem struct {
+	Key     uint64
+	Denial  bool // item is from the denial cache
+	OrigTTL uint32
+	Stored  time.Time
+	Msg     []byte // the item as a packed message
+}
+
+// snapshotVersion is written at the start of the snapshot file, a file with another version is ignored.
+const snapshotVersion = 1
+
+// startSnapshot loads the snapshot, if it exists, and starts saving new ones.
+func (c *Cache) startSnapshot() {
+	pn, nn, err := c.loadSnapshot()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		log.Warningf("Failed to load cache snapshot %s: %s", c.snapshot.path, err)
+	default:
+		log.Infof("Restored %d success and %d denial items from cache snapshot %s", pn, nn, c.snapshot.path)
+	}
+
+	c.snapshot.stop = make(chan struct{})
+	if c.snapshot.interval == 0 {
+		return
+	}
+	go func() {
+		tick := time.NewTicker(c.snapshot.interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-c.snapshot.stop:
+				return
+			case <-tick.C:
+				if err := c.saveSnapshot(); err != nil {
+					log.Warningf("Failed to save cache snapshot %s: %s", c.snapshot.path, err)
+				}
+			}
+		}
+	}()
+}
+
+// stopSnapshot stops saving snapshots and saves a final one.
+func (c *Cache) stopSnapshot() {
+	if c.snapshot.stop != nil {
+		close(c.snapshot.stop)
+		c.snapshot.stop = nil
+	}
+	if err := c.saveSnapshot(); err != nil {
+		log.Warningf("Failed to save cache snapshot %s: %s", c.snapshot.path, err)
+	}
+}
+
+// saveSnapshot writes all items that can still be served to the snapshot file. The file is replaced
+// atomically.
+func (c *Cache) saveSnapshot() error {
+	now := c.now().UTC()
+	items := c.snapshotItems(c.pcache, false, now)
+	items = append(items, c.snapshotItems(c.ncache, true, now)...)
+
+	f, err := os.CreateTemp(filepath.Dir(c.snapshot.path), filepath.Base(c.snapshot.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	err = enc.Encode(snapshotVersion)
+	for i := 0; i < len(items) && err == nil; i++ {
+		err = enc.Encode(&items[i])
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.snapshot.path)
+}
+
+// snapshotItems returns the items in ca that are not expired, or that can still be served stale.
+func (c *Cache) snapshotItems(ca *cache.Cache, denial bool, now time.Time) []snapshotItem {
+	items := []snapshotItem{}
+	ca.Walk(func(m map[uint64]interface{}, key uint64) bool {
+		el, ok := m[key]
+		if !ok {
+			return true
+		}
+		i := el.(*item)
+		// Items for a client subnet can't be found without the subnets they are cached under.
+		if c.expired(i, now) || i.scope > 0 {
+			return true
+		}
+		buf, err := i.pack()
+		if err != nil {
+			return true
+		}
+		items = append(items, snapshotItem{Key: key, Denial: denial, OrigTTL: i.origTTL, Stored: i.stored, Msg: buf})
+		return true
+	})
+	return items
+}
+
+// loadSnapshot adds the items from the snapshot file to the cache, expired items are discarded. It
+// returns the number of success and denial items added.
+func (c *Cache) loadSnapshot() (pn, nn int, err error) {
+	f, err := os.Open(c.snapshot.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	version := 0
+	if err := dec.Decode(&version); err != nil {
+		return 0, 0, err
+	}
+	if version != snapshotVersion {
+		return 0, 0, fmt.Errorf("unsupported version %d", version)
+	}
+
+	now := c.now().UTC()
+	for {
+		s := snapshotItem{}
+		if err := dec.Decode(&s); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return pn, nn, err
+		}
+		m := new(dns.Msg)
+		if err := m.Unpack(s.Msg); err != nil {
+			continue
+		}
+		i := newItem(m, s.Stored, time.Duration(s.OrigTTL)*time.Second)
+		if c.expired(i, now) {
+			continue
+		}
+		if s.Denial {
+			c.ncache.Add(s.Key, i)
+			nn++
+			continue
+		}
+		c.pcache.Add(s.Key, i)
+		pn++
+	}
+
+	snapshotRestored.WithLabelValues(Success, c.zonesMetricLabel).Add(float64(pn))
+	snapshotRestored.WithLabelValues(Denial, c.zonesMetricLabel).Add(float64(nn))
+	return pn, nn, nil
+}
+
+// expired returns true if i can't be served anymore, not even as a stale item.
+func (c *Cache) expired(i *item, now time.Time) bool {
+	return i.ttl(now)+int(c.staleUpTo.Seconds()) <= 0
+}
+
+// pack returns i as a packed message.
+func (i *item) pack() ([]byte, error) {
+	m := new(dns.Msg)
+	if i.Name != "" {
+		m.Question = []dns.Question{{Name: i.Name, Qtype: i.QType, Qclass: dns.ClassINET}}
+	}
+	m.Rcode = i.Rcode
+	m.AuthenticatedData = i.AuthenticatedData
+	m.RecursionAvailable = i.RecursionAvailable
+	m.Answer = i.Answer
+	m.Ns = i.Ns
+	m.Extra = i.Extra
+	return m.Pack()
+}
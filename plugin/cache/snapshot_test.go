@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+
+	c := New()
+	c.snapshot = &snapshot{path: path}
+	for _, tc := range []struct {
+		qname string
+		ttl   int
+	}{
+		{"long.example.org.", 3600},
+		{"short.example.org.", 10},
+	} {
+		c.Next = ttlBackend(tc.ttl)
+		req := new(dns.Msg)
+		req.SetQuestion(tc.qname, dns.TypeA)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	}
+	if c.pcache.Len() != 2 {
+		t.Fatalf("Expected 2 items in the cache, got %d", c.pcache.Len())
+	}
+	if err := c.saveSnapshot(); err != nil {
+		t.Fatalf("Failed to save snapshot: %s", err)
+	}
+
+	// Restore in a new cache 30s later, the short item has expired by then.
+	c = New()
+	c.snapshot = &snapshot{path: path}
+	c.now = func() time.Time { return time.Now().Add(30 * time.Second) }
+	c.Next = test.ErrorHandler()
+	pn, nn, err := c.loadSnapshot()
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %s", err)
+	}
+	if pn != 1 || nn != 0 {
+		t.Fatalf("Expected 1 success and 0 denial items, got %d and %d", pn, nn)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("long.example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	c.ServeDNS(context.TODO(), rec, req)
+	if rec.Msg == nil || rec.Msg.Rcode != dns.RcodeSuccess || len(rec.Msg.Answer) != 1 {
+		t.Fatalf("Expected the restored item to be served, got %v", rec.Msg)
+	}
+	if ttl := rec.Msg.Answer[0].Header().Ttl; ttl > 3570 || ttl < 3560 {
+		t.Errorf("Expected the TTL of the restored item to be about 3570, got %d", ttl)
+	}
+}
+
+func TestSnapshotStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+
+	c := New()
+	c.snapshot = &snapshot{path: path}
+	c.Next = ttlBackend(10)
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+	c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	if err := c.saveSnapshot(); err != nil {
+		t.Fatalf("Failed to save snapshot: %s", err)
+	}
+
+	// An expired item is kept when it can still be served stale.
+	c = New()
+	c.snapshot = &snapshot{path: path}
+	c.staleUpTo = time.Hour
+	c.now = func() time.Time { return time.Now().Add(time.Minute) }
+	if pn, _, err := c.loadSnapshot(); err != nil || pn != 1 {
+		t.Fatalf("Expected 1 restored item, got %d: %v", pn, err)
+	}
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gob.NewEncoder(f).Encode(snapshotVersion + 1)
+	f.Close()
+
+	c := New()
+	c.snapshot = &snapshot{path: path}
+	if _, _, err := c.loadSnapshot(); err == nil {
+		t.Errorf("Expected error for unsupported snapshot version")
+	}
+}
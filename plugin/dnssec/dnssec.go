@@ -42,53 +42,71 @@ func New(zones []string, keys []*DNSKEY, splitkeys bool, next plugin.Handler, c
 // Signatures will be cached for a short while. By default we sign for 8 days,
 // starting 3 hours ago.
 func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.Msg {
+	m, _ := d.signMsg(state, now, server)
+	return m
+}
+
+// signMsg is Sign, but it also returns the last error encountered while signing. The message is
+// returned with all signatures that could be made.
+func (d Dnssec) signMsg(state request.Request, now time.Time, server string) (*dns.Msg, error) {
+	var signErr error
 	req := state.Req
 
 	incep, expir := incepExpir(now)
 
 	mt, _ := response.Typify(req, time.Now().UTC()) // TODO(miek): need opt record here?
 	if mt == response.Delegation {
-		return req
+		return req, nil
 	}
 
 	if mt == response.NameError || mt == response.NoData {
 		if req.Ns[0].Header().Rrtype != dns.TypeSOA || len(req.Ns) > 1 {
-			return req
+			return req, nil
 		}
 
 		ttl := req.Ns[0].Header().Ttl
 
 		if sigs, err := d.sign(req.Ns, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
+		} else {
+			signErr = err
 		}
 		if sigs, err := d.nsec(state, mt, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
+		} else {
+			signErr = err
 		}
 		if len(req.Ns) > 1 { // actually added nsec and sigs, reset the rcode
 			req.Rcode = dns.RcodeSuccess
 		}
-		return req
+		return req, signErr
 	}
 
 	for _, r := range rrSets(req.Answer) {
 		ttl := r[0].Header().Ttl
 		if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Answer = append(req.Answer, sigs...)
+		} else {
+			signErr = err
 		}
 	}
 	for _, r := range rrSets(req.Ns) {
 		ttl := r[0].Header().Ttl
 		if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
+		} else {
+			signErr = err
 		}
 	}
 	for _, r := range rrSets(req.Extra) {
 		ttl := r[0].Header().Ttl
 		if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Extra = append(req.Extra, sigs...)
+		} else {
+			signErr = err
 		}
 	}
-	return req
+	return req, signErr
 }
 
 func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
@@ -39,7 +39,7 @@ func (d Dnssec) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	}
 
 	if do {
-		drr := &ResponseWriter{w, d, server}
+		drr := &ResponseWriter{w, d, server, r}
 		return plugin.NextOrFailure(d.Name(), d.Next, ctx, drr, r)
 	}
 
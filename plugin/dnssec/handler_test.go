@@ -161,6 +161,39 @@ func TestLookupDNSKEY(t *testing.T) {
 	}
 }
 
+func TestSignFailureExtendedError(t *testing.T) {
+	dnskey, rm1, rm2 := newKey(t)
+	defer rm1()
+	defer rm2()
+	dnskey.s = nil // without a private key every signing attempt fails
+
+	c := cache.New(defaultCap)
+	next := test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{test.MX("miek.nl.	1800	IN	MX	1 aspmx.l.google.com.")}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+	dh := New([]string{"miek.nl."}, []*DNSKEY{dnskey}, false, next, c)
+
+	m := new(dns.Msg)
+	m.SetQuestion("miek.nl.", dns.TypeMX)
+	m.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := dh.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	o := rec.Msg.IsEdns0()
+	if o == nil || len(o.Option) != 1 {
+		t.Fatalf("Expected one EDNS0 option in the reply, got %v", o)
+	}
+	if ede, ok := o.Option[0].(*dns.EDNS0_EDE); !ok || ede.InfoCode != dns.ExtendedErrorCodeRRSIGsMissing {
+		t.Errorf("Expected RRSIGs Missing extended error, got %v", o.Option[0])
+	}
+}
+
 const dbMiekNL = `
 $TTL    30M
 $ORIGIN miek.nl.
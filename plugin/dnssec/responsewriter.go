@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -13,7 +14,8 @@ import (
 type ResponseWriter struct {
 	dns.ResponseWriter
 	d      Dnssec
-	server string // server label for metrics.
+	server string   // server label for metrics.
+	req    *dns.Msg // original request
 }
 
 // WriteMsg implements the dns.ResponseWriter interface.
@@ -28,8 +30,12 @@ func (d *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	}
 	state.Zone = zone
 
-	res = d.d.Sign(state, time.Now().UTC(), d.server)
+	res, err := d.d.signMsg(state, time.Now().UTC(), d.server)
 	cacheSize.WithLabelValues(d.server, "signature").Set(float64(d.d.cache.Len()))
+	if err != nil {
+		log.Errorf("Failed to sign response for %s: %s", state.Name(), err)
+		edns.SetExtendedError(d.req, res, dns.ExtendedErrorCodeRRSIGsMissing, "signing failed")
+	}
 	// No need for EDNS0 trickery, as that is handled by the server.
 
 	return d.ResponseWriter.WriteMsg(res)
@@ -14,10 +14,12 @@ type encoder struct {
 	fs *fs.Encoder
 }
 
-func newEncoder(w io.Writer, timeout time.Duration) (*encoder, error) {
+// newEncoder returns an encoder that writes to w. Bidirectional is true for a connection, where the
+// Frame Streams handshake is done with the other side, and false for a file.
+func newEncoder(w io.Writer, timeout time.Duration, bidirectional bool) (*encoder, error) {
 	fs, err := fs.NewEncoder(w, &fs.EncoderOptions{
 		ContentType:   []byte("protobuf:dnstap.Dnstap"),
-		Bidirectional: true,
+		Bidirectional: bidirectional,
 		Timeout:       timeout,
 	})
 	if err != nil {
@@ -0,0 +1,216 @@
+package dnstap
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rotation configures when a dnstap file is rotated, and what happens with the rotated files.
+type rotation struct {
+	size     int64         // rotate when the file has grown to size bytes, 0 disables this
+	interval time.Duration // rotate when the file has been open for interval, 0 disables this
+	keep     int           // number of rotated files to keep, 0 keeps all of them
+	compress bool          // gzip rotated files
+}
+
+// tapFile is a dnstap file that keeps track of its size.
+type tapFile struct {
+	*os.File
+	size   int64
+	opened time.Time
+}
+
+func (f *tapFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// On a reload the old instance stops writing its dnstap files before the new instance opens them. A file
+// that the new Corefile still uses is handed over while it is open, so it isn't rotated and the Frame
+// Stream just continues. The files the new Corefile doesn't use anymore are closed when it starts.
+var (
+	reloadMu   sync.Mutex
+	handedOver = map[string]*handover{} // open files of the old instance, by path
+	configured = map[string]bool{}      // paths of the files of the current instance
+)
+
+// handover is an open dnstap file with its encoder.
+type handover struct {
+	file *tapFile
+	enc  *encoder
+}
+
+// configure records that path is used by the instance being set up.
+func configure(path string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	configured[path] = true
+}
+
+// reload forgets the paths of the current instance, the instance that replaces it records its own.
+func reload() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	configured = map[string]bool{}
+}
+
+// sweep closes the handed over files that the current instance doesn't use.
+func sweep() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	for path, h := range handedOver {
+		if configured[path] {
+			continue
+		}
+		h.enc.close()
+		h.file.Close()
+		delete(handedOver, path)
+	}
+}
+
+// handOver flushes the dnstap file and leaves it open for the instance that replaces this one.
+func (d *dio) handOver() {
+	d.enc.flush()
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	handedOver[d.endpoint] = &handover{file: d.file, enc: d.enc}
+	d.file, d.enc = nil, nil
+}
+
+// takeOver returns the dnstap file that was handed over for path, or nil if there is none.
+func takeOver(path string) *handover {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	h := handedOver[path]
+	delete(handedOver, path)
+	return h
+}
+
+// open opens a new dnstap file, or continues with the file handed over by the previous instance. A file
+// left by a previous run is rotated first, as a Frame Streams file can't be appended to.
+func (d *dio) open() error {
+	if h := takeOver(d.endpoint); h != nil {
+		d.file, d.enc = h.file, h.enc
+		return nil
+	}
+	if _, err := os.Stat(d.endpoint); err == nil {
+		if err := d.archive(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(d.endpoint, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	d.file = &tapFile{File: f, opened: time.Now()}
+	d.enc, err = newEncoder(d.file, 0, false)
+	if err != nil {
+		d.file.Close()
+		d.file = nil
+	}
+	return err
+}
+
+// shouldRotate returns true if the dnstap file has reached its maximum size or age.
+func (d *dio) shouldRotate(now time.Time) bool {
+	if d.file == nil {
+		return false
+	}
+	if d.rotation.size > 0 && d.file.size >= d.rotation.size {
+		return true
+	}
+	return d.rotation.interval > 0 && now.Sub(d.file.opened) >= d.rotation.interval
+}
+
+// rotate closes the dnstap file, archives it and opens a new one.
+func (d *dio) rotate() error {
+	d.closeFile()
+	return d.open()
+}
+
+// closeFile flushes and closes the dnstap file.
+func (d *dio) closeFile() {
+	if d.enc != nil {
+		d.enc.flush()
+		d.enc.close()
+		d.enc = nil
+	}
+	if d.file != nil {
+		d.file.Close()
+		d.file = nil
+	}
+}
+
+// archive renames the dnstap file, adding the current time as a suffix. Compressing the file and removing
+// old files is done in the background.
+func (d *dio) archive() error {
+	name := d.endpoint + "." + time.Now().UTC().Format(archiveFormat)
+	if err := os.Rename(d.endpoint, name); err != nil {
+		return err
+	}
+	go func() {
+		if d.rotation.compress {
+			if err := compress(name); err != nil {
+				log.Warningf("Failed to compress dnstap file %s: %s", name, err)
+			}
+		}
+		d.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest archived dnstap files, so that at most rotation.keep remain.
+func (d *dio) prune() {
+	if d.rotation.keep <= 0 {
+		return
+	}
+	files, err := filepath.Glob(d.endpoint + ".*")
+	if err != nil {
+		return
+	}
+	// The names end with the time they were archived, so sorting them sorts them on age.
+	sort.Strings(files)
+	for len(files) > d.rotation.keep {
+		if err := os.Remove(files[0]); err != nil && !os.IsNotExist(err) {
+			log.Warningf("Failed to remove dnstap file %s: %s", files[0], err)
+		}
+		files = files[1:]
+	}
+}
+
+// compress replaces the file name with a gzipped copy, name.gz.
+func compress(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if e := zw.Close(); err == nil {
+		err = e
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Remove(name)
+}
+
+// archiveFormat is the time format of the suffix of archived dnstap files.
+const archiveFormat = "20060102T150405.000"
@@ -0,0 +1,203 @@
+package dnstap
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	fs "github.com/farsightsec/golang-framestream"
+	"google.golang.org/protobuf/proto"
+)
+
+// decodeFile returns the dnstap messages in the Frame Streams file name, which may be gzipped.
+func decodeFile(t *testing.T, name string) []*tap.Dnstap {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec, err := fs.NewDecoder(r, &fs.DecoderOptions{ContentType: []byte("protobuf:dnstap.Dnstap")})
+	if err != nil {
+		t.Fatalf("Failed to read %s: %s", name, err)
+	}
+	msgs := []*tap.Dnstap{}
+	for {
+		buf, err := dec.Decode()
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %s", name, err)
+		}
+		m := &tap.Dnstap{}
+		if err := proto.Unmarshal(buf, m); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+func TestFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "tap")
+	dio := newIO("file", name)
+	dio.flushTimeout = 10 * time.Millisecond
+	if err := dio.connect(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		dio.Dnstap(tmsg, nil)
+	}
+	time.Sleep(50 * time.Millisecond)
+	dio.close()
+
+	if msgs := decodeFile(t, name); len(msgs) != 3 {
+		t.Errorf("Expected 3 messages, got %d", len(msgs))
+	}
+
+	// A new dio rotates the existing file out of the way.
+	dio = newIO("file", name)
+	if err := dio.connect(); err != nil {
+		t.Fatal(err)
+	}
+	dio.Dnstap(tmsg, nil)
+	time.Sleep(10 * time.Millisecond)
+	dio.close()
+
+	files, _ := filepath.Glob(name + ".*")
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 rotated file, got %d", len(files))
+	}
+	if msgs := decodeFile(t, files[0]); len(msgs) != 3 {
+		t.Errorf("Expected 3 messages in the rotated file, got %d", len(msgs))
+	}
+	if msgs := decodeFile(t, name); len(msgs) != 1 {
+		t.Errorf("Expected 1 message, got %d", len(msgs))
+	}
+}
+
+func TestFileRotate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "tap")
+	dio := newIO("file", name)
+	dio.rotation = rotation{size: 1, keep: 2, compress: true}
+	if err := dio.connect(); err != nil {
+		t.Fatal(err)
+	}
+	// Every message is written to its own file, as the size of each file exceeds 1 byte.
+	for i := 0; i < 5; i++ {
+		dio.Dnstap(tmsg, nil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	dio.close()
+
+	// Compressing and pruning happens in the background.
+	var files []string
+	for i := 0; i < 50; i++ {
+		files, _ = filepath.Glob(name + ".*")
+		if len(files) == 2 && strings.HasSuffix(files[0], ".gz") && strings.HasSuffix(files[1], ".gz") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 rotated files, got %v", files)
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".gz") {
+			t.Errorf("Expected rotated file %s to be compressed", f)
+			continue
+		}
+		if msgs := decodeFile(t, f); len(msgs) != 1 {
+			t.Errorf("Expected 1 message in %s, got %d", f, len(msgs))
+		}
+	}
+}
+
+func TestFileReload(t *testing.T) {
+	dir := t.TempDir()
+	name, gone := filepath.Join(dir, "tap"), filepath.Join(dir, "gone")
+	reload()
+	configure(name)
+	configure(gone)
+
+	old := newIO("file", name)
+	oldGone := newIO("file", gone)
+	for _, d := range []*dio{old, oldGone} {
+		if err := d.connect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		old.Dnstap(tmsg, nil)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// The new Corefile only uses name.
+	reload()
+	old.release()
+	oldGone.release()
+	configure(name)
+	sweep()
+	if len(handedOver) != 1 {
+		t.Fatalf("Expected 1 handed over file, got %d", len(handedOver))
+	}
+
+	d := newIO("file", name)
+	if err := d.connect(); err != nil {
+		t.Fatal(err)
+	}
+	d.Dnstap(tmsg, nil)
+	time.Sleep(10 * time.Millisecond)
+	d.close()
+
+	if files, _ := filepath.Glob(name + ".*"); len(files) != 0 {
+		t.Errorf("Expected no rotated files after a reload, got %v", files)
+	}
+	if msgs := decodeFile(t, name); len(msgs) != 3 {
+		t.Errorf("Expected 3 messages, got %d", len(msgs))
+	}
+	if len(handedOver) != 0 {
+		t.Errorf("Expected no handed over files, got %d", len(handedOver))
+	}
+}
+
+func TestSinksFull(t *testing.T) {
+	full, short := newIO("tcp", "full"), newIO("tcp", "short")
+	full.full = true
+	s := sinks{full, short}
+
+	typ := tap.Dnstap_MESSAGE
+	m := &tap.Message{QueryMessage: []byte{1, 2, 3}}
+	s.Dnstap(tap.Dnstap{Type: &typ, Message: m}, nil)
+
+	if got := <-full.queue; len(got.Message.QueryMessage) != 3 {
+		t.Errorf("Expected the wire-format message for the full sink")
+	}
+	if got := <-short.queue; got.Message.QueryMessage != nil {
+		t.Errorf("Expected no wire-format message for the other sink")
+	}
+	if len(m.QueryMessage) != 3 {
+		t.Errorf("Expected the original message to be unchanged")
+	}
+}
+
+func TestSinksDrop(t *testing.T) {
+	dio := newIO("tcp", "drop")
+	dio.queue = make(chan tap.Dnstap, 1)
+	dio.Dnstap(tmsg, nil)
+	dio.Dnstap(tmsg, nil)
+	if dio.dropped != 1 {
+		t.Errorf("Expected 1 dropped message, got %d", dio.dropped)
+	}
+}
@@ -0,0 +1,129 @@
+package dnstap
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
+)
+
+// filter selects the messages that are sent to a sink. Each criterion that is set must match. Sampling
+// and rate limiting are applied to the messages that match.
+type filter struct {
+	zones   []string // qname must be in one of the zones
+	qtypes  map[uint16]struct{}
+	rcodes  map[int]struct{} // only applies to responses
+	clients []*net.IPNet
+	types   map[tap.Message_Type]struct{}
+
+	sample  float64       // fraction of the queries that is sent, 0 sends all of them
+	limiter *rate.Limiter // maximum rate of messages
+}
+
+// messageTypes are the message types that can be selected with the type option.
+var messageTypes = map[string]tap.Message_Type{
+	"client_query":       tap.Message_CLIENT_QUERY,
+	"client_response":    tap.Message_CLIENT_RESPONSE,
+	"forwarder_query":    tap.Message_FORWARDER_QUERY,
+	"forwarder_response": tap.Message_FORWARDER_RESPONSE,
+}
+
+// match returns true if the message m, about the DNS message r, must be sent. R may be nil, then the
+// DNS message is unpacked from m when needed. The reason a message is skipped is returned in reason.
+func (f *filter) match(m *tap.Message, r *dns.Msg) (ok bool, reason string) {
+	if !f.selects(m, r) {
+		return false, "filter"
+	}
+	if f.sample > 0 && !f.sampled(m, r) {
+		return false, "sample"
+	}
+	if f.limiter != nil && !f.limiter.Allow() {
+		return false, "rate"
+	}
+	return true, ""
+}
+
+func (f *filter) selects(m *tap.Message, r *dns.Msg) bool {
+	if len(f.types) > 0 {
+		if m.Type == nil {
+			return false
+		}
+		if _, ok := f.types[*m.Type]; !ok {
+			return false
+		}
+	}
+	if len(f.clients) > 0 {
+		ip := net.IP(m.QueryAddress)
+		found := false
+		for _, n := range f.clients {
+			if n.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.zones) == 0 && len(f.qtypes) == 0 && len(f.rcodes) == 0 {
+		return true
+	}
+
+	if r == nil {
+		r = unpack(m)
+	}
+	if r == nil || len(r.Question) == 0 {
+		return false
+	}
+	if len(f.zones) > 0 && plugin.Zones(f.zones).Matches(r.Question[0].Name) == "" {
+		return false
+	}
+	if len(f.qtypes) > 0 {
+		if _, ok := f.qtypes[r.Question[0].Qtype]; !ok {
+			return false
+		}
+	}
+	if len(f.rcodes) > 0 && r.Response {
+		if _, ok := f.rcodes[r.Rcode]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sampled returns true if m is in the sample. The decision is made on the ID and question of the DNS
+// message, so a query and its response are either both sent or both skipped.
+func (f *filter) sampled(m *tap.Message, r *dns.Msg) bool {
+	if r == nil {
+		r = unpack(m)
+	}
+	if r == nil || len(r.Question) == 0 {
+		return rand.Float64() < f.sample
+	}
+	h := fnv.New64()
+	h.Write([]byte{byte(r.Id >> 8), byte(r.Id)})
+	h.Write([]byte(dns.CanonicalName(r.Question[0].Name)))
+	return float64(h.Sum64()) < f.sample*math.MaxUint64
+}
+
+// unpack returns the DNS message included in m, or nil if there is none.
+func unpack(m *tap.Message) *dns.Msg {
+	buf := m.ResponseMessage
+	if buf == nil {
+		buf = m.QueryMessage
+	}
+	if buf == nil {
+		return nil
+	}
+	r := new(dns.Msg)
+	if err := r.Unpack(buf); err != nil {
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,136 @@
+package dnstap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/dnstap/msg"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+func filterMessage(typ tap.Message_Type, client string) *tap.Message {
+	m := new(tap.Message)
+	msg.SetType(m, typ)
+	msg.SetQueryAddress(m, &net.UDPAddr{IP: net.ParseIP(client), Port: 53})
+	return m
+}
+
+func filterDNS(qname string, qtype uint16, rcode int, response bool) *dns.Msg {
+	r := new(dns.Msg)
+	r.SetQuestion(qname, qtype)
+	r.Response, r.Rcode = response, rcode
+	return r
+}
+
+func parseTestFilter(t *testing.T, options string) *filter {
+	c := caddy.NewTestController("dns", "dnstap dnstap.sock {\n"+options+"\n}")
+	d, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %s", options, err)
+	}
+	return d.io.(sinks)[0].filter
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		options  string
+		typ      tap.Message_Type
+		client   string
+		r        *dns.Msg
+		expected bool
+	}{
+		{"qname example.org", tap.Message_CLIENT_QUERY, "10.0.0.1", filterDNS("www.example.org.", dns.TypeA, 0, false), true},
+		{"qname example.org", tap.Message_CLIENT_QUERY, "10.0.0.1", filterDNS("www.example.net.", dns.TypeA, 0, false), false},
+		{"qname example.org example.net", tap.Message_CLIENT_QUERY, "10.0.0.1", filterDNS("www.example.net.", dns.TypeA, 0, false), true},
+		{"qtype AAAA MX", tap.Message_CLIENT_QUERY, "10.0.0.1", filterDNS("example.org.", dns.TypeA, 0, false), false},
+		{"qtype AAAA MX", tap.Message_CLIENT_QUERY, "10.0.0.1", filterDNS("example.org.", dns.TypeMX, 0, false), true},
+		{"rcode NXDOMAIN", tap.Message_CLIENT_RESPONSE, "10.0.0.1", filterDNS("example.org.", dns.TypeA, dns.RcodeSuccess, true), false},
+		{"rcode NXDOMAIN", tap.Message_CLIENT_RESPONSE, "10.0.0.1", filterDNS("example.org.", dns.TypeA, dns.RcodeNameError, true), true},
+		{"rcode NXDOMAIN", tap.Message_CLIENT_QUERY, "10.0.0.1", filterDNS("example.org.", dns.TypeA, 0, false), true}, // not a response
+		{"client 10.0.0.0/8 192.168.1.1", tap.Message_CLIENT_QUERY, "10.1.2.3", filterDNS("example.org.", dns.TypeA, 0, false), true},
+		{"client 10.0.0.0/8 192.168.1.1", tap.Message_CLIENT_QUERY, "192.168.1.1", filterDNS("example.org.", dns.TypeA, 0, false), true},
+		{"client 10.0.0.0/8 192.168.1.1", tap.Message_CLIENT_QUERY, "192.168.1.2", filterDNS("example.org.", dns.TypeA, 0, false), false},
+		{"type forwarder_query forwarder_response", tap.Message_CLIENT_QUERY, "10.0.0.1", filterDNS("example.org.", dns.TypeA, 0, false), false},
+		{"type forwarder_query forwarder_response", tap.Message_FORWARDER_RESPONSE, "10.0.0.1", filterDNS("example.org.", dns.TypeA, 0, true), true},
+		{"qname example.org\nqtype A", tap.Message_CLIENT_QUERY, "10.0.0.1", filterDNS("example.org.", dns.TypeAAAA, 0, false), false},
+		{"qname example.org", tap.Message_CLIENT_QUERY, "10.0.0.1", nil, false}, // nothing to filter on
+	}
+	for i, tc := range tests {
+		f := parseTestFilter(t, tc.options)
+		if ok, _ := f.match(filterMessage(tc.typ, tc.client), tc.r); ok != tc.expected {
+			t.Errorf("Test %d: expected match %t for %q, got %t", i, tc.expected, tc.options, ok)
+		}
+	}
+}
+
+func TestFilterUnpack(t *testing.T) {
+	f := parseTestFilter(t, "qname example.org")
+	m := filterMessage(tap.Message_CLIENT_QUERY, "10.0.0.1")
+	m.QueryMessage, _ = filterDNS("www.example.org.", dns.TypeA, 0, false).Pack()
+	if ok, _ := f.match(m, nil); !ok {
+		t.Errorf("Expected the wire-format message to be used to filter")
+	}
+}
+
+func TestFilterSample(t *testing.T) {
+	f := parseTestFilter(t, "sample 0.25")
+	sampled := 0
+	for i := 0; i < 4000; i++ {
+		q := filterDNS("example.org.", dns.TypeA, 0, false)
+		q.Id = uint16(i)
+		r := q.Copy()
+		r.Response = true
+
+		qok, _ := f.match(filterMessage(tap.Message_CLIENT_QUERY, "10.0.0.1"), q)
+		rok, reason := f.match(filterMessage(tap.Message_CLIENT_RESPONSE, "10.0.0.1"), r)
+		if qok != rok {
+			t.Fatalf("Expected query and response %d to be sampled together", i)
+		}
+		if qok {
+			sampled++
+		} else if reason != "sample" {
+			t.Fatalf("Expected reason sample, got %s", reason)
+		}
+	}
+	if sampled < 800 || sampled > 1200 {
+		t.Errorf("Expected about 1000 sampled queries, got %d", sampled)
+	}
+}
+
+func TestFilterRateLimit(t *testing.T) {
+	f := parseTestFilter(t, "rate_limit 10")
+	sent := 0
+	for i := 0; i < 100; i++ {
+		if ok, _ := f.match(filterMessage(tap.Message_CLIENT_QUERY, "10.0.0.1"), nil); ok {
+			sent++
+		}
+	}
+	if sent < 10 || sent > 11 {
+		t.Errorf("Expected about 10 messages to be sent, got %d", sent)
+	}
+}
+
+func TestConfigFilter(t *testing.T) {
+	tests := []string{
+		"qname",
+		"qtype FOO",
+		"rcode FOO",
+		"client 10.0.0.0/33",
+		"client example.org",
+		"type client",
+		"sample 0",
+		"sample 1.5",
+		"sample 0.1 0.2",
+		"rate_limit 0",
+		"rate_limit many",
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", "dnstap dnstap.sock {\n"+tc+"\n}")
+		if _, err := parseConfig(c); err == nil {
+			t.Errorf("Test %d: expected %q to fail", i, tc)
+		}
+	}
+}
@@ -21,9 +21,13 @@ type Dnstap struct {
 }
 
 // TapMessage sends the message m to the dnstap interface.
-func (h Dnstap) TapMessage(m *tap.Message) {
+func (h Dnstap) TapMessage(m *tap.Message) { h.TapMessageFor(m, nil) }
+
+// TapMessageFor sends the message m to the dnstap interface, r is the DNS query or response m is about.
+// It is used to filter the message, without it the wire-format message in m has to be unpacked.
+func (h Dnstap) TapMessageFor(m *tap.Message, r *dns.Msg) {
 	t := tap.Dnstap_MESSAGE
-	h.io.Dnstap(tap.Dnstap{Type: &t, Message: m})
+	h.io.Dnstap(tap.Dnstap{Type: &t, Message: m}, r)
 }
 
 func (h Dnstap) tapQuery(w dns.ResponseWriter, query *dns.Msg, queryTime time.Time) {
@@ -36,7 +40,7 @@ func (h Dnstap) tapQuery(w dns.ResponseWriter, query *dns.Msg, queryTime time.Ti
 		q.QueryMessage = buf
 	}
 	msg.SetType(q, tap.Message_CLIENT_QUERY)
-	h.TapMessage(q)
+	h.TapMessageFor(q, query)
 }
 
 // ServeDNS logs the client query and response to dnstap and passes the dnstap Context.
@@ -34,7 +34,7 @@ type writer struct {
 	queue []*tap.Message
 }
 
-func (w *writer) Dnstap(e tap.Dnstap) {
+func (w *writer) Dnstap(e tap.Dnstap, _ *dns.Msg) {
 	if len(w.queue) == 0 {
 		w.t.Error("Message not expected")
 	}
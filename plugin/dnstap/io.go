@@ -2,10 +2,13 @@ package dnstap
 
 import (
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -18,20 +21,40 @@ const (
 
 // tapper interface is used in testing to mock the Dnstap method.
 type tapper interface {
-	Dnstap(tap.Dnstap)
+	// Dnstap sends payload, r is the DNS message the payload is about. It may be nil.
+	Dnstap(payload tap.Dnstap, r *dns.Msg)
+}
+
+// sinks sends each dnstap message to all of its sinks.
+type sinks []*dio
+
+// Dnstap implements the tapper interface.
+func (s sinks) Dnstap(payload tap.Dnstap, r *dns.Msg) {
+	for _, d := range s {
+		d.Dnstap(payload, r)
+	}
 }
 
 // dio implements the Tapper interface.
 type dio struct {
 	endpoint     string
-	proto        string
+	proto        string // "tcp", "unix" or "file"
+	full         bool   // include the wire-format DNS messages
 	conn         net.Conn
 	enc          *encoder
 	queue        chan tap.Dnstap
 	dropped      uint32
 	quit         chan struct{}
+	wg           sync.WaitGroup // the I/O routine
 	flushTimeout time.Duration
 	tcpTimeout   time.Duration
+
+	// When proto is "file".
+	file     *tapFile
+	rotation rotation
+	keep     bool // hand the file over to the next instance when closing
+
+	filter *filter // when set, only the messages it matches are sent
 }
 
 // newIO returns a new and initialized pointer to a dio.
@@ -47,6 +70,9 @@ func newIO(proto, endpoint string) *dio {
 }
 
 func (d *dio) dial() error {
+	if d.proto == "file" {
+		return d.open()
+	}
 	conn, err := net.DialTimeout(d.proto, d.endpoint, d.tcpTimeout)
 	if err != nil {
 		return err
@@ -56,48 +82,89 @@ func (d *dio) dial() error {
 		tcpConn.SetNoDelay(false)
 	}
 
-	d.enc, err = newEncoder(conn, d.tcpTimeout)
+	d.enc, err = newEncoder(conn, d.tcpTimeout, true)
 	return err
 }
 
 // Connect connects to the dnstap endpoint.
 func (d *dio) connect() error {
 	err := d.dial()
+	d.wg.Add(1)
 	go d.serve()
 	return err
 }
 
 // Dnstap enqueues the payload for log.
-func (d *dio) Dnstap(payload tap.Dnstap) {
+func (d *dio) Dnstap(payload tap.Dnstap, r *dns.Msg) {
+	if d.filter != nil && payload.Message != nil {
+		if ok, reason := d.filter.match(payload.Message, r); !ok {
+			skippedCount.WithLabelValues(d.endpoint, reason).Inc()
+			return
+		}
+	}
+	if !d.full && payload.Message != nil && (payload.Message.QueryMessage != nil || payload.Message.ResponseMessage != nil) {
+		// Another sink wants the wire-format messages, this one doesn't.
+		m := proto.Clone(payload.Message).(*tap.Message)
+		m.QueryMessage, m.ResponseMessage = nil, nil
+		payload.Message = m
+	}
 	select {
 	case d.queue <- payload:
 	default:
 		atomic.AddUint32(&d.dropped, 1)
+		droppedCount.WithLabelValues(d.endpoint).Inc()
 	}
 }
 
 // close waits until the I/O routine is finished to return.
-func (d *dio) close() { close(d.quit) }
+func (d *dio) close() {
+	close(d.quit)
+	d.wg.Wait()
+}
+
+// release is close for a reload: a dnstap file is kept open, so that the next instance continues with it.
+func (d *dio) release() {
+	d.keep = true
+	d.close()
+}
+
+// resume restarts the I/O routine after release, when the reload failed.
+func (d *dio) resume() error {
+	d.keep = false
+	d.quit = make(chan struct{})
+	return d.connect()
+}
 
 func (d *dio) write(payload *tap.Dnstap) error {
 	if d.enc == nil {
 		atomic.AddUint32(&d.dropped, 1)
+		droppedCount.WithLabelValues(d.endpoint).Inc()
 		return nil
 	}
 	if err := d.enc.writeMsg(payload); err != nil {
 		atomic.AddUint32(&d.dropped, 1)
+		droppedCount.WithLabelValues(d.endpoint).Inc()
 		return err
 	}
 	return nil
 }
 
 func (d *dio) serve() {
+	defer d.wg.Done()
 	timeout := time.NewTimer(d.flushTimeout)
 	defer timeout.Stop()
 	for {
 		timeout.Reset(d.flushTimeout)
 		select {
 		case <-d.quit:
+			if d.file != nil {
+				if d.keep {
+					d.handOver()
+					return
+				}
+				d.closeFile()
+				return
+			}
 			if d.enc == nil {
 				return
 			}
@@ -106,17 +173,37 @@ func (d *dio) serve() {
 			return
 		case payload := <-d.queue:
 			if err := d.write(&payload); err != nil {
-				d.dial()
+				d.redial()
+			} else if d.shouldRotate(time.Now()) {
+				d.reopen()
 			}
 		case <-timeout.C:
 			if dropped := atomic.SwapUint32(&d.dropped, 0); dropped > 0 {
-				log.Warningf("Dropped dnstap messages: %d", dropped)
+				log.Warningf("Dropped dnstap messages for %s: %d", d.endpoint, dropped)
 			}
-			if d.enc == nil {
+			switch {
+			case d.enc == nil:
 				d.dial()
-			} else {
+			case d.shouldRotate(time.Now()):
+				d.reopen()
+			default:
 				d.enc.flush()
 			}
 		}
 	}
 }
+
+// redial reconnects after a failed write. A file is closed first, so that it is rotated.
+func (d *dio) redial() {
+	if d.file != nil {
+		d.closeFile()
+	}
+	d.dial()
+}
+
+// reopen rotates the dnstap file.
+func (d *dio) reopen() {
+	if err := d.rotate(); err != nil {
+		log.Errorf("Failed to rotate dnstap file %s: %s", d.endpoint, err)
+	}
+}
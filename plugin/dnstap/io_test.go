@@ -65,7 +65,7 @@ func TestTransport(t *testing.T) {
 		dio.flushTimeout = 30 * time.Millisecond
 		dio.connect()
 
-		dio.Dnstap(tmsg)
+		dio.Dnstap(tmsg, nil)
 
 		wg.Wait()
 		l.Close()
@@ -99,7 +99,7 @@ func TestRace(t *testing.T) {
 	for i := 0; i < count; i++ {
 		go func() {
 			tmsg := tap.Dnstap_MESSAGE
-			dio.Dnstap(tap.Dnstap{Type: &tmsg})
+			dio.Dnstap(tap.Dnstap{Type: &tmsg}, nil)
 			wg.Done()
 		}()
 	}
@@ -128,7 +128,7 @@ func TestReconnect(t *testing.T) {
 	dio.connect()
 	defer dio.close()
 
-	dio.Dnstap(tmsg)
+	dio.Dnstap(tmsg, nil)
 
 	wg.Wait()
 
@@ -149,7 +149,7 @@ func TestReconnect(t *testing.T) {
 
 	for i := 0; i < count; i++ {
 		time.Sleep(100 * time.Millisecond)
-		dio.Dnstap(tmsg)
+		dio.Dnstap(tmsg, nil)
 	}
 	wg.Wait()
 }
@@ -0,0 +1,25 @@
+package dnstap
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// droppedCount is the number of dnstap messages dropped per sink.
+	droppedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "dnstap",
+		Name:      "dropped_total",
+		Help:      "Counter of dnstap messages dropped, because the queue was full or the message couldn't be written.",
+	}, []string{"endpoint"})
+	// skippedCount is the number of dnstap messages not sent to a sink because of its filter.
+	skippedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "dnstap",
+		Name:      "skipped_total",
+		Help:      "Counter of dnstap messages not sent, because they were filtered, sampled or rate limited.",
+	}, []string{"endpoint", "reason"})
+)
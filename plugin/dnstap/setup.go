@@ -1,13 +1,22 @@
 package dnstap
 
 import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/parse"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
 )
 
 var log = clog.NewWithPlugin("dnstap")
@@ -15,30 +24,122 @@ var log = clog.NewWithPlugin("dnstap")
 func init() { plugin.Register("dnstap", setup) }
 
 func parseConfig(c *caddy.Controller) (Dnstap, error) {
-	c.Next() // directive name
 	d := Dnstap{}
-	endpoint := ""
-
-	if !c.Args(&endpoint) {
-		return d, c.ArgErr()
-	}
+	s := sinks{}
 
-	if strings.HasPrefix(endpoint, "tcp://") {
-		// remote IP endpoint
-		servers, err := parse.HostPortOrFile(endpoint[6:])
-		if err != nil {
+	// Each dnstap directive in the server block adds a sink.
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
 			return d, c.ArgErr()
 		}
-		dio := newIO("tcp", servers[0])
-		d = Dnstap{io: dio}
-	} else {
-		endpoint = strings.TrimPrefix(endpoint, "unix://")
-		dio := newIO("unix", endpoint)
-		d = Dnstap{io: dio}
-	}
+		endpoint := args[0]
 
-	d.IncludeRawMessage = c.NextArg() && c.Val() == "full"
+		var dio *dio
+		switch {
+		case strings.HasPrefix(endpoint, "tcp://"):
+			// remote IP endpoint
+			servers, err := parse.HostPortOrFile(endpoint[6:])
+			if err != nil {
+				return d, c.ArgErr()
+			}
+			dio = newIO("tcp", servers[0])
+		case strings.HasPrefix(endpoint, "file://"):
+			path := endpoint[7:]
+			if path == "" {
+				return d, c.ArgErr()
+			}
+			if !filepath.IsAbs(path) && dnsserver.GetConfig(c).Root != "" {
+				path = filepath.Join(dnsserver.GetConfig(c).Root, path)
+			}
+			dio = newIO("file", path)
+			configure(path)
+		default:
+			endpoint = strings.TrimPrefix(endpoint, "unix://")
+			dio = newIO("unix", endpoint)
+		}
 
+		dio.full = len(args) > 1 && args[1] == "full"
+		d.IncludeRawMessage = d.IncludeRawMessage || dio.full
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "queue":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return d, c.ArgErr()
+				}
+				size, err := strconv.Atoi(args[0])
+				if err != nil {
+					return d, err
+				}
+				if size <= 0 {
+					return d, fmt.Errorf("queue size should be positive: %d", size)
+				}
+				dio.queue = make(chan tap.Dnstap, size)
+			case "rotate_size":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return d, c.ArgErr()
+				}
+				size, err := parseSize(args[0])
+				if err != nil {
+					return d, err
+				}
+				if size <= 0 {
+					return d, fmt.Errorf("rotate size should be positive: %d", size)
+				}
+				dio.rotation.size = size
+			case "rotate_interval":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return d, c.ArgErr()
+				}
+				interval, err := time.ParseDuration(args[0])
+				if err != nil {
+					return d, err
+				}
+				if interval <= 0 {
+					return d, fmt.Errorf("rotate interval should be positive: %s", interval)
+				}
+				dio.rotation.interval = interval
+			case "rotate_keep":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return d, c.ArgErr()
+				}
+				keep, err := strconv.Atoi(args[0])
+				if err != nil {
+					return d, err
+				}
+				if keep < 0 {
+					return d, fmt.Errorf("number of rotated files to keep can not be negative: %d", keep)
+				}
+				dio.rotation.keep = keep
+			case "compress":
+				if c.NextArg() {
+					return d, c.ArgErr()
+				}
+				dio.rotation.compress = true
+			case "qname", "qtype", "rcode", "client", "type", "sample", "rate_limit":
+				if dio.filter == nil {
+					dio.filter = &filter{}
+				}
+				if err := parseFilter(c, dio.filter); err != nil {
+					return d, err
+				}
+				continue
+			default:
+				return d, c.Errf("unknown property '%s'", c.Val())
+			}
+			if c.Val() != "queue" && dio.proto != "file" {
+				return d, fmt.Errorf("%s can only be used with a file:// endpoint", c.Val())
+			}
+		}
+		s = append(s, dio)
+	}
+
+	d.io = s
 	return d, nil
 }
 
@@ -49,19 +150,39 @@ func setup(c *caddy.Controller) error {
 	}
 
 	c.OnStartup(func() error {
-		if err := dnstap.io.(*dio).connect(); err != nil {
-			log.Errorf("No connection to dnstap endpoint: %s", err)
+		sweep()
+		for _, d := range dnstap.io.(sinks) {
+			if err := d.connect(); err != nil {
+				log.Errorf("No connection to dnstap endpoint %s: %s", d.endpoint, err)
+			}
 		}
 		return nil
 	})
 
 	c.OnRestart(func() error {
-		dnstap.io.(*dio).close()
+		reload()
+		for _, d := range dnstap.io.(sinks) {
+			d.release()
+		}
+		return nil
+	})
+
+	c.OnRestartFailed(func() error {
+		for _, d := range dnstap.io.(sinks) {
+			if d.proto == "file" {
+				configure(d.endpoint)
+			}
+			if err := d.resume(); err != nil {
+				log.Errorf("No connection to dnstap endpoint %s: %s", d.endpoint, err)
+			}
+		}
 		return nil
 	})
 
 	c.OnFinalShutdown(func() error {
-		dnstap.io.(*dio).close()
+		for _, d := range dnstap.io.(sinks) {
+			d.close()
+		}
 		return nil
 	})
 
@@ -73,3 +194,115 @@ func setup(c *caddy.Controller) error {
 
 	return nil
 }
+
+// parseFilter parses the filter option c is at into f.
+func parseFilter(c *caddy.Controller, f *filter) error {
+	opt := c.Val()
+	args := c.RemainingArgs()
+	if len(args) == 0 {
+		return c.ArgErr()
+	}
+	switch opt {
+	case "qname":
+		for _, a := range args {
+			f.zones = append(f.zones, plugin.Host(a).NormalizeExact()...)
+		}
+	case "qtype":
+		if f.qtypes == nil {
+			f.qtypes = make(map[uint16]struct{})
+		}
+		for _, a := range args {
+			qtype, ok := dns.StringToType[strings.ToUpper(a)]
+			if !ok {
+				return fmt.Errorf("invalid qtype: %s", a)
+			}
+			f.qtypes[qtype] = struct{}{}
+		}
+	case "rcode":
+		if f.rcodes == nil {
+			f.rcodes = make(map[int]struct{})
+		}
+		for _, a := range args {
+			rcode, ok := dns.StringToRcode[strings.ToUpper(a)]
+			if !ok {
+				return fmt.Errorf("invalid rcode: %s", a)
+			}
+			f.rcodes[rcode] = struct{}{}
+		}
+	case "client":
+		for _, a := range args {
+			if !strings.Contains(a, "/") {
+				if net.ParseIP(a) == nil {
+					return fmt.Errorf("invalid client address: %s", a)
+				}
+				if strings.Contains(a, ":") {
+					a += "/128"
+				} else {
+					a += "/32"
+				}
+			}
+			_, n, err := net.ParseCIDR(a)
+			if err != nil {
+				return err
+			}
+			f.clients = append(f.clients, n)
+		}
+	case "type":
+		if f.types == nil {
+			f.types = make(map[tap.Message_Type]struct{})
+		}
+		for _, a := range args {
+			t, ok := messageTypes[a]
+			if !ok {
+				return fmt.Errorf("invalid message type: %s", a)
+			}
+			f.types[t] = struct{}{}
+		}
+	case "sample":
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		sample, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return err
+		}
+		if sample <= 0 || sample > 1 {
+			return fmt.Errorf("sample should be in the range (0, 1]: %s", args[0])
+		}
+		f.sample = sample
+	case "rate_limit":
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		limit, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		if limit <= 0 {
+			return fmt.Errorf("rate limit should be positive: %d", limit)
+		}
+		f.limiter = rate.NewLimiter(rate.Limit(limit), limit)
+	}
+	return nil
+}
+
+// parseSize parses a size in bytes, with an optional K, M or G suffix.
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
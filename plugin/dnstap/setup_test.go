@@ -2,6 +2,7 @@ package dnstap
 
 import (
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
 )
@@ -32,10 +33,10 @@ func TestConfig(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Test %d: expected no error, got %s", i, err)
 		}
-		if x := tap.io.(*dio).endpoint; x != tc.endpoint {
+		if x := tap.io.(sinks)[0].endpoint; x != tc.endpoint {
 			t.Errorf("Test %d: expected endpoint %s, got %s", i, tc.endpoint, x)
 		}
-		if x := tap.io.(*dio).proto; x != tc.proto {
+		if x := tap.io.(sinks)[0].proto; x != tc.proto {
 			t.Errorf("Test %d: expected proto %s, got %s", i, tc.proto, x)
 		}
 		if x := tap.IncludeRawMessage; x != tc.full {
@@ -43,3 +44,57 @@ func TestConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigSinks(t *testing.T) {
+	tests := []struct {
+		in       string
+		sinks    int
+		full     bool
+		queue    int
+		rotation rotation
+		fail     bool
+	}{
+		{"dnstap dnstap.sock\ndnstap tcp://127.0.0.1:6000 full", 2, true, queueSize, rotation{}, false},
+		{"dnstap file:///tmp/tap {\nqueue 100\n}", 1, false, 100, rotation{}, false},
+		{`dnstap file:///tmp/tap full {
+			rotate_size 10M
+			rotate_interval 1h
+			rotate_keep 5
+			compress
+		}`, 1, true, queueSize, rotation{size: 10 << 20, interval: time.Hour, keep: 5, compress: true}, false},
+		// fails
+		{"dnstap file://", 0, false, 0, rotation{}, true},
+		{"dnstap dnstap.sock {\nrotate_size 10M\n}", 0, false, 0, rotation{}, true},
+		{"dnstap file:///tmp/tap {\nrotate_size 10X\n}", 0, false, 0, rotation{}, true},
+		{"dnstap file:///tmp/tap {\nrotate_interval -1h\n}", 0, false, 0, rotation{}, true},
+		{"dnstap file:///tmp/tap {\nqueue 0\n}", 0, false, 0, rotation{}, true},
+		{"dnstap file:///tmp/tap {\ncompress gzip\n}", 0, false, 0, rotation{}, true},
+		{"dnstap file:///tmp/tap {\nfoo\n}", 0, false, 0, rotation{}, true},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.in)
+		tap, err := parseConfig(c)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("Test %d: expected test to fail: %s", i, tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		s := tap.io.(sinks)
+		if len(s) != tc.sinks {
+			t.Fatalf("Test %d: expected %d sinks, got %d", i, tc.sinks, len(s))
+		}
+		if tap.IncludeRawMessage != tc.full {
+			t.Errorf("Test %d: expected IncludeRawMessage %t, got %t", i, tc.full, tap.IncludeRawMessage)
+		}
+		if cap(s[0].queue) != tc.queue {
+			t.Errorf("Test %d: expected queue size %d, got %d", i, tc.queue, cap(s[0].queue))
+		}
+		if s[0].rotation != tc.rotation {
+			t.Errorf("Test %d: expected rotation %v, got %v", i, tc.rotation, s[0].rotation)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/etcd/msg"
 	"github.com/coredns/coredns/plugin/pkg/fall"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/request"
 
@@ -26,6 +27,8 @@ const (
 	etcdTimeout = 5 * time.Second
 )
 
+var log = clog.NewWithPlugin("etcd")
+
 var errKeyNotFound = errors.New("key not found")
 
 // Etcd is a plugin talks to an etcd cluster.
@@ -38,6 +41,7 @@ type Etcd struct {
 	Client     *etcdcv3.Client
 
 	endpoints []string // Stored here as well, to aid in testing.
+	watch     *watcher // When set, records are read from the copy it keeps, instead of from etcd.
 }
 
 // Services implements the ServiceBackend interface.
@@ -68,16 +72,29 @@ func (e *Etcd) IsNameError(err error) bool {
 
 // Records looks up records in etcd. If exact is true, it will lookup just this
 // name. This is used when find matches when completing SRV lookups for instance.
+// When the plugin watches etcd, the records are read from its copy of the path, once that has been read.
 func (e *Etcd) Records(ctx context.Context, state request.Request, exact bool) ([]msg.Service, error) {
 	name := state.Name()
 
 	path, star := msg.PathWithWildcard(name, e.PathPrefix)
-	r, err := e.get(ctx, path, !exact)
-	if err != nil {
-		return nil, err
+	var nodes []*node
+	if e.watch != nil && e.watch.revision() > 0 {
+		var err error
+		nodes, err = e.watch.get(path, !exact)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		r, err := e.get(ctx, path, !exact)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range r.Kvs {
+			nodes = append(nodes, newNode(kv))
+		}
 	}
 	segments := strings.Split(msg.Path(name, e.PathPrefix), "/")
-	return e.loopNodes(r.Kvs, segments, star, state.QType())
+	return e.loopNodes(nodes, segments, star, state.QType())
 }
 
 func (e *Etcd) get(ctx context.Context, path string, recursive bool) (*etcdcv3.GetResponse, error) {
@@ -114,12 +131,41 @@ func (e *Etcd) get(ctx context.Context, path string, recursive bool) (*etcdcv3.G
 	return r, nil
 }
 
-func (e *Etcd) loopNodes(kv []*mvccpb.KeyValue, nameParts []string, star bool, qType uint16) (sx []msg.Service, err error) {
+// node is a key read from etcd, together with the service decoded from its value.
+type node struct {
+	kv   *mvccpb.KeyValue
+	serv *msg.Service // decoded service with its Key set, nil when the value can't be decoded
+	err  error        // why the value can't be decoded
+}
+
+func newNode(kv *mvccpb.KeyValue) *node {
+	serv := new(msg.Service)
+	if err := json.Unmarshal(kv.Value, serv); err != nil {
+		return &node{kv: kv, err: fmt.Errorf("%s: %s", kv.Key, err.Error())}
+	}
+	serv.Key = string(kv.Key)
+	return &node{kv: kv, serv: serv}
+}
+
+// service returns a copy of the service of n, with its TTL and priority set.
+func (e *Etcd) service(n *node) (*msg.Service, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	serv := *n.serv
+	serv.TTL = e.TTL(n.kv, n.serv)
+	if serv.Priority == 0 {
+		serv.Priority = priority
+	}
+	return &serv, nil
+}
+
+func (e *Etcd) loopNodes(nodes []*node, nameParts []string, star bool, qType uint16) (sx []msg.Service, err error) {
 	bx := make(map[msg.Service]struct{})
 Nodes:
-	for _, n := range kv {
+	for _, n := range nodes {
 		if star {
-			s := string(n.Key)
+			s := string(n.kv.Key)
 			keyParts := strings.Split(s, "/")
 			for i, n := range nameParts {
 				if i > len(keyParts)-1 {
@@ -134,21 +180,15 @@ Nodes:
 				}
 			}
 		}
-		serv := new(msg.Service)
-		if err := json.Unmarshal(n.Value, serv); err != nil {
-			return nil, fmt.Errorf("%s: %s", n.Key, err.Error())
+		if n.err != nil {
+			return nil, n.err
 		}
-		serv.Key = string(n.Key)
-		if _, ok := bx[*serv]; ok {
+		if _, ok := bx[*n.serv]; ok {
 			continue
 		}
-		bx[*serv] = struct{}{}
-
-		serv.TTL = e.TTL(n, serv)
-		if serv.Priority == 0 {
-			serv.Priority = priority
-		}
+		bx[*n.serv] = struct{}{}
 
+		serv, _ := e.service(n)
 		if shouldInclude(serv, qType) {
 			sx = append(sx, *serv)
 		}
@@ -0,0 +1,32 @@
+package etcd
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// watchKeys is the number of keys in the copy kept by watching etcd.
+	watchKeys = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "etcd",
+		Name:      "watch_keys",
+		Help:      "The number of keys in the copy of the path kept by watching etcd.",
+	}, []string{"path"})
+	// watchLag is the time it took etcd to answer the last progress request on the watch.
+	watchLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "etcd",
+		Name:      "watch_lag_seconds",
+		Help:      "The time the watch of etcd lags behind, measured with progress requests.",
+	}, []string{"path"})
+	// watchResyncs is the number of times all keys were read again after the watch failed.
+	watchResyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "etcd",
+		Name:      "watch_resyncs_total",
+		Help:      "Counter of the times all keys were read again after the watch of etcd failed.",
+	}, []string{"path"})
+)
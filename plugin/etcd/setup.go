@@ -1,11 +1,13 @@
 package etcd
 
 import (
+	"context"
 	"crypto/tls"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/etcd/msg"
 	mwtls "github.com/coredns/coredns/plugin/pkg/tls"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 
@@ -20,6 +22,18 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error("etcd", err)
 	}
 
+	if e.watch != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.OnStartup(func() error {
+			go e.watch.run(ctx)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			cancel()
+			return nil
+		})
+	}
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		e.Next = next
 		return e
@@ -36,6 +50,7 @@ func etcdParse(c *caddy.Controller) (*Etcd, error) {
 		endpoints = []string{defaultEndpoint}
 		username  string
 		password  string
+		watch     bool
 	)
 
 	etc.Upstream = upstream.New()
@@ -79,6 +94,11 @@ func etcdParse(c *caddy.Controller) (*Etcd, error) {
 					return &Etcd{}, c.Errf("credentials requires 2 arguments, username and password")
 				}
 				username, password = args[0], args[1]
+			case "watch":
+				if c.NextArg() {
+					return &Etcd{}, c.ArgErr()
+				}
+				watch = true
 			default:
 				if c.Val() != "}" {
 					return &Etcd{}, c.Errf("unknown property '%s'", c.Val())
@@ -91,6 +111,9 @@ func etcdParse(c *caddy.Controller) (*Etcd, error) {
 		}
 		etc.Client = client
 		etc.endpoints = endpoints
+		if watch {
+			etc.watch = newWatcher(client, msg.Path(".", etc.PathPrefix)+"/")
+		}
 
 		return &etc, nil
 	}
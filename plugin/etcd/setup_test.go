@@ -116,3 +116,46 @@ func TestSetupEtcd(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupEtcdWatch(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		expectedWatch string // prefix of the watch, empty when not watching
+	}{
+		{`etcd`, false, ""},
+		{`etcd {
+			watch
+		}`, false, "/skydns/"},
+		{`etcd {
+			path /coredns/dns
+			watch
+		}`, false, "/coredns/dns/"},
+		{`etcd {
+			watch 10s
+		}`, true, ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		etcd, err := etcdParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found one for input %s. Error was: %v", i, test.input, err)
+			continue
+		}
+
+		watch := ""
+		if etcd.watch != nil {
+			watch = etcd.watch.prefix
+		}
+		if watch != test.expectedWatch {
+			t.Errorf("Test %d: Expected watch of %q, got %q", i, test.expectedWatch, watch)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcdcv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	progressInterval = 10 * time.Second // interval at which the lag of the watch is measured
+	resyncDelay      = time.Second      // delay before reading all keys again after the watch failed
+)
+
+var errWatchClosed = errors.New("watch closed")
+
+// watcher holds a copy of the keys below the path of the plugin, with the services decoded from their values.
+// The copy is read in full once, and kept up to date by watching the path. When the watch fails, for instance
+// because the revision it was at has been compacted, all keys are read again.
+type watcher struct {
+	client *etcdcv3.Client
+	prefix string
+
+	sync.RWMutex
+	nodes []*node // sorted by key
+	rev   int64   // revision of the copy, 0 until the keys have been read
+}
+
+func newWatcher(client *etcdcv3.Client, prefix string) *watcher {
+	return &watcher{client: client, prefix: prefix}
+}
+
+// run reads all keys and watches them for changes until ctx is canceled.
+func (w *watcher) run(ctx context.Context) {
+	for {
+		rev, err := w.sync(ctx)
+		if err == nil {
+			log.Infof("Read %d keys below %s at revision %d", w.len(), w.prefix, rev)
+			err = w.watch(ctx, rev+1)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warningf("Failed to watch %s, reading all keys again: %s", w.prefix, err)
+		watchResyncs.WithLabelValues(w.prefix).Inc()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resyncDelay):
+		}
+	}
+}
+
+// sync replaces the copy with all keys below the prefix, and returns the revision they were read at.
+func (w *watcher) sync(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdTimeout)
+	defer cancel()
+	r, err := w.client.Get(ctx, w.prefix, etcdcv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := make([]*node, len(r.Kvs))
+	for i, kv := range r.Kvs {
+		nodes[i] = newNode(kv)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return bytes.Compare(nodes[i].kv.Key, nodes[j].kv.Key) < 0 })
+
+	w.Lock()
+	w.nodes = nodes
+	w.rev = r.Header.Revision
+	w.Unlock()
+
+	watchKeys.WithLabelValues(w.prefix).Set(float64(len(nodes)))
+	return r.Header.Revision, nil
+}
+
+// watch applies the changes below the prefix from revision rev on to the copy, until the watch fails or ctx
+// is canceled. The lag of the watch is measured by requesting a progress notification every progressInterval,
+// which etcd sends once all earlier changes have been sent.
+func (w *watcher) watch(ctx context.Context, rev int64) error {
+	ctx, cancel := context.WithCancel(etcdcv3.WithRequireLeader(ctx))
+	defer cancel()
+	wc := w.client.Watch(ctx, w.prefix, etcdcv3.WithPrefix(), etcdcv3.WithRev(rev))
+
+	tick := time.NewTicker(progressInterval)
+	defer tick.Stop()
+
+	var requested time.Time // time of the outstanding progress request, if any
+	for {
+		select {
+		case <-tick.C:
+			if !requested.IsZero() {
+				watchLag.WithLabelValues(w.prefix).Set(time.Since(requested).Seconds())
+				continue
+			}
+			requested = time.Now()
+			// The request must use the context of the watch, as that selects the stream it is sent on.
+			if err := w.client.RequestProgress(ctx); err != nil {
+				return err
+			}
+
+		case resp, ok := <-wc:
+			if !ok {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return errWatchClosed
+			}
+			if err := resp.Err(); err != nil {
+				return err
+			}
+			if resp.IsProgressNotify() {
+				if !requested.IsZero() {
+					watchLag.WithLabelValues(w.prefix).Set(time.Since(requested).Seconds())
+					requested = time.Time{}
+				}
+				continue
+			}
+			w.apply(resp.Events, resp.Header.Revision)
+		}
+	}
+}
+
+// apply applies the events of revision rev to the copy.
+func (w *watcher) apply(events []*etcdcv3.Event, rev int64) {
+	if len(events) == 0 {
+		return
+	}
+
+	// The values are decoded before the copy is locked.
+	nodes := make([]*node, len(events))
+	for i, ev := range events {
+		if ev.Type == mvccpb.PUT {
+			nodes[i] = newNode(ev.Kv)
+		}
+	}
+
+	w.Lock()
+	for j, ev := range events {
+		i, ok := w.search(string(ev.Kv.Key))
+		switch ev.Type {
+		case mvccpb.PUT:
+			if ok {
+				w.nodes[i] = nodes[j]
+				continue
+			}
+			w.nodes = append(w.nodes, nil)
+			copy(w.nodes[i+1:], w.nodes[i:])
+			w.nodes[i] = nodes[j]
+		case mvccpb.DELETE:
+			if ok {
+				w.nodes = append(w.nodes[:i], w.nodes[i+1:]...)
+			}
+		}
+	}
+	w.rev = rev
+	n := len(w.nodes)
+	w.Unlock()
+
+	watchKeys.WithLabelValues(w.prefix).Set(float64(n))
+}
+
+// get returns the key path from the copy. If recursive is true, it returns the keys below path instead, or
+// the key path when there are none, as Etcd.get does.
+func (w *watcher) get(path string, recursive bool) ([]*node, error) {
+	w.RLock()
+	defer w.RUnlock()
+
+	if recursive {
+		if !strings.HasSuffix(path, "/") {
+			path = path + "/"
+		}
+		if nodes := w.list(path); len(nodes) > 0 {
+			return nodes, nil
+		}
+		path = strings.TrimSuffix(path, "/")
+	}
+	if i, ok := w.search(path); ok {
+		return []*node{w.nodes[i]}, nil
+	}
+	return nil, errKeyNotFound
+}
+
+// tree returns the key path and the keys below it from the copy, together with the revision of the copy.
+func (w *watcher) tree(path string) ([]*node, int64) {
+	w.RLock()
+	defer w.RUnlock()
+
+	var nodes []*node
+	if i, ok := w.search(path); ok {
+		nodes = append(nodes, w.nodes[i])
+	}
+	return append(nodes, w.list(path+"/")...), w.rev
+}
+
+// list returns the keys starting with prefix, sorted. The caller must hold the lock of w.
+func (w *watcher) list(prefix string) []*node {
+	i, _ := w.search(prefix)
+	j := i
+	for j < len(w.nodes) && bytes.HasPrefix(w.nodes[j].kv.Key, []byte(prefix)) {
+		j++
+	}
+	return append([]*node(nil), w.nodes[i:j]...)
+}
+
+// search returns the index of key in the copy, or the index where it would be inserted. The caller must hold
+// the lock of w.
+func (w *watcher) search(key string) (int, bool) {
+	i := sort.Search(len(w.nodes), func(i int) bool { return string(w.nodes[i].kv.Key) >= key })
+	return i, i < len(w.nodes) && string(w.nodes[i].kv.Key) == key
+}
+
+// revision returns the revision of the copy, 0 when the keys haven't been read yet.
+func (w *watcher) revision() int64 {
+	w.RLock()
+	defer w.RUnlock()
+	return w.rev
+}
+
+func (w *watcher) len() int {
+	w.RLock()
+	defer w.RUnlock()
+	return len(w.nodes)
+}
@@ -0,0 +1,240 @@
+//go:build etcd
+
+package etcd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/etcd/msg"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcdcv3 "go.etcd.io/etcd/client/v3"
+)
+
+// newWatchPlugin returns an Etcd that answers from the copy of its watcher, which holds services.
+func newWatchPlugin(t *testing.T, services []*msg.Service) *Etcd {
+	e := &Etcd{
+		Upstream:   upstream.New(),
+		PathPrefix: "skydns",
+		Zones:      []string{"skydns.test.", "skydns_extra.test.", "skydns_zonea.test.", "skydns_zoneb.test.", "skydns_zonec.test.", "skydns_zoned.test.", "in-addr.arpa."},
+	}
+	e.watch = newWatcher(nil, "/skydns/")
+
+	var events []*etcdcv3.Event
+	for _, serv := range services {
+		events = append(events, putEvent(t, e, serv))
+	}
+	e.watch.apply(events, 1)
+	return e
+}
+
+func putEvent(t *testing.T, e *Etcd, serv *msg.Service) *etcdcv3.Event {
+	b, err := json.Marshal(serv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := msg.PathWithWildcard(serv.Key, e.PathPrefix)
+	return &etcdcv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(path), Value: b}}
+}
+
+func deleteEvent(e *Etcd, key string) *etcdcv3.Event {
+	path, _ := msg.PathWithWildcard(key, e.PathPrefix)
+	return &etcdcv3.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(path)}}
+}
+
+func TestWatchLookup(t *testing.T) {
+	etc := newWatchPlugin(t, services)
+
+	for i, tc := range dnsTestCases {
+		m := tc.Msg()
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		etc.ServeDNS(ctxt, rec, m)
+
+		resp := rec.Msg
+		if err := test.SortAndCheck(resp, tc); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+		}
+	}
+}
+
+func TestWatchApply(t *testing.T) {
+	etc := newWatchPlugin(t, []*msg.Service{
+		{Host: "10.0.0.1", Key: "a.server1.skydns.test."},
+		{Host: "10.0.0.2", Key: "b.server1.skydns.test."},
+	})
+
+	etc.watch.apply([]*etcdcv3.Event{
+		deleteEvent(etc, "a.server1.skydns.test."),
+		putEvent(t, etc, &msg.Service{Host: "10.0.0.3", Key: "b.server1.skydns.test."}),
+		putEvent(t, etc, &msg.Service{Host: "10.0.0.4", Key: "c.server1.skydns.test."}),
+		deleteEvent(etc, "d.server1.skydns.test."),
+	}, 2)
+
+	if rev := etc.watch.revision(); rev != 2 {
+		t.Errorf("Expected revision 2, got %d", rev)
+	}
+	if n := etc.watch.len(); n != 2 {
+		t.Errorf("Expected 2 keys, got %d", n)
+	}
+
+	tc := test.Case{
+		Qname: "server1.skydns.test.", Qtype: dns.TypeA,
+		Answer: []dns.RR{
+			test.A("server1.skydns.test. 300 A 10.0.0.3"),
+			test.A("server1.skydns.test. 300 A 10.0.0.4"),
+		},
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	etc.ServeDNS(ctxt, rec, tc.Msg())
+	if err := test.SortAndCheck(rec.Msg, tc); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := etc.watch.get("/skydns/test/skydns/server1/a", false); err != errKeyNotFound {
+		t.Errorf("Expected %s for deleted key, got %v", errKeyNotFound, err)
+	}
+}
+
+func TestWatchDecode(t *testing.T) {
+	etc := newWatchPlugin(t, []*msg.Service{
+		{Host: "10.0.0.1", Key: "a.server1.skydns.test."},
+	})
+	bad := &etcdcv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/skydns/test/skydns/bad"), Value: []byte("{")}}
+	etc.watch.apply([]*etcdcv3.Event{bad}, 2)
+
+	// The values are decoded when they are applied, lookups use the decoded services.
+	nodes, err := etc.watch.get("/skydns/test/skydns/server1/a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes[0].kv.Value = []byte("{")
+	tc := test.Case{
+		Qname: "a.server1.skydns.test.", Qtype: dns.TypeA,
+		Answer: []dns.RR{test.A("a.server1.skydns.test. 300 A 10.0.0.1")},
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	etc.ServeDNS(ctxt, rec, tc.Msg())
+	if err := test.SortAndCheck(rec.Msg, tc); err != nil {
+		t.Error(err)
+	}
+
+	// A value that can't be decoded fails the lookup, as it does when reading from etcd.
+	if _, err := etc.Records(ctxt, request.Request{Req: test.Case{Qname: "bad.skydns.test.", Qtype: dns.TypeA}.Msg()}, false); err == nil {
+		t.Errorf("Expected error for a value that can't be decoded")
+	}
+}
+
+func TestWatchTransfer(t *testing.T) {
+	etc := newWatchPlugin(t, []*msg.Service{
+		{Host: "10.0.0.1", Key: "a.server1.skydns.test."},
+		{Host: "2003::8:1", Key: "b.server1.skydns.test."},
+		{Host: "server1.example.org", Key: "cname.skydns.test."},
+		{Text: "sometext", Key: "txt.skydns.test."},
+		{Host: "10.0.0.2", Key: "a.ns.dns.skydns.test."},
+		{Host: "10.0.0.3", Key: "a.skydns_zonea.test."},
+	})
+
+	ch, err := etc.Transfer("skydns.test.", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rrs []dns.RR
+	for r := range ch {
+		rrs = append(rrs, r...)
+	}
+
+	expected := []string{
+		"skydns.test.	30	IN	SOA	ns.dns.skydns.test. hostmaster.skydns.test. 1 7200 1800 86400 30",
+		"skydns.test.	300	IN	NS	a.ns.dns.skydns.test.",
+		"cname.skydns.test.	300	IN	CNAME	server1.example.org.",
+		"dns.skydns.test.	300	IN	A	10.0.0.2",
+		"ns.dns.skydns.test.	300	IN	A	10.0.0.2",
+		"a.ns.dns.skydns.test.	300	IN	A	10.0.0.2",
+		"server1.skydns.test.	300	IN	A	10.0.0.1",
+		"server1.skydns.test.	300	IN	AAAA	2003::8:1",
+		"a.server1.skydns.test.	300	IN	A	10.0.0.1",
+		"b.server1.skydns.test.	300	IN	AAAA	2003::8:1",
+		"txt.skydns.test.	300	IN	TXT	\"sometext\"",
+		"skydns.test.	30	IN	SOA	ns.dns.skydns.test. hostmaster.skydns.test. 1 7200 1800 86400 30",
+	}
+	if len(rrs) != len(expected) {
+		t.Fatalf("Expected %d records, got %d: %v", len(expected), len(rrs), rrs)
+	}
+	for i, rr := range rrs {
+		if rr.String() != expected[i] {
+			t.Errorf("Expected record %d to be %q, got %q", i, expected[i], rr.String())
+		}
+	}
+
+	ch, err = etc.Transfer("skydns.test.", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rrs = nil
+	for r := range ch {
+		rrs = append(rrs, r...)
+	}
+	if len(rrs) != 1 || rrs[0].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("Expected a single SOA for the current serial, got %v", rrs)
+	}
+
+	etc.watch = nil
+	if _, err := etc.Transfer("skydns.test.", 0); err == nil {
+		t.Errorf("Expected error when not watching, got nil")
+	}
+}
+
+func TestWatchTransferGroups(t *testing.T) {
+	etc := newWatchPlugin(t, []*msg.Service{
+		{Host: "10.0.0.1", Key: "x1.www.skydns.test."},
+		{Host: "10.0.0.2", Key: "x2.www.skydns.test."},
+		{Host: "mx.example.org", Mail: true, Priority: 20, Key: "mail.skydns.test."},
+		{Host: "10.0.0.3", Port: 8080, Key: "x1.srv.skydns.test."},
+		{Host: "server.example.org", Port: 8081, Key: "x2.srv.skydns.test."},
+	})
+
+	ch, err := etc.Transfer("skydns.test.", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := map[string][]string{}
+	for r := range ch {
+		for _, rr := range r {
+			owners[rr.Header().Name] = append(owners[rr.Header().Name], rr.String())
+		}
+	}
+
+	expected := map[string][]string{
+		"www.skydns.test.": {
+			"www.skydns.test.	300	IN	A	10.0.0.1",
+			"www.skydns.test.	300	IN	A	10.0.0.2",
+		},
+		"mail.skydns.test.": {
+			"mail.skydns.test.	300	IN	MX	20 mx.example.org.",
+		},
+		"srv.skydns.test.": {
+			"srv.skydns.test.	300	IN	A	10.0.0.3",
+			"srv.skydns.test.	300	IN	SRV	10 50 8080 x1.srv.skydns.test.",
+			"srv.skydns.test.	300	IN	SRV	10 50 8081 server.example.org.",
+		},
+	}
+	for name, want := range expected {
+		got := owners[name]
+		if len(got) != len(want) {
+			t.Errorf("Expected %d records for %s, got %d: %v", len(want), name, len(got), got)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected record %d of %s to be %q, got %q", i, name, want[i], got[i])
+			}
+		}
+	}
+}
@@ -1,13 +1,29 @@
 package etcd
 
 import (
+	"context"
+	"math"
+	"sort"
 	"time"
 
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/etcd/msg"
+	"github.com/coredns/coredns/plugin/pkg/denial"
+	"github.com/coredns/coredns/plugin/transfer"
 	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
 )
 
-// Serial returns the serial number to use.
+// Serial returns the serial number to use. When the plugin watches etcd, this is the revision of its copy of
+// the path. It changes when the records do, and also when all keys are read again after the watch failed, as
+// the copy then has the latest revision of the etcd cluster.
 func (e *Etcd) Serial(state request.Request) uint32 {
+	if e.watch != nil {
+		if rev := e.watch.revision(); rev > 0 {
+			return uint32(rev)
+		}
+	}
 	return uint32(time.Now().Unix())
 }
 
@@ -15,3 +31,151 @@ func (e *Etcd) Serial(state request.Request) uint32 {
 func (e *Etcd) MinTTL(state request.Request) uint32 {
 	return 30
 }
+
+// Transfer implements the transfer.Transferer interface. Zones can only be transferred when the plugin watches
+// etcd, the records are then taken from its copy of the path. As with lookups, the records of a name are built
+// from the services at and below its path, so the services below www.example.org, such as x1.www.example.org,
+// are records of both names.
+func (e *Etcd) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
+	if e.watch == nil || plugin.Zones(e.Zones).Matches(zone) == "" {
+		return nil, transfer.ErrNotAuthoritative
+	}
+	nodes, rev := e.watch.tree(msg.Path(zone, e.PathPrefix))
+	if rev == 0 {
+		return nil, transfer.ErrNotAuthoritative
+	}
+
+	// state is not used by SOA, hence the empty request.Request{}
+	soa, err := plugin.SOA(context.TODO(), e, zone, request.Request{}, plugin.Options{})
+	if err != nil {
+		return nil, transfer.ErrNotAuthoritative
+	}
+	soa[0].(*dns.SOA).Serial = uint32(rev)
+
+	state := request.Request{Req: new(dns.Msg)}
+	state.Req.SetQuestion(zone, dns.TypeNS)
+	ns, _, err := plugin.NS(context.TODO(), e, zone, state, plugin.Options{})
+	if err != nil && !e.IsNameError(err) {
+		return nil, err
+	}
+
+	ch := make(chan []dns.RR)
+	go func() {
+		defer close(ch)
+
+		// ixfr fallback
+		if serial != 0 && serial >= uint32(rev) {
+			ch <- soa
+			return
+		}
+		ch <- soa
+		if len(ns) > 0 {
+			ch <- ns
+		}
+
+		names := e.transferServices(zone, nodes)
+		sorted := make([]string, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return denial.Compare(sorted[i], sorted[j]) < 0 })
+		for _, name := range sorted {
+			if rrs := transferRecords(name, msg.Group(names[name])); len(rrs) > 0 {
+				ch <- rrs
+			}
+		}
+
+		ch <- soa
+	}()
+	return ch, nil
+}
+
+// transferServices returns the services of each name below zone. A service belongs to the name of its key and
+// to the names above it, up to the zone.
+func (e *Etcd) transferServices(zone string, nodes []*node) map[string][]msg.Service {
+	names := make(map[string][]msg.Service)
+	for _, n := range nodes {
+		serv, err := e.service(n)
+		if err != nil {
+			log.Warningf("Skipping key in transfer of %s: %s", zone, err)
+			continue
+		}
+		for name := msg.Domain(serv.Key); name != zone && dns.IsSubDomain(zone, name); {
+			names[name] = append(names[name], *serv)
+			off, end := dns.NextLabel(name, 0)
+			if end {
+				break
+			}
+			name = name[off:]
+		}
+	}
+	return names
+}
+
+// transferRecords returns the records of name, built from its services as the lookups of plugin.A, plugin.AAAA,
+// plugin.TXT, plugin.MX and plugin.SRV do. A name whose own key holds a host name, without a port and not for
+// mail, only has the CNAME to that host.
+func transferRecords(name string, services []msg.Service) []dns.RR {
+	var rrs []dns.RR
+	for _, serv := range services {
+		if what, _ := serv.HostType(); what == dns.TypeCNAME && msg.Domain(serv.Key) == name && serv.Host != "" && !serv.Mail && serv.Port == 0 {
+			if plugin.Name(name).Matches(dns.Fqdn(serv.Host)) {
+				continue
+			}
+			return []dns.RR{serv.NewCNAME(name, serv.Host)}
+		}
+	}
+
+	dup := make(map[string]struct{})
+	weights := make(map[int]int)
+	for _, serv := range services {
+		weight := 100
+		if serv.Weight != 0 {
+			weight = serv.Weight
+		}
+		weights[serv.Priority] += weight
+	}
+
+	var mx, srv []dns.RR
+	for _, serv := range services {
+		what, ip := serv.HostType()
+		switch what {
+		case dns.TypeA, dns.TypeAAAA:
+			if _, ok := dup[serv.Host]; !ok {
+				dup[serv.Host] = struct{}{}
+				if what == dns.TypeA {
+					rrs = append(rrs, serv.NewA(name, ip))
+				} else {
+					rrs = append(rrs, serv.NewAAAA(name, ip))
+				}
+			}
+			// The MX and SRV records point to the name of the key, which holds the address.
+			serv.Host = msg.Domain(serv.Key)
+		case dns.TypeTXT:
+			rrs = append(rrs, serv.NewTXT(name))
+			continue
+		}
+		if serv.Host == "" {
+			continue
+		}
+		if serv.Mail {
+			mx = append(mx, serv.NewMX(name))
+		}
+		// Services without a port are left out, their SRV records can't be used.
+		if serv.Port > 0 {
+			w := 100.0 / float64(weights[serv.Priority])
+			if serv.Weight == 0 {
+				w *= 100
+			} else {
+				w *= float64(serv.Weight)
+			}
+			weight := uint16(math.Floor(w))
+			if weight == 0 {
+				weight = 1
+			}
+			srv = append(srv, serv.NewSRV(name, weight))
+		}
+	}
+	rrs = append(rrs, mx...)
+	return append(rrs, srv...)
+}
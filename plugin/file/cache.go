@@ -0,0 +1,124 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// LoadCacheFile loads the zone from its cache file, which holds the zone as it was last transferred. The
+// modification time of the file is the time the zone was last known to be current: when the SOA expire
+// has passed since then, the zone is not loaded.
+func (z *Zone) LoadCacheFile() error {
+	f, err := os.Open(z.CacheFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	z1, err := Parse(f, z.origin, z.CacheFile, -1)
+	if err != nil {
+		return err
+	}
+	expire := fi.ModTime().Add(time.Duration(z1.Apex.SOA.Expire) * time.Second)
+	if time.Now().After(expire) {
+		return fmt.Errorf("zone in cache file %s expired at %s", z.CacheFile, expire.Format(time.RFC3339))
+	}
+
+	z.Lock()
+	z.Tree = z1.Tree
+	z.Apex = z1.Apex
+	z.Expired = false
+	z.cacheExpire = expire
+	z.Unlock()
+	return nil
+}
+
+// ExpireCache marks z as expired when it was loaded from its cache file and the SOA expire has passed since
+// the cache file was written, without a transfer from the primaries. It returns true when z became expired.
+func (z *Zone) ExpireCache() bool {
+	z.Lock()
+	defer z.Unlock()
+	if z.Expired || z.cacheExpire.IsZero() || time.Now().Before(z.cacheExpire) {
+		return false
+	}
+	z.Expired = true
+	return true
+}
+
+// writeCacheFile writes z to its cache file, if it has one. The zone is written to a temporary file that
+// is renamed, so the cache file never holds a partial zone.
+func (z *Zone) writeCacheFile() {
+	if z.CacheFile == "" {
+		return
+	}
+	if err := z.writeZone(z.CacheFile); err != nil {
+		log.Warningf("Failed to write zone %s to cache file %s: %s", z.origin, z.CacheFile, err)
+		return
+	}
+	z.Lock()
+	z.cacheExpire = time.Time{}
+	z.Unlock()
+}
+
+// touchCacheFile updates the modification time of the cache file of z, if it has one, after a primary has
+// confirmed that the zone is current.
+func (z *Zone) touchCacheFile() {
+	if z.CacheFile == "" {
+		return
+	}
+	now := time.Now()
+	if err := os.Chtimes(z.CacheFile, now, now); err != nil {
+		log.Warningf("Failed to update cache file %s of zone %s: %s", z.CacheFile, z.origin, err)
+	}
+}
+
+// writeZone writes the records of z to path in the zone file format.
+func (z *Zone) writeZone(path string) error {
+	apex, err := z.ApexIfDefined()
+	if err != nil {
+		return err
+	}
+	var rrs [][]dns.RR
+	z.RLock()
+	z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { rrs = append(rrs, e.All()); return nil })
+	z.RUnlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails after the rename
+
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "; zone %s transferred at %s\n", z.origin, time.Now().UTC().Format(time.RFC3339))
+	for _, rr := range apex {
+		fmt.Fprintln(w, rr.String())
+	}
+	for _, e := range rrs {
+		for _, rr := range e {
+			fmt.Fprintln(w, rr.String())
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,88 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+
+	"github.com/miekg/dns"
+)
+
+func TestCacheFile(t *testing.T) {
+	p := &ixfrPrimary{}
+	s := dnstest.NewServer(p.Handler)
+	defer s.Close()
+
+	cache := filepath.Join(t.TempDir(), "db.example.org")
+
+	z := newIXFRZone(t, s.Addr)
+	z.CacheFile = cache
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := os.Stat(cache); err != nil {
+		t.Fatalf("Expected cache file to be written, got %v", err)
+	}
+
+	z1 := NewZone(ixfrZone, "stdin")
+	z1.CacheFile = cache
+	if err := z1.LoadCacheFile(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if z1.Apex.SOA.Serial != 3 {
+		t.Errorf("Expected serial 3, got %d", z1.Apex.SOA.Serial)
+	}
+	if len(z1.Apex.NS) != 1 || z1.Apex.NS[0].(*dns.NS).Ns != "ns2.example.org." {
+		t.Errorf("Expected NS ns2.example.org., got %v", z1.Apex.NS)
+	}
+	for _, name := range []string{"a.example.org.", "c.example.org."} {
+		if e, _ := z1.Tree.Search(name); e == nil || len(e.Type(dns.TypeA)) != 1 {
+			t.Errorf("Expected address for %s", name)
+		}
+	}
+	if z1.ExpireCache() {
+		t.Errorf("Expected zone not to expire")
+	}
+
+	// The zone expires when the cache file is older than the SOA expire.
+	old := time.Now().Add(-2 * 86400 * time.Second)
+	if err := os.Chtimes(cache, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewZone(ixfrZone, "stdin").LoadCacheFile(); err == nil {
+		t.Errorf("Expected error for missing cache file, got none")
+	}
+	z2 := NewZone(ixfrZone, "stdin")
+	z2.CacheFile = cache
+	if err := z2.LoadCacheFile(); err == nil {
+		t.Errorf("Expected error for expired cache file, got none")
+	}
+
+	// A primary that confirms the zone is current updates the cache file.
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fi, err := os.Stat(cache); err != nil || fi.ModTime().Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("Expected cache file to be updated, got %v", err)
+	}
+}
+
+func TestExpireCache(t *testing.T) {
+	z := NewZone(ixfrZone, "stdin")
+	if z.ExpireCache() {
+		t.Errorf("Expected zone without cache file not to expire")
+	}
+	z.cacheExpire = time.Now().Add(-time.Second)
+	if !z.ExpireCache() {
+		t.Errorf("Expected zone to expire")
+	}
+	if !z.Expired {
+		t.Errorf("Expected zone to be marked expired")
+	}
+	if z.ExpireCache() {
+		t.Errorf("Expected zone to expire only once")
+	}
+}
@@ -52,6 +52,13 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		return dns.RcodeRefused, nil
 	}
 
+	if r.Opcode == dns.OpcodeUpdate {
+		m := new(dns.Msg)
+		m.SetRcode(r, z.update(state))
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+
 	// This is only for when we are a secondary zones.
 	if r.Opcode == dns.OpcodeNotify {
 		if z.isNotify(state) {
@@ -0,0 +1,213 @@
+package file
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// diff is the change of a zone from one serial to the next, as sent in an incremental zone transfer (RFC 1995).
+type diff struct {
+	from    *dns.SOA
+	to      *dns.SOA
+	deleted []dns.RR
+	added   []dns.RR
+}
+
+// maxJournal is the number of diffs kept for serving incremental transfers.
+const maxJournal = 100
+
+// parseIXFR parses the records of an IXFR response to a request from serial into diffs. The response may also
+// be a single SOA, when the zone is up to date, or a full zone transfer, in which case full is true.
+func parseIXFR(rrs []dns.RR, serial uint32) (diffs []*diff, full bool, err error) {
+	if len(rrs) == 0 {
+		return nil, false, fmt.Errorf("empty response")
+	}
+	current, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return nil, false, fmt.Errorf("response does not start with SOA")
+	}
+	if len(rrs) == 1 {
+		if less(serial, current.Serial) {
+			return nil, false, fmt.Errorf("response is a single SOA of newer serial %d", current.Serial)
+		}
+		return nil, false, nil
+	}
+	if _, ok := rrs[1].(*dns.SOA); !ok {
+		return nil, true, nil
+	}
+
+	last, ok := rrs[len(rrs)-1].(*dns.SOA)
+	if !ok || last.Serial != current.Serial {
+		return nil, false, fmt.Errorf("response does not end with SOA of serial %d", current.Serial)
+	}
+	rrs = rrs[1 : len(rrs)-1]
+
+	i := 0
+	for i < len(rrs) {
+		d := &diff{from: rrs[i].(*dns.SOA)}
+		for i++; i < len(rrs) && rrs[i].Header().Rrtype != dns.TypeSOA; i++ {
+			d.deleted = append(d.deleted, rrs[i])
+		}
+		if i == len(rrs) {
+			return nil, false, fmt.Errorf("diff from serial %d has no additions", d.from.Serial)
+		}
+		d.to = rrs[i].(*dns.SOA)
+		for i++; i < len(rrs) && rrs[i].Header().Rrtype != dns.TypeSOA; i++ {
+			d.added = append(d.added, rrs[i])
+		}
+		diffs = append(diffs, d)
+	}
+	if len(diffs) == 0 || diffs[len(diffs)-1].to.Serial != current.Serial {
+		return nil, false, fmt.Errorf("diffs do not end at serial %d", current.Serial)
+	}
+	return diffs, false, nil
+}
+
+// applyDiffs applies diffs to z and adds them to its journal. The diffs must start at the serial of z, and
+// follow each other. They are applied to a copy of z, which replaces it when all diffs have been applied, so
+// that queries never see a partially applied change.
+func (z *Zone) applyDiffs(diffs []*diff) error {
+	z.updateMu.Lock()
+	defer z.updateMu.Unlock()
+
+	z.RLock()
+	serial := z.Apex.SOA.Serial
+	z.RUnlock()
+	for _, d := range diffs {
+		if d.from.Serial != serial {
+			return fmt.Errorf("diff from serial %d does not apply to serial %d", d.from.Serial, serial)
+		}
+		for _, rr := range d.added {
+			if t := rr.Header().Rrtype; t == dns.TypeNSEC3 || t == dns.TypeNSEC3PARAM {
+				return fmt.Errorf("NSEC3 zone is not supported, dropping RR: %s for zone: %s", rr.Header().Name, z.origin)
+			}
+		}
+		serial = d.to.Serial
+	}
+
+	z.RLock()
+	z1 := z.clone()
+	z.RUnlock()
+	for _, d := range diffs {
+		for _, rr := range d.deleted {
+			z1.Delete(dns.Copy(rr))
+		}
+		for _, rr := range d.added {
+			if err := z1.Insert(dns.Copy(rr)); err != nil {
+				return err
+			}
+		}
+		z1.Insert(dns.Copy(d.to))
+	}
+
+	z.Lock()
+	z.Tree = z1.Tree
+	z.Apex = z1.Apex
+	z.appendJournal(diffs...)
+	z.Expired = false
+	z.Unlock()
+	return nil
+}
+
+// appendJournal adds diffs to the journal of z, keeping at most maxJournal diffs. The caller must hold the
+// lock of z.
+func (z *Zone) appendJournal(diffs ...*diff) {
+	z.journal = append(z.journal, diffs...)
+	if len(z.journal) > maxJournal {
+		z.journal = append([]*diff(nil), z.journal[len(z.journal)-maxJournal:]...)
+	}
+}
+
+// journalFrom returns the diffs from serial to the current serial of z, or nil if the journal doesn't have
+// them.
+func (z *Zone) journalFrom(serial uint32) []*diff {
+	z.RLock()
+	defer z.RUnlock()
+
+	for i, d := range z.journal {
+		if d.from.Serial != serial {
+			continue
+		}
+		// The diffs must follow each other up to the current serial.
+		diffs := z.journal[i:]
+		for j := 1; j < len(diffs); j++ {
+			if diffs[j-1].to.Serial != diffs[j].from.Serial {
+				return nil
+			}
+		}
+		if diffs[len(diffs)-1].to.Serial != z.Apex.SOA.Serial {
+			return nil
+		}
+		return diffs
+	}
+	return nil
+}
+
+// transferInIncremental retrieves the changes since soa from the primaries with IXFR and applies them. When a
+// primary sends the full zone instead, it is set live as with AXFR.
+func (z *Zone) transferInIncremental(soa *dns.SOA) error {
+	var Err error
+	for _, tr := range z.TransferFrom {
+		m := new(dns.Msg)
+		m.SetIxfr(z.origin, soa.Serial, soa.Ns, soa.Mbox)
+		z.setTsig(m)
+		rrs, err := transferRecords(m, tr, z.tsigSecret())
+		if err != nil {
+			Err = err
+			continue
+		}
+		diffs, full, err := parseIXFR(rrs, soa.Serial)
+		if err != nil {
+			Err = err
+			continue
+		}
+		if full {
+			z1 := z.CopyWithoutApex()
+			for _, rr := range rrs {
+				if err := z1.Insert(rr); err != nil {
+					return err
+				}
+			}
+			z.Lock()
+			z.Tree = z1.Tree
+			z.Apex = z1.Apex
+			z.Expired = false
+			z.journal = nil
+			z.Unlock()
+			log.Infof("Transferred: %s from %s", z.origin, tr)
+			z.writeCacheFile()
+			return nil
+		}
+		if len(diffs) == 0 {
+			z.touchCacheFile()
+			return nil
+		}
+		if err := z.applyDiffs(diffs); err != nil {
+			Err = err
+			continue
+		}
+		log.Infof("Transferred: %s incrementally from %s with %d changes to %d SOA serial", z.origin, tr, len(diffs), diffs[len(diffs)-1].to.Serial)
+		z.writeCacheFile()
+		return nil
+	}
+	return Err
+}
+
+// transferRecords sends the transfer request m to the primary at addr and returns the records of the response.
+// When m is signed, secret holds the secret of its key.
+func transferRecords(m *dns.Msg, addr string, secret map[string]string) ([]dns.RR, error) {
+	t := &dns.Transfer{TsigSecret: secret}
+	c, err := t.In(m, addr)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dns.RR
+	for env := range c {
+		if env.Error != nil {
+			return nil, env.Error
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	return rrs, nil
+}
@@ -0,0 +1,337 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+const ixfrZone = "example.org."
+
+func ixfrSOA(serial uint32) *dns.SOA {
+	return test.SOA(fmt.Sprintf("%s 3600 IN SOA ns1.example.org. hostmaster.example.org. %d 3600 600 86400 60", ixfrZone, serial))
+}
+
+// ixfrPrimary serves the zone at serial 3, and the changes to it from serial 1 and 2.
+type ixfrPrimary struct {
+	noIXFR  bool
+	soaOnly bool // answer IXFR with just the SOA, whatever the serial asked for
+}
+
+func (p *ixfrPrimary) Handler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	switch req.Question[0].Qtype {
+	case dns.TypeSOA:
+		m.Answer = []dns.RR{ixfrSOA(3)}
+	case dns.TypeAXFR:
+		m.Answer = []dns.RR{
+			ixfrSOA(3),
+			test.NS("example.org. 3600 IN NS ns2.example.org."),
+			test.A("a.example.org. 3600 IN A 192.0.2.11"),
+			test.A("c.example.org. 3600 IN A 192.0.2.3"),
+			ixfrSOA(3),
+		}
+	case dns.TypeIXFR:
+		if p.noIXFR {
+			m.Rcode = dns.RcodeNotImplemented
+			break
+		}
+		m.Answer = []dns.RR{ixfrSOA(3)}
+		serial := req.Ns[0].(*dns.SOA).Serial
+		if serial >= 3 || p.soaOnly {
+			break
+		}
+		if serial == 1 {
+			m.Answer = append(m.Answer,
+				ixfrSOA(1),
+				test.A("a.example.org. 3600 IN A 192.0.2.1"),
+				ixfrSOA(2),
+				test.A("A.example.org. 3600 IN A 192.0.2.11"),
+			)
+		}
+		m.Answer = append(m.Answer,
+			ixfrSOA(2),
+			test.NS("example.org. 3600 IN NS ns1.example.org."),
+			test.A("b.example.org. 3600 IN A 192.0.2.2"),
+			ixfrSOA(3),
+			test.NS("example.org. 3600 IN NS ns2.example.org."),
+			test.A("c.example.org. 3600 IN A 192.0.2.3"),
+			ixfrSOA(3),
+		)
+	}
+	w.WriteMsg(m)
+}
+
+// newIXFRZone returns the zone at serial 1, transferred from primary.
+func newIXFRZone(t *testing.T, primary string) *Zone {
+	z := NewZone(ixfrZone, "stdin")
+	z.TransferFrom = []string{primary}
+	for _, rr := range []dns.RR{
+		ixfrSOA(1),
+		test.NS("example.org. 3600 IN NS ns1.example.org."),
+		test.A("a.example.org. 3600 IN A 192.0.2.1"),
+		test.A("b.example.org. 3600 IN A 192.0.2.2"),
+	} {
+		if err := z.Insert(rr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return z
+}
+
+func TestParseIXFR(t *testing.T) {
+	tests := []struct {
+		rrs     []dns.RR
+		diffs   int
+		full    bool
+		wantErr bool
+	}{
+		{[]dns.RR{ixfrSOA(3)}, 0, false, false},
+		{[]dns.RR{ixfrSOA(1)}, 0, false, false},
+		{[]dns.RR{ixfrSOA(3), test.A("a.example.org. IN A 192.0.2.1"), ixfrSOA(3)}, 0, true, false},
+		{[]dns.RR{ixfrSOA(3), ixfrSOA(2), ixfrSOA(3), ixfrSOA(3)}, 1, false, false},
+		{[]dns.RR{ixfrSOA(3), ixfrSOA(1), ixfrSOA(2), ixfrSOA(2), ixfrSOA(3), ixfrSOA(3)}, 2, false, false},
+		{(&ixfrPrimary{}).records(1), 2, false, false},
+		// fails
+		{nil, 0, false, true},
+		{[]dns.RR{ixfrSOA(4)}, 0, false, true},
+		{[]dns.RR{test.A("a.example.org. IN A 192.0.2.1")}, 0, false, true},
+		{[]dns.RR{ixfrSOA(3), ixfrSOA(2), ixfrSOA(3)}, 0, false, true},
+		{[]dns.RR{ixfrSOA(3), ixfrSOA(1), ixfrSOA(2), ixfrSOA(2)}, 0, false, true},
+		{[]dns.RR{ixfrSOA(3), ixfrSOA(1), ixfrSOA(2), ixfrSOA(3)}, 0, false, true},
+	}
+	for i, tc := range tests {
+		diffs, full, err := parseIXFR(tc.rrs, 3)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Test %d: expected error %t, got %v", i, tc.wantErr, err)
+			continue
+		}
+		if len(diffs) != tc.diffs {
+			t.Errorf("Test %d: expected %d diffs, got %d", i, tc.diffs, len(diffs))
+		}
+		if full != tc.full {
+			t.Errorf("Test %d: expected full %t, got %t", i, tc.full, full)
+		}
+	}
+}
+
+// records returns the records of the IXFR response from serial.
+func (p *ixfrPrimary) records(serial uint32) []dns.RR {
+	req := new(dns.Msg)
+	req.SetIxfr(ixfrZone, serial, "ns1.example.org.", "hostmaster.example.org.")
+	rec := dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+	p.Handler(rec, req)
+	return rec.Msg.Answer
+}
+
+func TestTransferInIncremental(t *testing.T) {
+	for _, noIXFR := range []bool{false, true} {
+		p := &ixfrPrimary{noIXFR: noIXFR}
+		s := dnstest.NewServer(p.Handler)
+		defer s.Close()
+
+		z := newIXFRZone(t, s.Addr)
+		if err := z.TransferIn(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if z.Apex.SOA.Serial != 3 {
+			t.Errorf("Expected serial 3, got %d", z.Apex.SOA.Serial)
+		}
+		if len(z.Apex.NS) != 1 || z.Apex.NS[0].(*dns.NS).Ns != "ns2.example.org." {
+			t.Errorf("Expected NS ns2.example.org., got %v", z.Apex.NS)
+		}
+		for name, want := range map[string]string{"a.example.org.": "192.0.2.11", "b.example.org.": "", "c.example.org.": "192.0.2.3"} {
+			e, _ := z.Tree.Search(name)
+			if want == "" {
+				if e != nil {
+					t.Errorf("Expected %s to be deleted, got %v", name, e.All())
+				}
+				continue
+			}
+			if e == nil || len(e.Type(dns.TypeA)) != 1 || e.Type(dns.TypeA)[0].(*dns.A).A.String() != want {
+				t.Errorf("Expected %s to have address %s", name, want)
+			}
+		}
+
+		journal := 2
+		if noIXFR {
+			journal = 0
+		}
+		if len(z.journal) != journal {
+			t.Errorf("Expected %d diffs in journal, got %d", journal, len(z.journal))
+		}
+
+		// Up to date.
+		if err := z.TransferIn(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(z.journal) != journal {
+			t.Errorf("Expected %d diffs in journal, got %d", journal, len(z.journal))
+		}
+	}
+}
+
+func TestTransferInSingleNewerSOA(t *testing.T) {
+	p := &ixfrPrimary{soaOnly: true}
+	s := dnstest.NewServer(p.Handler)
+	defer s.Close()
+
+	z := newIXFRZone(t, s.Addr)
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The SOA is newer than ours, so the zone is transferred with AXFR.
+	if z.Apex.SOA.Serial != 3 {
+		t.Errorf("Expected serial 3, got %d", z.Apex.SOA.Serial)
+	}
+	if e, _ := z.Tree.Search("c.example.org."); e == nil {
+		t.Errorf("Expected c.example.org. to be transferred")
+	}
+}
+
+func TestTransferJournal(t *testing.T) {
+	p := &ixfrPrimary{}
+	s := dnstest.NewServer(p.Handler)
+	defer s.Close()
+
+	z := newIXFRZone(t, s.Addr)
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		serial uint32
+		want   []dns.RR
+	}{
+		// ixfr from the journal
+		{1, p.records(1)},
+		{2, p.records(2)},
+		// up to date
+		{3, []dns.RR{ixfrSOA(3)}},
+		// not in the journal, axfr fallback
+		{4, nil},
+		{0, nil},
+	}
+	for _, tc := range tests {
+		ch, err := z.Transfer(tc.serial)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var got []dns.RR
+		for rrs := range ch {
+			got = append(got, rrs...)
+		}
+		if tc.want == nil {
+			// axfr: SOA, NS, a, c, SOA
+			if len(got) != 5 || got[1].Header().Rrtype != dns.TypeNS {
+				t.Errorf("Serial %d: expected full transfer, got %v", tc.serial, got)
+			}
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("Serial %d: expected %d records, got %d: %v", tc.serial, len(tc.want), len(got), got)
+			continue
+		}
+		for i := range got {
+			if !dns.IsDuplicate(got[i], tc.want[i]) {
+				t.Errorf("Serial %d: expected record %d to be %s, got %s", tc.serial, i, tc.want[i], got[i])
+			}
+		}
+	}
+}
+
+func TestJournalSize(t *testing.T) {
+	z := newIXFRZone(t, "")
+	for i := uint32(1); i <= maxJournal+10; i++ {
+		d := &diff{from: ixfrSOA(i), to: ixfrSOA(i + 1)}
+		if err := z.applyDiffs([]*diff{d}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if len(z.journal) != maxJournal {
+		t.Errorf("Expected %d diffs in journal, got %d", maxJournal, len(z.journal))
+	}
+	if z.journalFrom(1) != nil {
+		t.Errorf("Expected diff from serial 1 to be removed from journal")
+	}
+	if d := z.journalFrom(11); len(d) != maxJournal {
+		t.Errorf("Expected %d diffs from serial 11, got %d", maxJournal, len(d))
+	}
+
+	// A diff that doesn't apply to the current serial leaves the zone as it is.
+	if err := z.applyDiffs([]*diff{{from: ixfrSOA(1), to: ixfrSOA(2)}}); err == nil {
+		t.Errorf("Expected error applying diff to wrong serial")
+	}
+	if z.Apex.SOA.Serial != maxJournal+11 {
+		t.Errorf("Expected serial %d, got %d", maxJournal+11, z.Apex.SOA.Serial)
+	}
+}
+
+func TestJournalGap(t *testing.T) {
+	z := newIXFRZone(t, "")
+	z.Apex.SOA = ixfrSOA(4)
+	z.journal = []*diff{{from: ixfrSOA(1), to: ixfrSOA(2)}, {from: ixfrSOA(3), to: ixfrSOA(4)}}
+
+	if d := z.journalFrom(1); d != nil {
+		t.Errorf("Expected no diffs across the gap from serial 1, got %d", len(d))
+	}
+	if d := z.journalFrom(3); len(d) != 1 {
+		t.Errorf("Expected 1 diff from serial 3, got %d", len(d))
+	}
+}
+
+func TestApplyDiffsDuringLookups(t *testing.T) {
+	z := newIXFRZone(t, "")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, name := range []string{"a.example.org.", "b.example.org.", "n.example.org."} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			m := new(dns.Msg)
+			m.SetQuestion(name, dns.TypeA)
+			state := request.Request{W: &test.ResponseWriter{}, Req: m}
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// a is never deleted, only changed by the diffs.
+				if rrs, _, _, res := z.Lookup(context.TODO(), state, name); name == "a.example.org." && (res != Success || len(rrs) != 1) {
+					t.Errorf("Expected a single address for %s, got %v", name, rrs)
+					return
+				}
+			}
+		}(name)
+	}
+
+	for serial := uint32(1); serial < 200; serial++ {
+		d := &diff{
+			from:    ixfrSOA(serial),
+			to:      ixfrSOA(serial + 1),
+			deleted: []dns.RR{test.A(fmt.Sprintf("a.example.org. 3600 IN A 192.0.2.%d", serial%2+1))},
+			added:   []dns.RR{test.A(fmt.Sprintf("a.example.org. 3600 IN A 192.0.2.%d", (serial+1)%2+1))},
+		}
+		if serial%2 == 0 {
+			d.added = append(d.added, test.A("n.example.org. 3600 IN A 192.0.2.100"))
+		} else {
+			d.deleted = append(d.deleted, test.A("n.example.org. 3600 IN A 192.0.2.100"))
+		}
+		if err := z.applyDiffs([]*diff{d}); err != nil {
+			t.Fatalf("Serial %d: %s", serial, err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
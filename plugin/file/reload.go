@@ -19,31 +19,7 @@ func (z *Zone) Reload(t *transfer.Transfer) error {
 		for {
 			select {
 			case <-tick.C:
-				zFile := z.File()
-				reader, err := os.Open(filepath.Clean(zFile))
-				if err != nil {
-					log.Errorf("Failed to open zone %q in %q: %v", z.origin, zFile, err)
-					continue
-				}
-
-				serial := z.SOASerialIfDefined()
-				zone, err := Parse(reader, z.origin, zFile, serial)
-				reader.Close()
-				if err != nil {
-					if _, ok := err.(*serialErr); !ok {
-						log.Errorf("Parsing zone %q: %v", z.origin, err)
-					}
-					continue
-				}
-
-				// copy elements we need
-				z.Lock()
-				z.Apex = zone.Apex
-				z.Tree = zone.Tree
-				z.Unlock()
-
-				log.Infof("Successfully reloaded zone %q in %q with %d SOA serial", z.origin, zFile, z.Apex.SOA.Serial)
-				if t != nil {
+				if z.reload() && t != nil {
 					if err := t.Notify(z.origin); err != nil {
 						log.Warningf("Failed sending notifies: %s", err)
 					}
@@ -58,6 +34,42 @@ func (z *Zone) Reload(t *transfer.Transfer) error {
 	return nil
 }
 
+// reload parses the file of z and sets it live when its serial is newer than the one of z. It returns true
+// when it did. The journal of z is dropped, as it has no diff for the changes made to the file.
+func (z *Zone) reload() bool {
+	// Reloads and dynamic updates don't overlap, an update would otherwise undo the changes of the file, and
+	// write its own zone over it.
+	z.updateMu.Lock()
+	defer z.updateMu.Unlock()
+
+	zFile := z.File()
+	reader, err := os.Open(filepath.Clean(zFile))
+	if err != nil {
+		log.Errorf("Failed to open zone %q in %q: %v", z.origin, zFile, err)
+		return false
+	}
+
+	serial := z.SOASerialIfDefined()
+	zone, err := Parse(reader, z.origin, zFile, serial)
+	reader.Close()
+	if err != nil {
+		if _, ok := err.(*serialErr); !ok {
+			log.Errorf("Parsing zone %q: %v", z.origin, err)
+		}
+		return false
+	}
+
+	// copy elements we need
+	z.Lock()
+	z.Apex = zone.Apex
+	z.Tree = zone.Tree
+	z.journal = nil
+	z.Unlock()
+
+	log.Infof("Successfully reloaded zone %q in %q with %d SOA serial", z.origin, zFile, zone.Apex.SOA.Serial)
+	return true
+}
+
 // SOASerialIfDefined returns the SOA's serial if the zone has a SOA record in the Apex, or -1 otherwise.
 func (z *Zone) SOASerialIfDefined() int64 {
 	z.RLock()
@@ -7,13 +7,23 @@ import (
 	"github.com/miekg/dns"
 )
 
-// TransferIn retrieves the zone from the masters, parses it and sets it live.
+// TransferIn retrieves the zone from the masters, parses it and sets it live. When the zone has been
+// transferred before, only the changes are retrieved with IXFR, falling back to AXFR when that fails.
 func (z *Zone) TransferIn() error {
 	if len(z.TransferFrom) == 0 {
 		return nil
 	}
-	m := new(dns.Msg)
-	m.SetAxfr(z.origin)
+
+	z.RLock()
+	soa := z.Apex.SOA
+	z.RUnlock()
+	if soa != nil {
+		err := z.transferInIncremental(soa)
+		if err == nil {
+			return nil
+		}
+		log.Warningf("Failed incremental transfer of `%s', falling back to full transfer: %v", z.origin, err)
+	}
 
 	z1 := z.CopyWithoutApex()
 	var (
@@ -23,7 +33,10 @@ func (z *Zone) TransferIn() error {
 
 Transfer:
 	for _, tr = range z.TransferFrom {
-		t := new(dns.Transfer)
+		m := new(dns.Msg)
+		m.SetAxfr(z.origin)
+		z.setTsig(m)
+		t := &dns.Transfer{TsigSecret: z.tsigSecret()}
 		c, err := t.In(m, tr)
 		if err != nil {
 			log.Errorf("Failed to setup transfer `%s' with `%q': %v", z.origin, tr, err)
@@ -55,8 +68,10 @@ Transfer:
 	z.Tree = z1.Tree
 	z.Apex = z1.Apex
 	z.Expired = false
+	z.journal = nil
 	z.Unlock()
 	log.Infof("Transferred: %s from %s", z.origin, tr)
+	z.writeCacheFile()
 	return nil
 }
 
@@ -65,8 +80,7 @@ Transfer:
 func (z *Zone) shouldTransfer() (bool, error) {
 	c := new(dns.Client)
 	c.Net = "tcp" // do this query over TCP to minimize spoofing
-	m := new(dns.Msg)
-	m.SetQuestion(z.origin, dns.TypeSOA)
+	c.TsigSecret = z.tsigSecret()
 
 	var Err error
 	serial := -1
@@ -74,6 +88,9 @@ func (z *Zone) shouldTransfer() (bool, error) {
 Transfer:
 	for _, tr := range z.TransferFrom {
 		Err = nil
+		m := new(dns.Msg)
+		m.SetQuestion(z.origin, dns.TypeSOA)
+		z.setTsig(m)
 		ret, _, err := c.Exchange(m, tr)
 		if err != nil || ret.Rcode != dns.RcodeSuccess {
 			Err = err
@@ -95,6 +112,23 @@ Transfer:
 	return less(z.Apex.SOA.Serial, uint32(serial)), Err
 }
 
+// setTsig signs m with the TSIG key of z, if it has one. As the signing removes the TSIG record from m, m
+// can only be sent once.
+func (z *Zone) setTsig(m *dns.Msg) {
+	if z.TsigKey != nil {
+		m.SetTsig(z.TsigKey.Name, z.TsigKey.Algorithm, 300, time.Now().Unix())
+	}
+}
+
+// tsigSecret returns the secret of the TSIG key of z, as used by dns.Client and dns.Transfer, or nil when z
+// has no key.
+func (z *Zone) tsigSecret() map[string]string {
+	if z.TsigKey == nil {
+		return nil
+	}
+	return map[string]string{z.TsigKey.Name: z.TsigKey.Secret}
+}
+
 // less returns true of a is smaller than b when taking RFC 1982 serial arithmetic into account.
 func less(a, b uint32) bool {
 	if a < b {
@@ -149,6 +183,8 @@ Restart:
 					// transfer failed, leave retryActive true
 					break
 				}
+			} else {
+				z.touchCacheFile()
 			}
 
 			// no errors, stop timers and restart
@@ -175,6 +211,8 @@ Restart:
 					retryActive = true
 					break
 				}
+			} else {
+				z.touchCacheFile()
 			}
 
 			// no errors, stop timers and restart
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -11,6 +12,8 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
 )
 
 func init() { plugin.Register("file", setup) }
@@ -22,6 +25,11 @@ func setup(c *caddy.Controller) error {
 	}
 
 	f := File{Zones: zones}
+	for _, n := range zones.Names {
+		if len(zones.Z[n].updatePolicies) > 0 {
+			dnsserver.GetConfig(c).Updates = true
+		}
+	}
 	// get the transfer plugin, so we can send notifies and send notifies on startup as well.
 	c.OnStartup(func() error {
 		t := dnsserver.GetConfig(c).Handler("transfer")
@@ -29,6 +37,12 @@ func setup(c *caddy.Controller) error {
 			return nil
 		}
 		f.transfer = t.(*transfer.Transfer) // if found this must be OK.
+		for _, n := range zones.Names {
+			z := zones.Z[n]
+			z.Lock()
+			z.transfer = f.transfer
+			z.Unlock()
+		}
 		go func() {
 			for _, n := range zones.Names {
 				f.transfer.Notify(n)
@@ -82,6 +96,7 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 			return Zones{}, c.ArgErr()
 		}
 		fileName := c.Val()
+		var policies []updatePolicy
 
 		origins := plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
 		if !filepath.IsAbs(fileName) && config.Root != "" {
@@ -121,15 +136,27 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 			case "upstream":
 				// remove soon
 				c.RemainingArgs()
+			case "update":
+				p, err := parseUpdatePolicy(c)
+				if err != nil {
+					return Zones{}, err
+				}
+				policies = append(policies, p)
 
 			default:
 				return Zones{}, c.Errf("unknown property '%s'", c.Val())
 			}
 		}
 
+		// An update rewrites the file with the records of its zone only, which would drop the other zones.
+		if len(policies) > 0 && len(origins) > 1 {
+			return Zones{}, c.Errf("update can't be used with a file that serves more than one origin: %v", origins)
+		}
+
 		for i := range origins {
 			z[origins[i]].ReloadInterval = reload
 			z[origins[i]].Upstream = upstream.New()
+			z[origins[i]].updatePolicies = policies
 		}
 	}
 
@@ -143,3 +170,44 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 	}
 	return Zones{Z: z, Names: names}, nil
 }
+
+// parseUpdatePolicy parses an update policy: update KEY [zonesub|subdomain NAME|name NAME] [TYPES...].
+func parseUpdatePolicy(c *caddy.Controller) (updatePolicy, error) {
+	args := c.RemainingArgs()
+	if len(args) == 0 {
+		return updatePolicy{}, c.ArgErr()
+	}
+	p := updatePolicy{key: dns.CanonicalName(args[0]), match: matchZonesub}
+	if _, ok := dnsserver.GetConfig(c).TsigKeys[p.key]; !ok {
+		return p, c.Errf("unknown TSIG key: %s", args[0])
+	}
+	args = args[1:]
+
+	if len(args) > 0 {
+		switch m := strings.ToLower(args[0]); m {
+		case matchZonesub:
+			args = args[1:]
+		case matchSubdomain, matchName:
+			if len(args) < 2 {
+				return p, c.ArgErr()
+			}
+			if _, ok := dns.IsDomainName(args[1]); !ok {
+				return p, c.Errf("invalid name: %s", args[1])
+			}
+			p.match, p.name = m, dns.CanonicalName(args[1])
+			args = args[2:]
+		}
+	}
+
+	for _, a := range args {
+		qtype, ok := dns.StringToType[strings.ToUpper(a)]
+		if !ok {
+			return p, c.Errf("invalid type: %s", a)
+		}
+		if p.types == nil {
+			p.types = make(map[uint16]struct{})
+		}
+		p.types[qtype] = struct{}{}
+	}
+	return p, nil
+}
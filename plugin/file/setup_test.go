@@ -5,7 +5,10 @@ import (
 	"time"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func TestFileParse(t *testing.T) {
@@ -122,3 +125,72 @@ func TestParseReload(t *testing.T) {
 		}
 	}
 }
+
+func TestFileParseUpdate(t *testing.T) {
+	zoneFileName, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		policy    updatePolicy
+	}{
+		{`update ddns.miek.nl`, false, updatePolicy{key: "ddns.miek.nl.", match: matchZonesub}},
+		{`update ddns.miek.nl zonesub A AAAA`, false, updatePolicy{key: "ddns.miek.nl.", match: matchZonesub, types: map[uint16]struct{}{dns.TypeA: {}, dns.TypeAAAA: {}}}},
+		{`update ddns.miek.nl subdomain dyn.miek.nl`, false, updatePolicy{key: "ddns.miek.nl.", match: matchSubdomain, name: "dyn.miek.nl."}},
+		{`update ddns.miek.nl name www.miek.nl TXT`, false, updatePolicy{key: "ddns.miek.nl.", match: matchName, name: "www.miek.nl.", types: map[uint16]struct{}{dns.TypeTXT: {}}}},
+		// errors
+		{`update`, true, updatePolicy{}},
+		{`update other.miek.nl`, true, updatePolicy{}},
+		{`update ddns.miek.nl subdomain`, true, updatePolicy{}},
+		{`update ddns.miek.nl name www.miek.nl BOGUS`, true, updatePolicy{}},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", "file "+zoneFileName+" miek.nl {\n"+tc.input+"\n}")
+		key := &dnsserver.TsigKey{Name: "ddns.miek.nl.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+		dnsserver.GetConfig(c).TsigKeys = map[string]*dnsserver.TsigKey{key.Name: key}
+
+		zones, err := fileParse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d expected errors, but got no error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		policies := zones.Z["miek.nl."].updatePolicies
+		if len(policies) != 1 {
+			t.Fatalf("Test %d expected one policy, got %d", i, len(policies))
+		}
+		p := policies[0]
+		if p.key != tc.policy.key || p.match != tc.policy.match || p.name != tc.policy.name || len(p.types) != len(tc.policy.types) {
+			t.Errorf("Test %d expected policy %+v, got %+v", i, tc.policy, p)
+		}
+		for qtype := range tc.policy.types {
+			if _, ok := p.types[qtype]; !ok {
+				t.Errorf("Test %d expected type %s in policy", i, dns.TypeToString[qtype])
+			}
+		}
+	}
+}
+
+func TestFileParseUpdateOrigins(t *testing.T) {
+	zoneFileName, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	c := caddy.NewTestController("dns", "file "+zoneFileName+" miek.nl example.org {\nupdate ddns.miek.nl\n}")
+	key := &dnsserver.TsigKey{Name: "ddns.miek.nl.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+	dnsserver.GetConfig(c).TsigKeys = map[string]*dnsserver.TsigKey{key.Name: key}
+	if _, err := fileParse(c); err == nil {
+		t.Errorf("Expected error for update of a file with more than one origin")
+	}
+}
@@ -10,7 +10,7 @@ type Elem struct {
 
 // newElem returns a new elem.
 func newElem(rr dns.RR) *Elem {
-	e := Elem{m: make(map[uint16][]dns.RR)}
+	e := Elem{m: make(map[uint16][]dns.RR), name: rr.Header().Name}
 	e.m[rr.Header().Rrtype] = []dns.RR{rr}
 	return &e
 }
@@ -97,5 +97,25 @@ func (e *Elem) Delete(rr dns.RR) {
 	delete(e.m, t)
 }
 
+// DeleteRR removes the RRs equal to rr, ignoring the TTL, from e.
+func (e *Elem) DeleteRR(rr dns.RR) {
+	t := rr.Header().Rrtype
+	rrs, ok := e.m[t]
+	if !ok {
+		return
+	}
+	keep := rrs[:0:0]
+	for _, r := range rrs {
+		if !dns.IsDuplicate(r, rr) {
+			keep = append(keep, r)
+		}
+	}
+	if len(keep) == 0 {
+		delete(e.m, t)
+		return
+	}
+	e.m[t] = keep
+}
+
 // Less is a tree helper function that calls less.
 func Less(a *Elem, name string) int { return less(name, a.Name()) }
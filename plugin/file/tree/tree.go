@@ -292,6 +292,22 @@ func (t *Tree) Delete(rr dns.RR) {
 	}
 }
 
+// DeleteRR removes rr from t. If after the deletion of rr the node is empty the entire node is deleted.
+func (t *Tree) DeleteRR(rr dns.RR) {
+	if t.Root == nil {
+		return
+	}
+
+	el, _ := t.Search(rr.Header().Name)
+	if el == nil {
+		return
+	}
+	el.DeleteRR(rr)
+	if el.Empty() {
+		t.deleteNode(rr)
+	}
+}
+
 // DeleteNode deletes the node that matches rr according to Less().
 func (t *Tree) deleteNode(rr dns.RR) {
 	if t.Root == nil {
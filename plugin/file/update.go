@@ -0,0 +1,414 @@
+package file
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// updatePolicy grants the holder of a TSIG key the right to update names in a zone with dynamic updates
+// (RFC 2136).
+type updatePolicy struct {
+	key   string              // name of the TSIG key
+	match string              // zonesub, subdomain or name
+	name  string              // name for subdomain and name
+	types map[uint16]struct{} // the types that may be updated, all when empty
+}
+
+// Match types of an update policy.
+const (
+	matchZonesub   = "zonesub"
+	matchSubdomain = "subdomain"
+	matchName      = "name"
+)
+
+// allows returns true when p allows the holder of key to update the records of type qtype at name.
+func (p updatePolicy) allows(key, name string, qtype uint16) bool {
+	if !strings.EqualFold(key, p.key) {
+		return false
+	}
+	switch p.match {
+	case matchSubdomain:
+		if !dns.IsSubDomain(p.name, name) {
+			return false
+		}
+	case matchName:
+		if !strings.EqualFold(p.name, name) {
+			return false
+		}
+	}
+	if len(p.types) == 0 {
+		return true
+	}
+	_, ok := p.types[qtype]
+	return ok
+}
+
+// update handles the dynamic update in state, and returns the rcode of the reply. The update must be signed
+// with a TSIG key of one of the update policies of z, which must allow each of the updated records. Changes
+// are added to the journal, so they can be transferred with IXFR, the zone is written to its file and the
+// secondaries are notified.
+func (z *Zone) update(state request.Request) int {
+	r := state.Req
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	if !strings.EqualFold(r.Question[0].Name, z.origin) {
+		return dns.RcodeNotAuth
+	}
+
+	z.RLock()
+	signed := len(z.Apex.SIGSOA) > 0
+	z.RUnlock()
+	if signed {
+		// The signatures and denial records can't be updated along with the records.
+		log.Infof("Refusing update of signed zone %s from %s", z.origin, state.IP())
+		return dns.RcodeRefused
+	}
+
+	key := updateKey(state)
+	if key == "" {
+		log.Infof("Refusing unsigned update of %s from %s", z.origin, state.IP())
+		return dns.RcodeRefused
+	}
+	if rcode := z.checkUpdate(key, r.Ns); rcode != dns.RcodeSuccess {
+		log.Infof("Refusing update of %s from %s with key %s: %s", z.origin, state.IP(), key, dns.RcodeToString[rcode])
+		return rcode
+	}
+
+	z.updateMu.Lock()
+	defer z.updateMu.Unlock()
+
+	// The update is applied to a copy of z, which replaces it when the update has been applied as a whole.
+	z.RLock()
+	rcode := z.checkPrerequisites(r.Answer)
+	var z1 *Zone
+	if rcode == dns.RcodeSuccess {
+		z1 = z.clone()
+	}
+	t := z.transfer
+	z.RUnlock()
+	if rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	d := z1.applyUpdate(r.Ns)
+	if d == nil {
+		return dns.RcodeSuccess
+	}
+	z.Lock()
+	z.Tree = z1.Tree
+	z.Apex = z1.Apex
+	z.appendJournal(d)
+	z.Unlock()
+	log.Infof("Updated %s from %s with key %s: %d deleted and %d added records, %d SOA serial", z.origin, state.IP(), key, len(d.deleted), len(d.added), d.to.Serial)
+
+	if err := z.writeZone(z.File()); err != nil {
+		log.Errorf("Failed to write updated zone %s to %s: %s", z.origin, z.File(), err)
+	}
+	if t != nil {
+		go func() {
+			if err := t.Notify(z.origin); err != nil {
+				log.Warningf("Failed sending notifies: %s", err)
+			}
+		}()
+	}
+	return dns.RcodeSuccess
+}
+
+// updateKey returns the name of the TSIG key the update in state is signed with, or an empty string when
+// it is unsigned, or the signature failed to verify.
+func updateKey(state request.Request) string {
+	rr := state.Req.IsTsig()
+	if rr == nil || state.W.TsigStatus() != nil {
+		return ""
+	}
+	return strings.ToLower(rr.Hdr.Name)
+}
+
+// checkUpdate checks the records of the update section (RFC 2136, section 3.4.1) and whether the policies
+// of z allow the holder of key to update them.
+func (z *Zone) checkUpdate(key string, updates []dns.RR) int {
+	for _, rr := range updates {
+		h := rr.Header()
+		if !dns.IsSubDomain(z.origin, h.Name) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassINET:
+			if isMeta(h.Rrtype) || h.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if h.Ttl != 0 || h.Rdlength != 0 || isMeta(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if h.Ttl != 0 || isMeta(h.Rrtype) || h.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+		switch h.Rrtype {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+			return dns.RcodeRefused // signed zones are not updated
+		}
+		if !z.allows(key, h.Name, h.Rrtype) {
+			return dns.RcodeRefused
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// allows returns true when one of the update policies of z allows the holder of key to update the records
+// of type qtype at name.
+func (z *Zone) allows(key, name string, qtype uint16) bool {
+	for _, p := range z.updatePolicies {
+		if p.allows(key, name, qtype) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMeta returns true for the meta types that can't be in an update.
+func isMeta(qtype uint16) bool {
+	switch qtype {
+	case dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG, dns.TypeTKEY:
+		return true
+	}
+	return false
+}
+
+// checkPrerequisites checks the prerequisites of an update (RFC 2136, section 3.2). The caller must hold
+// the lock of z.
+func (z *Zone) checkPrerequisites(prereqs []dns.RR) int {
+	type key struct {
+		name  string
+		qtype uint16
+	}
+	var rrsets map[key][]dns.RR // value dependent prerequisites
+
+	for _, rr := range prereqs {
+		h := rr.Header()
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(z.origin, h.Name) {
+			return dns.RcodeNotZone
+		}
+		name := strings.ToLower(h.Name)
+		switch h.Class {
+		case dns.ClassANY:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if !z.nameInUse(name) {
+					return dns.RcodeNameError
+				}
+			} else if len(z.rrset(name, h.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if z.nameInUse(name) {
+					return dns.RcodeYXDomain
+				}
+			} else if len(z.rrset(name, h.Rrtype)) != 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			if rrsets == nil {
+				rrsets = make(map[key][]dns.RR)
+			}
+			k := key{name, h.Rrtype}
+			rrsets[k] = append(rrsets[k], rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	for k, want := range rrsets {
+		if !equalRRset(z.rrset(k.name, k.qtype), want) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// equalRRset returns true when a and b hold the same records, ignoring their TTLs.
+func equalRRset(a, b []dns.RR) bool {
+	if len(a) == 0 {
+		return false
+	}
+	for _, rr := range a {
+		if !containsRR(b, rr) {
+			return false
+		}
+	}
+	for _, rr := range b {
+		if !containsRR(a, rr) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsRR returns true when rrs holds a record equal to r, ignoring the TTL.
+func containsRR(rrs []dns.RR, r dns.RR) bool { return indexRR(rrs, r) >= 0 }
+
+// rrset returns the records of type qtype at name. The caller must hold the lock of z.
+func (z *Zone) rrset(name string, qtype uint16) []dns.RR {
+	if name == z.origin {
+		switch qtype {
+		case dns.TypeSOA:
+			return []dns.RR{z.Apex.SOA}
+		case dns.TypeNS:
+			return z.Apex.NS
+		}
+	}
+	e, ok := z.Tree.Search(name)
+	if !ok {
+		return nil
+	}
+	return e.Type(qtype)
+}
+
+// records returns the records at name. The caller must hold the lock of z.
+func (z *Zone) records(name string) []dns.RR {
+	var rrs []dns.RR
+	if name == z.origin {
+		rrs = append(rrs, z.Apex.SOA)
+		rrs = append(rrs, z.Apex.NS...)
+	}
+	if e, ok := z.Tree.Search(name); ok {
+		rrs = append(rrs, e.All()...)
+	}
+	return rrs
+}
+
+// nameInUse returns true when name has records. The caller must hold the lock of z.
+func (z *Zone) nameInUse(name string) bool { return len(z.records(name)) > 0 }
+
+// applyUpdate applies the records of the update section (RFC 2136, section 3.4.2) to z, and bumps the
+// SOA serial. It returns the changes, or nil when nothing changed. z must not be serving queries, update
+// applies the records to a clone.
+func (z *Zone) applyUpdate(updates []dns.RR) *diff {
+	d := &diff{from: z.Apex.SOA}
+	var soa *dns.SOA
+
+	del := func(rr dns.RR) {
+		z.Delete(dns.Copy(rr))
+		if i := indexRR(d.added, rr); i >= 0 {
+			d.added = append(d.added[:i], d.added[i+1:]...)
+			return
+		}
+		d.deleted = append(d.deleted, rr)
+	}
+	add := func(rr dns.RR) {
+		z.Insert(rr)
+		if i := indexRR(d.deleted, rr); i >= 0 {
+			d.deleted = append(d.deleted[:i], d.deleted[i+1:]...)
+			return
+		}
+		d.added = append(d.added, rr)
+	}
+
+	for _, u := range updates {
+		rr := dns.Copy(u)
+		h := rr.Header()
+		h.Name = strings.ToLower(h.Name)
+		apex := h.Name == z.origin
+
+		switch h.Class {
+		case dns.ClassINET:
+			switch h.Rrtype {
+			case dns.TypeSOA:
+				current := z.Apex.SOA
+				if soa != nil {
+					current = soa
+				}
+				if apex && less(current.Serial, rr.(*dns.SOA).Serial) {
+					soa = rr.(*dns.SOA)
+				}
+				continue
+			case dns.TypeCNAME:
+				// A CNAME replaces a CNAME, and is ignored when the name has other records.
+				other := false
+				for _, x := range z.records(h.Name) {
+					if x.Header().Rrtype != dns.TypeCNAME {
+						other = true
+					}
+				}
+				if other {
+					continue
+				}
+				for _, x := range z.rrset(h.Name, dns.TypeCNAME) {
+					del(x)
+				}
+			default:
+				// Other records are ignored when the name has a CNAME.
+				if len(z.rrset(h.Name, dns.TypeCNAME)) > 0 {
+					continue
+				}
+			}
+			if containsRR(z.rrset(h.Name, h.Rrtype), rr) {
+				continue
+			}
+			add(rr)
+
+		case dns.ClassANY:
+			for _, x := range z.records(h.Name) {
+				t := x.Header().Rrtype
+				if h.Rrtype != dns.TypeANY && t != h.Rrtype {
+					continue
+				}
+				if apex && (t == dns.TypeSOA || t == dns.TypeNS) {
+					continue
+				}
+				del(x)
+			}
+
+		case dns.ClassNONE:
+			if h.Rrtype == dns.TypeSOA {
+				continue
+			}
+			rrs := z.rrset(h.Name, h.Rrtype)
+			if apex && h.Rrtype == dns.TypeNS && len(rrs) == 1 {
+				continue // the last NS record of the zone is never deleted
+			}
+			h.Class = dns.ClassINET
+			if i := indexRR(rrs, rr); i >= 0 {
+				del(rrs[i])
+			}
+		}
+	}
+
+	if len(d.deleted) == 0 && len(d.added) == 0 && soa == nil {
+		return nil
+	}
+	if soa == nil {
+		soa = dns.Copy(d.from).(*dns.SOA)
+		soa.Serial++
+	}
+	z.Insert(soa)
+	d.to = z.Apex.SOA
+	return d
+}
+
+// indexRR returns the index of the record in rrs equal to r, ignoring the TTL, or -1.
+func indexRR(rrs []dns.RR, r dns.RR) int {
+	for i, rr := range rrs {
+		if dns.IsDuplicate(rr, r) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,398 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+const dbUpdate = `$ORIGIN example.org.
+$TTL 3600
+@       IN SOA  ns1 hostmaster 1 3600 600 86400 60
+@       IN NS   ns1
+ns1     IN A    192.0.2.53
+www     IN A    192.0.2.1
+www     IN A    192.0.2.2
+mail    IN CNAME www
+dyn     IN TXT  "dynamic"
+`
+
+const ddnsKey = "ddns.example.org."
+
+// statusWriter is a test.ResponseWriter that returns status as the verification result of the TSIG.
+type statusWriter struct {
+	*test.ResponseWriter
+	status error
+}
+
+func (w *statusWriter) TsigStatus() error { return w.status }
+
+func newUpdateZone(t *testing.T, policies ...updatePolicy) *Zone {
+	path := filepath.Join(t.TempDir(), "db.example.org")
+	if err := os.WriteFile(path, []byte(dbUpdate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	z, err := Parse(strings.NewReader(dbUpdate), "example.org.", path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) == 0 {
+		policies = []updatePolicy{{key: ddnsKey, match: matchZonesub}}
+	}
+	z.updatePolicies = policies
+	return z
+}
+
+// updateState returns the signed update msg, prepared by prepare.
+func updateState(prepare func(m *dns.Msg)) request.Request {
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	prepare(m)
+	m.SetTsig(ddnsKey, dns.HmacSHA256, 300, time.Now().Unix())
+	return request.Request{W: &statusWriter{ResponseWriter: &test.ResponseWriter{}}, Req: m}
+}
+
+func TestUpdateAdd(t *testing.T) {
+	z := newUpdateZone(t)
+	state := updateState(func(m *dns.Msg) {
+		m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.10"), test.A("www.example.org. 300 IN A 192.0.2.1")})
+	})
+	if rcode := z.update(state); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+
+	if z.Apex.SOA.Serial != 2 {
+		t.Errorf("Expected serial 2, got %d", z.Apex.SOA.Serial)
+	}
+	if rrs := z.rrset("new.example.org.", dns.TypeA); len(rrs) != 1 {
+		t.Errorf("Expected added record, got %v", rrs)
+	}
+	if rrs := z.rrset("www.example.org.", dns.TypeA); len(rrs) != 2 {
+		t.Errorf("Expected duplicate to be ignored, got %v", rrs)
+	}
+	if len(z.journal) != 1 || len(z.journal[0].added) != 1 || len(z.journal[0].deleted) != 0 {
+		t.Fatalf("Expected journal with one added record, got %v", z.journal)
+	}
+
+	// The zone is written to its file.
+	f, err := os.Open(z.File())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	z1, err := Parse(f, "example.org.", z.File(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z1.Apex.SOA.Serial != 2 {
+		t.Errorf("Expected serial 2 in zone file, got %d", z1.Apex.SOA.Serial)
+	}
+	if e, _ := z1.Tree.Search("new.example.org."); e == nil {
+		t.Errorf("Expected added record in zone file")
+	}
+
+	// The change can be transferred with IXFR.
+	if diffs := z.journalFrom(1); len(diffs) != 1 {
+		t.Errorf("Expected journal from serial 1, got %v", diffs)
+	}
+}
+
+func TestUpdateDuringLookups(t *testing.T) {
+	z := newUpdateZone(t)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.org.", dns.TypeA)
+		state := request.Request{W: &test.ResponseWriter{}, Req: m}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// The updates replace one address of www with another, there are always 2.
+			if rrs, _, _, res := z.Lookup(context.TODO(), state, "www.example.org."); res != Success || len(rrs) != 2 {
+				t.Errorf("Expected 2 addresses for www.example.org., got %v", rrs)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		old, next := "192.0.2.2", "192.0.2.3"
+		if i%2 == 1 {
+			old, next = next, old
+		}
+		state := updateState(func(m *dns.Msg) {
+			m.Remove([]dns.RR{test.A("www.example.org. 0 IN A " + old)})
+			m.Insert([]dns.RR{test.A("www.example.org. 300 IN A " + next)})
+		})
+		if rcode := z.update(state); rcode != dns.RcodeSuccess {
+			t.Fatalf("Update %d: expected NOERROR, got %s", i, dns.RcodeToString[rcode])
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestUpdateAfterReload(t *testing.T) {
+	z := newUpdateZone(t)
+	add := func(name string) {
+		state := updateState(func(m *dns.Msg) {
+			m.Insert([]dns.RR{test.A(name + " 300 IN A 192.0.2.10")})
+		})
+		if rcode := z.update(state); rcode != dns.RcodeSuccess {
+			t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+		}
+	}
+	add("new1.example.org.")
+
+	// The operator edits the file, which is reloaded at serial 5.
+	edited := strings.Replace(dbUpdate, "hostmaster 1 ", "hostmaster 5 ", 1) + "edit    IN A    192.0.2.5\n"
+	if err := os.WriteFile(z.File(), []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !z.reload() {
+		t.Fatalf("Expected zone to be reloaded")
+	}
+	add("new2.example.org.")
+
+	if z.Apex.SOA.Serial != 6 {
+		t.Errorf("Expected serial 6, got %d", z.Apex.SOA.Serial)
+	}
+	if rrs := z.rrset("edit.example.org.", dns.TypeA); len(rrs) != 1 {
+		t.Errorf("Expected record of the edited file, got %v", rrs)
+	}
+
+	// The journal has no diff for the reload, a secondary at serial 1 or 2 gets the full zone.
+	for _, serial := range []uint32{1, 2} {
+		if diffs := z.journalFrom(serial); diffs != nil {
+			t.Errorf("Expected no journal from serial %d, got %v", serial, diffs)
+		}
+		ch, err := z.Transfer(serial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rrs []dns.RR
+		for r := range ch {
+			rrs = append(rrs, r...)
+		}
+		if len(rrs) < 2 || rrs[1].Header().Rrtype == dns.TypeSOA {
+			t.Errorf("Serial %d: expected full transfer, got %v", serial, rrs)
+		}
+	}
+	if diffs := z.journalFrom(5); len(diffs) != 1 {
+		t.Errorf("Expected journal from serial 5, got %v", diffs)
+	}
+}
+
+func TestUpdateDelete(t *testing.T) {
+	z := newUpdateZone(t)
+	state := updateState(func(m *dns.Msg) {
+		m.Remove([]dns.RR{test.A("www.example.org. 0 IN A 192.0.2.1")})
+		m.RemoveRRset([]dns.RR{&dns.TXT{Hdr: dns.RR_Header{Name: "dyn.example.org.", Rrtype: dns.TypeTXT}}})
+		m.RemoveName([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "mail.example.org."}}})
+		// Neither the SOA nor the last NS record of the zone are deleted.
+		m.RemoveName([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "example.org."}}})
+		m.Remove([]dns.RR{test.NS("example.org. 0 IN NS ns1.example.org.")})
+	})
+	if rcode := z.update(state); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+
+	if rrs := z.rrset("www.example.org.", dns.TypeA); len(rrs) != 1 || rrs[0].(*dns.A).A.String() != "192.0.2.2" {
+		t.Errorf("Expected 192.0.2.2 to be left, got %v", rrs)
+	}
+	for _, name := range []string{"dyn.example.org.", "mail.example.org."} {
+		if z.nameInUse(name) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+	if z.Apex.SOA == nil || len(z.Apex.NS) != 1 {
+		t.Errorf("Expected SOA and NS to be kept, got %v %v", z.Apex.SOA, z.Apex.NS)
+	}
+	if len(z.journal) != 1 || len(z.journal[0].deleted) != 3 {
+		t.Errorf("Expected journal with three deleted records, got %v", z.journal)
+	}
+}
+
+func TestUpdateNoChange(t *testing.T) {
+	z := newUpdateZone(t)
+	state := updateState(func(m *dns.Msg) {
+		m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.10")})
+		m.Remove([]dns.RR{test.A("new.example.org. 0 IN A 192.0.2.10")})
+		m.Remove([]dns.RR{test.A("www.example.org. 0 IN A 192.0.2.9")})
+	})
+	if rcode := z.update(state); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+	if z.Apex.SOA.Serial != 1 {
+		t.Errorf("Expected serial 1, got %d", z.Apex.SOA.Serial)
+	}
+	if len(z.journal) != 0 {
+		t.Errorf("Expected empty journal, got %v", z.journal)
+	}
+}
+
+func TestUpdateCNAME(t *testing.T) {
+	z := newUpdateZone(t)
+	state := updateState(func(m *dns.Msg) {
+		m.Insert([]dns.RR{
+			test.A("mail.example.org. 300 IN A 192.0.2.25"),               // ignored, mail has a CNAME
+			test.CNAME("www.example.org. 300 IN CNAME mail.example.org."), // ignored, www has other records
+			test.CNAME("mail.example.org. 300 IN CNAME new.example.org."), // replaces the CNAME
+		})
+	})
+	if rcode := z.update(state); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+	if rrs := z.records("mail.example.org."); len(rrs) != 1 || rrs[0].(*dns.CNAME).Target != "new.example.org." {
+		t.Errorf("Expected mail.example.org. CNAME new.example.org., got %v", rrs)
+	}
+	if rrs := z.rrset("www.example.org.", dns.TypeCNAME); len(rrs) != 0 {
+		t.Errorf("Expected no CNAME for www.example.org., got %v", rrs)
+	}
+}
+
+func TestUpdateSOA(t *testing.T) {
+	z := newUpdateZone(t)
+	state := updateState(func(m *dns.Msg) {
+		m.Insert([]dns.RR{test.SOA("example.org. 3600 IN SOA ns1.example.org. hostmaster.example.org. 2021010100 3600 600 86400 60")})
+	})
+	if rcode := z.update(state); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+	if z.Apex.SOA.Serial != 2021010100 {
+		t.Errorf("Expected serial 2021010100, got %d", z.Apex.SOA.Serial)
+	}
+}
+
+func TestUpdatePrerequisites(t *testing.T) {
+	tests := []struct {
+		prereq []dns.RR
+		used   bool // NameUsed or RRsetUsed instead of NameNotUsed or RRsetNotUsed
+		rcode  int
+	}{
+		{[]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "www.example.org."}}}, true, dns.RcodeSuccess},
+		{[]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "nope.example.org."}}}, true, dns.RcodeNameError},
+		{[]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "nope.example.org."}}}, false, dns.RcodeSuccess},
+		{[]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "www.example.org."}}}, false, dns.RcodeYXDomain},
+		{[]dns.RR{test.A("www.example.org. 0 IN A 127.0.0.1")}, true, dns.RcodeSuccess},
+		{[]dns.RR{test.AAAA("www.example.org. 0 IN AAAA ::1")}, true, dns.RcodeNXRrset},
+		{[]dns.RR{test.AAAA("www.example.org. 0 IN AAAA ::1")}, false, dns.RcodeSuccess},
+		{[]dns.RR{test.A("www.example.org. 0 IN A 127.0.0.1")}, false, dns.RcodeYXRrset},
+		{[]dns.RR{test.A("www.example.net. 0 IN A 127.0.0.1")}, true, dns.RcodeNotZone},
+	}
+
+	for i, tc := range tests {
+		z := newUpdateZone(t)
+		state := updateState(func(m *dns.Msg) {
+			switch _, any := tc.prereq[0].(*dns.ANY); {
+			case any && tc.used:
+				m.NameUsed(tc.prereq)
+			case any:
+				m.NameNotUsed(tc.prereq)
+			case tc.used:
+				m.RRsetUsed(tc.prereq)
+			default:
+				m.RRsetNotUsed(tc.prereq)
+			}
+			m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.10")})
+		})
+		if rcode := z.update(state); rcode != tc.rcode {
+			t.Errorf("Test %d: expected %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+		}
+	}
+}
+
+func TestUpdateValuePrerequisites(t *testing.T) {
+	tests := []struct {
+		prereq []dns.RR
+		rcode  int
+	}{
+		{[]dns.RR{test.A("www.example.org. 0 IN A 192.0.2.1"), test.A("www.example.org. 0 IN A 192.0.2.2")}, dns.RcodeSuccess},
+		{[]dns.RR{test.A("www.example.org. 0 IN A 192.0.2.1")}, dns.RcodeNXRrset},
+		{[]dns.RR{test.A("www.example.org. 0 IN A 192.0.2.1"), test.A("www.example.org. 0 IN A 192.0.2.3")}, dns.RcodeNXRrset},
+		{[]dns.RR{test.A("nope.example.org. 0 IN A 192.0.2.1")}, dns.RcodeNXRrset},
+	}
+
+	for i, tc := range tests {
+		z := newUpdateZone(t)
+		state := updateState(func(m *dns.Msg) {
+			m.Used(tc.prereq)
+			m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.10")})
+		})
+		if rcode := z.update(state); rcode != tc.rcode {
+			t.Errorf("Test %d: expected %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+		}
+	}
+}
+
+func TestUpdateRefused(t *testing.T) {
+	insert := func(m *dns.Msg) { m.Insert([]dns.RR{test.A("www.dyn.example.org. 300 IN A 192.0.2.10")}) }
+
+	tests := []struct {
+		policies []updatePolicy
+		state    request.Request
+		rcode    int
+	}{
+		// allowed
+		{[]updatePolicy{{key: ddnsKey, match: matchSubdomain, name: "dyn.example.org."}}, updateState(insert), dns.RcodeSuccess},
+		{[]updatePolicy{{key: ddnsKey, match: matchName, name: "www.dyn.example.org.", types: map[uint16]struct{}{dns.TypeA: {}}}}, updateState(insert), dns.RcodeSuccess},
+		{nil, updateState(insert), dns.RcodeSuccess},
+		// not allowed
+		{[]updatePolicy{{key: "other.example.org.", match: matchZonesub}}, updateState(insert), dns.RcodeRefused},
+		{[]updatePolicy{{key: ddnsKey, match: matchSubdomain, name: "static.example.org."}}, updateState(insert), dns.RcodeRefused},
+		{[]updatePolicy{{key: ddnsKey, match: matchName, name: "dyn.example.org."}}, updateState(insert), dns.RcodeRefused},
+		{[]updatePolicy{{key: ddnsKey, match: matchZonesub, types: map[uint16]struct{}{dns.TypeAAAA: {}}}}, updateState(insert), dns.RcodeRefused},
+		// not signed, or bad signature
+		{nil, request.Request{W: &test.ResponseWriter{}, Req: new(dns.Msg).SetUpdate("example.org.")}, dns.RcodeRefused},
+		{nil, func() request.Request {
+			state := updateState(insert)
+			state.W.(*statusWriter).status = dns.ErrSig
+			return state
+		}(), dns.RcodeRefused},
+		// bad update
+		{nil, updateState(func(m *dns.Msg) { m.Insert([]dns.RR{test.A("www.example.net. 300 IN A 192.0.2.10")}) }), dns.RcodeNotZone},
+		{nil, updateState(func(m *dns.Msg) { m.Question[0].Name = "www.example.org." }), dns.RcodeNotAuth},
+		{nil, updateState(func(m *dns.Msg) { m.Question[0].Qtype = dns.TypeA }), dns.RcodeFormatError},
+		{nil, updateState(func(m *dns.Msg) {
+			m.Insert([]dns.RR{test.RRSIG("www.example.org. 300 IN RRSIG A 8 3 300 20211231000000 20210101000000 12345 example.org. c2lnbmF0dXJl")})
+		}), dns.RcodeRefused},
+	}
+
+	for i, tc := range tests {
+		z := newUpdateZone(t, tc.policies...)
+		if rcode := z.update(tc.state); rcode != tc.rcode {
+			t.Errorf("Test %d: expected %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+		}
+	}
+}
+
+func TestUpdateSigned(t *testing.T) {
+	z := newUpdateZone(t)
+	if err := z.Insert(test.RRSIG("example.org. 3600 IN RRSIG SOA 8 2 3600 20211231000000 20210101000000 12345 example.org. c2lnbmF0dXJl")); err != nil {
+		t.Fatal(err)
+	}
+
+	state := updateState(func(m *dns.Msg) { m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 192.0.2.10")}) })
+	if rcode := z.update(state); rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for an update of a signed zone, got %s", dns.RcodeToString[rcode])
+	}
+	if rrs := z.rrset("new.example.org.", dns.TypeA); len(rrs) != 0 {
+		t.Errorf("Expected the signed zone to be unchanged, got %v", rrs)
+	}
+}
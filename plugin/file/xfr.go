@@ -16,28 +16,51 @@ func (f File) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
 	return z.Transfer(serial)
 }
 
-// Transfer transfers a zone with serial in the returned channel and implements IXFR fallback, by just
-// sending a single SOA record.
+// Transfer transfers a zone with serial in the returned channel. For IXFR the changes since serial are sent
+// when they are in the journal, otherwise it falls back to AXFR. An up to date IXFR is answered with just
+// a single SOA record.
 func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
 	// get soa and apex
 	apex, err := z.ApexIfDefined()
 	if err != nil {
 		return nil, err
 	}
+	soa := apex[0].(*dns.SOA)
+
+	var diffs []*diff
+	if serial != 0 && soa.Serial != serial {
+		diffs = z.journalFrom(serial)
+	}
+
+	// Take the records under the lock, as the zone may be changed while the transfer is sent.
+	var rrs [][]dns.RR
+	if serial == 0 || soa.Serial != serial && diffs == nil {
+		z.RLock()
+		z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { rrs = append(rrs, e.All()); return nil })
+		z.RUnlock()
+	}
 
 	ch := make(chan []dns.RR)
 	go func() {
-		if serial != 0 && apex[0].(*dns.SOA).Serial == serial { // ixfr fallback, only send SOA
-			ch <- []dns.RR{apex[0]}
+		switch {
+		case serial != 0 && soa.Serial == serial: // ixfr fallback, only send SOA
+			ch <- []dns.RR{soa}
 
-			close(ch)
-			return
-		}
-
-		ch <- apex
-		z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { ch <- e.All(); return nil })
-		ch <- []dns.RR{apex[0]}
+		case diffs != nil: // ixfr
+			ch <- []dns.RR{soa}
+			for _, d := range diffs {
+				ch <- append([]dns.RR{d.from}, d.deleted...)
+				ch <- append([]dns.RR{d.to}, d.added...)
+			}
+			ch <- []dns.RR{soa}
 
+		default:
+			ch <- apex
+			for _, r := range rrs {
+				ch <- r
+			}
+			ch <- []dns.RR{soa}
+		}
 		close(ch)
 	}()
 
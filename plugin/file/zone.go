@@ -7,8 +7,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin/file/tree"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/coredns/coredns/plugin/transfer"
 
 	"github.com/miekg/dns"
 )
@@ -26,10 +28,19 @@ type Zone struct {
 
 	StartupOnce  sync.Once
 	TransferFrom []string
+	TsigKey      *dnsserver.TsigKey // signs the requests to, and is required on the notifies from, the primaries
+	CacheFile    string             // file the zone is written to after each transfer, to load it on startup
+	cacheExpire  time.Time          // when the zone loaded from CacheFile expires, unless transferred again
 
 	ReloadInterval time.Duration
 	reloadShutdown chan bool
 
+	journal []*diff // changes received by IXFR or made by dynamic updates, oldest first
+
+	updatePolicies []updatePolicy     // policies for dynamic updates, none allows no updates
+	updateMu       sync.Mutex         // serializes dynamic updates, including the writing of the zone file
+	transfer       *transfer.Transfer // sends notifies after dynamic updates
+
 	Upstream *upstream.Upstream // Upstream for looking up external names during the resolution process.
 }
 
@@ -71,6 +82,24 @@ func (z *Zone) CopyWithoutApex() *Zone {
 	return z1
 }
 
+// clone returns a copy of z with its own tree, that can be changed while z serves queries. The records
+// themselves are shared. The caller must hold the lock of z.
+func (z *Zone) clone() *Zone {
+	z1 := z.CopyWithoutApex()
+	z1.Apex = Apex{
+		SOA:    z.Apex.SOA,
+		NS:     append([]dns.RR(nil), z.Apex.NS...),
+		SIGSOA: append([]dns.RR(nil), z.Apex.SIGSOA...),
+		SIGNS:  append([]dns.RR(nil), z.Apex.SIGNS...),
+	}
+	for _, e := range z.Tree.All() {
+		for _, rr := range e.All() {
+			z1.Tree.Insert(rr)
+		}
+	}
+	return z1
+}
+
 // Insert inserts r into z.
 func (z *Zone) Insert(r dns.RR) error {
 	r.Header().Name = strings.ToLower(r.Header().Name)
@@ -115,6 +144,54 @@ func (z *Zone) Insert(r dns.RR) error {
 	return nil
 }
 
+// Delete deletes r from z. The SOA record is never deleted, it is only replaced by inserting a new one.
+func (z *Zone) Delete(r dns.RR) {
+	r.Header().Name = strings.ToLower(r.Header().Name)
+
+	switch h := r.Header().Rrtype; h {
+	case dns.TypeNS:
+		r.(*dns.NS).Ns = strings.ToLower(r.(*dns.NS).Ns)
+
+		if r.Header().Name == z.origin {
+			z.Apex.NS = deleteRR(z.Apex.NS, r)
+			return
+		}
+	case dns.TypeSOA:
+		return
+	case dns.TypeRRSIG:
+		x := r.(*dns.RRSIG)
+		switch x.TypeCovered {
+		case dns.TypeSOA:
+			z.Apex.SIGSOA = deleteRR(z.Apex.SIGSOA, x)
+			return
+		case dns.TypeNS:
+			if r.Header().Name == z.origin {
+				z.Apex.SIGNS = deleteRR(z.Apex.SIGNS, x)
+				return
+			}
+		}
+	case dns.TypeCNAME:
+		r.(*dns.CNAME).Target = strings.ToLower(r.(*dns.CNAME).Target)
+	case dns.TypeMX:
+		r.(*dns.MX).Mx = strings.ToLower(r.(*dns.MX).Mx)
+	case dns.TypeSRV:
+		r.(*dns.SRV).Target = strings.ToLower(r.(*dns.SRV).Target)
+	}
+
+	z.Tree.DeleteRR(r)
+}
+
+// deleteRR returns rrs without the records equal to r.
+func deleteRR(rrs []dns.RR, r dns.RR) []dns.RR {
+	keep := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		if !dns.IsDuplicate(rr, r) {
+			keep = append(keep, rr)
+		}
+	}
+	return keep
+}
+
 // File retrieves the file path in a safe way.
 func (z *Zone) File() string {
 	z.RLock()
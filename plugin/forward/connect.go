@@ -114,9 +114,29 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 
 	var ret *dns.Msg
 	pc.c.SetReadDeadline(time.Now().Add(readTimeout))
+	stop := func() {}
+	if opts.cancelable {
+		// Unblock the read below when the query is cancelled, i.e. when another upstream won the race.
+		// stop must have returned before the connection is given back, so that the deadline of a
+		// connection that is in use by another query is never changed.
+		done, exited := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-ctx.Done():
+				pc.c.SetReadDeadline(time.Now())
+			case <-done:
+			}
+		}()
+		stop = func() {
+			close(done)
+			<-exited
+		}
+	}
 	for {
 		ret, err = pc.c.ReadMsg()
 		if err != nil {
+			stop()
 			pc.c.Close() // not giving it back
 			if err == io.EOF && cached {
 				return nil, ErrCachedClosed
@@ -132,6 +152,7 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 			break
 		}
 	}
+	stop()
 	// recovery the origin Id after upstream.
 	ret.Id = originId
 
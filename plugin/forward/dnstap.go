@@ -44,7 +44,7 @@ func toDnstap(f *Forward, host string, state request.Request, opts options, repl
 		q.QueryMessage = buf
 	}
 	msg.SetType(q, tap.Message_FORWARDER_QUERY)
-	f.tapPlugin.TapMessage(q)
+	f.tapPlugin.TapMessageFor(q, state.Req)
 
 	// Response
 	if reply != nil {
@@ -58,6 +58,6 @@ func toDnstap(f *Forward, host string, state request.Request, opts options, repl
 		msg.SetResponseAddress(r, ta)
 		msg.SetResponseTime(r, time.Now())
 		msg.SetType(r, tap.Message_FORWARDER_RESPONSE)
-		f.tapPlugin.TapMessage(r)
+		f.tapPlugin.TapMessageFor(r, reply)
 	}
 }
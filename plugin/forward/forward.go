@@ -15,7 +15,9 @@ import (
 	"github.com/coredns/coredns/plugin/debug"
 	"github.com/coredns/coredns/plugin/dnstap"
 	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/stale"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -37,6 +39,8 @@ type Forward struct {
 	from    string
 	ignored []string
 
+	routes *routes // per zone upstreams, nil when no routes are configured
+
 	tlsConfig     *tls.Config
 	tlsServerName string
 	maxfails      uint32
@@ -80,21 +84,39 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		return plugin.NextOrFailure(f.Name(), f.Next, ctx, w, r)
 	}
 
+	proxies := f.proxies
+	if f.routes != nil {
+		if p := f.routes.lookup(state.Name()); p != nil {
+			proxies = p
+		}
+	}
+
+	// A raced query has multiple upstream queries in flight, each of which counts towards max_concurrent.
+	inflight := int64(1)
+	rc, racing := f.p.(*race)
+	if racing {
+		inflight = int64(rc.fanout(len(proxies)))
+	}
+
 	if f.maxConcurrent > 0 {
-		count := atomic.AddInt64(&(f.concurrent), 1)
-		defer atomic.AddInt64(&(f.concurrent), -1)
+		count := atomic.AddInt64(&(f.concurrent), inflight)
+		defer atomic.AddInt64(&(f.concurrent), -inflight)
 		if count > f.maxConcurrent {
 			MaxConcurrentRejectCount.Add(1)
 			return dns.RcodeRefused, f.ErrLimitExceeded
 		}
 	}
 
+	if racing {
+		return f.serveRace(ctx, state, proxies, int(inflight))
+	}
+
 	fails := 0
 	var span, child ot.Span
 	var upstreamErr error
 	span = ot.SpanFromContext(ctx)
 	i := 0
-	list := f.List()
+	list := f.p.List(proxies)
 	deadline := time.Now().Add(defaultTimeout)
 	start := time.Now()
 	for time.Now().Before(deadline) {
@@ -108,13 +130,13 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		i++
 		if proxy.Down(f.maxfails) {
 			fails++
-			if fails < len(f.proxies) {
+			if fails < len(proxies) {
 				continue
 			}
 			// All upstream proxies are dead, assume healthcheck is completely broken and randomly
 			// select an upstream to connect to.
 			r := new(random)
-			proxy = r.List(f.proxies)[0]
+			proxy = r.List(proxies)[0]
 
 			HealthcheckBrokenCount.Add(1)
 		}
@@ -129,23 +151,7 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			return proxy.addr
 		})
 
-		var (
-			ret *dns.Msg
-			err error
-		)
-		opts := f.opts
-		for {
-			ret, err = proxy.Connect(ctx, state, opts)
-			if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
-				continue
-			}
-			// Retry with TCP if truncated and prefer_udp configured.
-			if ret != nil && ret.Truncated && !opts.forceTCP && opts.preferUDP {
-				opts.forceTCP = true
-				continue
-			}
-			break
-		}
+		ret, opts, err := exchange(ctx, proxy, state, f.opts)
 
 		if child != nil {
 			child.Finish()
@@ -163,7 +169,7 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 				proxy.Healthcheck()
 			}
 
-			if fails < len(f.proxies) {
+			if fails < len(proxies) {
 				continue
 			}
 			break
@@ -183,11 +189,44 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		return 0, nil
 	}
 
-	if upstreamErr != nil {
-		return dns.RcodeServerFailure, upstreamErr
+	return fail(ctx, upstreamErr)
+}
+
+// fail is called when none of the upstreams answered the query. When a plugin before forward offers
+// stale data for the query it is used to answer it, otherwise SERVFAIL is returned with err, wrapped in
+// an edns.ExtendedError telling why, which the server adds to its reply.
+func fail(ctx context.Context, err error) (int, error) {
+	if err == nil {
+		err = ErrNoHealthy
+	}
+	if stale.Serve(ctx) {
+		log.Debugf("Answered with stale data: %s", err)
+		return 0, nil
+	}
+
+	code := dns.ExtendedErrorCodeNetworkError
+	if err == ErrNoHealthy {
+		code = dns.ExtendedErrorCodeNoReachableAuthority
 	}
+	return dns.RcodeServerFailure, &edns.ExtendedError{Code: code, Err: err}
+}
 
-	return dns.RcodeServerFailure, ErrNoHealthy
+// exchange sends the query in state to proxy. It retries when a cached connection was closed by the remote
+// side and, if prefer_udp is configured, over TCP when the reply was truncated. The options used for the
+// final attempt are returned.
+func exchange(ctx context.Context, proxy *Proxy, state request.Request, opts options) (*dns.Msg, options, error) {
+	for {
+		ret, err := proxy.Connect(ctx, state, opts)
+		if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
+			continue
+		}
+		// Retry with TCP if truncated and prefer_udp configured.
+		if ret != nil && ret.Truncated && !opts.forceTCP && opts.preferUDP {
+			opts.forceTCP = true
+			continue
+		}
+		return ret, opts, err
+	}
 }
 
 func (f *Forward) match(state request.Request) bool {
@@ -234,6 +273,7 @@ type options struct {
 	forceTCP           bool
 	preferUDP          bool
 	hcRecursionDesired bool
+	cancelable         bool // abort the upstream exchange when the context is done
 }
 
 var defaultTimeout = 5 * time.Second
@@ -1,7 +1,18 @@
 package forward
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/pkg/stale"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func TestList(t *testing.T) {
@@ -22,3 +33,55 @@ func TestList(t *testing.T) {
 		}
 	}
 }
+
+type staleServer struct{ w dns.ResponseWriter }
+
+func (s staleServer) ServeStale() bool {
+	m := new(dns.Msg)
+	m.Answer = []dns.RR{test.A("example.org. 0 IN A 127.0.0.1")}
+	s.w.WriteMsg(m)
+	return true
+}
+
+func TestFailure(t *testing.T) {
+	// Nothing listens on this port, all queries fail.
+	c := caddy.NewTestController("dns", "forward . 127.0.0.1:1 {\nmax_fails 0\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	defer func(d time.Duration) { defaultTimeout = d }(defaultTimeout)
+	defaultTimeout = 100 * time.Millisecond
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.SetEdns0(4096, false)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	rcode, err := f.ServeDNS(context.TODO(), rec, m)
+	if rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected %s without stale data, got %s", dns.RcodeToString[dns.RcodeServerFailure], dns.RcodeToString[rcode])
+	}
+	var ede *edns.ExtendedError
+	if !errors.As(err, &ede) {
+		t.Errorf("Expected an extended error, got %v", err)
+	} else if ede.Code != dns.ExtendedErrorCodeNetworkError {
+		t.Errorf("Expected extended error %d, got %d", dns.ExtendedErrorCodeNetworkError, ede.Code)
+	}
+	if rec.Msg != nil {
+		t.Errorf("Expected no reply to be written, got %v", rec.Msg)
+	}
+
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	ctx := stale.NewContext(context.TODO(), staleServer{rec})
+	rcode, err = f.ServeDNS(ctx, rec, m)
+	if rcode != dns.RcodeSuccess || err != nil {
+		t.Errorf("Expected stale answer, got %s: %v", dns.RcodeToString[rcode], err)
+	}
+	if rec.Msg == nil || len(rec.Msg.Answer) != 1 {
+		t.Errorf("Expected stale answer to be written")
+	}
+}
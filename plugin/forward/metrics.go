@@ -52,6 +52,18 @@ var (
 		Name:      "max_concurrent_rejects_total",
 		Help:      "Counter of the number of queries rejected because the concurrent queries were at maximum.",
 	})
+	RaceWinsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "race_wins_total",
+		Help:      "Counter of raced queries answered by an upstream.",
+	}, []string{"to"})
+	RaceCancelsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "race_cancels_total",
+		Help:      "Counter of raced queries cancelled per upstream because another upstream answered first.",
+	}, []string{"to"})
 	ConnCacheHitsCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
 		Subsystem: "forward",
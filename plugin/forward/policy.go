@@ -65,4 +65,24 @@ func (r *sequential) List(p []*Proxy) []*Proxy {
 	return p
 }
 
+// race is a policy that sends each query to the first n upstreams concurrently and uses the first valid
+// response. The upstreams are returned in the configured order.
+type race struct {
+	n int
+}
+
+func (r *race) String() string { return "race" }
+
+func (r *race) List(p []*Proxy) []*Proxy {
+	return p
+}
+
+// fanout returns the number of upstreams that are queried concurrently when l upstreams are configured.
+func (r *race) fanout(l int) int {
+	if r.n > l {
+		return l
+	}
+	return r.n
+}
+
 var rn = rand.New(time.Now().UnixNano())
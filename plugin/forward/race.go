@@ -0,0 +1,114 @@
+package forward
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin/debug"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// serveRace sends the query to n upstreams concurrently and writes the first valid response back to the
+// client; the queries still in flight are then cancelled. A response is valid when it matches the query
+// and its rcode is neither SERVFAIL nor REFUSED. When no response is valid the last one received is used.
+func (f *Forward) serveRace(ctx context.Context, state request.Request, proxies []*Proxy, n int) (int, error) {
+	list := f.raceList(proxies, n)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		proxy *Proxy
+		ret   *dns.Msg
+		err   error
+	}
+	results := make(chan result, len(list))
+	start := time.Now()
+
+	for _, proxy := range list {
+		go func(proxy *Proxy) {
+			// Connect rewrites the message ID, so every upstream gets its own copy of the query.
+			st := request.Request{W: state.W, Req: state.Req.Copy()}
+			opts := f.opts
+			opts.cancelable = true
+
+			ret, opts, err := exchange(ctx, proxy, st, opts)
+			if f.tapPlugin != nil {
+				toDnstap(f, proxy.addr, st, opts, ret, start)
+			}
+			results <- result{proxy: proxy, ret: ret, err: err}
+		}(proxy)
+	}
+
+	var (
+		last        *dns.Msg
+		upstreamErr error
+	)
+	pending := make(map[*Proxy]bool, len(list))
+	for _, proxy := range list {
+		pending[proxy] = true
+	}
+
+	for range list {
+		res := <-results
+		delete(pending, res.proxy)
+
+		if res.err != nil {
+			upstreamErr = res.err
+			// Kick off health check to see if *our* upstream is broken.
+			if f.maxfails != 0 {
+				res.proxy.Healthcheck()
+			}
+			continue
+		}
+
+		if !state.Match(res.ret) {
+			debug.Hexdumpf(res.ret, "Wrong reply for id: %d, %s %d", res.ret.Id, state.QName(), state.QType())
+			continue
+		}
+
+		if res.ret.Rcode == dns.RcodeServerFailure || res.ret.Rcode == dns.RcodeRefused {
+			last = res.ret
+			continue
+		}
+
+		cancel()
+		RaceWinsCount.WithLabelValues(res.proxy.addr).Add(1)
+		for p := range pending {
+			RaceCancelsCount.WithLabelValues(p.addr).Add(1)
+		}
+
+		state.W.WriteMsg(res.ret)
+		return 0, nil
+	}
+
+	if last != nil {
+		state.W.WriteMsg(last)
+		return 0, nil
+	}
+
+	return fail(ctx, upstreamErr)
+}
+
+// raceList returns the first n healthy upstreams from proxies in the configured order. When all upstreams
+// are down health checking is assumed to be broken and n random upstreams are returned instead.
+func (f *Forward) raceList(proxies []*Proxy, n int) []*Proxy {
+	list := make([]*Proxy, 0, n)
+	for _, p := range f.p.List(proxies) {
+		if p.Down(f.maxfails) {
+			continue
+		}
+		list = append(list, p)
+		if len(list) == n {
+			return list
+		}
+	}
+	if len(list) > 0 {
+		return list
+	}
+
+	HealthcheckBrokenCount.Add(1)
+	return new(random).List(proxies)[:n]
+}
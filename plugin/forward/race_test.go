@@ -0,0 +1,143 @@
+package forward
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// newTestServers starts a test server for each handler. As dnstest.NewServer registers its handler for
+// all servers, queries are dispatched to the handlers on the port they were received on.
+func newTestServers(handlers ...dns.HandlerFunc) []*dnstest.Server {
+	var mu sync.RWMutex
+	ports := make(map[string]dns.HandlerFunc, len(handlers))
+	dispatch := func(w dns.ResponseWriter, r *dns.Msg) {
+		_, port, _ := net.SplitHostPort(w.LocalAddr().String())
+		mu.RLock()
+		h := ports[port]
+		mu.RUnlock()
+		h(w, r)
+	}
+
+	servers := make([]*dnstest.Server, len(handlers))
+	for i, h := range handlers {
+		servers[i] = dnstest.NewServer(dispatch)
+		_, port, _ := net.SplitHostPort(servers[i].Addr)
+		mu.Lock()
+		ports[port] = h
+		mu.Unlock()
+	}
+	return servers
+}
+
+func TestRace(t *testing.T) {
+	s := newTestServers(
+		func(w dns.ResponseWriter, r *dns.Msg) {
+			time.Sleep(500 * time.Millisecond)
+			ret := new(dns.Msg)
+			ret.SetReply(r)
+			ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.2"))
+			w.WriteMsg(ret)
+		},
+		func(w dns.ResponseWriter, r *dns.Msg) {
+			ret := new(dns.Msg)
+			ret.SetRcode(r, dns.RcodeServerFailure)
+			w.WriteMsg(ret)
+		},
+		func(w dns.ResponseWriter, r *dns.Msg) {
+			ret := new(dns.Msg)
+			ret.SetReply(r)
+			ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+			w.WriteMsg(ret)
+		},
+	)
+	slow, servfail, fast := s[0], s[1], s[2]
+	defer slow.Close()
+	defer servfail.Close()
+	defer fast.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+slow.Addr+" "+servfail.Addr+" "+fast.Addr+" {\npolicy race 3\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	start := time.Now()
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("Expected the fast upstream to win the race, took %s", d)
+	}
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected %s, got %s", dns.RcodeToString[dns.RcodeSuccess], dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if x := rec.Msg.Answer[0].(*dns.A).A.String(); x != "127.0.0.1" {
+		t.Errorf("Expected answer from fast upstream %s, got %s", "127.0.0.1", x)
+	}
+	if rec.Msg.Id != m.Id {
+		t.Errorf("Expected message ID %d, got %d", m.Id, rec.Msg.Id)
+	}
+}
+
+func TestRaceAllFail(t *testing.T) {
+	servfail := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetRcode(r, dns.RcodeServerFailure)
+		w.WriteMsg(ret)
+	})
+	defer servfail.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+servfail.Addr+" "+servfail.Addr+" {\npolicy race 2\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected %s, got %s", dns.RcodeToString[dns.RcodeServerFailure], dns.RcodeToString[rec.Msg.Rcode])
+	}
+}
+
+func TestRaceMaxConcurrent(t *testing.T) {
+	c := caddy.NewTestController("dns", "forward . 127.0.0.1 127.0.0.2 127.0.0.3 {\npolicy race 2\nmax_concurrent 3\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	// One raced query is in flight, a second one would bring the total to 4 upstream queries.
+	f.concurrent = 2
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	rcode, err := f.ServeDNS(context.TODO(), &test.ResponseWriter{}, m)
+	if rcode != dns.RcodeRefused {
+		t.Errorf("Expected %s, got %s", dns.RcodeToString[dns.RcodeRefused], dns.RcodeToString[rcode])
+	}
+	if err != f.ErrLimitExceeded {
+		t.Errorf("Expected %v, got %v", f.ErrLimitExceeded, err)
+	}
+}
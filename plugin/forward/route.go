@@ -0,0 +1,235 @@
+package forward
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+)
+
+// route is a single routing rule: queries for names at or below zone are sent to the upstreams in to.
+type route struct {
+	zone string
+	to   []string
+}
+
+// newRoutes parses a routing rule for zone. A zone given in CIDR notation may expand to multiple rules.
+func newRoutes(zone string, to []string) ([]route, error) {
+	zones := plugin.Host(zone).NormalizeExact()
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("unable to normalize '%s'", zone)
+	}
+	toHosts, err := parseTo(to)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]route, len(zones))
+	for i := range zones {
+		rules[i] = route{zone: zones[i], to: toHosts}
+	}
+	return rules, nil
+}
+
+// parseRoutes parses a routing file. Each line holds a zone followed by its upstreams, the same as
+// the route property. Empty lines and everything after a '#' are ignored.
+func parseRoutes(r io.Reader) ([]route, error) {
+	var rules []route
+
+	scanner := bufio.NewScanner(r)
+	for i := 1; scanner.Scan(); i++ {
+		line := scanner.Text()
+		if j := strings.IndexByte(line, '#'); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: no upstreams for '%s'", i, fields[0])
+		}
+		rs, err := newRoutes(fields[0], fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i, err)
+		}
+		rules = append(rules, rs...)
+	}
+	return rules, scanner.Err()
+}
+
+// routes is a routing table that sends queries to a group of upstreams based on the longest matching
+// zone. The rules are defined inline in the Corefile and/or read from a file that is reloaded when
+// it changes. Upstreams are shared between all rules that use them, so each one is health checked once.
+type routes struct {
+	sync.RWMutex
+	table   map[string][]*Proxy
+	proxies map[string]*Proxy // all upstreams used in table, keyed by host
+	running bool
+
+	inline []route
+	path   string
+	reload time.Duration
+
+	// mtime and size are only read and modified by a single goroutine
+	mtime time.Time
+	size  int64
+
+	newProxy   func(host string) *Proxy
+	hcInterval time.Duration
+	stop       chan bool
+}
+
+func newRouteTable() *routes {
+	return &routes{reload: defaultRouteReload}
+}
+
+// lookup returns the upstreams for the longest zone that matches name, or nil if there is none.
+func (r *routes) lookup(name string) []*Proxy {
+	r.RLock()
+	defer r.RUnlock()
+
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if p, ok := r.table[name[off:]]; ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// Len returns the number of zones in the routing table.
+func (r *routes) Len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.table)
+}
+
+// load (re)builds the routing table from the inline rules and the routing file. When the file is
+// unchanged since the last load nothing is done.
+func (r *routes) load() error {
+	var rules []route
+	if r.path != "" {
+		file, err := os.Open(r.path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if r.table != nil && r.mtime.Equal(stat.ModTime()) && r.size == stat.Size() {
+			return nil
+		}
+		rules, err = parseRoutes(file)
+		if err != nil {
+			return fmt.Errorf("%s: %s", r.path, err)
+		}
+		r.mtime = stat.ModTime()
+		r.size = stat.Size()
+	}
+	// Inline rules take precedence over the ones from the file.
+	rules = append(rules, r.inline...)
+
+	r.build(rules)
+	return nil
+}
+
+// build replaces the routing table with one made from rules. Upstreams already in use are kept; when
+// the routing table is running new upstreams are started and unused ones are stopped.
+func (r *routes) build(rules []route) {
+	r.RLock()
+	old := r.proxies
+	r.RUnlock()
+
+	table := make(map[string][]*Proxy, len(rules))
+	proxies := make(map[string]*Proxy)
+	var added []*Proxy
+	for _, rule := range rules {
+		group := make([]*Proxy, len(rule.to))
+		for i, host := range rule.to {
+			p, ok := proxies[host]
+			if !ok {
+				if p, ok = old[host]; !ok {
+					p = r.newProxy(host)
+					added = append(added, p)
+				}
+				proxies[host] = p
+			}
+			group[i] = p
+		}
+		table[rule.zone] = group
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.table = table
+	r.proxies = proxies
+
+	if !r.running {
+		return
+	}
+	for _, p := range added {
+		p.start(r.hcInterval)
+	}
+	for host, p := range old {
+		if _, ok := proxies[host]; !ok {
+			p.stop()
+		}
+	}
+}
+
+// start starts all upstreams in the routing table and, if configured, the periodic reload of the
+// routing file.
+func (r *routes) start(hcInterval time.Duration) {
+	r.Lock()
+	r.running = true
+	r.hcInterval = hcInterval
+	for _, p := range r.proxies {
+		p.start(hcInterval)
+	}
+	r.Unlock()
+
+	r.stop = make(chan bool)
+	if r.path == "" || r.reload == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(r.reload)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if err := r.load(); err != nil {
+					log.Warningf("Failed to reload routes, keeping previous routes: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+// shutdown stops the periodic reload and all upstreams in the routing table.
+func (r *routes) shutdown() {
+	if r.stop != nil {
+		close(r.stop)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.running = false
+	for _, p := range r.proxies {
+		p.stop()
+	}
+}
+
+const defaultRouteReload = 5 * time.Second
@@ -0,0 +1,162 @@
+package forward
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseRoutes(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    []route
+		expectedErr string
+	}{
+		{"example.org 10.0.0.1", []route{{"example.org.", []string{"10.0.0.1:53"}}}, ""},
+		{"# comment\n\nexample.org 10.0.0.1:5353 tls://10.0.0.2 # trailing\nExample.NET. 10.0.0.3\n",
+			[]route{{"example.org.", []string{"10.0.0.1:5353", "tls://10.0.0.2:853"}}, {"example.net.", []string{"10.0.0.3:53"}}}, ""},
+		{"example.org\n", nil, "line 1: no upstreams"},
+		{"example.org 10.0.0.1\nexample.net nothing\n", nil, "line 2: not an IP address or file"},
+		{"example.org grpc://10.0.0.1\n", nil, "not supported"},
+	}
+
+	for i, tc := range tests {
+		rules, err := parseRoutes(strings.NewReader(tc.input))
+		if tc.expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("Test %d: expected error to contain %q, got: %v", i, tc.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != len(tc.expected) {
+			t.Errorf("Test %d: expected %d rules, got %d", i, len(tc.expected), len(rules))
+			continue
+		}
+		for j, r := range rules {
+			if r.zone != tc.expected[j].zone || strings.Join(r.to, " ") != strings.Join(tc.expected[j].to, " ") {
+				t.Errorf("Test %d: expected rule %v, got %v", i, tc.expected[j], r)
+			}
+		}
+	}
+}
+
+func TestRoutesLookup(t *testing.T) {
+	r := newRouteTable()
+	r.newProxy = func(host string) *Proxy { return &Proxy{addr: host} }
+	r.build([]route{
+		{"example.org.", []string{"10.0.0.1:53"}},
+		{"a.example.org.", []string{"10.0.0.2:53", "10.0.0.1:53"}},
+	})
+
+	tests := []struct {
+		qname    string
+		expected string
+	}{
+		{"example.org.", "10.0.0.1:53"},
+		{"www.example.org.", "10.0.0.1:53"},
+		{"a.example.org.", "10.0.0.2:53 10.0.0.1:53"},
+		{"www.a.example.org.", "10.0.0.2:53 10.0.0.1:53"},
+		{"ba.example.org.", "10.0.0.1:53"},
+		{"example.net.", ""},
+		{".", ""},
+	}
+	for i, tc := range tests {
+		var got []string
+		for _, p := range r.lookup(tc.qname) {
+			got = append(got, p.addr)
+		}
+		if x := strings.Join(got, " "); x != tc.expected {
+			t.Errorf("Test %d: expected %q for %s, got %q", i, tc.expected, tc.qname, x)
+		}
+	}
+
+	if r.lookup("example.org.")[0] != r.lookup("a.example.org.")[1] {
+		t.Errorf("Expected upstreams to be shared between routes")
+	}
+}
+
+func TestRouteForward(t *testing.T) {
+	s := newTestServers(
+		func(w dns.ResponseWriter, r *dns.Msg) {
+			ret := new(dns.Msg)
+			ret.SetReply(r)
+			ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 127.0.0.1"))
+			w.WriteMsg(ret)
+		},
+		func(w dns.ResponseWriter, r *dns.Msg) {
+			ret := new(dns.Msg)
+			ret.SetReply(r)
+			ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 127.0.0.2"))
+			w.WriteMsg(ret)
+		},
+	)
+	defaultUpstream, routeUpstream := s[0], s[1]
+	defer defaultUpstream.Close()
+	defer routeUpstream.Close()
+
+	dir := t.TempDir()
+	routeFile := filepath.Join(dir, "routes")
+	if err := os.WriteFile(routeFile, []byte("example.net "+routeUpstream.Addr+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("dns", "forward . "+defaultUpstream.Addr+" {\nroute example.org "+routeUpstream.Addr+"\nroute_file "+routeFile+" 10ms\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	query := func(qname string) string {
+		m := new(dns.Msg)
+		m.SetQuestion(qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Expected to receive reply for %s, but didn't: %s", qname, err)
+		}
+		return rec.Msg.Answer[0].(*dns.A).A.String()
+	}
+
+	for qname, expected := range map[string]string{
+		"www.example.org.": "127.0.0.2",
+		"www.example.net.": "127.0.0.2",
+		"www.example.com.": "127.0.0.1",
+	} {
+		if x := query(qname); x != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, qname, x)
+		}
+	}
+
+	// Move example.com to the route upstream and drop example.net.
+	if err := os.WriteFile(routeFile, []byte("example.com "+routeUpstream.Addr+"\n# reloaded\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for f.routes.lookup("example.com.") == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for qname, expected := range map[string]string{
+		"www.example.org.": "127.0.0.2",
+		"www.example.net.": "127.0.0.1",
+		"www.example.com.": "127.0.0.2",
+	} {
+		if x := query(qname); x != expected {
+			t.Errorf("After reload expected %s for %s, got %s", expected, qname, x)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -23,9 +24,6 @@ func setup(c *caddy.Controller) error {
 	if err != nil {
 		return plugin.Error("forward", err)
 	}
-	if f.Len() > max {
-		return plugin.Error("forward", fmt.Errorf("more than %d TOs configured: %d", max, f.Len()))
-	}
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		f.Next = next
@@ -56,6 +54,9 @@ func (f *Forward) OnStartup() (err error) {
 	for _, p := range f.proxies {
 		p.start(f.hcInterval)
 	}
+	if f.routes != nil {
+		f.routes.start(f.hcInterval)
+	}
 	return nil
 }
 
@@ -64,6 +65,9 @@ func (f *Forward) OnShutdown() error {
 	for _, p := range f.proxies {
 		p.stop()
 	}
+	if f.routes != nil {
+		f.routes.shutdown()
+	}
 	return nil
 }
 
@@ -108,19 +112,14 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 		return f, c.ArgErr()
 	}
 
-	toHosts, err := parse.HostPortOrFile(to...)
+	toHosts, err := parseTo(to)
 	if err != nil {
 		return f, err
 	}
 
 	transports := make([]string, len(toHosts))
-	allowedTrans := map[string]bool{"dns": true, "tls": true}
 	for i, host := range toHosts {
 		trans, h := parse.Transport(host)
-
-		if !allowedTrans[trans] {
-			return f, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
-		}
 		p := NewProxy(h, trans)
 		f.proxies = append(f.proxies, p)
 		transports[i] = trans
@@ -141,21 +140,61 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 	f.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(len(f.proxies))
 
 	for i := range f.proxies {
-		// Only set this for proxies that need it.
-		if transports[i] == transport.TLS {
-			f.proxies[i].SetTLSConfig(f.tlsConfig)
-		}
-		f.proxies[i].SetExpire(f.expire)
-		f.proxies[i].health.SetRecursionDesired(f.opts.hcRecursionDesired)
-		// when TLS is used, checks are set to tcp-tls
-		if f.opts.forceTCP && transports[i] != transport.TLS {
-			f.proxies[i].health.SetTCPTransport()
+		f.configureProxy(f.proxies[i], transports[i])
+	}
+
+	if f.routes != nil {
+		f.routes.newProxy = f.newProxy
+		if err := f.routes.load(); err != nil {
+			return f, err
 		}
 	}
 
 	return f, nil
 }
 
+// parseTo parses the upstreams in to, which can be addresses or resolv.conf like files, and checks if
+// their transport is supported.
+func parseTo(to []string) ([]string, error) {
+	toHosts, err := parse.HostPortOrFile(to...)
+	if err != nil {
+		return nil, err
+	}
+	if len(toHosts) > max {
+		return nil, fmt.Errorf("more than %d TOs configured: %d", max, len(toHosts))
+	}
+
+	allowedTrans := map[string]bool{"dns": true, "tls": true}
+	for _, host := range toHosts {
+		if trans, _ := parse.Transport(host); !allowedTrans[trans] {
+			return nil, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
+		}
+	}
+	return toHosts, nil
+}
+
+// newProxy returns a new proxy for host, as returned by parseTo, configured with the options of f.
+func (f *Forward) newProxy(host string) *Proxy {
+	trans, h := parse.Transport(host)
+	p := NewProxy(h, trans)
+	f.configureProxy(p, trans)
+	return p
+}
+
+// configureProxy applies the TLS, expire and health check options of f to p.
+func (f *Forward) configureProxy(p *Proxy, trans string) {
+	// Only set this for proxies that need it.
+	if trans == transport.TLS {
+		p.SetTLSConfig(f.tlsConfig)
+	}
+	p.SetExpire(f.expire)
+	p.health.SetRecursionDesired(f.opts.hcRecursionDesired)
+	// when TLS is used, checks are set to tcp-tls
+	if f.opts.forceTCP && trans != transport.TLS {
+		p.health.SetTCPTransport()
+	}
+}
+
 func parseBlock(c *caddy.Controller, f *Forward) error {
 	switch c.Val() {
 	case "except":
@@ -166,6 +205,44 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 		for i := 0; i < len(ignore); i++ {
 			f.ignored = append(f.ignored, plugin.Host(ignore[i]).NormalizeExact()...)
 		}
+	case "route":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		rules, err := newRoutes(args[0], args[1:])
+		if err != nil {
+			return err
+		}
+		if f.routes == nil {
+			f.routes = newRouteTable()
+		}
+		f.routes.inline = append(f.routes.inline, rules...)
+	case "route_file":
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		if f.routes == nil {
+			f.routes = newRouteTable()
+		}
+		if f.routes.path != "" {
+			return c.Err("route_file can only be used once")
+		}
+		f.routes.path = args[0]
+		if root := dnsserver.GetConfig(c).Root; !filepath.IsAbs(f.routes.path) && root != "" {
+			f.routes.path = filepath.Join(root, f.routes.path)
+		}
+		if len(args) == 2 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			if dur < 0 {
+				return fmt.Errorf("route_file reload can't be negative: %s", dur)
+			}
+			f.routes.reload = dur
+		}
 	case "max_fails":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -246,6 +323,18 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			f.p = &roundRobin{}
 		case "sequential":
 			f.p = &sequential{}
+		case "race":
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			n, err := strconv.Atoi(c.Val())
+			if err != nil {
+				return err
+			}
+			if n < 1 {
+				return fmt.Errorf("race needs at least one upstream: %d", n)
+			}
+			f.p = &race{n: n}
 		default:
 			return c.Errf("unknown policy '%s'", x)
 		}
@@ -18,8 +18,12 @@ func TestSetupPolicy(t *testing.T) {
 		{"forward . 127.0.0.1 {\npolicy random\n}\n", false, "random", ""},
 		{"forward . 127.0.0.1 {\npolicy round_robin\n}\n", false, "round_robin", ""},
 		{"forward . 127.0.0.1 {\npolicy sequential\n}\n", false, "sequential", ""},
+		{"forward . 127.0.0.1 127.0.0.2 {\npolicy race 2\n}\n", false, "race", ""},
 		// negative
 		{"forward . 127.0.0.1 {\npolicy random2\n}\n", true, "random", "unknown policy"},
+		{"forward . 127.0.0.1 {\npolicy race\n}\n", true, "race", "Wrong argument count"},
+		{"forward . 127.0.0.1 {\npolicy race 0\n}\n", true, "race", "at least one upstream"},
+		{"forward . 127.0.0.1 {\npolicy race two\n}\n", true, "race", "invalid syntax"},
 	}
 
 	for i, test := range tests {
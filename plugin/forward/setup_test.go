@@ -32,7 +32,12 @@ func TestSetup(t *testing.T) {
 		{"forward . [2003::1]:53", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		{"forward . 127.0.0.1 \n", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		{"forward 10.9.3.0/18 127.0.0.1", false, "0.9.10.in-addr.arpa.", nil, 2, options{hcRecursionDesired: true}, ""},
+		{"forward . 127.0.0.1 {\nroute example.org 10.0.0.1 10.0.0.2\n}\n", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		// negative
+		{"forward . 127.0.0.1 {\nroute example.org\n}\n", true, "", nil, 0, options{hcRecursionDesired: true}, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nroute example.org a27.0.0.1\n}\n", true, "", nil, 0, options{hcRecursionDesired: true}, "not an IP"},
+		{"forward . 127.0.0.1 {\nroute_file /does/not/exist\n}\n", true, "", nil, 0, options{hcRecursionDesired: true}, "no such file"},
+		{"forward . 127.0.0.1 {\nroute_file /etc/hosts -1s\n}\n", true, "", nil, 0, options{hcRecursionDesired: true}, "negative"},
 		{"forward . a27.0.0.1", true, "", nil, 0, options{hcRecursionDesired: true}, "not an IP"},
 		{"forward . 127.0.0.1 {\nblaatl\n}\n", true, "", nil, 0, options{hcRecursionDesired: true}, "unknown property"},
 		{`forward . ::1
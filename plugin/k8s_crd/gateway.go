@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
 	"sigs.k8s.io/external-dns/endpoint"
@@ -135,8 +136,8 @@ func (gw *Gateway) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 	log.Infof("Computed Index Keys %v", indexKey)
 
 	if !gw.Controller.HasSynced() {
-		// TODO maybe there's a better way to do this? e.g. return an error back to the client?
-		return dns.RcodeServerFailure, plugin.Error(thisPlugin, fmt.Errorf("Could not sync required resources"))
+		err := &edns.ExtendedError{Code: dns.ExtendedErrorCodeNotReady, Text: "resources not synced", Err: fmt.Errorf("Could not sync required resources")}
+		return dns.RcodeServerFailure, plugin.Error(thisPlugin, err)
 	}
 
 	for _, z := range gw.Zones {
@@ -0,0 +1,138 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// entry is a query log entry in the JSON format.
+type entry struct {
+	Remote   string            `json:"remote"`
+	Port     int               `json:"port"`
+	ID       uint16            `json:"id"`
+	Opcode   string            `json:"opcode"`
+	Type     string            `json:"type"`
+	Class    string            `json:"class"`
+	Name     string            `json:"name"`
+	Proto    string            `json:"proto"`
+	Size     int               `json:"size"`
+	Do       bool              `json:"do"`
+	Bufsize  int               `json:"bufsize"`
+	EDNS     []ednsOption      `json:"edns,omitempty"`
+	Rcode    string            `json:"rcode"`
+	Rflags   []string          `json:"rflags"`
+	Rsize    int               `json:"rsize"`
+	Duration float64           `json:"duration"` // in seconds
+	Answer   []string          `json:"answer,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ednsOption is an EDNS0 option of the query.
+type ednsOption struct {
+	Code  string `json:"code"`
+	Value string `json:"value,omitempty"`
+}
+
+// jsonEntry returns the JSON log entry for the request in state and its recorded response. The answer
+// section of the response is included when answer is true.
+func jsonEntry(ctx context.Context, state request.Request, rr *dnstest.Recorder, answer bool) string {
+	port, _ := strconv.Atoi(state.Port())
+	e := entry{
+		Remote:   state.IP(),
+		Port:     port,
+		ID:       state.Req.Id,
+		Opcode:   dns.OpcodeToString[state.Req.Opcode],
+		Type:     state.Type(),
+		Class:    state.Class(),
+		Name:     state.Name(),
+		Proto:    state.Proto(),
+		Size:     state.Req.Len(),
+		Do:       state.Do(),
+		Bufsize:  state.Size(),
+		Rsize:    rr.Len,
+		Duration: time.Since(rr.Start).Seconds(),
+	}
+	if o := state.Req.IsEdns0(); o != nil {
+		for _, opt := range o.Option {
+			e.EDNS = append(e.EDNS, ednsOption{Code: optionCode(opt.Option()), Value: opt.String()})
+		}
+	}
+
+	if rr.Msg != nil {
+		e.Rcode = dns.RcodeToString[rr.Rcode]
+		if e.Rcode == "" {
+			e.Rcode = strconv.Itoa(rr.Rcode)
+		}
+		e.Rflags = flags(rr.Msg.MsgHdr)
+		if answer {
+			for _, r := range rr.Msg.Answer {
+				e.Answer = append(e.Answer, r.String())
+			}
+		}
+	}
+
+	if funcs := metadata.ValueFuncs(ctx); len(funcs) > 0 {
+		e.Metadata = make(map[string]string, len(funcs))
+		for label, f := range funcs {
+			e.Metadata[label] = f()
+		}
+	}
+
+	// Names can hold any byte, encoding/json escapes them so the entry remains valid JSON. The HTML
+	// escaping is not needed in a log.
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(e)
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}))
+}
+
+// flags returns the names of the flags that are set in the header h.
+func flags(h dns.MsgHdr) []string {
+	f := []string{}
+	for _, x := range []struct {
+		set  bool
+		name string
+	}{
+		{h.Response, "qr"}, {h.Authoritative, "aa"}, {h.Truncated, "tc"}, {h.RecursionDesired, "rd"},
+		{h.RecursionAvailable, "ra"}, {h.Zero, "z"}, {h.AuthenticatedData, "ad"}, {h.CheckingDisabled, "cd"},
+	} {
+		if x.set {
+			f = append(f, x.name)
+		}
+	}
+	return f
+}
+
+// optionCode returns the name of the EDNS0 option code.
+func optionCode(code uint16) string {
+	if s, ok := optionCodes[code]; ok {
+		return s
+	}
+	return strconv.Itoa(int(code))
+}
+
+var optionCodes = map[uint16]string{
+	dns.EDNS0LLQ:          "LLQ",
+	dns.EDNS0UL:           "UL",
+	dns.EDNS0NSID:         "NSID",
+	dns.EDNS0ESU:          "ESU",
+	dns.EDNS0DAU:          "DAU",
+	dns.EDNS0DHU:          "DHU",
+	dns.EDNS0N3U:          "N3U",
+	dns.EDNS0SUBNET:       "SUBNET",
+	dns.EDNS0EXPIRE:       "EXPIRE",
+	dns.EDNS0COOKIE:       "COOKIE",
+	dns.EDNS0TCPKEEPALIVE: "TCPKEEPALIVE",
+	dns.EDNS0PADDING:      "PADDING",
+	dns.EDNS0EDE:          "EDE",
+}
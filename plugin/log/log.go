@@ -3,9 +3,11 @@ package log
 
 import (
 	"context"
+	"math/rand"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/replacer"
@@ -13,6 +15,7 @@ import (
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
 )
 
 // Logger is a basic request logging plugin.
@@ -37,16 +40,21 @@ func (l Logger) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 		// If we don't set up a class in config, the default "all" will be added
 		// and we shouldn't have an empty rule.Class.
-		_, ok := rule.Class[response.All]
-		var ok1 bool
-		if !ok {
+		_, all := rule.Class[response.All]
+		class := response.All
+		if !all || len(rule.Sample) > 0 || len(rule.Limiters) > 0 {
 			tpe, _ := response.Typify(rrw.Msg, time.Now().UTC())
-			class := response.Classify(tpe)
-			_, ok1 = rule.Class[class]
+			class = response.Classify(tpe)
 		}
-		if ok || ok1 {
-			logstr := l.repl.Replace(ctx, state, rrw, rule.Format)
-			clog.Infof(logstr)
+		if _, ok := rule.Class[class]; all || ok {
+			if reason := rule.suppress(class); reason != "" {
+				suppressedCount.WithLabelValues(metrics.WithServer(ctx), class.String(), reason).Inc()
+			} else if rule.JSON {
+				clog.Info(jsonEntry(ctx, state, rrw, rule.Answer))
+			} else {
+				logstr := l.repl.Replace(ctx, state, rrw, rule.Format)
+				clog.Infof(logstr)
+			}
 		}
 
 		return rc, err
@@ -63,6 +71,28 @@ type Rule struct {
 	NameScope string
 	Class     map[response.Class]struct{}
 	Format    string
+	JSON      bool // log a JSON object instead of Format
+	Answer    bool // include the answer section in the JSON object
+
+	Sample   map[response.Class]float64       // fraction of the entries of a class that is logged, All sets the default
+	Limiters map[response.Class]*rate.Limiter // maximum rate of the log entries of a class, unlimited when absent
+}
+
+// suppress returns why the log entry of a response of class must not be written: "sample" when it's
+// not in the sample, and "rate" when the rate limit is exceeded. It returns the empty string when
+// the entry must be written.
+func (r Rule) suppress(class response.Class) string {
+	ratio, ok := r.Sample[class]
+	if !ok {
+		ratio, ok = r.Sample[response.All]
+	}
+	if ok && rand.Float64() >= ratio {
+		return "sample"
+	}
+	if l, ok := r.Limiters[class]; ok && !l.Allow() {
+		return "rate"
+	}
+	return ""
 }
 
 const (
@@ -3,11 +3,16 @@ package log
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"log"
+	"net"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/replacer"
@@ -15,6 +20,7 @@ import (
 	"github.com/coredns/coredns/plugin/test"
 
 	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
 )
 
 func init() { clog.Discard() }
@@ -239,6 +245,151 @@ func TestLogged(t *testing.T) {
 	}
 }
 
+func TestLoggedJSON(t *testing.T) {
+	var f bytes.Buffer
+	log.SetOutput(&f)
+
+	next := plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		m.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.ParseIP("127.0.0.1")}}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+	logger := Logger{
+		Rules: []Rule{{NameScope: ".", Class: map[response.Class]struct{}{response.All: {}}, JSON: true, Answer: true}},
+		Next:  next,
+		repl:  replacer.New(),
+	}
+
+	ctx := metadata.ContextWithMetadata(context.TODO())
+	metadata.SetValueFunc(ctx, "test/label", func() string { return "value" })
+	r := new(dns.Msg)
+	r.SetQuestion(`a"<b>\\.example.org.`, dns.TypeA)
+	r.SetEdns0(4096, true)
+	o := r.IsEdns0()
+	o.Option = append(o.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := logger.ServeDNS(ctx, rec, r); err != nil {
+		t.Fatal(err)
+	}
+
+	logged := strings.TrimSpace(f.String())
+	i := strings.IndexByte(logged, '{')
+	if i < 0 {
+		t.Fatalf("Expected a JSON object, got %s", logged)
+	}
+	e := entry{}
+	if err := json.Unmarshal([]byte(logged[i:]), &e); err != nil {
+		t.Fatalf("Failed to parse %s: %s", logged, err)
+	}
+	if e.Name != `a\"<b>\\.example.org.` || e.Type != "A" || e.Remote != "10.240.0.1" || e.Port != 40212 {
+		t.Errorf("Unexpected query fields in %s", logged)
+	}
+	if e.Rcode != "NOERROR" || strings.Join(e.Rflags, ",") != "qr,aa,rd" || !e.Do || e.Bufsize != 4096 {
+		t.Errorf("Unexpected response fields in %s", logged)
+	}
+	if len(e.EDNS) != 1 || e.EDNS[0].Code != "NSID" {
+		t.Errorf("Expected the NSID option, got %v", e.EDNS)
+	}
+	if len(e.Answer) != 1 || !strings.HasSuffix(e.Answer[0], "127.0.0.1") {
+		t.Errorf("Expected the answer section, got %v", e.Answer)
+	}
+	if e.Metadata["test/label"] != "value" {
+		t.Errorf("Expected metadata test/label, got %v", e.Metadata)
+	}
+}
+
+func TestLoggedSuppressed(t *testing.T) {
+	tests := []struct {
+		rule   Rule
+		logged int // number of the 10 queries that are logged
+	}{
+		// test.ErrorHandler returns SERVFAIL, an error.
+		{Rule{Sample: map[response.Class]float64{response.Error: 0}}, 0},
+		{Rule{Sample: map[response.Class]float64{response.Success: 0}}, 10},
+		{Rule{Sample: map[response.Class]float64{response.All: 0, response.Error: 1}}, 10},
+		{Rule{Sample: map[response.Class]float64{response.All: 0}}, 0},
+		{Rule{Limiters: map[response.Class]*rate.Limiter{response.Error: rate.NewLimiter(rate.Every(time.Hour), 3)}}, 3},
+		{Rule{Limiters: map[response.Class]*rate.Limiter{response.Success: rate.NewLimiter(rate.Every(time.Hour), 1)}}, 10},
+		{Rule{Sample: map[response.Class]float64{response.Error: 1}, Limiters: map[response.Class]*rate.Limiter{response.Error: rate.NewLimiter(rate.Every(time.Hour), 1)}}, 1},
+	}
+
+	for i, tc := range tests {
+		var f bytes.Buffer
+		log.SetOutput(&f)
+
+		tc.rule.NameScope = "."
+		tc.rule.Format = DefaultLogFormat
+		tc.rule.Class = map[response.Class]struct{}{response.All: {}}
+		logger := Logger{
+			Rules: []Rule{tc.rule},
+			Next:  test.ErrorHandler(),
+			repl:  replacer.New(),
+		}
+
+		r := new(dns.Msg)
+		r.SetQuestion("example.org.", dns.TypeA)
+		for n := 0; n < 10; n++ {
+			logger.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+		}
+
+		if logged := strings.Count(f.String(), "\n"); logged != tc.logged {
+			t.Errorf("Test %d: expected %d log entries, got %d", i, tc.logged, logged)
+		}
+	}
+}
+
+func TestLoggedRateLimitPerClass(t *testing.T) {
+	var f bytes.Buffer
+	log.SetOutput(&f)
+
+	rule := Rule{
+		NameScope: ".",
+		Format:    "{rcode}",
+		Class:     map[response.Class]struct{}{response.All: {}},
+		Limiters: map[response.Class]*rate.Limiter{
+			response.Success: rate.NewLimiter(rate.Every(time.Hour), 2),
+			response.Error:   rate.NewLimiter(rate.Every(time.Hour), 2),
+		},
+	}
+	logger := Logger{
+		Rules: []Rule{rule},
+		Next: plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			switch r.Question[0].Name {
+			case "nx.example.org.":
+				m.Rcode = dns.RcodeNameError
+				m.Ns = []dns.RR{test.SOA("example.org. 3600 IN SOA ns.example.org. hostmaster.example.org. 1 3600 600 86400 300")}
+			case "fail.example.org.":
+				m.Rcode = dns.RcodeServerFailure
+			default:
+				m.Answer = []dns.RR{test.A(r.Question[0].Name + " 3600 IN A 127.0.0.1")}
+			}
+			w.WriteMsg(m)
+			return m.Rcode, nil
+		}),
+		repl: replacer.New(),
+	}
+
+	// A flood of successful responses must not use up the limit of the errors, nor affect the
+	// denials that have no limit.
+	for _, name := range []string{"a.example.org.", "a.example.org.", "a.example.org.", "a.example.org.", "nx.example.org.", "nx.example.org.", "nx.example.org.", "fail.example.org."} {
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		logger.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+	}
+
+	for rcode, expected := range map[string]int{"NOERROR": 2, "NXDOMAIN": 3, "SERVFAIL": 1} {
+		if logged := strings.Count(f.String(), rcode); logged != expected {
+			t.Errorf("Expected %d %s log entries, got %d", expected, rcode, logged)
+		}
+	}
+}
+
 func BenchmarkLogged(b *testing.B) {
 	log.SetOutput(io.Discard)
 
@@ -0,0 +1,16 @@
+package log
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// suppressedCount is the number of log entries not written, because of sampling or the rate limit.
+var suppressedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "log",
+	Name:      "suppressed_total",
+	Help:      "Counter of query log entries not written, because they were sampled out or rate limited.",
+}, []string{"server", "class", "reason"})
@@ -1,6 +1,8 @@
 package log
 
 import (
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/coredns/caddy"
@@ -10,6 +12,7 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/response"
 
 	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
 )
 
 func init() { plugin.Register("log", setup) }
@@ -33,6 +36,7 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 	for c.Next() {
 		args := c.RemainingArgs()
 		length := len(rules)
+		explicit := false // FORMAT is given
 
 		switch len(args) {
 		case 0:
@@ -53,6 +57,7 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 			format := DefaultLogFormat
 
 			if strings.Contains(args[len(args)-1], "{") {
+				explicit = true
 				format = args[len(args)-1]
 				format = strings.Replace(format, "{common}", CommonLogFormat, -1)
 				format = strings.Replace(format, "{combined}", CombinedLogFormat, -1)
@@ -70,6 +75,11 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 
 		// Class refinements in an extra block.
 		classes := make(map[response.Class]struct{})
+		json, answer := false, false
+		var (
+			sample   map[response.Class]float64
+			limiters map[response.Class]*rate.Limiter
+		)
 		for c.NextBlock() {
 			switch c.Val() {
 			// class followed by combinations of all, denial, error and success.
@@ -85,6 +95,76 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 					}
 					classes[cls] = struct{}{}
 				}
+			case "format":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "json":
+					json = true
+				case "text":
+					json = false
+				default:
+					return nil, c.Errf("unknown format: %s", args[0])
+				}
+			case "sample":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				cls, err := response.ClassFromString(args[0])
+				if err != nil {
+					return nil, err
+				}
+				ratio, err := strconv.ParseFloat(args[1], 64)
+				if err != nil || ratio < 0 || ratio > 1 {
+					return nil, c.Errf("invalid sample ratio: %s", args[1])
+				}
+				if sample == nil {
+					sample = make(map[response.Class]float64)
+				}
+				sample[cls] = ratio
+			case "rate_limit":
+				args := c.RemainingArgs()
+				if len(args) < 2 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				cls, err := response.ClassFromString(args[0])
+				if err != nil {
+					return nil, err
+				}
+				r, err := strconv.ParseFloat(args[1], 64)
+				if err != nil || r <= 0 {
+					return nil, c.Errf("invalid rate limit: %s", args[1])
+				}
+				burst := int(math.Ceil(r))
+				if len(args) == 3 {
+					burst, err = strconv.Atoi(args[2])
+					if err != nil || burst < 1 {
+						return nil, c.Errf("invalid burst: %s", args[2])
+					}
+				}
+				if limiters == nil {
+					limiters = make(map[response.Class]*rate.Limiter)
+				}
+				// Each class gets its own limiter, so that a flood of one class can't suppress the
+				// entries of the others. With all, the classes without a limit of their own share
+				// the rate, but not the limiter.
+				if cls != response.All {
+					limiters[cls] = rate.NewLimiter(rate.Limit(r), burst)
+					break
+				}
+				for _, cls := range []response.Class{response.Success, response.Denial, response.Error} {
+					if _, ok := limiters[cls]; !ok {
+						limiters[cls] = rate.NewLimiter(rate.Limit(r), burst)
+					}
+				}
+			case "answer":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				answer = true
 			default:
 				return nil, c.ArgErr()
 			}
@@ -92,9 +172,19 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 		if len(classes) == 0 {
 			classes[response.All] = struct{}{}
 		}
+		if json && explicit {
+			return nil, c.Err("FORMAT can't be used with format json")
+		}
+		if answer && !json {
+			return nil, c.Err("answer requires format json")
+		}
 
 		for i := len(rules) - 1; i >= length; i-- {
 			rules[i].Class = classes
+			rules[i].JSON = json
+			rules[i].Answer = answer
+			rules[i].Sample = sample
+			rules[i].Limiters = limiters
 		}
 	}
 
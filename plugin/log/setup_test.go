@@ -149,6 +149,41 @@ func TestLogParse(t *testing.T) {
 			Format:    "{when} " + CommonLogFormat + " {/forward/upstream}",
 			Class:     map[response.Class]struct{}{response.All: {}},
 		}}},
+		{`log example.org {
+			format json
+		}`, false, []Rule{{
+			NameScope: "example.org.",
+			Format:    DefaultLogFormat,
+			Class:     map[response.Class]struct{}{response.All: {}},
+			JSON:      true,
+		}}},
+		{`log {
+			format json
+			answer
+			class denial
+		}`, false, []Rule{{
+			NameScope: ".",
+			Format:    DefaultLogFormat,
+			Class:     map[response.Class]struct{}{response.Denial: {}},
+			JSON:      true,
+			Answer:    true,
+		}}},
+		{`log {
+			format text
+		}`, false, []Rule{{
+			NameScope: ".",
+			Format:    DefaultLogFormat,
+			Class:     map[response.Class]struct{}{response.All: {}},
+		}}},
+		{`log {
+			format yaml
+		}`, true, []Rule{}},
+		{`log {
+			answer
+		}`, true, []Rule{}},
+		{`log . {combined} {
+			format json
+		}`, true, []Rule{}},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.inputLogRules)
@@ -176,6 +211,11 @@ func TestLogParse(t *testing.T) {
 					i, j, test.inputLogRules, test.expectedLogRules[j].Format, actualLogRule.Format)
 			}
 
+			if actualLogRule.JSON != test.expectedLogRules[j].JSON || actualLogRule.Answer != test.expectedLogRules[j].Answer {
+				t.Errorf("Test %d expected %dth LogRule JSON %t and Answer %t, but got %t and %t",
+					i, j, test.expectedLogRules[j].JSON, test.expectedLogRules[j].Answer, actualLogRule.JSON, actualLogRule.Answer)
+			}
+
 			if !reflect.DeepEqual(actualLogRule.Class, test.expectedLogRules[j].Class) {
 				t.Errorf("Test %d expected %dth LogRule Class to be  %v  , but got %v",
 					i, j, test.expectedLogRules[j].Class, actualLogRule.Class)
@@ -183,3 +223,71 @@ func TestLogParse(t *testing.T) {
 		}
 	}
 }
+
+func TestLogParseLimits(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		sample    map[response.Class]float64
+		limits    map[response.Class][2]float64 // rate and burst
+	}{
+		{`log`, false, nil, nil},
+		{`log {
+			sample success 0.1
+		}`, false, map[response.Class]float64{response.Success: 0.1}, nil},
+		{`log {
+			sample success 0.1
+			sample all 0.5
+			rate_limit success 100
+		}`, false, map[response.Class]float64{response.Success: 0.1, response.All: 0.5}, map[response.Class][2]float64{response.Success: {100, 100}}},
+		{`log {
+			rate_limit error 0.5 10
+			rate_limit all 20
+		}`, false, nil, map[response.Class][2]float64{response.Success: {20, 20}, response.Denial: {20, 20}, response.Error: {0.5, 10}}},
+		{`log {
+			sample success 1.5
+		}`, true, nil, nil},
+		{`log {
+			sample nothing 0.5
+		}`, true, nil, nil},
+		{`log {
+			sample success
+		}`, true, nil, nil},
+		{`log {
+			rate_limit 10
+		}`, true, nil, nil},
+		{`log {
+			rate_limit success 0
+		}`, true, nil, nil},
+		{`log {
+			rate_limit success 10 0
+		}`, true, nil, nil},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		rules, err := logParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		r := rules[0]
+		if !reflect.DeepEqual(r.Sample, test.sample) {
+			t.Errorf("Test %d: expected sample %v, got %v", i, test.sample, r.Sample)
+		}
+		if len(r.Limiters) != len(test.limits) {
+			t.Errorf("Test %d: expected %d rate limits, got %d", i, len(test.limits), len(r.Limiters))
+			continue
+		}
+		for cls, limit := range test.limits {
+			l, ok := r.Limiters[cls]
+			if !ok || float64(l.Limit()) != limit[0] || float64(l.Burst()) != limit[1] {
+				t.Errorf("Test %d: expected rate limit %g with burst %g for %s", i, limit[0], limit[1], cls)
+			}
+		}
+	}
+}
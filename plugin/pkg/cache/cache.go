@@ -1,6 +1,6 @@
 // Package cache implements a cache. The cache hold 256 shards, each shard
-// holds a cache: a map with a mutex. There is no fancy expunge algorithm, it
-// just randomly evicts elements when it gets full.
+// holds a cache: a map with a mutex. When a shard gets full an element is evicted
+// according to the eviction policy of the cache, by default a random element.
 package cache
 
 import (
@@ -20,16 +20,20 @@ type Cache struct {
 	shards [shardSize]*shard
 }
 
-// shard is a cache with random eviction.
+// shard is a cache with random eviction, unless it has a policy.
 type shard struct {
-	items map[uint64]interface{}
-	size  int
+	items  map[uint64]interface{}
+	size   int
+	policy policy
 
 	sync.RWMutex
 }
 
-// New returns a new cache.
-func New(size int) *Cache {
+// New returns a new cache that randomly evicts elements.
+func New(size int) *Cache { return NewWithPolicy(size, Random) }
+
+// NewWithPolicy returns a new cache that evicts elements according to policy p.
+func NewWithPolicy(size int, p Policy) *Cache {
 	ssize := size / shardSize
 	if ssize < 4 {
 		ssize = 4
@@ -39,7 +43,7 @@ func New(size int) *Cache {
 
 	// Initialize all the shards
 	for i := 0; i < shardSize; i++ {
-		c.shards[i] = newShard(ssize)
+		c.shards[i] = newPolicyShard(ssize, p)
 	}
 	return c
 }
@@ -72,6 +76,18 @@ func (c *Cache) Len() int {
 	return l
 }
 
+// Shards returns the number of elements in each shard.
+func (c *Cache) Shards() []int {
+	l := make([]int, shardSize)
+	for i, s := range &c.shards {
+		l[i] = s.Len()
+	}
+	return l
+}
+
+// ShardCap returns the capacity of a shard.
+func (c *Cache) ShardCap() int { return c.shards[0].size }
+
 // Walk walks each shard in the cache.
 func (c *Cache) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	for _, s := range &c.shards {
@@ -82,11 +98,34 @@ func (c *Cache) Walk(f func(map[uint64]interface{}, uint64) bool) {
 // newShard returns a new shard with size.
 func newShard(size int) *shard { return &shard{items: make(map[uint64]interface{}), size: size} }
 
+// newPolicyShard returns a new shard with size that evicts elements according to policy p.
+func newPolicyShard(size int, p Policy) *shard {
+	s := newShard(size)
+	switch p {
+	case LRU:
+		s.policy = newLRU(size)
+	case TinyLFU:
+		s.policy = newTinyLFU(size)
+	}
+	return s
+}
+
 // Add adds element indexed by key into the cache. Any existing element is overwritten
 // Returns true if an existing element was evicted to make room for this element.
 func (s *shard) Add(key uint64, el interface{}) bool {
 	eviction := false
 	s.Lock()
+	if s.policy != nil {
+		if _, ok := s.items[key]; ok {
+			s.policy.get(key)
+		} else if victim, ok := s.policy.add(key); ok {
+			delete(s.items, victim)
+			eviction = true
+		}
+		s.items[key] = el
+		s.Unlock()
+		return eviction
+	}
 	if len(s.items) >= s.size {
 		if _, ok := s.items[key]; !ok {
 			for k := range s.items {
@@ -104,6 +143,9 @@ func (s *shard) Add(key uint64, el interface{}) bool {
 // Remove removes the element indexed by key from the cache.
 func (s *shard) Remove(key uint64) {
 	s.Lock()
+	if _, ok := s.items[key]; ok && s.policy != nil {
+		s.policy.remove(key)
+	}
 	delete(s.items, key)
 	s.Unlock()
 }
@@ -112,6 +154,9 @@ func (s *shard) Remove(key uint64) {
 func (s *shard) Evict() {
 	s.Lock()
 	for k := range s.items {
+		if s.policy != nil {
+			s.policy.remove(k)
+		}
 		delete(s.items, k)
 		break
 	}
@@ -120,6 +165,16 @@ func (s *shard) Evict() {
 
 // Get looks up the element indexed under key.
 func (s *shard) Get(key uint64) (interface{}, bool) {
+	if s.policy != nil {
+		// The policy records the access, so this needs the write lock.
+		s.Lock()
+		el, found := s.items[key]
+		if found {
+			s.policy.get(key)
+		}
+		s.Unlock()
+		return el, found
+	}
 	s.RLock()
 	el, found := s.items[key]
 	s.RUnlock()
@@ -134,7 +189,8 @@ func (s *shard) Len() int {
 	return l
 }
 
-// Walk walks the shard for each element the function f is executed while holding a write lock.
+// Walk walks the shard for each element the function f is executed while holding a write lock. Elements
+// that f deletes from the map are removed from the cache.
 func (s *shard) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	s.RLock()
 	items := make([]uint64, len(s.items))
@@ -146,7 +202,11 @@ func (s *shard) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	s.RUnlock()
 	for _, k := range items {
 		s.Lock()
+		_, exists := s.items[k]
 		ok := f(s.items, k)
+		if _, found := s.items[k]; exists && !found && s.policy != nil {
+			s.policy.remove(k)
+		}
 		s.Unlock()
 		if !ok {
 			return
@@ -83,3 +83,21 @@ func BenchmarkCache(b *testing.B) {
 		c.Get(1)
 	}
 }
+
+func TestCacheShards(t *testing.T) {
+	c := New(shardSize * 4)
+	c.Add(1, 1)
+	c.Add(2, 2)
+	c.Add(shardSize+1, 3)
+
+	shards := c.Shards()
+	if len(shards) != shardSize {
+		t.Fatalf("Expected %d shards, got %d", shardSize, len(shards))
+	}
+	if shards[1] != 2 || shards[2] != 1 {
+		t.Errorf("Expected 2 elements in shard 1 and 1 in shard 2, got %d and %d", shards[1], shards[2])
+	}
+	if c.ShardCap() != 4 {
+		t.Errorf("Expected shard capacity of 4, got %d", c.ShardCap())
+	}
+}
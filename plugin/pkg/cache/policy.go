@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"time"
+
+	"github.com/coredns/coredns/plugin/cache/freq"
+)
+
+// Policy is the eviction policy of a cache, it decides which element is evicted when a shard is full.
+type Policy int
+
+const (
+	// Random evicts a random element.
+	Random Policy = iota
+	// LRU evicts the least recently used element.
+	LRU
+	// TinyLFU is W-TinyLFU: new elements enter a small LRU window, an element leaving the window is only
+	// admitted to the main cache if it is used more often than the element it would replace.
+	TinyLFU
+)
+
+// String implements the fmt.Stringer interface.
+func (p Policy) String() string {
+	switch p {
+	case Random:
+		return "random"
+	case LRU:
+		return "lru"
+	case TinyLFU:
+		return "tinylfu"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// ParsePolicy returns the Policy named s.
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range []Policy{Random, LRU, TinyLFU} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return Random, fmt.Errorf("unknown eviction policy: %q", s)
+}
+
+// policy tracks the keys in a shard. Its methods are called with the shard's write lock held.
+type policy interface {
+	// add records that key was added. If the shard is over capacity it returns the key to evict and true.
+	add(key uint64) (uint64, bool)
+	// get records that key was used.
+	get(key uint64)
+	// remove forgets key.
+	remove(key uint64)
+}
+
+// lru is a policy that evicts the least recently used key.
+type lru struct {
+	size  int
+	order *list.List // most recently used at the front
+	keys  map[uint64]*list.Element
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), keys: make(map[uint64]*list.Element)}
+}
+
+func (l *lru) add(key uint64) (uint64, bool) {
+	l.keys[key] = l.order.PushFront(key)
+	if l.order.Len() <= l.size {
+		return 0, false
+	}
+	victim := l.order.Remove(l.order.Back()).(uint64)
+	delete(l.keys, victim)
+	return victim, true
+}
+
+func (l *lru) get(key uint64) {
+	if e, ok := l.keys[key]; ok {
+		l.order.MoveToFront(e)
+	}
+}
+
+func (l *lru) remove(key uint64) {
+	if e, ok := l.keys[key]; ok {
+		l.order.Remove(e)
+		delete(l.keys, key)
+	}
+}
+
+// tinyLFU is the W-TinyLFU policy. Keys enter the window, a small LRU. The main cache is a segmented LRU:
+// keys admitted from the window go to probation, and move to protected when they are used again. When the
+// window is full, its least recently used key competes with the least recently used key in probation, the
+// one that is used least often is evicted.
+//
+// How often a key is used is tracked with a freq.Freq, counting the uses without a gap of more than
+// tinyLFUGap. Frequencies of evicted keys are remembered for at most size keys, so a key that returns soon
+// after its eviction keeps its history.
+type tinyLFU struct {
+	windowSize    int
+	protectedSize int
+	mainSize      int
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	keys      map[uint64]*list.Element
+
+	history     map[uint64]*freq.Freq // frequencies of evicted keys
+	historySize int
+
+	now func() time.Time
+}
+
+// tinyEntry is a key tracked by tinyLFU.
+type tinyEntry struct {
+	key  uint64
+	freq *freq.Freq
+	list *list.List // the segment the key is in
+}
+
+func newTinyLFU(size int) *tinyLFU {
+	window := size / 100
+	if window < 1 {
+		window = 1
+	}
+	main := size - window
+	return &tinyLFU{
+		windowSize:    window,
+		mainSize:      main,
+		protectedSize: main * 8 / 10,
+		window:        list.New(),
+		probation:     list.New(),
+		protected:     list.New(),
+		keys:          make(map[uint64]*list.Element),
+		history:       make(map[uint64]*freq.Freq),
+		historySize:   size,
+		now:           time.Now,
+	}
+}
+
+func (t *tinyLFU) add(key uint64) (uint64, bool) {
+	now := t.now()
+	f, ok := t.history[key]
+	if ok {
+		delete(t.history, key)
+	} else {
+		f = freq.New(now)
+	}
+	f.Update(tinyLFUGap, now)
+	t.keys[key] = t.window.PushFront(&tinyEntry{key: key, freq: f, list: t.window})
+
+	if t.window.Len() <= t.windowSize {
+		return 0, false
+	}
+	candidate := t.window.Back()
+	if t.probation.Len()+t.protected.Len() < t.mainSize {
+		t.move(candidate, t.probation)
+		return 0, false
+	}
+
+	victim := t.probation.Back()
+	if victim == nil {
+		victim = t.protected.Back()
+	}
+	if victim == nil || candidate.Value.(*tinyEntry).freq.Hits() > victim.Value.(*tinyEntry).freq.Hits() {
+		t.move(candidate, t.probation)
+		if victim == nil {
+			return 0, false
+		}
+		return t.evict(victim), true
+	}
+	return t.evict(candidate), true
+}
+
+func (t *tinyLFU) get(key uint64) {
+	e, ok := t.keys[key]
+	if !ok {
+		return
+	}
+	te := e.Value.(*tinyEntry)
+	te.freq.Update(tinyLFUGap, t.now())
+
+	switch te.list {
+	case t.window, t.protected:
+		te.list.MoveToFront(e)
+	case t.probation:
+		t.move(e, t.protected)
+		if t.protected.Len() > t.protectedSize {
+			t.move(t.protected.Back(), t.probation)
+		}
+	}
+}
+
+func (t *tinyLFU) remove(key uint64) {
+	if e, ok := t.keys[key]; ok {
+		te := e.Value.(*tinyEntry)
+		te.list.Remove(e)
+		delete(t.keys, key)
+	}
+}
+
+// move moves e to the front of the segment l.
+func (t *tinyLFU) move(e *list.Element, l *list.List) {
+	te := e.Value.(*tinyEntry)
+	te.list.Remove(e)
+	te.list = l
+	t.keys[te.key] = l.PushFront(te)
+}
+
+// evict removes e and remembers its frequency. It returns the key of e.
+func (t *tinyLFU) evict(e *list.Element) uint64 {
+	te := e.Value.(*tinyEntry)
+	te.list.Remove(e)
+	delete(t.keys, te.key)
+
+	if len(t.history) >= t.historySize {
+		for k := range t.history {
+			delete(t.history, k)
+			break
+		}
+	}
+	t.history[te.key] = te.freq
+	return te.key
+}
+
+// tinyLFUGap is the longest gap between two uses of a key for which tinyLFU still counts them together.
+const tinyLFUGap = 10 * time.Minute
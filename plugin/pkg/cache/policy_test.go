@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, p := range []Policy{Random, LRU, TinyLFU} {
+		got, err := ParsePolicy(p.String())
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %s", p, err)
+		}
+		if got != p {
+			t.Errorf("Expected %s, got %s", p, got)
+		}
+	}
+	if _, err := ParsePolicy("fifo"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestShardLRU(t *testing.T) {
+	s := newPolicyShard(4, LRU)
+	for i := uint64(1); i <= 4; i++ {
+		s.Add(i, i)
+	}
+	s.Get(1)
+	if !s.Add(5, 5) {
+		t.Fatal("Expected an eviction")
+	}
+	if _, found := s.Get(2); found {
+		t.Error("Expected least recently used element 2 to be evicted")
+	}
+	for _, k := range []uint64{1, 3, 4, 5} {
+		if _, found := s.Get(k); !found {
+			t.Errorf("Expected element %d to be in the shard", k)
+		}
+	}
+
+	s.Remove(3)
+	if s.Add(6, 6) {
+		t.Error("Expected no eviction after a remove")
+	}
+	if s.Len() != 4 {
+		t.Errorf("Expected 4 elements, got %d", s.Len())
+	}
+}
+
+func TestShardTinyLFU(t *testing.T) {
+	s := newPolicyShard(4, TinyLFU)
+	for i := uint64(1); i <= 4; i++ {
+		s.Add(i, i)
+	}
+	// Make 1, 2 and 3 popular.
+	for n := 0; n < 3; n++ {
+		s.Get(1)
+		s.Get(2)
+		s.Get(3)
+	}
+
+	// A stream of new elements that are used once should not push out the popular ones.
+	for i := uint64(10); i < 100; i++ {
+		s.Add(i, i)
+		if s.Len() != 4 {
+			t.Fatalf("Expected 4 elements, got %d", s.Len())
+		}
+	}
+	for _, k := range []uint64{1, 2, 3} {
+		if _, found := s.Get(k); !found {
+			t.Errorf("Expected popular element %d to be in the shard", k)
+		}
+	}
+	if _, found := s.Get(99); !found {
+		t.Error("Expected the newest element to be in the window")
+	}
+}
+
+func TestCachePolicyWalk(t *testing.T) {
+	for _, p := range []Policy{LRU, TinyLFU} {
+		c := NewWithPolicy(shardSize*4, p)
+		for i := uint64(0); i < shardSize*4; i++ {
+			c.Add(i, i)
+		}
+		// Delete half of the elements in each shard, the policy should forget them.
+		c.Walk(func(items map[uint64]interface{}, key uint64) bool {
+			if key >= shardSize*2 {
+				delete(items, key)
+			}
+			return true
+		})
+		for i := uint64(shardSize * 4); i < shardSize*6; i++ {
+			if c.Add(i, i) {
+				t.Fatalf("%s: expected no eviction after deleting elements", p)
+			}
+		}
+		if c.Len() != shardSize*4 {
+			t.Errorf("%s: expected %d elements, got %d", p, shardSize*4, c.Len())
+		}
+	}
+}
+
+// hitRatio returns the hit ratio of a cache with policy p and size for the keys.
+func hitRatio(p Policy, size int, keys []uint64) float64 {
+	c := NewWithPolicy(size, p)
+	hits := 0
+	for _, k := range keys {
+		if _, found := c.Get(k); found {
+			hits++
+			continue
+		}
+		c.Add(k, k)
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+// zipfKeys returns n keys drawn from a Zipf distribution over max keys, mimicking the popularity of
+// names in DNS traffic.
+func zipfKeys(n int, max uint64) []uint64 {
+	z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, max)
+	keys := make([]uint64, n)
+	for i := range keys {
+		keys[i] = Hash([]byte(strconv.FormatUint(z.Uint64(), 10)))
+	}
+	return keys
+}
+
+func TestCachePolicyHitRatio(t *testing.T) {
+	keys := zipfKeys(200000, 100000)
+	random := hitRatio(Random, shardSize*8, keys)
+	lru := hitRatio(LRU, shardSize*8, keys)
+	tinylfu := hitRatio(TinyLFU, shardSize*8, keys)
+	if tinylfu <= random || tinylfu <= lru {
+		t.Errorf("Expected tinylfu to have the best hit ratio, got random %.3f, lru %.3f, tinylfu %.3f", random, lru, tinylfu)
+	}
+}
+
+func benchmarkHitRatio(b *testing.B, p Policy) {
+	keys := zipfKeys(500000, 1000000)
+	b.ResetTimer()
+	ratio := 0.0
+	for n := 0; n < b.N; n++ {
+		ratio = hitRatio(p, shardSize*40, keys)
+	}
+	b.ReportMetric(ratio*100, "hit%")
+}
+
+func BenchmarkHitRatioRandom(b *testing.B)  { benchmarkHitRatio(b, Random) }
+func BenchmarkHitRatioLRU(b *testing.B)     { benchmarkHitRatio(b, LRU) }
+func BenchmarkHitRatioTinyLFU(b *testing.B) { benchmarkHitRatio(b, TinyLFU) }
@@ -0,0 +1,267 @@
+// Package denial checks the authenticated denial of existence in a negative response, using either
+// NSEC (RFC 4035) or NSEC3 (RFC 5155) records. The records must be validated before calling its functions.
+package denial
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// NameError returns true if the records in ns prove name does not exist.
+func NameError(name string, ns []dns.RR) bool {
+	nsec, nsec3 := denials(ns)
+	if len(nsec3) > 0 {
+		ce, _, ok := closestEncloser(name, nsec3)
+		return ok && covered3(WildcardOf(ce), nsec3)
+	}
+
+	for _, n := range nsec {
+		if !Covers(n, name) {
+			continue
+		}
+		ce := Encloser(name, n)
+		for _, w := range nsec {
+			if Covers(w, WildcardOf(ce)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NoData returns true if the records in ns prove name does not have any records of type qtype.
+func NoData(name string, qtype uint16, ns []dns.RR) bool {
+	nsec, nsec3 := denials(ns)
+	if len(nsec3) > 0 {
+		for _, n := range nsec3 {
+			if n.Match(name) {
+				return absent(n.TypeBitMap, qtype) && !parentSide(n.TypeBitMap, qtype)
+			}
+		}
+		// Wildcard no data.
+		ce, _, ok := closestEncloser(name, nsec3)
+		if !ok {
+			return false
+		}
+		for _, n := range nsec3 {
+			if n.Match(WildcardOf(ce)) {
+				return absent(n.TypeBitMap, qtype)
+			}
+		}
+		return false
+	}
+
+	for _, n := range nsec {
+		if equal(n.Hdr.Name, name) {
+			return absent(n.TypeBitMap, qtype) && !parentSide(n.TypeBitMap, qtype)
+		}
+	}
+	for _, n := range nsec {
+		if !Covers(n, name) {
+			continue
+		}
+		// An empty non-terminal.
+		if dns.IsSubDomain(name, n.NextDomain) {
+			return true
+		}
+		// Wildcard no data.
+		ce := Encloser(name, n)
+		for _, w := range nsec {
+			if equal(w.Hdr.Name, WildcardOf(ce)) {
+				return absent(w.TypeBitMap, qtype)
+			}
+		}
+	}
+	return false
+}
+
+// NoDS returns ok if the records in ns prove name has no DS records. Delegation is true if name is an
+// unsigned delegation, and false if name is not a delegation at all.
+func NoDS(name string, ns []dns.RR) (delegation, ok bool) {
+	nsec, nsec3 := denials(ns)
+	if len(nsec3) > 0 {
+		for _, n := range nsec3 {
+			if n.Match(name) {
+				if Has(n.TypeBitMap, dns.TypeDS) || Has(n.TypeBitMap, dns.TypeSOA) {
+					return false, false
+				}
+				return Has(n.TypeBitMap, dns.TypeNS), true
+			}
+		}
+		// An opt-out NSEC3 covering the next closer name can hide unsigned delegations, RFC 5155, section 6.
+		_, next, ok := closestEncloser(name, nsec3)
+		if !ok {
+			return false, false
+		}
+		for _, n := range nsec3 {
+			if n.Cover(next) && n.Flags&OptOut == OptOut {
+				return true, true
+			}
+		}
+		return false, false
+	}
+
+	for _, n := range nsec {
+		if equal(n.Hdr.Name, name) {
+			if Has(n.TypeBitMap, dns.TypeDS) || Has(n.TypeBitMap, dns.TypeSOA) {
+				return false, false
+			}
+			return Has(n.TypeBitMap, dns.TypeNS), true
+		}
+	}
+	// Name does not exist, or is an empty non-terminal, both are not delegations.
+	for _, n := range nsec {
+		if Covers(n, name) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// NoCloserMatch returns true if the records in ns prove the owner of the wildcard expanded signature sig
+// does not exist, i.e. the wildcard expansion was done correctly.
+func NoCloserMatch(sig *dns.RRSIG, ns []dns.RR) bool {
+	name := sig.Hdr.Name
+	nsec, nsec3 := denials(ns)
+	if len(nsec3) > 0 {
+		// The next closer name is one label longer than the wildcard's closest encloser.
+		off := dns.Split(name)
+		next := name[off[len(off)-int(sig.Labels)-1]:]
+		return covered3(next, nsec3)
+	}
+	for _, n := range nsec {
+		if Covers(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wildcard returns true if sig was made over a wildcard expanded RRset.
+func Wildcard(sig *dns.RRSIG) bool {
+	labels := dns.CountLabel(sig.Hdr.Name)
+	if strings.HasPrefix(sig.Hdr.Name, "*.") {
+		labels--
+	}
+	return int(sig.Labels) < labels
+}
+
+// closestEncloser returns the closest encloser of name and the next closer name, as proven by nsec3.
+// See RFC 5155, section 8.3.
+func closestEncloser(name string, nsec3 []*dns.NSEC3) (ce, next string, ok bool) {
+	off := dns.Split(name)
+	for i := 1; i < len(off); i++ {
+		ce = name[off[i]:]
+		for _, n := range nsec3 {
+			if n.Match(ce) {
+				next = name[off[i-1]:]
+				return ce, next, covered3(next, nsec3)
+			}
+		}
+	}
+	return "", "", false
+}
+
+func covered3(name string, nsec3 []*dns.NSEC3) bool {
+	for _, n := range nsec3 {
+		if n.Cover(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers returns true if name falls between the owner name and the next domain name of n.
+func Covers(n *dns.NSEC, name string) bool {
+	if Compare(n.Hdr.Name, n.NextDomain) < 0 {
+		return Compare(n.Hdr.Name, name) < 0 && Compare(name, n.NextDomain) < 0
+	}
+	// The last NSEC in the zone, the next domain name is the apex.
+	return Compare(n.Hdr.Name, name) < 0 && dns.IsSubDomain(n.NextDomain, name)
+}
+
+// Encloser returns the closest encloser of name as proven by the NSEC covering it, see RFC 4035, section 5.4.
+func Encloser(name string, n *dns.NSEC) string {
+	a := ancestor(name, n.Hdr.Name)
+	if b := ancestor(name, n.NextDomain); dns.CountLabel(b) > dns.CountLabel(a) {
+		return b
+	}
+	return a
+}
+
+// ancestor returns the longest common ancestor of a and b.
+func ancestor(a, b string) string {
+	n := dns.CompareDomainName(a, b)
+	off := dns.Split(a)
+	if n >= len(off) {
+		return a
+	}
+	if n == 0 {
+		return "."
+	}
+	return a[off[len(off)-n]:]
+}
+
+// WildcardOf returns the wildcard name directly below name.
+func WildcardOf(name string) string {
+	if name == "." {
+		return "*."
+	}
+	return "*." + name
+}
+
+// Compare compares a and b in canonical DNS name order, see RFC 4034, section 6.1.
+func Compare(a, b string) int {
+	la, lb := dns.SplitDomainName(strings.ToLower(a)), dns.SplitDomainName(strings.ToLower(b))
+	i, j := len(la)-1, len(lb)-1
+	for ; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+func equal(a, b string) bool { return strings.EqualFold(a, b) }
+
+// absent returns true if the bitmap proves qtype does not exist. A CNAME would have been followed, so
+// that must be absent as well.
+func absent(bitmap []uint16, qtype uint16) bool {
+	return !Has(bitmap, qtype) && !Has(bitmap, dns.TypeCNAME)
+}
+
+// parentSide returns true if bitmap is from the parent side of a delegation, such a record can only
+// deny the existence of DS records.
+func parentSide(bitmap []uint16, qtype uint16) bool {
+	return qtype != dns.TypeDS && Has(bitmap, dns.TypeNS) && !Has(bitmap, dns.TypeSOA)
+}
+
+// Has returns true if qtype is in bitmap.
+func Has(bitmap []uint16, qtype uint16) bool {
+	for _, t := range bitmap {
+		if t == qtype {
+			return true
+		}
+	}
+	return false
+}
+
+func denials(rrs []dns.RR) ([]*dns.NSEC, []*dns.NSEC3) {
+	var (
+		nsec  []*dns.NSEC
+		nsec3 []*dns.NSEC3
+	)
+	for _, r := range rrs {
+		switch r := r.(type) {
+		case *dns.NSEC:
+			nsec = append(nsec, r)
+		case *dns.NSEC3:
+			nsec3 = append(nsec3, r)
+		}
+	}
+	return nsec, nsec3
+}
+
+// OptOut is the Opt-Out flag of an NSEC3 record.
+const OptOut = 1
@@ -0,0 +1,69 @@
+package denial
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCompare(t *testing.T) {
+	// The example from RFC 4034, section 6.1, in canonical order.
+	names := []string{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"Z.a.example.",
+		"zABC.a.EXAMPLE.",
+		"z.example.",
+		"\001.z.example.",
+		"*.z.example.",
+		"\200.z.example.",
+	}
+	shuffled := []string{names[3], names[8], names[0], names[5], names[1], names[7], names[2], names[6], names[4]}
+	sort.Slice(shuffled, func(i, j int) bool { return Compare(shuffled[i], shuffled[j]) < 0 })
+	for i := range names {
+		if shuffled[i] != names[i] {
+			t.Errorf("Expected %q at position %d, got %q", names[i], i, shuffled[i])
+		}
+	}
+}
+
+func TestNSEC3(t *testing.T) {
+	apex, www := hash("example.org."), hash("www.example.org.")
+	// Two NSEC3 records that form the whole chain.
+	ns := []dns.RR{
+		nsec3(apex, www, 0, dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM),
+		nsec3(www, apex, 0, dns.TypeA, dns.TypeRRSIG),
+	}
+
+	if !NoData("www.example.org.", dns.TypeAAAA, ns) {
+		t.Errorf("Expected no data proof for www.example.org. AAAA")
+	}
+	if NoData("www.example.org.", dns.TypeA, ns) {
+		t.Errorf("Expected no proof for www.example.org. A")
+	}
+	if !NameError("nope.example.org.", ns) {
+		t.Errorf("Expected name error proof for nope.example.org.")
+	}
+	if NameError("www.example.org.", ns) {
+		t.Errorf("Expected no name error proof for www.example.org.")
+	}
+	if _, ok := NoDS("sub.example.org.", ns); ok {
+		t.Errorf("Expected no DS proof for sub.example.org. without opt-out")
+	}
+
+	for _, r := range ns {
+		r.(*dns.NSEC3).Flags = OptOut
+	}
+	if delegation, ok := NoDS("sub.example.org.", ns); !ok || !delegation {
+		t.Errorf("Expected insecure delegation for sub.example.org. with opt-out")
+	}
+}
+
+func hash(name string) string { return dns.HashName(name, dns.SHA1, 0, "") }
+
+func nsec3(owner, next string, flags uint8, types ...uint16) *dns.NSEC3 {
+	return &dns.NSEC3{Hdr: dns.RR_Header{Name: owner + ".example.org.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 3600},
+		Hash: dns.SHA1, Flags: flags, NextDomain: next, TypeBitMap: types}
+}
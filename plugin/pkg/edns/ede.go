@@ -0,0 +1,43 @@
+package edns
+
+import "github.com/miekg/dns"
+
+// SetExtendedError adds an Extended DNS Error (RFC 8914) with info code and extra text to the reply m
+// for the request req. When req has no OPT record the client does not support EDNS0 and nothing is added.
+// When m shares the OPT record of req, as after request.Request.SizeAndDo, m gets its own copy so that req
+// is left as it is.
+func SetExtendedError(req, m *dns.Msg, code uint16, text string) {
+	ro := req.IsEdns0()
+	if ro == nil {
+		return
+	}
+
+	o := m.IsEdns0()
+	switch o {
+	case nil:
+		o = &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+		m.Extra = append(m.Extra, o)
+	case ro:
+		o = dns.Copy(ro).(*dns.OPT)
+		for i, rr := range m.Extra {
+			if rr == ro {
+				m.Extra[i] = o
+			}
+		}
+	}
+	o.Option = append(o.Option, &dns.EDNS0_EDE{InfoCode: code, ExtraText: text})
+}
+
+// ExtendedError is an error that carries an Extended DNS Error. A plugin that returns an rcode for which the
+// server writes the reply, such as SERVFAIL, can return it to have the Extended DNS Error added to that reply.
+type ExtendedError struct {
+	Code uint16 // info code
+	Text string // extra text
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *ExtendedError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the wrapped error.
+func (e *ExtendedError) Unwrap() error { return e.Err }
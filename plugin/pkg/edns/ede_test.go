@@ -0,0 +1,65 @@
+package edns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSetExtendedError(t *testing.T) {
+	req := ednsMsg()
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeServerFailure)
+
+	SetExtendedError(req, m, dns.ExtendedErrorCodeStaleAnswer, "")
+	SetExtendedError(req, m, dns.ExtendedErrorCodeNetworkError, "no healthy proxies")
+
+	o := m.IsEdns0()
+	if o == nil {
+		t.Fatalf("Expected OPT record in reply")
+	}
+	if len(o.Option) != 2 {
+		t.Fatalf("Expected %d options, got %d", 2, len(o.Option))
+	}
+	ede, ok := o.Option[1].(*dns.EDNS0_EDE)
+	if !ok {
+		t.Fatalf("Expected EDNS0_EDE option, got %T", o.Option[1])
+	}
+	if ede.InfoCode != dns.ExtendedErrorCodeNetworkError || ede.ExtraText != "no healthy proxies" {
+		t.Errorf("Expected %d %q, got %d %q", dns.ExtendedErrorCodeNetworkError, "no healthy proxies", ede.InfoCode, ede.ExtraText)
+	}
+}
+
+func TestSetExtendedErrorSharedOPT(t *testing.T) {
+	req := ednsMsg()
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeServerFailure)
+	m.Extra = append(m.Extra, req.IsEdns0()) // as request.Request.SizeAndDo does
+
+	SetExtendedError(req, m, dns.ExtendedErrorCodeNetworkError, "")
+
+	for _, opt := range req.IsEdns0().Option {
+		if _, ok := opt.(*dns.EDNS0_EDE); ok {
+			t.Fatalf("Expected request to be left without extended error")
+		}
+	}
+	o := m.IsEdns0()
+	if o == nil || o == req.IsEdns0() {
+		t.Fatalf("Expected reply to have its own OPT record")
+	}
+	if _, ok := o.Option[len(o.Option)-1].(*dns.EDNS0_EDE); !ok {
+		t.Errorf("Expected extended error in reply, got %v", o.Option)
+	}
+}
+
+func TestSetExtendedErrorNoEdns(t *testing.T) {
+	req := ednsMsg()
+	req.Extra = nil
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeServerFailure)
+
+	SetExtendedError(req, m, dns.ExtendedErrorCodeStaleAnswer, "")
+	if m.IsEdns0() != nil {
+		t.Errorf("Expected no OPT record in reply to a request without EDNS0")
+	}
+}
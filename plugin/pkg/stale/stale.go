@@ -0,0 +1,36 @@
+// Package stale lets a plugin that holds stale data, such as cache, offer it to the plugins after it
+// in the chain. A plugin that fails to resolve a query, such as forward, can then answer the query with
+// the stale data instead of returning SERVFAIL, see RFC 8767.
+package stale
+
+import "context"
+
+// Server is implemented by plugins that can answer the current query with stale data.
+type Server interface {
+	// ServeStale writes a stale answer for the current query to the client. It returns false if
+	// no stale answer is available, in which case nothing has been written.
+	ServeStale() bool
+}
+
+type key struct{}
+
+// NewContext returns a context that carries s.
+func NewContext(ctx context.Context, s Server) context.Context {
+	return context.WithValue(ctx, key{}, s)
+}
+
+// FromContext returns the Server in ctx, or nil if there is none.
+func FromContext(ctx context.Context) Server {
+	s, _ := ctx.Value(key{}).(Server)
+	return s
+}
+
+// Serve asks the Server in ctx to answer the current query with stale data. It returns true if a stale
+// answer has been written to the client.
+func Serve(ctx context.Context) bool {
+	s := FromContext(ctx)
+	if s == nil {
+		return false
+	}
+	return s.ServeStale()
+}
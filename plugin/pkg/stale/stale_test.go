@@ -0,0 +1,36 @@
+package stale
+
+import (
+	"context"
+	"testing"
+)
+
+type server struct {
+	available bool
+	called    int
+}
+
+func (s *server) ServeStale() bool {
+	s.called++
+	return s.available
+}
+
+func TestServe(t *testing.T) {
+	if Serve(context.TODO()) {
+		t.Errorf("Expected no stale answer without a server in the context")
+	}
+
+	s := &server{}
+	ctx := NewContext(context.TODO(), s)
+	if Serve(ctx) {
+		t.Errorf("Expected no stale answer when the server has none")
+	}
+
+	s.available = true
+	if !Serve(ctx) {
+		t.Errorf("Expected a stale answer")
+	}
+	if s.called != 2 {
+		t.Errorf("Expected server to be called %d times, got %d", 2, s.called)
+	}
+}
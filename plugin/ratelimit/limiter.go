@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// limiter holds a token bucket per client. The buckets are spread over shards, each with its own lock, so
+// that many clients can be tracked without contention.
+type limiter struct {
+	name   string
+	rate   float64 // tokens per second
+	burst  int     // size of the bucket
+	shards [numShards]*shard
+}
+
+// shard holds the buckets of some of the clients. When it holds max buckets, a new client takes the place of
+// the client that has been idle the longest.
+type shard struct {
+	sync.Mutex
+	buckets map[string]*list.Element // values are *bucket
+	idle    *list.List               // buckets ordered on their last use, the longest idle at the back
+	max     int
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(name string, rate float64, burst, maxClients int) *limiter {
+	l := &limiter{name: name, rate: rate, burst: burst}
+	max := maxClients / numShards
+	if max < 1 {
+		max = 1
+	}
+	for i := range l.shards {
+		l.shards[i] = &shard{buckets: make(map[string]*list.Element), idle: list.New(), max: max}
+	}
+	return l
+}
+
+// reserve takes a token from the bucket of key at now. It returns 0 when a token is available. Otherwise
+// it returns how long it takes until one is, and only takes the token when this is at most maxWait.
+func (l *limiter) reserve(key string, now time.Time, maxWait time.Duration) time.Duration {
+	s := l.shard(key)
+	s.Lock()
+	defer s.Unlock()
+
+	b := s.bucket(key, float64(l.burst), now)
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if max := float64(l.burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	if wait <= maxWait {
+		b.tokens--
+	}
+	return wait
+}
+
+// shard returns the shard that holds the bucket of key.
+func (l *limiter) shard(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return l.shards[h.Sum32()%numShards]
+}
+
+// bucket returns the bucket of key, the bucket of a new client starts with tokens. The caller must hold the
+// lock of s.
+func (s *shard) bucket(key string, tokens float64, now time.Time) *bucket {
+	if e, ok := s.buckets[key]; ok {
+		s.idle.MoveToFront(e)
+		return e.Value.(*bucket)
+	}
+	if len(s.buckets) >= s.max {
+		// Forgetting the longest idle client is the least harmful: its bucket has had the most time to fill up.
+		if e := s.idle.Back(); e != nil {
+			s.idle.Remove(e)
+			delete(s.buckets, e.Value.(*bucket).key)
+		}
+	}
+	b := &bucket{key: key, tokens: tokens, last: now}
+	s.buckets[key] = s.idle.PushFront(b)
+	return b
+}
+
+// len returns the number of buckets.
+func (l *limiter) len() int {
+	n := 0
+	for _, s := range l.shards {
+		s.Lock()
+		n += len(s.buckets)
+		s.Unlock()
+	}
+	return n
+}
+
+const numShards = 256
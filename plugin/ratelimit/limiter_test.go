@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	l := newLimiter("", 1, 2, 1000)
+	now := time.Now()
+
+	// A burst of 2 is allowed, the 3rd query has to wait a second for a token.
+	for i, want := range []time.Duration{0, 0, time.Second, time.Second} {
+		if got := l.reserve("a", now, 0); got != want {
+			t.Errorf("Query %d: expected wait %s, got %s", i, want, got)
+		}
+	}
+	if got := l.reserve("b", now, 0); got != 0 {
+		t.Errorf("Expected another client not to wait, got %s", got)
+	}
+
+	// Reserving takes the token, the next query waits longer.
+	if got := l.reserve("a", now, 2*time.Second); got != time.Second {
+		t.Errorf("Expected wait 1s, got %s", got)
+	}
+	if got := l.reserve("a", now, 2*time.Second); got != 2*time.Second {
+		t.Errorf("Expected wait 2s, got %s", got)
+	}
+	if got := l.reserve("a", now.Add(3*time.Second), 0); got != 0 {
+		t.Errorf("Expected no wait after the reserved tokens were refilled, got %s", got)
+	}
+}
+
+func TestLimiterShards(t *testing.T) {
+	l := newLimiter("", 1, 1, numShards*2)
+	now := time.Now()
+	for i := 0; i < numShards*4; i++ {
+		l.reserve(strconv.Itoa(i), now, 0)
+	}
+	// Each shard holds at most 2 clients, the longest idle ones are forgotten.
+	if n := l.len(); n > numShards*2 {
+		t.Errorf("Expected %d clients, got %d", numShards*2, n)
+	}
+}
+
+func TestLimiterFull(t *testing.T) {
+	l := newLimiter("", 1, 1, 1) // a single client per shard
+	now := time.Now()
+
+	// Find two clients in the same shard.
+	a, b := "0", ""
+	for i := 1; b == ""; i++ {
+		if k := strconv.Itoa(i); l.shard(k) == l.shard(a) {
+			b = k
+		}
+	}
+
+	l.reserve(a, now, 0)
+	// b takes the place of a in the full shard, and is limited like any other client.
+	if got := l.reserve(b, now, 0); got != 0 {
+		t.Errorf("Expected no wait for the first query of a new client, got %s", got)
+	}
+	if got := l.reserve(b, now, 0); got == 0 {
+		t.Error("Expected a new client in a full shard to be limited")
+	}
+	if _, ok := l.shard(a).buckets[a]; ok {
+		t.Error("Expected the longest idle client to be forgotten")
+	}
+}
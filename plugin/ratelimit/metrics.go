@@ -0,0 +1,16 @@
+package ratelimit
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// limitedCount is the number of queries over the rate limit, per action taken.
+var limitedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "ratelimit",
+	Name:      "limited_requests_total",
+	Help:      "Counter of requests over the rate limit, by the action taken: refused, dropped or delayed.",
+}, []string{"server", "limiter", "action"})
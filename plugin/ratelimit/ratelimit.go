@@ -0,0 +1,128 @@
+// Package ratelimit implements a plugin that limits the rate of queries per client.
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// RateLimit limits the rate of queries of each client, which is identified by its address, its network
+// or a metadata value.
+type RateLimit struct {
+	Next  plugin.Handler
+	Zones []string
+
+	limiter  *limiter
+	key      keyType
+	ipv4Mask net.IPMask // for keySubnet
+	ipv6Mask net.IPMask
+	label    string // for keyMetadata
+	action   action
+	maxDelay time.Duration // for actionDelay
+	exempt   []*net.IPNet
+
+	now func() time.Time
+}
+
+// keyType is what identifies a client.
+type keyType int
+
+const (
+	keyIP keyType = iota
+	keySubnet
+	keyMetadata
+)
+
+// action is what is done with a query over the limit.
+type action int
+
+const (
+	actionRefuse action = iota // reply with REFUSED
+	actionDrop                 // don't reply
+	actionDelay                // delay the query until it is within the limit, or drop it
+)
+
+var actionNames = map[action]string{actionRefuse: "refused", actionDrop: "dropped", actionDelay: "delayed"}
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *RateLimit) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if plugin.Zones(rl.Zones).Matches(state.Name()) == "" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+	ip := net.ParseIP(state.IP())
+	if rl.exempted(ip) {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	maxWait := time.Duration(0)
+	if rl.action == actionDelay {
+		maxWait = rl.maxDelay
+	}
+	wait := rl.limiter.reserve(rl.clientKey(ctx, ip), rl.now(), maxWait)
+	if wait == 0 {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	server := metrics.WithServer(ctx)
+	switch {
+	case rl.action == actionDelay && wait <= maxWait:
+		limitedCount.WithLabelValues(server, rl.limiter.name, actionNames[actionDelay]).Inc()
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+		case <-ctx.Done():
+			return dns.RcodeServerFailure, ctx.Err()
+		}
+	case rl.action == actionRefuse:
+		limitedCount.WithLabelValues(server, rl.limiter.name, actionNames[actionRefuse]).Inc()
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+	// Drop, also when a delayed query would have to wait too long.
+	limitedCount.WithLabelValues(server, rl.limiter.name, actionNames[actionDrop]).Inc()
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the plugin.Handler interface.
+func (rl *RateLimit) Name() string { return "ratelimit" }
+
+// clientKey returns the key of the bucket of the client at ip.
+func (rl *RateLimit) clientKey(ctx context.Context, ip net.IP) string {
+	switch rl.key {
+	case keySubnet:
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(rl.ipv4Mask).String()
+		}
+		return ip.Mask(rl.ipv6Mask).String()
+	case keyMetadata:
+		// Queries without a value are limited per client address.
+		if f := metadata.ValueFunc(ctx, rl.label); f != nil {
+			if v := f(); v != "" {
+				return "/" + v
+			}
+		}
+	}
+	return ip.String()
+}
+
+func (rl *RateLimit) exempted(ip net.IP) bool {
+	for _, n := range rl.exempt {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
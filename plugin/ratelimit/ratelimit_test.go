@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func newTestRateLimit(a action) *RateLimit {
+	now := time.Now()
+	return &RateLimit{
+		Next:     test.NextHandler(dns.RcodeSuccess, nil),
+		Zones:    []string{"."},
+		limiter:  newLimiter("test", 1, 1, 1000),
+		ipv4Mask: net.CIDRMask(24, 32),
+		ipv6Mask: net.CIDRMask(56, 128),
+		action:   a,
+		maxDelay: defaultMaxDelay,
+		now:      func() time.Time { return now },
+	}
+}
+
+// serve sends a query to rl and returns the rcode and the written reply.
+func serve(ctx context.Context, rl *RateLimit, w dns.ResponseWriter) (int, *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(w)
+	rcode, _ := rl.ServeDNS(ctx, rec, m)
+	return rcode, rec.Msg
+}
+
+func TestRateLimitActions(t *testing.T) {
+	rl := newTestRateLimit(actionRefuse)
+	if rcode, m := serve(context.TODO(), rl, &test.ResponseWriter{}); rcode != dns.RcodeSuccess || m != nil {
+		t.Fatalf("Expected the first query to be passed on")
+	}
+	if _, m := serve(context.TODO(), rl, &test.ResponseWriter{}); m == nil || m.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for a query over the limit")
+	}
+	// Another client has its own bucket.
+	if _, m := serve(context.TODO(), rl, &test.ResponseWriter6{}); m != nil {
+		t.Errorf("Expected a query of another client to be passed on")
+	}
+
+	rl.action = actionDrop
+	if rcode, m := serve(context.TODO(), rl, &test.ResponseWriter{}); rcode != dns.RcodeSuccess || m != nil {
+		t.Errorf("Expected a query over the limit to be dropped")
+	}
+
+	rl.exempt = []*net.IPNet{{IP: net.ParseIP("10.240.0.0"), Mask: net.CIDRMask(16, 32)}}
+	rl.action = actionRefuse
+	if _, m := serve(context.TODO(), rl, &test.ResponseWriter{}); m != nil {
+		t.Errorf("Expected a query of an exempted client to be passed on")
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	rl := newTestRateLimit(actionDelay)
+	rl.limiter = newLimiter("test", 100, 1, 1000)
+	rl.now = time.Now
+	rl.maxDelay = 15 * time.Millisecond
+
+	start := time.Now()
+	serve(context.TODO(), rl, &test.ResponseWriter{})
+	serve(context.TODO(), rl, &test.ResponseWriter{})
+	if d := time.Since(start); d < 5*time.Millisecond {
+		t.Errorf("Expected the second query to be delayed, took %s", d)
+	}
+
+	// A query that would have to wait longer than the maximum delay is dropped.
+	rl.maxDelay = time.Millisecond
+	start = time.Now()
+	serve(context.TODO(), rl, &test.ResponseWriter{})
+	if d := time.Since(start); d > 5*time.Millisecond {
+		t.Errorf("Expected the query to be dropped right away, took %s", d)
+	}
+
+	// A canceled query is not delayed further.
+	rl.maxDelay = time.Hour
+	rl.limiter = newLimiter("test", 0.001, 1, 1000)
+	ctx, cancel := context.WithCancel(context.TODO())
+	serve(ctx, rl, &test.ResponseWriter{})
+	cancel()
+	if rcode, _ := serve(ctx, rl, &test.ResponseWriter{}); rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL for a canceled query, got %d", rcode)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	rl := newTestRateLimit(actionRefuse)
+	ip4, ip6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8:1:2:3::1")
+	if k := rl.clientKey(context.TODO(), ip4); k != "192.0.2.1" {
+		t.Errorf("Expected key 192.0.2.1, got %s", k)
+	}
+
+	rl.key = keySubnet
+	if k := rl.clientKey(context.TODO(), ip4); k != "192.0.2.0" {
+		t.Errorf("Expected key 192.0.2.0, got %s", k)
+	}
+	if k := rl.clientKey(context.TODO(), ip6); k != "2001:db8:1::" {
+		t.Errorf("Expected key 2001:db8:1::, got %s", k)
+	}
+
+	rl.key, rl.label = keyMetadata, "test/tenant"
+	ctx := metadata.ContextWithMetadata(context.TODO())
+	if k := rl.clientKey(ctx, ip4); k != "192.0.2.1" {
+		t.Errorf("Expected the client address as key without metadata, got %s", k)
+	}
+	metadata.SetValueFunc(ctx, "test/tenant", func() string { return "acme" })
+	if k := rl.clientKey(ctx, ip4); k != "/acme" {
+		t.Errorf("Expected key /acme, got %s", k)
+	}
+}
@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+)
+
+func init() { plugin.Register("ratelimit", setup) }
+
+func setup(c *caddy.Controller) error {
+	rl, err := parse(c)
+	if err != nil {
+		return plugin.Error("ratelimit", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	return nil
+}
+
+// limiterKey is the key under which a named limiter is stored in the caddy instance, so that server
+// blocks using the same name share it.
+type limiterKey string
+
+func parse(c *caddy.Controller) (*RateLimit, error) {
+	rl := &RateLimit{
+		ipv4Mask: net.CIDRMask(24, 32),
+		ipv6Mask: net.CIDRMask(56, 128),
+		maxDelay: defaultMaxDelay,
+		now:      time.Now,
+	}
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		var (
+			name       string
+			rate       float64
+			burst      int
+			maxClients = defaultMaxClients
+		)
+		for c.NextBlock() {
+			switch v := c.Val(); v {
+			case "rate":
+				args := c.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				var err error
+				rate, err = strconv.ParseFloat(args[0], 64)
+				if err != nil || rate <= 0 {
+					return nil, c.Errf("invalid rate: %s", args[0])
+				}
+				burst = int(math.Ceil(rate))
+				if len(args) == 2 {
+					burst, err = strconv.Atoi(args[1])
+					if err != nil || burst < 1 {
+						return nil, c.Errf("invalid burst: %s", args[1])
+					}
+				}
+			case "limiter":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				name = c.Val()
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "key":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "ip":
+					if len(args) != 1 {
+						return nil, c.ArgErr()
+					}
+					rl.key = keyIP
+				case "subnet":
+					if len(args) > 3 {
+						return nil, c.ArgErr()
+					}
+					rl.key = keySubnet
+					for i, bits := range []int{32, 128} {
+						if len(args) < i+2 {
+							break
+						}
+						l, err := strconv.Atoi(args[i+1])
+						if err != nil || l < 0 || l > bits {
+							return nil, c.Errf("invalid prefix length: %s", args[i+1])
+						}
+						if bits == 32 {
+							rl.ipv4Mask = net.CIDRMask(l, bits)
+						} else {
+							rl.ipv6Mask = net.CIDRMask(l, bits)
+						}
+					}
+				case "metadata":
+					if len(args) != 2 {
+						return nil, c.ArgErr()
+					}
+					if !metadata.IsLabel(args[1]) {
+						return nil, c.Errf("invalid metadata label: %s", args[1])
+					}
+					rl.key = keyMetadata
+					rl.label = args[1]
+				default:
+					return nil, c.Errf("unknown key: %s", args[0])
+				}
+			case "action":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "refuse":
+					rl.action = actionRefuse
+				case "drop":
+					rl.action = actionDrop
+				case "delay":
+					rl.action = actionDelay
+				default:
+					return nil, c.Errf("unknown action: %s", args[0])
+				}
+				if len(args) > 1 && rl.action != actionDelay || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				if len(args) == 2 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil || d <= 0 {
+						return nil, c.Errf("invalid maximum delay: %s", args[1])
+					}
+					rl.maxDelay = d
+				}
+			case "exempt":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					if !strings.Contains(a, "/") {
+						if strings.Contains(a, ":") {
+							a += "/128"
+						} else {
+							a += "/32"
+						}
+					}
+					_, n, err := net.ParseCIDR(a)
+					if err != nil {
+						return nil, c.Errf("invalid network: %s", a)
+					}
+					rl.exempt = append(rl.exempt, n)
+				}
+			case "max_clients":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				m, err := strconv.Atoi(args[0])
+				if err != nil || m < 1 {
+					return nil, c.Errf("invalid max_clients: %s", args[0])
+				}
+				maxClients = m
+			default:
+				return nil, c.Errf("unknown property '%s'", v)
+			}
+		}
+
+		l, err := sharedLimiter(c, name, rate, burst, maxClients)
+		if err != nil {
+			return nil, err
+		}
+		rl.limiter = l
+	}
+	return rl, nil
+}
+
+// sharedLimiter returns the limiter called name, creating it when it doesn't exist yet. A limiter without
+// a name is not shared. The rate of a shared limiter has to be set once, other server blocks using it may
+// leave it out or have to set the same rate.
+func sharedLimiter(c *caddy.Controller, name string, rate float64, burst, maxClients int) (*limiter, error) {
+	if name != "" {
+		if l, ok := c.Get(limiterKey(name)).(*limiter); ok {
+			if rate != 0 && (rate != l.rate || burst != l.burst) {
+				return nil, fmt.Errorf("limiter %q is already defined with another rate", name)
+			}
+			return l, nil
+		}
+	}
+	if rate == 0 {
+		if name != "" {
+			return nil, fmt.Errorf("no rate for limiter %q", name)
+		}
+		return nil, fmt.Errorf("no rate")
+	}
+	l := newLimiter(name, rate, burst, maxClients)
+	if name != "" {
+		c.Set(limiterKey(name), l)
+	}
+	return l, nil
+}
+
+const (
+	defaultMaxDelay   = time.Second
+	defaultMaxClients = 1000000
+)
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/caddy/caddyfile"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("dns", "ratelimit {\nrate 10\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+
+	c = caddy.NewTestController("dns", "ratelimit {\nrate 10\n}\nratelimit {\nrate 10\n}")
+	if err := setup(c); err == nil {
+		t.Fatal("Expected errors for a second ratelimit, but got none")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		key       keyType
+		action    action
+	}{
+		{"rate 10", false, keyIP, actionRefuse},
+		{"rate 10 20\nkey subnet 16 48\naction drop", false, keySubnet, actionDrop},
+		{"rate 0.5\nkey metadata geoip/country/code\naction delay 2s", false, keyMetadata, actionDelay},
+		{"rate 10\nkey ip\nexempt 10.0.0.0/8 ::1\nmax_clients 100", false, keyIP, actionRefuse},
+		{"rate 10\nlimiter tenants", false, keyIP, actionRefuse},
+		{"", true, 0, 0},
+		{"rate 0", true, 0, 0},
+		{"rate 10 0", true, 0, 0},
+		{"rate 10\nkey subnet 33", true, 0, 0},
+		{"rate 10\nkey metadata country", true, 0, 0},
+		{"rate 10\nkey name", true, 0, 0},
+		{"rate 10\naction delay 0s", true, 0, 0},
+		{"rate 10\naction drop 1s", true, 0, 0},
+		{"rate 10\naction servfail", true, 0, 0},
+		{"rate 10\nexempt 10.0.0.0/33", true, 0, 0},
+		{"rate 10\nmax_clients 0", true, 0, 0},
+		{"rate 10\nlimiter", true, 0, 0},
+		{"rate 10\nunknown", true, 0, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("ratelimit {\n%s\n}", tc.input))
+		rl, err := parse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if rl.key != tc.key || rl.action != tc.action {
+			t.Errorf("Test %d: expected key %d and action %d, got %d and %d", i, tc.key, tc.action, rl.key, rl.action)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	c := caddy.NewTestController("dns", `ratelimit example.org {
+		rate 10 20
+		key subnet 16 48
+		action delay 2s
+	}`)
+	rl, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rl.Zones) != 1 || rl.Zones[0] != "example.org." {
+		t.Errorf("Expected zone example.org., got %v", rl.Zones)
+	}
+	if rl.limiter.rate != 10 || rl.limiter.burst != 20 || rl.maxDelay != 2*time.Second {
+		t.Errorf("Unexpected rate %g, burst %d or maximum delay %s", rl.limiter.rate, rl.limiter.burst, rl.maxDelay)
+	}
+	if ones, _ := rl.ipv4Mask.Size(); ones != 16 {
+		t.Errorf("Expected IPv4 prefix length 16, got %d", ones)
+	}
+	if ones, _ := rl.ipv6Mask.Size(); ones != 48 {
+		t.Errorf("Expected IPv6 prefix length 48, got %d", ones)
+	}
+}
+
+func TestParseShared(t *testing.T) {
+	// The server blocks of a Corefile are parsed with controllers of the same instance.
+	c := caddy.NewTestController("dns", "ratelimit {\nrate 10\nlimiter tenants\n}")
+	parseBlock := func(input string) (*RateLimit, error) {
+		c.Dispenser = caddyfile.NewDispenser("Testfile", strings.NewReader(input))
+		return parse(c)
+	}
+
+	first, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := parseBlock("ratelimit {\nlimiter tenants\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.limiter != second.limiter {
+		t.Error("Expected server blocks to share the limiter")
+	}
+	if _, err := parseBlock("ratelimit {\nrate 10\nlimiter tenants\n}"); err != nil {
+		t.Errorf("Expected no error for the same rate, got %s", err)
+	}
+	if _, err := parseBlock("ratelimit {\nrate 20\nlimiter tenants\n}"); err == nil {
+		t.Error("Expected error for another rate of the shared limiter")
+	}
+	if _, err := parseBlock("ratelimit {\nlimiter others\n}"); err == nil {
+		t.Error("Expected error for a limiter without a rate")
+	}
+
+	unnamed, err := parseBlock("ratelimit {\nrate 10\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unnamed.limiter == first.limiter {
+		t.Error("Expected a limiter without a name not to be shared")
+	}
+}
@@ -0,0 +1,312 @@
+package rpz
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+// action is what is done with a query that triggers a rule.
+type action int
+
+const (
+	actionNXDomain  action = iota // reply with NXDOMAIN
+	actionNoData                  // reply with NOERROR and no answer
+	actionPassthru                // answer the query as if no rule was triggered
+	actionDrop                    // don't reply
+	actionTCPOnly                 // reply truncated over UDP, so the client retries over TCP
+	actionLocalData               // reply with the records of the rule
+)
+
+var actionNames = map[action]string{
+	actionNXDomain:  "nxdomain",
+	actionNoData:    "nodata",
+	actionPassthru:  "passthru",
+	actionDrop:      "drop",
+	actionTCPOnly:   "tcp-only",
+	actionLocalData: "local-data",
+}
+
+func (a action) String() string { return actionNames[a] }
+
+// trigger is what triggers a rule.
+type trigger int
+
+const (
+	triggerClientIP trigger = iota
+	triggerQName
+	triggerResponseIP
+	triggerNSDName
+)
+
+var triggerNames = map[trigger]string{
+	triggerClientIP:   "client-ip",
+	triggerQName:      "qname",
+	triggerResponseIP: "response-ip",
+	triggerNSDName:    "nsdname",
+}
+
+func (t trigger) String() string { return triggerNames[t] }
+
+// rule is a rule of a policy zone.
+type rule struct {
+	owner   string // owner name of the rule in the policy zone
+	trigger trigger
+	action  action
+	data    []dns.RR // for actionLocalData
+}
+
+// policyZone is a response policy zone. Its rules are compiled from the zone whenever the zone has been
+// reloaded or transferred, which replaces its SOA record.
+type policyZone struct {
+	name string
+	z    *file.Zone
+
+	mu       sync.RWMutex
+	compiled *dns.SOA // SOA of the zone the rules were compiled from
+	rules    *rules
+}
+
+// rules holds the rules of a policy zone by trigger.
+type rules struct {
+	soa   *dns.SOA
+	count int
+
+	qnames     names
+	nsdnames   names
+	clientIP   *iptree.Tree
+	responseIP *iptree.Tree
+}
+
+// names holds rules for exact names and for wildcards, which are keyed by the name below the '*'.
+type names struct {
+	exact     map[string]*rule
+	wildcards map[string]*rule
+}
+
+func newPolicyZone(name string, z *file.Zone) *policyZone {
+	return &policyZone{name: name, z: z}
+}
+
+// get returns the rules of the zone, compiling them when the zone has changed. It returns nil when the zone
+// hasn't been loaded yet.
+func (p *policyZone) get() *rules {
+	p.z.RLock()
+	soa := p.z.Apex.SOA
+	p.z.RUnlock()
+	if soa == nil {
+		return nil
+	}
+
+	p.mu.RLock()
+	if p.compiled == soa {
+		r := p.rules
+		p.mu.RUnlock()
+		return r
+	}
+	p.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Incremental transfers change the tree in place, so compile under the lock of the zone.
+	p.z.RLock()
+	defer p.z.RUnlock()
+	soa = p.z.Apex.SOA
+	if p.compiled != soa {
+		p.rules = compile(p.name, p.z.Tree, soa)
+		p.compiled = soa
+		log.Infof("Compiled %d rules of policy zone %s with %d SOA serial", p.rules.count, p.name, soa.Serial)
+	}
+	return p.rules
+}
+
+// compile compiles the rules of the policy zone origin from the records in t.
+func compile(origin string, t *tree.Tree, soa *dns.SOA) *rules {
+	rs := &rules{
+		soa:        soa,
+		qnames:     newNames(),
+		nsdnames:   newNames(),
+		clientIP:   iptree.NewTree(),
+		responseIP: iptree.NewTree(),
+	}
+	for _, e := range t.All() {
+		if e.Empty() {
+			continue
+		}
+		name := e.Name()
+		if !dns.IsSubDomain(origin, name) || name == origin {
+			continue
+		}
+		r, err := newRule(strings.TrimSuffix(name, "."+origin), e.All())
+		if err != nil {
+			log.Warningf("Skipping rule %s of policy zone %s: %s", name, origin, err)
+			continue
+		}
+		r.owner = name
+
+		switch r.trigger {
+		case triggerQName:
+			rs.qnames.insert(r)
+		case triggerNSDName:
+			rs.nsdnames.insert(r)
+		case triggerClientIP:
+			rs.clientIP.InplaceInsertNet(r.net, r.rule)
+		case triggerResponseIP:
+			rs.responseIP.InplaceInsertNet(r.net, r.rule)
+		}
+		rs.count++
+	}
+	return rs
+}
+
+// parsedRule is a rule with the name or network that triggers it.
+type parsedRule struct {
+	*rule
+	name string
+	net  *net.IPNet
+}
+
+// newRule parses the rule with the owner name relative, relative to the policy zone, and records rrs.
+func newRule(relative string, rrs []dns.RR) (parsedRule, error) {
+	r := parsedRule{rule: &rule{trigger: triggerQName}}
+
+	labels := dns.SplitDomainName(relative)
+	switch last := labels[len(labels)-1]; last {
+	case "rpz-client-ip", "rpz-ip":
+		r.trigger = triggerClientIP
+		if last == "rpz-ip" {
+			r.trigger = triggerResponseIP
+		}
+		n, err := parseIPTrigger(labels[:len(labels)-1])
+		if err != nil {
+			return r, err
+		}
+		r.net = n
+	case "rpz-nsdname":
+		r.trigger = triggerNSDName
+		if len(labels) == 1 {
+			return r, fmt.Errorf("no name")
+		}
+		r.name = dns.Fqdn(strings.Join(labels[:len(labels)-1], "."))
+	case "rpz-nsip":
+		return r, fmt.Errorf("NSIP triggers are not supported")
+	default:
+		r.name = dns.Fqdn(relative)
+	}
+
+	r.action = actionLocalData
+	if len(rrs) == 1 {
+		if cname, ok := rrs[0].(*dns.CNAME); ok {
+			switch cname.Target {
+			case ".":
+				r.action = actionNXDomain
+			case "*.":
+				r.action = actionNoData
+			case "rpz-passthru.":
+				r.action = actionPassthru
+			case "rpz-drop.":
+				r.action = actionDrop
+			case "rpz-tcp-only.":
+				r.action = actionTCPOnly
+			}
+		}
+	}
+	if r.action == actionLocalData {
+		r.data = rrs
+	}
+	return r, nil
+}
+
+// parseIPTrigger parses the labels of an IP trigger: the prefix length followed by the address in reverse
+// order. IPv4 addresses have 4 labels, IPv6 addresses are written in groups of 16 bits, where "zz" stands
+// for "::".
+func parseIPTrigger(labels []string) (*net.IPNet, error) {
+	if len(labels) < 2 {
+		return nil, fmt.Errorf("invalid IP trigger")
+	}
+	prefix, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix length %q", labels[0])
+	}
+
+	addr := make([]string, 0, len(labels)-1)
+	for i := len(labels) - 1; i > 0; i-- {
+		addr = append(addr, labels[i])
+	}
+
+	var s string
+	if len(addr) == 4 && !strings.Contains(strings.Join(addr, ""), "zz") {
+		s = strings.Join(addr, ".")
+	} else {
+		for i := range addr {
+			if addr[i] == "zz" {
+				addr[i] = ""
+			}
+		}
+		s = strings.Join(addr, ":")
+		if strings.HasPrefix(s, ":") {
+			s = ":" + s
+		}
+		if strings.HasSuffix(s, ":") {
+			s += ":"
+		}
+	}
+
+	_, n, err := net.ParseCIDR(s + "/" + strconv.Itoa(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP trigger %q", s+"/"+strconv.Itoa(prefix))
+	}
+	return n, nil
+}
+
+func newNames() names {
+	return names{exact: make(map[string]*rule), wildcards: make(map[string]*rule)}
+}
+
+func (n names) insert(r parsedRule) {
+	if strings.HasPrefix(r.name, "*.") {
+		parent := r.name[2:]
+		if parent == "" {
+			parent = "."
+		}
+		n.wildcards[parent] = r.rule
+		return
+	}
+	n.exact[r.name] = r.rule
+}
+
+// match returns the rule for name: the rule for name itself or else the rule of the closest wildcard.
+func (n names) match(name string) *rule {
+	if r, ok := n.exact[name]; ok {
+		return r
+	}
+	if len(n.wildcards) == 0 {
+		return nil
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if r, ok := n.wildcards[name[off:]]; ok {
+			return r
+		}
+	}
+	return n.wildcards["."]
+}
+
+// matchIP returns the rule of the longest prefix in t that contains ip.
+func matchIP(t *iptree.Tree, ip net.IP) *rule {
+	if ip == nil {
+		return nil
+	}
+	v, ok := t.GetByIP(ip)
+	if !ok {
+		return nil
+	}
+	return v.(*rule)
+}
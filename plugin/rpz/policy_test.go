@@ -0,0 +1,149 @@
+package rpz
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/file"
+)
+
+const dbRPZ = `$ORIGIN rpz.example.
+$TTL 60
+@                         SOA   ns.rpz.example. hostmaster.rpz.example. 1 3600 600 86400 30
+                          NS    ns.rpz.example.
+
+bad.example.org           CNAME .
+*.bad.example.org         CNAME .
+nodata.example.org        CNAME *.
+ok.bad.example.org        CNAME rpz-passthru.
+drop.example.org          CNAME rpz-drop.
+tcp.example.org           CNAME rpz-tcp-only.
+local.example.org         A     192.0.2.53
+                          TXT   "blocked"
+garden.example.org        CNAME walled.example.net.
+
+32.1.2.0.192.rpz-client-ip  CNAME .
+24.0.2.0.192.rpz-client-ip  CNAME rpz-drop.
+48.zz.2001.rpz-client-ip    CNAME .
+32.66.2.0.192.rpz-ip        CNAME .
+64.zz.db8.2001.rpz-ip       CNAME *.
+ns.bad.example.net.rpz-nsdname CNAME .
+*.evil.example.net.rpz-nsdname CNAME *.
+10.0.0.10.rpz-nsip          CNAME .
+`
+
+func testPolicyZone(t *testing.T) *policyZone {
+	t.Helper()
+	z, err := file.Parse(strings.NewReader(dbRPZ), "rpz.example.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse policy zone: %s", err)
+	}
+	return newPolicyZone("rpz.example.", z)
+}
+
+func TestCompile(t *testing.T) {
+	p := testPolicyZone(t)
+	rs := p.get()
+	if rs == nil {
+		t.Fatal("Expected rules")
+	}
+	if rs.count != 15 {
+		t.Errorf("Expected 15 rules, got %d", rs.count)
+	}
+	if rs2 := p.get(); rs2 != rs {
+		t.Errorf("Expected rules to be compiled once")
+	}
+
+	tests := []struct {
+		qname  string
+		action action
+		owner  string
+	}{
+		{"bad.example.org.", actionNXDomain, "bad.example.org.rpz.example."},
+		{"a.b.bad.example.org.", actionNXDomain, "*.bad.example.org.rpz.example."},
+		{"ok.bad.example.org.", actionPassthru, "ok.bad.example.org.rpz.example."},
+		{"nodata.example.org.", actionNoData, "nodata.example.org.rpz.example."},
+		{"drop.example.org.", actionDrop, "drop.example.org.rpz.example."},
+		{"tcp.example.org.", actionTCPOnly, "tcp.example.org.rpz.example."},
+		{"local.example.org.", actionLocalData, "local.example.org.rpz.example."},
+	}
+	for _, tc := range tests {
+		ru := rs.qnames.match(tc.qname)
+		if ru == nil {
+			t.Errorf("Expected rule for %s", tc.qname)
+			continue
+		}
+		if ru.action != tc.action {
+			t.Errorf("Expected action %s for %s, got %s", tc.action, tc.qname, ru.action)
+		}
+		if ru.owner != tc.owner {
+			t.Errorf("Expected owner %s for %s, got %s", tc.owner, tc.qname, ru.owner)
+		}
+	}
+
+	if ru := rs.qnames.match("local.example.org."); len(ru.data) != 2 {
+		t.Errorf("Expected 2 records of local data, got %d", len(ru.data))
+	}
+	if ru := rs.nsdnames.match("ns.bad.example.net."); ru == nil || ru.action != actionNXDomain {
+		t.Errorf("Expected NXDOMAIN rule for ns.bad.example.net.")
+	}
+	if ru := rs.nsdnames.match("ns1.evil.example.net."); ru == nil || ru.action != actionNoData {
+		t.Errorf("Expected NODATA rule for ns1.evil.example.net.")
+	}
+	if ru := rs.nsdnames.match("evil.example.net."); ru != nil {
+		t.Errorf("Expected no rule for evil.example.net.")
+	}
+}
+
+func TestNamesMatch(t *testing.T) {
+	n := newNames()
+	all := &rule{owner: "*.rpz.example."}
+	org := &rule{owner: "*.org.rpz.example."}
+	n.insert(parsedRule{rule: all, name: "*."})
+	n.insert(parsedRule{rule: org, name: "*.org."})
+
+	tests := []struct {
+		name string
+		want *rule
+	}{
+		{"example.org.", org},
+		{"a.example.org.", org},
+		{"org.", all},
+		{"example.com.", all},
+		{".", all},
+	}
+	for _, tc := range tests {
+		if got := n.match(tc.name); got != tc.want {
+			t.Errorf("Expected rule %v for %s, got %v", tc.want, tc.name, got)
+		}
+	}
+}
+
+func TestParseIPTrigger(t *testing.T) {
+	tests := []struct {
+		labels  string
+		net     string
+		wantErr bool
+	}{
+		{"32.1.2.0.192", "192.0.2.1/32", false},
+		{"24.0.2.0.192", "192.0.2.0/24", false},
+		{"128.1.zz.db8.2001", "2001:db8::1/128", false},
+		{"48.zz.2001", "2001::/48", false},
+		{"128.zz.1", "1::/128", false},
+		{"128.1.zz", "::1/128", false},
+		{"64.0.0.0.0.0.0.db8.2001", "2001:db8::/64", false},
+		{"33.1.2.0.192", "", true},
+		{"x.1.2.0.192", "", true},
+		{"32", "", true},
+	}
+	for _, tc := range tests {
+		n, err := parseIPTrigger(strings.Split(tc.labels, "."))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Expected error %t for %s, got %v", tc.wantErr, tc.labels, err)
+			continue
+		}
+		if err == nil && n.String() != tc.net {
+			t.Errorf("Expected %s for %s, got %s", tc.net, tc.labels, n)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package rpz
+
+import (
+	"context"
+	"strings"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// ResponseWriter checks the response for response IP and NSDNAME triggers, and rewrites it when one of
+// them is triggered.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	ctx   context.Context
+	rpz   RPZ
+	state request.Request
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
+	for _, p := range w.rpz.policies {
+		rs := p.get()
+		if rs == nil {
+			continue
+		}
+		ru := matchResponse(rs, res)
+		if ru == nil {
+			continue
+		}
+		hit(w.ctx, w.state, p, ru)
+		if ru.action == actionPassthru || ru.action == actionTCPOnly && w.state.Proto() == "tcp" {
+			break
+		}
+		if m := reply(w.state, rs, ru); m != nil {
+			return w.ResponseWriter.WriteMsg(m)
+		}
+		return nil
+	}
+	return w.ResponseWriter.WriteMsg(res)
+}
+
+// matchResponse returns the rule triggered by an address in the answer section of res, or else by the
+// name of a name server in res.
+func matchResponse(rs *rules, res *dns.Msg) *rule {
+	for _, rr := range res.Answer {
+		switch x := rr.(type) {
+		case *dns.A:
+			if ru := matchIP(rs.responseIP, x.A); ru != nil {
+				return ru
+			}
+		case *dns.AAAA:
+			if ru := matchIP(rs.responseIP, x.AAAA); ru != nil {
+				return ru
+			}
+		}
+	}
+	for _, section := range [][]dns.RR{res.Answer, res.Ns} {
+		for _, rr := range section {
+			if ns, ok := rr.(*dns.NS); ok {
+				if ru := rs.nsdnames.match(strings.ToLower(ns.Ns)); ru != nil {
+					return ru
+				}
+			}
+		}
+	}
+	return nil
+}
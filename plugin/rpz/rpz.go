@@ -0,0 +1,123 @@
+// Package rpz implements a plugin that applies DNS response policy zones.
+package rpz
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("rpz")
+
+// RPZ rewrites queries and responses that trigger a rule of one of its response policy zones.
+type RPZ struct {
+	Next  plugin.Handler
+	Zones []string
+
+	policies []*policyZone
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (rpz RPZ) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if plugin.Zones(rpz.Zones).Matches(state.Name()) == "" {
+		return plugin.NextOrFailure(rpz.Name(), rpz.Next, ctx, w, r)
+	}
+
+	// Client IP and QNAME triggers are checked before the query is answered, response IP and NSDNAME
+	// triggers when the response is written.
+	ip := net.ParseIP(state.IP())
+	qname := strings.ToLower(state.Name())
+	for _, p := range rpz.policies {
+		rs := p.get()
+		if rs == nil {
+			continue
+		}
+		if ru := matchIP(rs.clientIP, ip); ru != nil {
+			return rpz.apply(ctx, state, p, rs, ru)
+		}
+		if ru := rs.qnames.match(qname); ru != nil {
+			return rpz.apply(ctx, state, p, rs, ru)
+		}
+	}
+
+	rw := &ResponseWriter{ResponseWriter: w, ctx: ctx, rpz: rpz, state: state}
+	return plugin.NextOrFailure(rpz.Name(), rpz.Next, ctx, rw, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (rpz RPZ) Name() string { return "rpz" }
+
+// apply applies the rule ru of policy zone p to the query. Passthru hands the query to the next plugin.
+func (rpz RPZ) apply(ctx context.Context, state request.Request, p *policyZone, rs *rules, ru *rule) (int, error) {
+	hit(ctx, state, p, ru)
+	if ru.action == actionPassthru || ru.action == actionTCPOnly && state.Proto() == "tcp" {
+		return plugin.NextOrFailure(rpz.Name(), rpz.Next, ctx, state.W, state.Req)
+	}
+	if m := reply(state, rs, ru); m != nil {
+		state.W.WriteMsg(m)
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// hit logs and counts a hit of rule ru.
+func hit(ctx context.Context, state request.Request, p *policyZone, ru *rule) {
+	log.Infof("Client %s: %s %s rewrite %s/%s via %s", state.IP(), ru.trigger, ru.action, state.Name(), state.Type(), ru.owner)
+	hitCount.WithLabelValues(metrics.WithServer(ctx), p.name, ru.trigger.String(), ru.action.String()).Inc()
+}
+
+// reply returns the reply for the query after rule ru has been triggered, or nil when no reply is sent.
+func reply(state request.Request, rs *rules, ru *rule) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.RecursionAvailable = true
+
+	switch ru.action {
+	case actionDrop:
+		return nil
+	case actionTCPOnly:
+		m.Truncated = true
+		return m
+	case actionNXDomain:
+		m.Rcode = dns.RcodeNameError
+	case actionLocalData:
+		m.Answer = localData(ru.data, state.Name(), state.QType())
+	}
+	if len(m.Answer) == 0 {
+		m.Ns = []dns.RR{soa(rs.soa)}
+	}
+	return m
+}
+
+// localData returns the records of data that answer qtype, with qname as owner name. A CNAME answers all
+// types.
+func localData(data []dns.RR, qname string, qtype uint16) []dns.RR {
+	var answer []dns.RR
+	for _, rr := range data {
+		t := rr.Header().Rrtype
+		if t != qtype && t != dns.TypeCNAME && qtype != dns.TypeANY {
+			continue
+		}
+		rr = dns.Copy(rr)
+		rr.Header().Name = qname
+		answer = append(answer, rr)
+	}
+	return answer
+}
+
+// soa returns a copy of the SOA of the policy zone, with its TTL set to its minimum TTL, for negative
+// answers.
+func soa(s *dns.SOA) dns.RR {
+	s1 := dns.Copy(s).(*dns.SOA)
+	if s1.Minttl < s1.Hdr.Ttl {
+		s1.Hdr.Ttl = s1.Minttl
+	}
+	return s1
+}
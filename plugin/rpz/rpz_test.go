@@ -0,0 +1,154 @@
+package rpz
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// backend answers like an upstream would, for the response triggers.
+func backend() plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		switch r.Question[0].Name {
+		case "rip.example.com.":
+			m.Answer = []dns.RR{test.A("rip.example.com. 300 IN A 192.0.2.66")}
+		case "rip6.example.com.":
+			m.Answer = []dns.RR{test.AAAA("rip6.example.com. 300 IN AAAA 2001:db8::1")}
+		case "ns.example.com.":
+			m.Ns = []dns.RR{test.NS("example.com. 300 IN NS ns.bad.example.net.")}
+		case "evil.example.com.":
+			m.Ns = []dns.RR{test.NS("example.com. 300 IN NS ns1.EVIL.example.net.")}
+		default:
+			m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 192.0.2.10")}
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func TestRPZ(t *testing.T) {
+	rpz := RPZ{Next: backend(), Zones: []string{"."}, policies: []*policyZone{testPolicyZone(t)}}
+
+	tests := []struct {
+		qname    string
+		qtype    uint16
+		remote   string
+		tcp      bool
+		noReply  bool
+		rcode    int
+		answer   []dns.RR
+		soa      bool
+		truncate bool
+	}{
+		{qname: "www.example.com.", qtype: dns.TypeA, answer: []dns.RR{test.A("www.example.com. 300 IN A 192.0.2.10")}},
+		{qname: "bad.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{qname: "www.BAD.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{qname: "ok.bad.example.org.", qtype: dns.TypeA, answer: []dns.RR{test.A("ok.bad.example.org. 300 IN A 192.0.2.10")}},
+		{qname: "nodata.example.org.", qtype: dns.TypeA, soa: true},
+		{qname: "drop.example.org.", qtype: dns.TypeA, noReply: true},
+		{qname: "tcp.example.org.", qtype: dns.TypeA, truncate: true},
+		{qname: "tcp.example.org.", qtype: dns.TypeA, tcp: true, answer: []dns.RR{test.A("tcp.example.org. 300 IN A 192.0.2.10")}},
+		{qname: "local.example.org.", qtype: dns.TypeA, answer: []dns.RR{test.A("local.example.org. 60 IN A 192.0.2.53")}},
+		{qname: "local.example.org.", qtype: dns.TypeTXT, answer: []dns.RR{test.TXT(`local.example.org. 60 IN TXT "blocked"`)}},
+		{qname: "local.example.org.", qtype: dns.TypeMX, soa: true},
+		{qname: "garden.example.org.", qtype: dns.TypeA, answer: []dns.RR{test.CNAME("garden.example.org. 60 IN CNAME walled.example.net.")}},
+		// Client IP triggers take precedence over QNAME triggers.
+		{qname: "local.example.org.", qtype: dns.TypeA, remote: "192.0.2.1", rcode: dns.RcodeNameError, soa: true},
+		{qname: "www.example.com.", qtype: dns.TypeA, remote: "192.0.2.2", noReply: true},
+		{qname: "www.example.com.", qtype: dns.TypeA, remote: "2001::1", rcode: dns.RcodeNameError, soa: true},
+		// Response triggers.
+		{qname: "rip.example.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{qname: "rip6.example.com.", qtype: dns.TypeAAAA, soa: true},
+		{qname: "ns.example.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{qname: "evil.example.com.", qtype: dns.TypeA, soa: true},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		remote := tc.remote
+		if remote == "" {
+			remote = "10.240.0.1"
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: remote, TCP: tc.tcp})
+		if _, err := rpz.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if tc.noReply {
+			if rec.Msg != nil {
+				t.Errorf("Test %d: expected no reply, got %s", i, rec.Msg)
+			}
+			continue
+		}
+		if rec.Msg == nil {
+			t.Fatalf("Test %d: expected reply", i)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, rec.Msg.Rcode)
+		}
+		if rec.Msg.Truncated != tc.truncate {
+			t.Errorf("Test %d: expected truncated %t, got %t", i, tc.truncate, rec.Msg.Truncated)
+		}
+		if err := test.Section(test.Case{Answer: tc.answer}, test.Answer, rec.Msg.Answer); err != nil {
+			t.Errorf("Test %d: %s", i, err)
+		}
+		if soa := len(rec.Msg.Ns) == 1 && rec.Msg.Ns[0].Header().Rrtype == dns.TypeSOA; soa != tc.soa {
+			t.Errorf("Test %d: expected SOA %t, got %v", i, tc.soa, rec.Msg.Ns)
+		}
+	}
+}
+
+func TestRPZOrder(t *testing.T) {
+	// The first policy zone with a triggered rule decides.
+	z, err := file.Parse(strings.NewReader(dbSecond), "second.example.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse policy zone: %s", err)
+	}
+	second := newPolicyZone("second.example.", z)
+	rpz := RPZ{Next: backend(), Zones: []string{"example.org."}, policies: []*policyZone{testPolicyZone(t), second}}
+
+	tests := []struct {
+		qname string
+		rcode int
+	}{
+		{"ok.bad.example.org.", dns.RcodeSuccess},
+		{"www.example.org.", dns.RcodeNameError},
+	}
+	m := new(dns.Msg)
+	for _, tc := range tests {
+		m.SetQuestion(tc.qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := rpz.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Expected rcode %d for %s, got %d", tc.rcode, tc.qname, rec.Msg.Rcode)
+		}
+	}
+
+	// Queries outside of the zones are not rewritten.
+	m.SetQuestion("www.example.net.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: "192.0.2.1"})
+	if _, err := rpz.ServeDNS(context.Background(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected NOERROR, got %d", rec.Msg.Rcode)
+	}
+}
+
+const dbSecond = `$ORIGIN second.example.
+$TTL 60
+@                   SOA   ns.second.example. hostmaster.second.example. 1 3600 600 86400 30
+ok.bad.example.org  CNAME .
+www.example.org     CNAME .
+`
@@ -0,0 +1,142 @@
+package rpz
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/miekg/dns"
+)
+
+func init() { plugin.Register("rpz", setup) }
+
+func setup(c *caddy.Controller) error {
+	rpz, err := parseRPZ(c)
+	if err != nil {
+		return plugin.Error("rpz", err)
+	}
+
+	for _, p := range rpz.policies {
+		z, name := p.z, p.name
+		if len(z.TransferFrom) == 0 {
+			c.OnStartup(func() error {
+				z.StartupOnce.Do(func() { z.Reload(nil) })
+				return nil
+			})
+			c.OnShutdown(z.OnShutdown)
+			continue
+		}
+		c.OnStartup(func() error {
+			z.StartupOnce.Do(func() {
+				go func() {
+					dur := time.Millisecond * 250
+					step := time.Duration(2)
+					max := time.Second * 10
+					for {
+						err := z.TransferIn()
+						if err == nil {
+							break
+						}
+						log.Warningf("All '%s' masters failed to transfer, retrying in %s: %s", name, dur.String(), err)
+						time.Sleep(dur)
+						dur = step * dur
+						if dur > max {
+							dur = max
+						}
+					}
+					z.Update()
+				}()
+			})
+			return nil
+		})
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rpz.Next = next
+		return rpz
+	})
+
+	return nil
+}
+
+func parseRPZ(c *caddy.Controller) (RPZ, error) {
+	rpz := RPZ{}
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return rpz, plugin.ErrOnce
+		}
+		i++
+
+		rpz.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		reload := defaultReload
+		var zones []*file.Zone
+		for c.NextBlock() {
+			switch v := c.Val(); v {
+			case "file":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return rpz, c.ArgErr()
+				}
+				name, path := dns.Fqdn(args[0]), args[1]
+				if !filepath.IsAbs(path) && config.Root != "" {
+					path = filepath.Join(config.Root, path)
+				}
+				reader, err := os.Open(filepath.Clean(path))
+				if err != nil {
+					return rpz, c.Errf("failed to open policy zone %s: %s", name, err)
+				}
+				z, err := file.Parse(reader, name, path, 0)
+				reader.Close()
+				if err != nil {
+					return rpz, c.Errf("failed to parse policy zone %s: %s", name, err)
+				}
+				zones = append(zones, z)
+				rpz.policies = append(rpz.policies, newPolicyZone(name, z))
+			case "transfer":
+				if !c.NextArg() {
+					return rpz, c.ArgErr()
+				}
+				name := dns.Fqdn(c.Val())
+				from, err := parse.TransferIn(c)
+				if err != nil {
+					return rpz, err
+				}
+				z := file.NewZone(name, "stdin")
+				z.TransferFrom = from
+				rpz.policies = append(rpz.policies, newPolicyZone(name, z))
+			case "reload":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return rpz, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < 0 {
+					return rpz, c.Errf("invalid reload duration: %s", args[0])
+				}
+				reload = d
+			default:
+				return rpz, c.Errf("unknown property '%s'", v)
+			}
+		}
+		if len(rpz.policies) == 0 {
+			return rpz, c.Err("no policy zones")
+		}
+		for _, z := range zones {
+			z.ReloadInterval = reload
+		}
+	}
+	return rpz, nil
+}
+
+// defaultReload is the default interval at which policy zone files are checked for changes.
+const defaultReload = time.Minute
@@ -0,0 +1,74 @@
+package rpz
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.rpz")
+	if err := os.WriteFile(path, []byte(dbRPZ), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input     string
+		policies  int
+		reload    time.Duration
+		transfer  bool
+		shouldErr bool
+	}{
+		{fmt.Sprintf("file rpz.example %s", path), 1, defaultReload, false, false},
+		{fmt.Sprintf("file rpz.example %s\nreload 10s", path), 1, 10 * time.Second, false, false},
+		{fmt.Sprintf("file rpz.example %s\nreload 0", path), 1, 0, false, false},
+		{"transfer rpz.example from 10.0.0.1", 1, 0, true, false},
+		{fmt.Sprintf("transfer feed.example from 10.0.0.1:5353\nfile rpz.example %s", path), 2, defaultReload, true, false},
+		// fails
+		{"", 0, 0, false, true},
+		{"file rpz.example", 0, 0, false, true},
+		{"file rpz.example /does/not/exist", 0, 0, false, true},
+		{"transfer rpz.example", 0, 0, false, true},
+		{"transfer rpz.example to 10.0.0.1", 0, 0, false, true},
+		{fmt.Sprintf("file rpz.example %s\nreload -1s", path), 0, 0, false, true},
+		{"blocklist rpz.example", 0, 0, false, true},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("rpz {\n%s\n}", tc.input))
+		rpz, err := parseRPZ(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if len(rpz.policies) != tc.policies {
+			t.Errorf("Test %d: expected %d policy zones, got %d", i, tc.policies, len(rpz.policies))
+		}
+		z := rpz.policies[len(rpz.policies)-1].z
+		if !tc.transfer || tc.policies > 1 {
+			if z.ReloadInterval != tc.reload {
+				t.Errorf("Test %d: expected reload %s, got %s", i, tc.reload, z.ReloadInterval)
+			}
+		}
+		if got := len(rpz.policies[0].z.TransferFrom) > 0; got != tc.transfer {
+			t.Errorf("Test %d: expected transfer %t, got %t", i, tc.transfer, got)
+		}
+	}
+}
+
+func TestSetupOnce(t *testing.T) {
+	c := caddy.NewTestController("dns", "rpz {\ntransfer rpz.example from 10.0.0.1\n}\nrpz {\ntransfer rpz.example from 10.0.0.1\n}")
+	if _, err := parseRPZ(c); err == nil {
+		t.Errorf("Expected error for second rpz block")
+	}
+}
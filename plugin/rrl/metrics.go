@@ -0,0 +1,25 @@
+package rrl
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// droppedCount is the number of responses dropped because of the rate limit.
+	droppedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "rrl",
+		Name:      "dropped_responses_total",
+		Help:      "Counter of responses dropped, because they exceeded the rate limit.",
+	}, []string{"server", "class"})
+	// slippedCount is the number of responses that were sent truncated because of the rate limit.
+	slippedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "rrl",
+		Name:      "slipped_responses_total",
+		Help:      "Counter of responses sent truncated, because they exceeded the rate limit.",
+	}, []string{"server", "class"})
+)
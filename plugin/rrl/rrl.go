@@ -0,0 +1,190 @@
+// Package rrl implements response rate limiting, see
+// https://kb.isc.org/docs/aa-01000 for the BIND implementation it follows.
+package rrl
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// RRL limits the rate of UDP responses sent to a client network. A spoofed source address makes a
+// DNS server reflect, and amplify, responses to a victim; the rate limit caps this traffic. Every
+// slip'th limited response is sent truncated instead of being dropped, so a real client can retry
+// over TCP, which is not limited.
+type RRL struct {
+	Next  plugin.Handler
+	Zones []string
+
+	rates    [numClasses]float64 // responses per second for each class, 0 is unlimited
+	window   time.Duration       // time over which the rate is accounted
+	ipv4Mask net.IPMask
+	ipv6Mask net.IPMask
+	slip     int          // every slip'th limited response is truncated, 0 drops all of them
+	exempt   []*net.IPNet // clients that are not limited
+	report   bool         // only count the responses that would be limited
+
+	table *table
+	now   func() time.Time
+}
+
+// class is the kind of a response, each class has its own rate.
+type class int
+
+const (
+	classResponse class = iota // a positive answer
+	classNoData
+	classNXDomain
+	classReferral
+	classError
+	numClasses
+)
+
+var classNames = [numClasses]string{"responses", "nodata", "nxdomains", "referrals", "errors"}
+
+func (c class) String() string { return classNames[c] }
+
+// New returns a new RRL with the defaults of BIND.
+func New() *RRL {
+	return &RRL{
+		window:   defaultWindow,
+		ipv4Mask: net.CIDRMask(24, 32),
+		ipv6Mask: net.CIDRMask(56, 128),
+		slip:     2,
+		table:    newTable(defaultMaxTableSize),
+		now:      time.Now,
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *RRL) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	zone := plugin.Zones(rl.Zones).Matches(state.Name())
+	if zone == "" || state.Proto() != "udp" || rl.exempted(net.ParseIP(state.IP())) {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	rw := &ResponseWriter{ResponseWriter: w, rrl: rl, server: metrics.WithServer(ctx), state: state}
+	return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, rw, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (rl *RRL) Name() string { return "rrl" }
+
+func (rl *RRL) exempted(ip net.IP) bool {
+	for _, n := range rl.exempt {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseWriter applies the rate limit to the response it writes.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	rrl    *RRL
+	server string
+	state  request.Request
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
+	cls, name := classify(res)
+	rate := w.rrl.rates[cls]
+	if rate == 0 {
+		return w.ResponseWriter.WriteMsg(res)
+	}
+
+	key := w.rrl.key(net.ParseIP(w.state.IP()), cls, name, w.state.QType())
+	allowed, n := w.rrl.table.debit(key, rate, w.rrl.window, w.rrl.now())
+	if allowed {
+		return w.ResponseWriter.WriteMsg(res)
+	}
+
+	if w.rrl.slip > 0 && n%w.rrl.slip == 0 {
+		slippedCount.WithLabelValues(w.server, cls.String()).Inc()
+		if w.rrl.report {
+			return w.ResponseWriter.WriteMsg(res)
+		}
+		m := new(dns.Msg)
+		m.SetReply(w.state.Req)
+		m.Rcode = res.Rcode
+		m.Truncated = true
+		return w.ResponseWriter.WriteMsg(m)
+	}
+	droppedCount.WithLabelValues(w.server, cls.String()).Inc()
+	if w.rrl.report {
+		return w.ResponseWriter.WriteMsg(res)
+	}
+	return nil
+}
+
+// key returns the account of a response of class cls about name to the client ip. Responses are
+// accounted per client network; positive answers per name and type, the other classes per name only,
+// and errors for all names together.
+func (rl *RRL) key(ip net.IP, cls class, name string, qtype uint16) string {
+	var prefix net.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		prefix = ip4.Mask(rl.ipv4Mask)
+	} else {
+		prefix = ip.Mask(rl.ipv6Mask)
+	}
+	b := strings.Builder{}
+	b.WriteString(prefix.String())
+	b.WriteByte('/')
+	b.WriteString(strconv.Itoa(int(cls)))
+	if cls == classError {
+		return b.String()
+	}
+	b.WriteByte('/')
+	b.WriteString(strings.ToLower(name))
+	if cls == classResponse {
+		b.WriteByte('/')
+		b.WriteString(strconv.Itoa(int(qtype)))
+	}
+	return b.String()
+}
+
+// classify returns the class of the response m, and the name it is accounted under: the question for
+// answers and no data responses, the zone for name errors and the delegation for referrals.
+func classify(m *dns.Msg) (class, string) {
+	qname := ""
+	if len(m.Question) > 0 {
+		qname = m.Question[0].Name
+	}
+	switch {
+	case m.Rcode == dns.RcodeNameError:
+		for _, r := range m.Ns {
+			if r.Header().Rrtype == dns.TypeSOA {
+				return classNXDomain, r.Header().Name
+			}
+		}
+		return classNXDomain, qname
+	case m.Rcode != dns.RcodeSuccess:
+		return classError, ""
+	case len(m.Answer) > 0:
+		return classResponse, qname
+	}
+	if !m.Authoritative {
+		for _, r := range m.Ns {
+			if r.Header().Rrtype == dns.TypeNS {
+				return classReferral, r.Header().Name
+			}
+		}
+	}
+	return classNoData, qname
+}
+
+const (
+	defaultWindow       = 15 * time.Second
+	defaultMaxTableSize = 100000
+)
@@ -0,0 +1,167 @@
+package rrl
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// backend answers A queries, returns NXDOMAIN for nx.example.org. and REFUSED for other types.
+var backend = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	q := r.Question[0]
+	switch {
+	case q.Name == "nx.example.org.":
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{test.SOA("example.org. 300 IN SOA ns.example.org. hostmaster.example.org. 1 3600 600 86400 300")}
+	case q.Qtype == dns.TypeA:
+		m.Answer = []dns.RR{test.A(q.Name + " 300 IN A 127.0.0.1")}
+	default:
+		m.Rcode = dns.RcodeRefused
+	}
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+})
+
+func newTestRRL(now *time.Time) *RRL {
+	rl := New()
+	rl.Zones = []string{"."}
+	rl.rates = [numClasses]float64{1, 1, 1, 1, 1}
+	rl.Next = backend
+	rl.now = func() time.Time { return *now }
+	return rl
+}
+
+// serve sends a query for qname and qtype to rl and returns the reply, nil if it was dropped.
+func serve(rl *RRL, w dns.ResponseWriter, qname string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	rec := dnstest.NewRecorder(w)
+	rl.ServeDNS(context.TODO(), rec, m)
+	return rec.Msg
+}
+
+func TestRRL(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(&now)
+
+	tests := []struct {
+		qname     string
+		qtype     uint16
+		dropped   bool
+		truncated bool
+	}{
+		{"a.example.org.", dns.TypeA, false, false},
+		{"a.example.org.", dns.TypeA, true, false},  // first limited response is dropped
+		{"a.example.org.", dns.TypeA, false, true},  // second slips
+		{"b.example.org.", dns.TypeA, false, false}, // other name, other account
+		{"nx.example.org.", dns.TypeA, false, false},
+		{"other.nx.example.org.", dns.TypeA, false, false}, // not an NXDOMAIN, so answered
+		{"a.example.org.", dns.TypeMX, false, false},       // errors
+		{"b.example.org.", dns.TypeMX, true, false},        // errors share an account
+	}
+	for i, tc := range tests {
+		m := serve(rl, &test.ResponseWriter{}, tc.qname, tc.qtype)
+		if tc.dropped {
+			if m != nil {
+				t.Errorf("Test %d: expected response to be dropped", i)
+			}
+			continue
+		}
+		if m == nil {
+			t.Errorf("Test %d: expected a response", i)
+			continue
+		}
+		if m.Truncated != tc.truncated {
+			t.Errorf("Test %d: expected truncated %t, got %t", i, tc.truncated, m.Truncated)
+		}
+		if tc.truncated && len(m.Answer) > 0 {
+			t.Errorf("Test %d: expected an empty truncated response", i)
+		}
+	}
+
+	// The same client network over TCP is not limited.
+	if m := serve(rl, &test.ResponseWriter{TCP: true}, "a.example.org.", dns.TypeA); m == nil || m.Truncated {
+		t.Error("Expected a full response over TCP")
+	}
+	// Nor are exempted clients.
+	_, n, _ := net.ParseCIDR("10.240.0.0/16")
+	rl.exempt = []*net.IPNet{n}
+	if m := serve(rl, &test.ResponseWriter{}, "a.example.org.", dns.TypeA); m == nil || m.Truncated {
+		t.Error("Expected a full response for an exempted client")
+	}
+	rl.exempt = nil
+
+	// After the window the limit is lifted.
+	now = now.Add(defaultWindow + time.Second)
+	if m := serve(rl, &test.ResponseWriter{}, "a.example.org.", dns.TypeA); m == nil || m.Truncated {
+		t.Error("Expected a full response after the window")
+	}
+}
+
+func TestRRLSlip(t *testing.T) {
+	for _, slip := range []int{0, 1, 3} {
+		now := time.Now()
+		rl := newTestRRL(&now)
+		rl.slip = slip
+
+		dropped, truncated := 0, 0
+		for i := 0; i < 7; i++ {
+			m := serve(rl, &test.ResponseWriter{}, "a.example.org.", dns.TypeA)
+			switch {
+			case m == nil:
+				dropped++
+			case m.Truncated:
+				truncated++
+			}
+		}
+		// 1 response is allowed, the other 6 are limited.
+		want := 0
+		if slip > 0 {
+			want = 6 / slip
+		}
+		if truncated != want || dropped != 6-want {
+			t.Errorf("Slip %d: expected %d truncated and %d dropped, got %d and %d", slip, want, 6-want, truncated, dropped)
+		}
+	}
+}
+
+func TestRRLReportOnly(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(&now)
+	rl.report = true
+	for i := 0; i < 5; i++ {
+		if m := serve(rl, &test.ResponseWriter{}, "a.example.org.", dns.TypeA); m == nil || m.Truncated {
+			t.Fatalf("Expected a full response in report only mode")
+		}
+	}
+}
+
+func TestRRLPrefix(t *testing.T) {
+	rl := New()
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.0.2.1", "192.0.2.0/0/example.org./1"},
+		{"192.0.2.200", "192.0.2.0/0/example.org./1"},
+		{"2001:db8:1:2:3::1", "2001:db8:1::/0/example.org./1"},
+	}
+	for _, tc := range tests {
+		if got := rl.key(net.ParseIP(tc.ip), classResponse, "Example.org.", dns.TypeA); got != tc.want {
+			t.Errorf("Expected key %s for %s, got %s", tc.want, tc.ip, got)
+		}
+	}
+	if got := rl.key(net.ParseIP("192.0.2.1"), classError, "example.org.", dns.TypeA); got != "192.0.2.0/4" {
+		t.Errorf("Expected errors to be accounted without a name, got %s", got)
+	}
+}
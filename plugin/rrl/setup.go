@@ -0,0 +1,166 @@
+package rrl
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("rrl", setup) }
+
+func setup(c *caddy.Controller) error {
+	rl, err := parse(c)
+	if err != nil {
+		return plugin.Error("rrl", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*RRL, error) {
+	rl := New()
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		var (
+			rates    [numClasses]float64
+			rateSet  [numClasses]bool
+			maxTable = defaultMaxTableSize
+		)
+		for c.NextBlock() {
+			switch v := c.Val(); v {
+			case "responses_per_second", "nodata_per_second", "nxdomains_per_second", "referrals_per_second", "errors_per_second":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				r, err := strconv.ParseFloat(args[0], 64)
+				if err != nil || r < 0 {
+					return nil, c.Errf("invalid rate for %s: %s", v, args[0])
+				}
+				cls := classOf(strings.TrimSuffix(v, "_per_second"))
+				rates[cls], rateSet[cls] = r, true
+			case "window":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				w, err := strconv.Atoi(args[0])
+				if err != nil || w < 1 || w > 3600 {
+					return nil, c.Errf("invalid window: %s", args[0])
+				}
+				rl.window = time.Duration(w) * time.Second
+			case "ipv4_prefix_length", "ipv6_prefix_length":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				bits := 32
+				if v == "ipv6_prefix_length" {
+					bits = 128
+				}
+				l, err := strconv.Atoi(args[0])
+				if err != nil || l < 0 || l > bits {
+					return nil, c.Errf("invalid %s: %s", v, args[0])
+				}
+				if bits == 32 {
+					rl.ipv4Mask = net.CIDRMask(l, bits)
+				} else {
+					rl.ipv6Mask = net.CIDRMask(l, bits)
+				}
+			case "slip":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				s, err := strconv.Atoi(args[0])
+				if err != nil || s < 0 || s > 10 {
+					return nil, c.Errf("invalid slip: %s", args[0])
+				}
+				rl.slip = s
+			case "exempt":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					if !strings.Contains(a, "/") {
+						if strings.Contains(a, ":") {
+							a += "/128"
+						} else {
+							a += "/32"
+						}
+					}
+					_, n, err := net.ParseCIDR(a)
+					if err != nil {
+						return nil, c.Errf("invalid network: %s", a)
+					}
+					rl.exempt = append(rl.exempt, n)
+				}
+			case "max_table_size":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				m, err := strconv.Atoi(args[0])
+				if err != nil || m < 1 {
+					return nil, c.Errf("invalid max_table_size: %s", args[0])
+				}
+				maxTable = m
+			case "report_only":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				rl.report = true
+			default:
+				return nil, c.Errf("unknown property '%s'", v)
+			}
+		}
+
+		// The other classes default to the rate of the responses.
+		for cls := classNoData; cls < numClasses; cls++ {
+			if !rateSet[cls] {
+				rates[cls] = rates[classResponse]
+			}
+		}
+		zero := true
+		for _, r := range rates {
+			if r > 0 {
+				zero = false
+			}
+		}
+		if zero {
+			return nil, c.Err("at least one rate must be set")
+		}
+		rl.rates = rates
+		rl.table = newTable(maxTable)
+	}
+	return rl, nil
+}
+
+// classOf returns the class named s.
+func classOf(s string) class {
+	for i, n := range classNames {
+		if n == s {
+			return class(i)
+		}
+	}
+	return classResponse
+}
@@ -0,0 +1,94 @@
+package rrl
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("dns", "rrl {\nresponses_per_second 10\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+
+	c = caddy.NewTestController("dns", "rrl {\nresponses_per_second 10\n}\nrrl {\nresponses_per_second 10\n}")
+	if err := setup(c); err == nil {
+		t.Fatal("Expected errors for a second rrl, but got none")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		rates     [numClasses]float64
+	}{
+		{`responses_per_second 10`, false, [numClasses]float64{10, 10, 10, 10, 10}},
+		{"responses_per_second 10\nnxdomains_per_second 5\nerrors_per_second 0", false, [numClasses]float64{10, 10, 5, 10, 0}},
+		{`nodata_per_second 2`, false, [numClasses]float64{0, 2, 0, 0, 0}},
+		{``, true, [numClasses]float64{}},
+		{`responses_per_second 0`, true, [numClasses]float64{}},
+		{`responses_per_second -1`, true, [numClasses]float64{}},
+		{`responses_per_second`, true, [numClasses]float64{}},
+		{"responses_per_second 10\nwindow 0", true, [numClasses]float64{}},
+		{"responses_per_second 10\nslip 11", true, [numClasses]float64{}},
+		{"responses_per_second 10\nipv4_prefix_length 33", true, [numClasses]float64{}},
+		{"responses_per_second 10\nexempt 10.0.0.0/33", true, [numClasses]float64{}},
+		{"responses_per_second 10\nmax_table_size 0", true, [numClasses]float64{}},
+		{"responses_per_second 10\nreport_only yes", true, [numClasses]float64{}},
+		{"responses_per_second 10\nunknown", true, [numClasses]float64{}},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("rrl {\n%s\n}", tc.input))
+		rl, err := parse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if rl.rates != tc.rates {
+			t.Errorf("Test %d: expected rates %v, got %v", i, tc.rates, rl.rates)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	c := caddy.NewTestController("dns", `rrl example.org {
+		responses_per_second 10
+		window 5
+		slip 0
+		ipv4_prefix_length 32
+		ipv6_prefix_length 64
+		exempt 10.0.0.0/8 ::1
+		max_table_size 10
+		report_only
+	}`)
+	rl, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rl.Zones) != 1 || rl.Zones[0] != "example.org." {
+		t.Errorf("Expected zone example.org., got %v", rl.Zones)
+	}
+	if rl.window != 5*time.Second || rl.slip != 0 || !rl.report || rl.table.max != 10 {
+		t.Errorf("Unexpected window %s, slip %d, report_only %t or max_table_size %d", rl.window, rl.slip, rl.report, rl.table.max)
+	}
+	if ones, _ := rl.ipv4Mask.Size(); ones != 32 {
+		t.Errorf("Expected IPv4 prefix length 32, got %d", ones)
+	}
+	if ones, _ := rl.ipv6Mask.Size(); ones != 64 {
+		t.Errorf("Expected IPv6 prefix length 64, got %d", ones)
+	}
+	if len(rl.exempt) != 2 || !rl.exempted(net.ParseIP("10.1.2.3")) || !rl.exempted(net.ParseIP("::1")) || rl.exempted(net.ParseIP("192.0.2.1")) {
+		t.Errorf("Unexpected exempted networks %v", rl.exempt)
+	}
+}
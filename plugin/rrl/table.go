@@ -0,0 +1,84 @@
+package rrl
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// table holds the accounts of the rate limited responses. When the table is full, the least recently
+// used account is evicted to make room for a new one, as BIND does.
+type table struct {
+	sync.Mutex
+	accounts map[string]*list.Element // values are *account
+	lru      *list.List               // most recently used account in front
+	max      int
+}
+
+// account is a token bucket. Its balance is credited with rate tokens per second, up to rate, and
+// debited with a token for each response. A response is limited when the balance is negative. The
+// balance can drop to -rate*window, so a client that exceeds the rate stays limited until its
+// responses have been below the rate for up to window.
+type account struct {
+	key     string
+	balance float64
+	last    time.Time
+	limited int // number of limited responses, for the slip
+}
+
+func newTable(max int) *table {
+	return &table{accounts: make(map[string]*list.Element), lru: list.New(), max: max}
+}
+
+// debit debits the account key for a response at now. It returns true when the response is allowed,
+// and otherwise the number of consecutive limited responses of this account.
+func (t *table) debit(key string, rate float64, window time.Duration, now time.Time) (bool, int) {
+	t.Lock()
+	defer t.Unlock()
+
+	var a *account
+	if e, ok := t.accounts[key]; ok {
+		t.lru.MoveToFront(e)
+		a = e.Value.(*account)
+	} else {
+		if len(t.accounts) >= t.max {
+			t.evict()
+		}
+		a = &account{key: key, balance: rate, last: now}
+		t.accounts[key] = t.lru.PushFront(a)
+	}
+
+	a.balance += now.Sub(a.last).Seconds() * rate
+	if a.balance > rate {
+		a.balance = rate
+	}
+	a.last = now
+
+	a.balance--
+	if min := -rate * window.Seconds(); a.balance < min {
+		a.balance = min
+	}
+	if a.balance >= 0 {
+		a.limited = 0
+		return true, 0
+	}
+	a.limited++
+	return false, a.limited
+}
+
+// evict removes the least recently used account. The caller must hold the lock of t.
+func (t *table) evict() {
+	e := t.lru.Back()
+	if e == nil {
+		return
+	}
+	t.lru.Remove(e)
+	delete(t.accounts, e.Value.(*account).key)
+}
+
+// len returns the number of accounts.
+func (t *table) len() int {
+	t.Lock()
+	defer t.Unlock()
+	return len(t.accounts)
+}
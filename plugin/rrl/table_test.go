@@ -0,0 +1,72 @@
+package rrl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTableDebit(t *testing.T) {
+	tb := newTable(10)
+	now := time.Now()
+
+	// A rate of 2 per second allows 2 responses, the balance then goes into debt.
+	for i, want := range []bool{true, true, false, false, false} {
+		if ok, _ := tb.debit("a", 2, 5*time.Second, now); ok != want {
+			t.Errorf("Response %d: expected allowed %t", i, want)
+		}
+	}
+	// The debt of 3 tokens is paid off after 1.5 seconds.
+	if ok, _ := tb.debit("a", 2, 5*time.Second, now.Add(time.Second)); ok {
+		t.Error("Expected response to be limited while in debt")
+	}
+	if ok, _ := tb.debit("a", 2, 5*time.Second, now.Add(3*time.Second)); !ok {
+		t.Error("Expected response to be allowed after the debt is paid")
+	}
+	// Other accounts are not affected.
+	if ok, _ := tb.debit("b", 2, 5*time.Second, now); !ok {
+		t.Error("Expected response for another account to be allowed")
+	}
+}
+
+func TestTableWindow(t *testing.T) {
+	tb := newTable(10)
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		tb.debit("a", 1, 2*time.Second, now)
+	}
+	// The debt is capped at rate*window, 2 tokens, which are paid off in 2 seconds.
+	if ok, n := tb.debit("a", 1, 2*time.Second, now.Add(2*time.Second)); ok || n != 1000 {
+		t.Errorf("Expected response to be limited, as limited response 1000, got %t, %d", ok, n)
+	}
+	if ok, _ := tb.debit("a", 1, 2*time.Second, now.Add(5*time.Second)); !ok {
+		t.Error("Expected response to be allowed after the window")
+	}
+}
+
+func TestTableFull(t *testing.T) {
+	tb := newTable(2)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		tb.debit("a", 1, time.Second, now)
+	}
+	tb.debit("b", 1, time.Second, now)
+	tb.debit("a", 1, time.Second, now) // a is now the most recently used account
+
+	// A new account evicts the least recently used one, b, and is limited like any other account.
+	for i, want := range []bool{true, false, false} {
+		if ok, _ := tb.debit("c", 1, time.Second, now); ok != want {
+			t.Errorf("Response %d: expected allowed %t for a new account in a full table", i, want)
+		}
+	}
+	if tb.len() != 2 {
+		t.Errorf("Expected 2 accounts, got %d", tb.len())
+	}
+	// a kept its debt.
+	if ok, n := tb.debit("a", 1, time.Second, now); ok || n != 4 {
+		t.Errorf("Expected the account of a to be kept, got %t, %d", ok, n)
+	}
+	// b starts over with a full balance.
+	if ok, _ := tb.debit("b", 1, time.Second, now); !ok {
+		t.Error("Expected the evicted account to start over")
+	}
+}
@@ -1,6 +1,9 @@
 package secondary
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -10,6 +13,8 @@ import (
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
+
+	"github.com/miekg/dns"
 )
 
 var log = clog.NewWithPlugin("secondary")
@@ -26,6 +31,15 @@ func setup(c *caddy.Controller) error {
 	for i := range zones.Names {
 		n := zones.Names[i]
 		z := zones.Z[n]
+		if z.CacheFile != "" {
+			if err := z.LoadCacheFile(); errors.Is(err, os.ErrNotExist) {
+				log.Infof("No cache file for '%s' yet: %s", n, z.CacheFile)
+			} else if err != nil {
+				log.Warningf("Failed to load '%s' from cache file: %s", n, err)
+			} else {
+				log.Infof("Loaded '%s' from cache file %s", n, z.CacheFile)
+			}
+		}
 		if len(z.TransferFrom) > 0 {
 			c.OnStartup(func() error {
 				z.StartupOnce.Do(func() {
@@ -38,6 +52,9 @@ func setup(c *caddy.Controller) error {
 							if err == nil {
 								break
 							}
+							if z.ExpireCache() {
+								log.Errorf("Zone '%s' loaded from cache file has expired", n)
+							}
 							log.Warningf("All '%s' masters failed to transfer, retrying in %s: %s", n, dur.String(), err)
 							time.Sleep(dur)
 							dur = step * dur
@@ -84,6 +101,31 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 					if err != nil {
 						return file.Zones{}, err
 					}
+				case "cache_file":
+					args := c.RemainingArgs()
+					if len(args) != 1 {
+						return file.Zones{}, c.ArgErr()
+					}
+					if len(origins) != 1 {
+						return file.Zones{}, c.Err("cache_file requires a single zone")
+					}
+					path := args[0]
+					if root := dnsserver.GetConfig(c).Root; !filepath.IsAbs(path) && root != "" {
+						path = filepath.Join(root, path)
+					}
+					z[origins[0]].CacheFile = path
+				case "tsig":
+					args := c.RemainingArgs()
+					if len(args) != 1 {
+						return file.Zones{}, c.ArgErr()
+					}
+					key, ok := dnsserver.GetConfig(c).TsigKeys[dns.CanonicalName(args[0])]
+					if !ok {
+						return file.Zones{}, c.Errf("unknown TSIG key: %s", args[0])
+					}
+					for _, origin := range origins {
+						z[origin].TsigKey = key
+					}
 				default:
 					return file.Zones{}, c.Errf("unknown property '%s'", c.Val())
 				}
@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/miekg/dns"
 )
 
 func TestSecondaryParse(t *testing.T) {
@@ -61,3 +64,62 @@ func TestSecondaryParse(t *testing.T) {
 		}
 	}
 }
+
+func TestSecondaryParseTsig(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{"secondary example.org {\ntransfer from 127.0.0.1\ntsig transfer.example.org\n}", false},
+		{"secondary example.org {\ntransfer from 127.0.0.1\ntsig other.example.org\n}", true},
+		{"secondary example.org {\ntransfer from 127.0.0.1\ntsig\n}", true},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		key := &dnsserver.TsigKey{Name: "transfer.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+		dnsserver.GetConfig(c).TsigKeys = map[string]*dnsserver.TsigKey{key.Name: key}
+
+		s, err := secondaryParse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d expected errors, but got no error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if z := s.Z["example.org."]; z.TsigKey != key {
+			t.Errorf("Test %d expected key %s, got %v", i, key.Name, z.TsigKey)
+		}
+	}
+}
+
+func TestSecondaryParseCacheFile(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		cacheFile string
+	}{
+		{"secondary example.org {\ntransfer from 127.0.0.1\ncache_file /var/lib/coredns/db.example.org\n}", false, "/var/lib/coredns/db.example.org"},
+		{"secondary example.org {\ntransfer from 127.0.0.1\ncache_file db.example.org\n}", false, "db.example.org"},
+		{"secondary example.org example.net {\ntransfer from 127.0.0.1\ncache_file db.example.org\n}", true, ""},
+		{"secondary example.org {\ntransfer from 127.0.0.1\ncache_file\n}", true, ""},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		s, err := secondaryParse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d expected errors, but got no error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if x := s.Z["example.org."].CacheFile; x != tc.cacheFile {
+			t.Errorf("Test %d expected cache file %q, got %q", i, tc.cacheFile, x)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package transfer
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/rcode"
 
@@ -23,6 +24,10 @@ func (t *Transfer) Notify(zone string) error {
 	if x == nil {
 		return fmt.Errorf("no such zone registred in the transfer plugin: %s", zone)
 	}
+	if x.key != nil {
+		m.SetTsig(x.key.Name, x.key.Algorithm, 300, time.Now().Unix())
+		c.TsigSecret = map[string]string{x.key.Name: x.key.Secret}
+	}
 
 	var err1 error
 	for _, t := range x.to {
@@ -42,7 +47,8 @@ func sendNotify(c *dns.Client, m *dns.Msg, s string) error {
 
 	code := dns.RcodeServerFailure
 	for i := 0; i < 3; i++ {
-		ret, _, err := c.Exchange(m, s)
+		// The signing of m removes its TSIG record, so each try sends a copy.
+		ret, _, err := c.Exchange(m.Copy(), s)
 		if err != nil {
 			continue
 		}
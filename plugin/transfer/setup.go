@@ -6,6 +6,8 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
 )
 
 func init() {
@@ -66,6 +68,16 @@ func parseTransfer(c *caddy.Controller) (*Transfer, error) {
 					}
 					x.to = append(x.to, normalized)
 				}
+			case "tsig":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				key, ok := dnsserver.GetConfig(c).TsigKeys[dns.CanonicalName(args[0])]
+				if !ok {
+					return nil, plugin.Error("transfer", c.Errf("unknown TSIG key: %s", args[0]))
+				}
+				x.key = key
 			default:
 				return nil, plugin.Error("transfer", c.Errf("unknown property %q", c.Val()))
 			}
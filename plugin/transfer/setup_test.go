@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/miekg/dns"
 )
 
 func TestParse(t *testing.T) {
@@ -131,3 +134,34 @@ func TestSetup(t *testing.T) {
 		t.Fatalf("Expected no errors, but got %v", err)
 	}
 }
+
+func TestParseTsig(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{"transfer example.org {\nto *\ntsig transfer.example.org\n}", false},
+		{"transfer example.org {\nto *\ntsig TRANSFER.example.org.\n}", false},
+		{"transfer example.org {\nto *\ntsig other.example.org\n}", true},
+		{"transfer example.org {\nto *\ntsig\n}", true},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		key := &dnsserver.TsigKey{Name: "transfer.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+		dnsserver.GetConfig(c).TsigKeys = map[string]*dnsserver.TsigKey{key.Name: key}
+
+		transfer, err := parseTransfer(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d expected errors, but got no error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if transfer.xfrs[0].key != key {
+			t.Errorf("Test %d expected key %s, got %v", i, key.Name, transfer.xfrs[0].key)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
 
+	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/request"
@@ -24,6 +26,7 @@ type Transfer struct {
 type xfr struct {
 	Zones []string
 	to    []string
+	key   *dnsserver.TsigKey // when set, transfers must be signed with it, as are the notifies
 }
 
 // Transferer may be implemented by plugins to enable zone transfers
@@ -67,7 +70,7 @@ func (t *Transfer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		return plugin.NextOrFailure(t.Name(), t.Next, ctx, w, r)
 	}
 
-	if !x.allowed(state) {
+	if !x.allowed(state) || !x.signed(w, r) {
 		// write msg here, so logging will pick it up
 		m := new(dns.Msg)
 		m.SetRcode(r, dns.RcodeRefused)
@@ -197,6 +200,19 @@ func (x xfr) allowed(state request.Request) bool {
 	return false
 }
 
+// signed returns true when r is signed with the key of x, or x has no key. The signature itself is
+// verified by the server.
+func (x xfr) signed(w dns.ResponseWriter, r *dns.Msg) bool {
+	if x.key == nil {
+		return true
+	}
+	rr := r.IsTsig()
+	if rr == nil || w.TsigStatus() != nil {
+		return false
+	}
+	return strings.EqualFold(rr.Hdr.Name, x.key.Name) && strings.EqualFold(rr.Algorithm, x.key.Algorithm)
+}
+
 // Find the first transfer instance for which the queried zone is the longest match. When nothing
 // is found nil is returned.
 func longestMatch(xfrs []*xfr, name string) *xfr {
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/test"
@@ -276,3 +278,35 @@ func TestTransferNotAllowed(t *testing.T) {
 		t.Errorf("Expected REFUSED response code, got %s", dns.RcodeToString[w.Msg.Rcode])
 	}
 }
+
+func TestTransferSigned(t *testing.T) {
+	transfer := newTestTransfer()
+	transfer.xfrs[0].key = &dnsserver.TsigKey{Name: "transfer.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+
+	ctx := context.TODO()
+	for _, key := range []string{"", "other.example.org."} {
+		w := dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+		m := &dns.Msg{}
+		m.SetAxfr(transfer.xfrs[0].Zones[0])
+		if key != "" {
+			m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+		}
+
+		if _, err := transfer.ServeDNS(ctx, w, m); err != nil {
+			t.Error(err)
+		}
+		if w.Msg.Rcode != dns.RcodeRefused {
+			t.Errorf("Expected REFUSED response code for key %q, got %s", key, dns.RcodeToString[w.Msg.Rcode])
+		}
+	}
+
+	w := dnstest.NewMultiRecorder(&test.ResponseWriter{TCP: true})
+	m := &dns.Msg{}
+	m.SetAxfr(transfer.xfrs[0].Zones[0])
+	m.SetTsig("transfer.example.org.", dns.HmacSHA256, 300, time.Now().Unix())
+
+	if _, err := transfer.ServeDNS(ctx, w, m); err != nil {
+		t.Error(err)
+	}
+	validateAXFRResponse(t, w)
+}
@@ -0,0 +1,111 @@
+package tsig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/coredns/coredns/core/dnsserver"
+)
+
+// parseKeys parses the key statements of a BIND formatted key file, such as written by tsig-keygen:
+//
+//	key "transfer.example.org." {
+//		algorithm hmac-sha256;
+//		secret "L9Fw7sAMvx6ygxjuSxGfdQ2IhfH4jbLxJ1xRM2Ma5Hg=";
+//	};
+//
+// Comments start with '#' or '//'.
+func parseKeys(r io.Reader) ([]*dnsserver.TsigKey, error) {
+	tokens, err := tokenize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	next := func() string {
+		if len(tokens) == 0 {
+			return ""
+		}
+		t := tokens[0]
+		tokens = tokens[1:]
+		return t
+	}
+	expect := func(want string) error {
+		if t := next(); t != want {
+			return fmt.Errorf("expected %q, got %q", want, t)
+		}
+		return nil
+	}
+
+	var keys []*dnsserver.TsigKey
+	for len(tokens) > 0 {
+		if err := expect("key"); err != nil {
+			return nil, err
+		}
+		name := next()
+		if err := expect("{"); err != nil {
+			return nil, err
+		}
+		var algorithm, secret string
+		for len(tokens) > 0 && tokens[0] != "}" {
+			switch option := next(); option {
+			case "algorithm":
+				algorithm = next()
+			case "secret":
+				secret = next()
+			default:
+				return nil, fmt.Errorf("unknown option in key %s: %q", name, option)
+			}
+			if err := expect(";"); err != nil {
+				return nil, err
+			}
+		}
+		if err := expect("}"); err != nil {
+			return nil, err
+		}
+		if err := expect(";"); err != nil {
+			return nil, err
+		}
+		key, err := newKey(name, algorithm, secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// tokenize splits a key file into words, quoted strings and the characters '{', '}' and ';'.
+func tokenize(r io.Reader) ([]string, error) {
+	var tokens []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		for line != "" {
+			switch {
+			case line[0] == '#' || strings.HasPrefix(line, "//"):
+				line = ""
+			case line[0] == '{' || line[0] == '}' || line[0] == ';':
+				tokens = append(tokens, line[:1])
+				line = line[1:]
+			case line[0] == '"':
+				i := strings.IndexByte(line[1:], '"')
+				if i < 0 {
+					return nil, fmt.Errorf("unterminated string: %s", line)
+				}
+				tokens = append(tokens, line[1:i+1])
+				line = line[i+2:]
+			default:
+				i := strings.IndexAny(line, " \t{};\"")
+				if i < 0 {
+					i = len(line)
+				}
+				tokens = append(tokens, line[:i])
+				line = line[i:]
+			}
+			line = strings.TrimLeft(line, " \t")
+		}
+	}
+	return tokens, scanner.Err()
+}
@@ -0,0 +1,49 @@
+package tsig
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseKeys(t *testing.T) {
+	const keyFile = `# written by tsig-keygen
+key "transfer.example.org." {
+	algorithm hmac-sha256;
+	secret "L9Fw7sAMvx6ygxjuSxGfdQ2IhfH4jbLxJ1xRM2Ma5Hg=";
+};
+// a second key
+key notify.example.org {algorithm "HMAC-SHA512"; secret "c2VjcmV0";};
+`
+	keys, err := parseKeys(strings.NewReader(keyFile))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(keys))
+	}
+	if keys[0].Name != "transfer.example.org." || keys[0].Algorithm != dns.HmacSHA256 || keys[0].Secret != "L9Fw7sAMvx6ygxjuSxGfdQ2IhfH4jbLxJ1xRM2Ma5Hg=" {
+		t.Errorf("Unexpected first key: %+v", keys[0])
+	}
+	if keys[1].Name != "notify.example.org." || keys[1].Algorithm != dns.HmacSHA512 || keys[1].Secret != "c2VjcmV0" {
+		t.Errorf("Unexpected second key: %+v", keys[1])
+	}
+}
+
+func TestParseKeysErrors(t *testing.T) {
+	tests := []string{
+		`key "a." { algorithm hmac-sha256; secret "c2VjcmV0"; }`, // missing ;
+		`key "a." { algorithm hmac-sha256 secret "c2VjcmV0"; };`, // missing ;
+		`key "a." { algorithm hmac-md5; secret "c2VjcmV0"; };`,   // unsupported algorithm
+		`key "a." { algorithm hmac-sha256; secret "c2VjcmV0; };`, // unterminated string
+		`key "a." { algorithm hmac-sha256; };`,                   // no secret
+		`key "a." { algorithm hmac-sha256; keys "c2VjcmV0"; };`,  // unknown option
+		`server 192.0.2.1 { keys "a."; };`,                       // not a key
+	}
+	for i, tc := range tests {
+		if _, err := parseKeys(strings.NewReader(tc)); err == nil {
+			t.Errorf("Test %d: expected error, got none", i)
+		}
+	}
+}
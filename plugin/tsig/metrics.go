@@ -0,0 +1,17 @@
+package tsig
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// verificationErrors is the number of queries refused because their signature failed to verify, or was
+// missing when required.
+var verificationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "tsig",
+	Name:      "verification_errors_total",
+	Help:      "Counter of DNS requests with a transaction signature that failed to verify, or that were unsigned when required.",
+}, []string{"server", "error"})
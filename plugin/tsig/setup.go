@@ -0,0 +1,124 @@
+package tsig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+)
+
+func init() { plugin.Register("tsig", setup) }
+
+func setup(c *caddy.Controller) error {
+	t, err := parse(c)
+	if err != nil {
+		return plugin.Error("tsig", err)
+	}
+
+	config := dnsserver.GetConfig(c)
+	config.TsigKeys = t.keys
+
+	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		t.Next = next
+		return t
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (TSIG, error) {
+	t := TSIG{keys: make(map[string]*dnsserver.TsigKey)}
+	config := dnsserver.GetConfig(c)
+
+	add := func(key *dnsserver.TsigKey) error {
+		if _, ok := t.keys[key.Name]; ok {
+			return c.Errf("key %s defined more than once", key.Name)
+		}
+		t.keys[key.Name] = key
+		return nil
+	}
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return t, plugin.ErrOnce
+		}
+		i++
+
+		t.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch v := c.Val(); v {
+			case "key":
+				args := c.RemainingArgs()
+				if len(args) != 3 {
+					return t, c.ArgErr()
+				}
+				key, err := newKey(args[0], args[1], args[2])
+				if err != nil {
+					return t, c.Err(err.Error())
+				}
+				if err := add(key); err != nil {
+					return t, err
+				}
+			case "secrets":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return t, c.ArgErr()
+				}
+				path := args[0]
+				if !filepath.IsAbs(path) && config.Root != "" {
+					path = filepath.Join(config.Root, path)
+				}
+				f, err := os.Open(path)
+				if err != nil {
+					return t, c.Errf("failed to open secrets file: %s", err)
+				}
+				keys, err := parseKeys(f)
+				f.Close()
+				if err != nil {
+					return t, c.Errf("failed to parse secrets file %s: %s", path, err)
+				}
+				for _, key := range keys {
+					if err := add(key); err != nil {
+						return t, err
+					}
+				}
+			case "require":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return t, c.ArgErr()
+				}
+				t.all, t.types = false, nil
+				switch strings.ToLower(args[0]) {
+				case "all", "none":
+					if len(args) > 1 {
+						return t, c.ArgErr()
+					}
+					t.all = strings.ToLower(args[0]) == "all"
+					continue
+				}
+				t.types = make(map[uint16]struct{})
+				for _, a := range args {
+					qtype, ok := dns.StringToType[strings.ToUpper(a)]
+					if !ok {
+						return t, c.Errf("invalid query type: %s", a)
+					}
+					t.types[qtype] = struct{}{}
+				}
+			default:
+				return t, c.Errf("unknown property '%s'", v)
+			}
+		}
+	}
+
+	if len(t.keys) == 0 {
+		return t, c.Err("no keys defined")
+	}
+	return t, nil
+}
@@ -0,0 +1,103 @@
+package tsig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/miekg/dns"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("dns", "tsig {\nkey transfer.example.org. hmac-sha256 c2VjcmV0\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	plugins := dnsserver.GetConfig(c).Plugin
+	if len(plugins) != 1 {
+		t.Fatalf("Expected one plugin, got %d", len(plugins))
+	}
+	if _, ok := dnsserver.GetConfig(c).TsigKeys["transfer.example.org."]; !ok {
+		t.Errorf("Expected key to be added to the config")
+	}
+}
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	secrets := filepath.Join(dir, "secrets.conf")
+	if err := os.WriteFile(secrets, []byte(`key "file.example.org." { algorithm hmac-sha512; secret "c2VjcmV0"; };`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		keys      []string
+		all       bool
+		types     []uint16
+	}{
+		{`key transfer.example.org hmac-sha256 c2VjcmV0`, false, []string{"transfer.example.org."}, false, nil},
+		{`key transfer.example.org HMAC-SHA512. c2VjcmV0`, false, []string{"transfer.example.org."}, false, nil},
+		{"secrets " + secrets, false, []string{"file.example.org."}, false, nil},
+		{"key a.example.org hmac-sha256 c2VjcmV0\nkey b.example.org hmac-sha256 c2VjcmV0\nrequire all", false, []string{"a.example.org.", "b.example.org."}, true, nil},
+		{"key a.example.org hmac-sha256 c2VjcmV0\nrequire AXFR ixfr", false, []string{"a.example.org."}, false, []uint16{dns.TypeAXFR, dns.TypeIXFR}},
+		{"key a.example.org hmac-sha256 c2VjcmV0\nrequire none", false, []string{"a.example.org."}, false, nil},
+		// errors
+		{``, true, nil, false, nil},
+		{`require all`, true, nil, false, nil},
+		{`key a.example.org hmac-sha256`, true, nil, false, nil},
+		{`key a.example.org hmac-sha1 c2VjcmV0`, true, nil, false, nil},
+		{`key a.example.org hmac-sha256 not-base64!`, true, nil, false, nil},
+		{"key a.example.org hmac-sha256 c2VjcmV0\nkey a.example.org. hmac-sha512 c2VjcmV0", true, nil, false, nil},
+		{"key a.example.org hmac-sha256 c2VjcmV0\nrequire", true, nil, false, nil},
+		{"key a.example.org hmac-sha256 c2VjcmV0\nrequire all AXFR", true, nil, false, nil},
+		{"key a.example.org hmac-sha256 c2VjcmV0\nrequire BOGUS", true, nil, false, nil},
+		{"secrets " + filepath.Join(dir, "missing.conf"), true, nil, false, nil},
+		{"key a.example.org hmac-sha256 c2VjcmV0\nunknown", true, nil, false, nil},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("tsig {\n%s\n}", tc.input))
+		ts, err := parse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %v", i, err)
+			continue
+		}
+		if len(ts.keys) != len(tc.keys) {
+			t.Errorf("Test %d: expected %d keys, got %d", i, len(tc.keys), len(ts.keys))
+		}
+		for _, name := range tc.keys {
+			if _, ok := ts.keys[name]; !ok {
+				t.Errorf("Test %d: expected key %s", i, name)
+			}
+		}
+		if ts.all != tc.all {
+			t.Errorf("Test %d: expected all %t, got %t", i, tc.all, ts.all)
+		}
+		if len(ts.types) != len(tc.types) {
+			t.Errorf("Test %d: expected %d required types, got %d", i, len(tc.types), len(ts.types))
+		}
+		for _, qtype := range tc.types {
+			if !ts.required(qtype) {
+				t.Errorf("Test %d: expected %s to be required", i, dns.TypeToString[qtype])
+			}
+		}
+	}
+}
+
+func TestParseOnce(t *testing.T) {
+	c := caddy.NewTestController("dns", "tsig {\nkey a.example.org hmac-sha256 c2VjcmV0\n}\ntsig {\nkey b.example.org hmac-sha256 c2VjcmV0\n}")
+	if _, err := parse(c); err == nil {
+		t.Errorf("Expected error for second tsig block, got none")
+	}
+}
@@ -0,0 +1,138 @@
+// Package tsig implements transaction signatures (RFC 8945) for queries and replies.
+package tsig
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("tsig")
+
+// TSIG verifies the transaction signatures of queries and signs the replies to signed queries.
+type TSIG struct {
+	Next  plugin.Handler
+	Zones []string
+
+	keys  map[string]*dnsserver.TsigKey
+	all   bool                // all queries must be signed
+	types map[uint16]struct{} // queries of these types must be signed
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (t TSIG) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if plugin.Zones(t.Zones).Matches(state.Name()) == "" {
+		return plugin.NextOrFailure(t.Name(), t.Next, ctx, w, r)
+	}
+
+	rr := r.IsTsig()
+	if rr == nil {
+		if t.required(state.QType()) {
+			verificationErrors.WithLabelValues(metrics.WithServer(ctx), "unsigned").Inc()
+			log.Debugf("Refusing unsigned %s query for %s from %s", state.Type(), state.Name(), state.IP())
+			return dns.RcodeRefused, nil
+		}
+		return plugin.NextOrFailure(t.Name(), t.Next, ctx, w, r)
+	}
+
+	if code := t.verify(w, rr); code != dns.RcodeSuccess {
+		verificationErrors.WithLabelValues(metrics.WithServer(ctx), strings.ToLower(dns.RcodeToString[code])).Inc()
+		log.Debugf("Failed to verify TSIG %s of query for %s from %s: %s", rr.Hdr.Name, state.Name(), state.IP(), dns.RcodeToString[code])
+		w.WriteMsg(notAuth(r, rr, code))
+		return dns.RcodeNotAuth, nil
+	}
+
+	return plugin.NextOrFailure(t.Name(), t.Next, ctx, &ResponseWriter{ResponseWriter: w, tsig: rr}, r)
+}
+
+// required returns true when queries of type qtype must be signed.
+func (t TSIG) required(qtype uint16) bool {
+	if t.all {
+		return true
+	}
+	_, ok := t.types[qtype]
+	return ok
+}
+
+// verify returns the TSIG error of the signature rr of a query, as verified by the server that received it.
+// The key must be one of the keys of t, with the same algorithm.
+func (t TSIG) verify(w dns.ResponseWriter, rr *dns.TSIG) int {
+	key, ok := t.keys[strings.ToLower(rr.Hdr.Name)]
+	if !ok || !strings.EqualFold(rr.Algorithm, key.Algorithm) {
+		return dns.RcodeBadKey
+	}
+	switch w.TsigStatus() {
+	case nil:
+		return dns.RcodeSuccess
+	case dns.ErrSecret:
+		return dns.RcodeBadKey
+	case dns.ErrTime:
+		return dns.RcodeBadTime
+	default:
+		return dns.RcodeBadSig
+	}
+}
+
+// notAuth returns the NOTAUTH reply to a query of which the signature rr failed to verify with code. The
+// reply is only signed for BADTIME, and then carries the time of the server.
+func notAuth(r *dns.Msg, rr *dns.TSIG, code int) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeNotAuth)
+	m.SetTsig(rr.Hdr.Name, rr.Algorithm, rr.Fudge, int64(rr.TimeSigned))
+	t := m.IsTsig()
+	t.Error = uint16(code)
+	if code == dns.RcodeBadTime {
+		now := uint64(time.Now().Unix())
+		t.OtherData = hex.EncodeToString([]byte{byte(now >> 40), byte(now >> 32), byte(now >> 24), byte(now >> 16), byte(now >> 8), byte(now)})
+		t.OtherLen = 6
+	}
+	return m
+}
+
+// Name implements the Handler interface.
+func (t TSIG) Name() string { return "tsig" }
+
+// ResponseWriter signs the replies to a signed query with the key of the query.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	tsig *dns.TSIG
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(m *dns.Msg) error {
+	if m.IsTsig() == nil {
+		m.SetTsig(w.tsig.Hdr.Name, w.tsig.Algorithm, w.tsig.Fudge, time.Now().Unix())
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// newKey returns the key with name, algorithm and secret. Only the HMAC-SHA256 and HMAC-SHA512 algorithms
+// are supported.
+func newKey(name, algorithm, secret string) (*dnsserver.TsigKey, error) {
+	if _, ok := dns.IsDomainName(name); !ok {
+		return nil, fmt.Errorf("invalid key name: %s", name)
+	}
+	alg := dns.CanonicalName(algorithm)
+	if alg != dns.HmacSHA256 && alg != dns.HmacSHA512 {
+		return nil, fmt.Errorf("unsupported algorithm for key %s: %s", name, algorithm)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("no secret for key %s", name)
+	}
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+		return nil, fmt.Errorf("invalid secret for key %s: %s", name, err)
+	}
+	return &dnsserver.TsigKey{Name: dns.CanonicalName(name), Algorithm: alg, Secret: secret}, nil
+}
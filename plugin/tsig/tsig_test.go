@@ -0,0 +1,109 @@
+package tsig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// statusWriter is a test.ResponseWriter that returns status as the verification result of the TSIG.
+type statusWriter struct {
+	*test.ResponseWriter
+	status error
+}
+
+func (w *statusWriter) TsigStatus() error { return w.status }
+
+func newTSIG() TSIG {
+	key, _ := newKey("transfer.example.org.", "hmac-sha256", "c2VjcmV0")
+	return TSIG{
+		Next:  reply(),
+		Zones: []string{"example.org."},
+		keys:  map[string]*dnsserver.TsigKey{key.Name: key},
+		types: map[uint16]struct{}{dns.TypeAXFR: {}},
+	}
+}
+
+// reply returns a handler that replies to every query.
+func reply() plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func TestServeDNS(t *testing.T) {
+	tests := []struct {
+		name      string
+		qtype     uint16
+		key       string
+		algorithm string
+		status    error
+		rcode     int // rcode returned by ServeDNS
+		tsigError int // error of the TSIG in the reply, -1 for an unsigned reply
+	}{
+		{"www.example.org.", dns.TypeA, "", "", nil, dns.RcodeSuccess, -1},
+		{"example.org.", dns.TypeAXFR, "", "", nil, dns.RcodeRefused, -1},
+		{"www.example.com.", dns.TypeAXFR, "", "", nil, dns.RcodeSuccess, -1},
+		{"www.example.org.", dns.TypeA, "transfer.example.org.", dns.HmacSHA256, nil, dns.RcodeSuccess, dns.RcodeSuccess},
+		{"example.org.", dns.TypeAXFR, "transfer.example.org.", dns.HmacSHA256, nil, dns.RcodeSuccess, dns.RcodeSuccess},
+		{"www.example.org.", dns.TypeA, "other.example.org.", dns.HmacSHA256, nil, dns.RcodeNotAuth, dns.RcodeBadKey},
+		{"www.example.org.", dns.TypeA, "transfer.example.org.", dns.HmacSHA512, nil, dns.RcodeNotAuth, dns.RcodeBadKey},
+		{"www.example.org.", dns.TypeA, "transfer.example.org.", dns.HmacSHA256, dns.ErrSecret, dns.RcodeNotAuth, dns.RcodeBadKey},
+		{"www.example.org.", dns.TypeA, "transfer.example.org.", dns.HmacSHA256, dns.ErrSig, dns.RcodeNotAuth, dns.RcodeBadSig},
+		{"www.example.org.", dns.TypeA, "transfer.example.org.", dns.HmacSHA256, dns.ErrTime, dns.RcodeNotAuth, dns.RcodeBadTime},
+	}
+
+	ts := newTSIG()
+	ctx := context.TODO()
+	for i, tc := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(tc.name, tc.qtype)
+		if tc.key != "" {
+			r.SetTsig(tc.key, tc.algorithm, 300, time.Now().Unix())
+		}
+
+		rec := dnstest.NewRecorder(&statusWriter{ResponseWriter: &test.ResponseWriter{TCP: true}, status: tc.status})
+		rcode, err := ts.ServeDNS(ctx, rec, r)
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+			continue
+		}
+		if rec.Msg == nil {
+			continue
+		}
+		rr := rec.Msg.IsTsig()
+		if tc.tsigError == -1 {
+			if rr != nil {
+				t.Errorf("Test %d: expected unsigned reply, got %s", i, rr)
+			}
+			continue
+		}
+		if rr == nil {
+			t.Errorf("Test %d: expected signed reply", i)
+			continue
+		}
+		if rr.Hdr.Name != tc.key {
+			t.Errorf("Test %d: expected reply to be signed with %s, got %s", i, tc.key, rr.Hdr.Name)
+		}
+		if int(rr.Error) != tc.tsigError {
+			t.Errorf("Test %d: expected TSIG error %s, got %s", i, dns.RcodeToString[tc.tsigError], dns.RcodeToString[int(rr.Error)])
+		}
+		if tc.tsigError == dns.RcodeBadTime && rr.OtherLen != 6 {
+			t.Errorf("Test %d: expected server time in BADTIME reply, got %q", i, rr.OtherData)
+		}
+	}
+}
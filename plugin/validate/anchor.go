@@ -0,0 +1,39 @@
+package validate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// rootAnchor is the DS record of the root zone's KSK-2017, it is used when no trust anchors are configured.
+const rootAnchor = ". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"
+
+// parseAnchors reads the DS and DNSKEY records in r, which is in zone file format, and adds them to anchors.
+func parseAnchors(r io.Reader, file string, anchors map[string][]dns.RR) error {
+	zp := dns.NewZoneParser(r, ".", file)
+	zp.SetIncludeAllowed(true)
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch x := rr.(type) {
+		case *dns.DS:
+		case *dns.DNSKEY:
+			if x.Flags&dns.ZONE == 0 {
+				return fmt.Errorf("DNSKEY for %s in %s is not a zone key", x.Hdr.Name, file)
+			}
+		default:
+			return fmt.Errorf("unsupported %s record for %s in %s, only DS and DNSKEY can be trust anchors", dns.TypeToString[rr.Header().Rrtype], rr.Header().Name, file)
+		}
+		name := dns.CanonicalName(rr.Header().Name)
+		anchors[name] = append(anchors[name], rr)
+	}
+	return zp.Err()
+}
+
+func defaultAnchors() map[string][]dns.RR {
+	anchors := map[string][]dns.RR{}
+	parseAnchors(strings.NewReader(rootAnchor), "root", anchors)
+	return anchors
+}
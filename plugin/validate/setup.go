@@ -0,0 +1,96 @@
+package validate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("validate")
+
+func init() { plugin.Register("validate", setup) }
+
+func setup(c *caddy.Controller) error {
+	zones, anchors, capacity, err := validateParse(c)
+	if err != nil {
+		return plugin.Error("validate", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		return New(zones, anchors, capacity, next)
+	})
+
+	return nil
+}
+
+func validateParse(c *caddy.Controller) ([]string, map[string][]dns.RR, int, error) {
+	zones := []string{}
+	anchors := map[string][]dns.RR{}
+	capacity := defaultCap
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, nil, 0, plugin.ErrOnce
+		}
+		i++
+
+		// validate [zones...]
+		zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch x := c.Val(); x {
+			case "trust_anchor":
+				if !c.NextArg() {
+					return nil, nil, 0, c.ArgErr()
+				}
+				file := c.Val()
+				if !filepath.IsAbs(file) && dnsserver.GetConfig(c).Root != "" {
+					file = filepath.Join(dnsserver.GetConfig(c).Root, file)
+				}
+				if c.NextArg() {
+					return nil, nil, 0, c.ArgErr()
+				}
+				f, err := os.Open(filepath.Clean(file))
+				if err != nil {
+					return nil, nil, 0, err
+				}
+				err = parseAnchors(f, file, anchors)
+				f.Close()
+				if err != nil {
+					return nil, nil, 0, err
+				}
+			case "cache_capacity":
+				if !c.NextArg() {
+					return nil, nil, 0, c.ArgErr()
+				}
+				cacheCap, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return nil, nil, 0, err
+				}
+				if cacheCap <= 0 {
+					return nil, nil, 0, fmt.Errorf("cache_capacity must be positive: %d", cacheCap)
+				}
+				capacity = cacheCap
+			default:
+				return nil, nil, 0, c.Errf("unknown property '%s'", x)
+			}
+		}
+	}
+
+	if len(anchors) == 0 {
+		anchors = defaultAnchors()
+	}
+	return zones, anchors, capacity, nil
+}
+
+// defaultCap is the default capacity of the DNSKEY and DS cache.
+const defaultCap = 10000
@@ -0,0 +1,94 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	dir := t.TempDir()
+	anchor := filepath.Join(dir, "anchor")
+	if err := os.WriteFile(anchor, []byte(`example.org. IN DS 59725 13 2 7C4ADA4A5C8FB8C7CF1B2F2A0C4D7E1E4A3B4B5E5F0A1C2D3E4F5A6B7C8D9E0F
+example.net. IN DNSKEY 257 3 13 0J8u0XJ9GNGFEBXuAmLu04taHG4BXPP3gwhetiOUMnGA+x09nqzgF5IY OyjWB7N3rXqQbnOSILhH1hnuyh7mmA==`), 0644); err != nil {
+		t.Fatalf("Failed to write trust anchor file: %s", err)
+	}
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("example.org. IN A 127.0.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write trust anchor file: %s", err)
+	}
+
+	tests := []struct {
+		input              string
+		shouldErr          bool
+		expectedZones      []string
+		expectedAnchors    []string
+		expectedCapacity   int
+		expectedErrContent string
+	}{
+		{`validate`, false, nil, []string{"."}, defaultCap, ""},
+		{`validate example.org`, false, []string{"example.org."}, []string{"."}, defaultCap, ""},
+		{`validate {
+			trust_anchor ` + anchor + `
+			cache_capacity 100
+		}`, false, nil, []string{"example.org.", "example.net."}, 100, ""},
+		// fails
+		{`validate {
+			trust_anchor ` + bad + `
+		}`, true, nil, nil, 0, "only DS and DNSKEY"},
+		{`validate {
+			trust_anchor ` + filepath.Join(dir, "missing") + `
+		}`, true, nil, nil, 0, "no such file"},
+		{`validate {
+			trust_anchor
+		}`, true, nil, nil, 0, "Wrong argument count"},
+		{`validate {
+			cache_capacity 0
+		}`, true, nil, nil, 0, "must be positive"},
+		{`validate {
+			cache_capacity x
+		}`, true, nil, nil, 0, "invalid syntax"},
+		{`validate {
+			unknown
+		}`, true, nil, nil, 0, "unknown property"},
+		{`validate
+		  validate`, true, nil, nil, 0, "plugin"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		zones, anchors, capacity, err := validateParse(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but found %s for input %s", i, err, test.input)
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: Expected no error but found one for input %s. Error was: %v", i, test.input, err)
+			}
+			if !strings.Contains(err.Error(), test.expectedErrContent) {
+				t.Errorf("Test %d: Expected error to contain: %v, found error: %v, input: %s", i, test.expectedErrContent, err, test.input)
+			}
+			continue
+		}
+		for j, z := range test.expectedZones {
+			if zones[j] != z {
+				t.Errorf("Test %d: Expected zone %s, got %s", i, z, zones[j])
+			}
+		}
+		if len(anchors) != len(test.expectedAnchors) {
+			t.Errorf("Test %d: Expected %d trust anchors, got %d", i, len(test.expectedAnchors), len(anchors))
+		}
+		for _, a := range test.expectedAnchors {
+			if _, ok := anchors[a]; !ok {
+				t.Errorf("Test %d: Expected trust anchor for %s", i, a)
+			}
+		}
+		if capacity != test.expectedCapacity {
+			t.Errorf("Test %d: Expected capacity %d, got %d", i, test.expectedCapacity, capacity)
+		}
+	}
+}
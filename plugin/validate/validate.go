@@ -0,0 +1,160 @@
+// Package validate implements a plugin that validates DNSSEC signed responses.
+package validate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/plugin/pkg/stale"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// Validate validates the responses of the plugins after it in the chain.
+type Validate struct {
+	Next plugin.Handler
+
+	zones   []string
+	anchors map[string][]dns.RR // trust anchors (DS or DNSKEY records) keyed by their owner name
+	cache   *cache.Cache        // validated DNSKEY and DS records
+
+	now func() time.Time
+}
+
+// New returns a new Validate.
+func New(zones []string, anchors map[string][]dns.RR, capacity int, next plugin.Handler) *Validate {
+	return &Validate{Next: next,
+		zones:   zones,
+		anchors: anchors,
+		cache:   cache.New(capacity),
+		now:     time.Now,
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (v *Validate) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	zone := plugin.Zones(v.zones).Matches(state.Name())
+	// With CD set the client does its own validation.
+	if zone == "" || r.CheckingDisabled {
+		return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
+	}
+
+	do := state.Do()
+	req := r.Copy()
+	setDo(req)
+
+	nw := nonwriter.New(w)
+	rcode, err := plugin.NextOrFailure(v.Name(), v.Next, ctx, nw, req)
+	if nw.Msg == nil {
+		return rcode, err
+	}
+	resp := nw.Msg
+
+	st, verr := v.validate(ctx, state, resp)
+	resultCount.WithLabelValues(metrics.WithServer(ctx), st.String()).Inc()
+
+	switch st {
+	case bogus:
+		log.Debugf("Bogus answer for %s %s: %s", state.Name(), state.Type(), verr)
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		edns.SetExtendedError(r, m, errorCode(verr), verr.Error())
+		w.WriteMsg(m)
+		// Return success as the rcode to signal we have written to the client.
+		return dns.RcodeSuccess, verr
+	case secure:
+		resp.AuthenticatedData = do || r.AuthenticatedData
+	default:
+		resp.AuthenticatedData = false
+	}
+
+	if !do {
+		resp.Answer = filter(resp.Answer, state.QType())
+		resp.Ns = filter(resp.Ns, dns.TypeNone)
+		resp.Extra = filter(resp.Extra, dns.TypeNone)
+	}
+	if r.IsEdns0() == nil {
+		resp.Extra = removeOPT(resp.Extra)
+	}
+
+	w.WriteMsg(resp)
+	return rcode, err
+}
+
+// Name implements the Handler interface.
+func (v *Validate) Name() string { return "validate" }
+
+// setDo sets the DO bit on m, adding an OPT record if needed.
+func setDo(m *dns.Msg) {
+	o := m.IsEdns0()
+	if o != nil {
+		o.SetDo()
+		return
+	}
+
+	o = &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	o.SetDo()
+	o.SetUDPSize(defaultUDPBufSize)
+	m.Extra = append(m.Extra, o)
+}
+
+// filter removes the DNSSEC records from rrs, records of type qtype are kept.
+func filter(rrs []dns.RR, qtype uint16) []dns.RR {
+	j := 0
+	for _, r := range rrs {
+		switch t := r.Header().Rrtype; t {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			if t != qtype {
+				continue
+			}
+		}
+		rrs[j] = r
+		j++
+	}
+	return rrs[:j]
+}
+
+func removeOPT(rrs []dns.RR) []dns.RR {
+	j := 0
+	for _, r := range rrs {
+		if r.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		rrs[j] = r
+		j++
+	}
+	return rrs[:j]
+}
+
+// query sends a DNSSEC query for name and qtype down the plugin chain and returns the reply.
+func (v *Validate) query(ctx context.Context, state request.Request, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.CheckingDisabled = true
+	setDo(m)
+
+	nw := nonwriter.New(state.W)
+	// Stale data must not be written to the client for our own queries.
+	rcode, err := plugin.NextOrFailure(v.Name(), v.Next, stale.NewContext(ctx, nil), nw, m)
+	if err != nil {
+		return nil, err
+	}
+	if nw.Msg == nil {
+		return nil, fmt.Errorf("no reply, rcode %s", dns.RcodeToString[rcode])
+	}
+	return nw.Msg, nil
+}
+
+// defaultUDPBufSize is the bufsize the validate plugin uses on outgoing requests that don't
+// have an OPT RR.
+const defaultUDPBufSize = 2048
@@ -0,0 +1,345 @@
+package validate
+
+import (
+	"context"
+	"crypto"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/cache"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/denial"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestValidate(t *testing.T) {
+	v := newValidate(t)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		do    bool
+		ad    bool // AD bit in the query
+
+		rcode  int
+		expAD  bool
+		answer int
+		ede    uint16
+	}{
+		// secure answers
+		{qname: "www.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeSuccess, expAD: true, answer: 2},
+		{qname: "www.example.org.", qtype: dns.TypeA, ad: true, rcode: dns.RcodeSuccess, expAD: true, answer: 1},
+		{qname: "www.example.org.", qtype: dns.TypeA, rcode: dns.RcodeSuccess, answer: 1},
+		{qname: "www.sub.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeSuccess, expAD: true, answer: 2},
+		{qname: "foo.wild.example.org.", qtype: dns.TypeTXT, do: true, rcode: dns.RcodeSuccess, expAD: true, answer: 2},
+		{qname: "nope.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeNameError, expAD: true},
+		{qname: "www.example.org.", qtype: dns.TypeAAAA, do: true, rcode: dns.RcodeSuccess, expAD: true},
+		{qname: "nope.sub.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeNameError, expAD: true},
+		// insecure delegation
+		{qname: "www.insecure.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeSuccess, answer: 1},
+		// no trust anchor
+		{qname: "www.example.net.", qtype: dns.TypeA, do: true, rcode: dns.RcodeSuccess, answer: 1},
+		// bogus answers
+		{qname: "www.bogus.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeServerFailure, ede: dns.ExtendedErrorCodeDNSBogus},
+		{qname: "www.expired.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeServerFailure, ede: dns.ExtendedErrorCodeSignatureExpired},
+		{qname: "www.stripped.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeServerFailure, ede: dns.ExtendedErrorCodeRRSIGsMissing},
+		{qname: "www.nokey.example.org.", qtype: dns.TypeA, do: true, rcode: dns.RcodeServerFailure, ede: dns.ExtendedErrorCodeDNSKEYMissing},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.AuthenticatedData = tc.ad
+		if tc.do {
+			m.SetEdns0(4096, true)
+		}
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := v.ServeDNS(context.TODO(), rec, m); err != nil && tc.ede == 0 {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+			continue
+		}
+		if rec.Msg.AuthenticatedData != tc.expAD {
+			t.Errorf("Test %d: expected AD %t, got %t", i, tc.expAD, rec.Msg.AuthenticatedData)
+		}
+		if len(rec.Msg.Answer) != tc.answer {
+			t.Errorf("Test %d: expected %d records in the answer, got %d", i, tc.answer, len(rec.Msg.Answer))
+		}
+		if !tc.do && rec.Msg.IsEdns0() != nil {
+			t.Errorf("Test %d: expected no OPT record", i)
+		}
+		if tc.ede == 0 {
+			continue
+		}
+		if code := extendedError(rec.Msg); code != tc.ede {
+			t.Errorf("Test %d: expected extended error %d, got %d", i, tc.ede, code)
+		}
+	}
+}
+
+func TestValidateCheckingDisabled(t *testing.T) {
+	v := newValidate(t)
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.bogus.example.org.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	m.CheckingDisabled = true
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := v.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected NOERROR for bogus answer with CD set, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if rec.Msg.AuthenticatedData {
+		t.Errorf("Expected no AD bit with CD set")
+	}
+}
+
+func TestValidateBehindCache(t *testing.T) {
+	// cache is before validate, a bogus answer fetched with CD set must not be served to other clients.
+	c := cache.New()
+	c.Next = newValidate(t)
+
+	for i, tc := range []struct {
+		cd    bool
+		rcode int
+	}{
+		{true, dns.RcodeSuccess},
+		{false, dns.RcodeServerFailure},
+		{true, dns.RcodeSuccess},
+	} {
+		m := new(dns.Msg)
+		m.SetQuestion("www.bogus.example.org.", dns.TypeA)
+		m.SetEdns0(4096, true)
+		m.CheckingDisabled = tc.cd
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, m)
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s with CD %t, got %s", i, dns.RcodeToString[tc.rcode], tc.cd, dns.RcodeToString[rec.Msg.Rcode])
+		}
+	}
+}
+
+func TestValidateCachesKeys(t *testing.T) {
+	v := newValidate(t)
+	queries := 0
+	next := v.Next
+	v.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		queries++
+		return next.ServeDNS(ctx, w, r)
+	})
+
+	for i := 0; i < 2; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("www.sub.example.org.", dns.TypeA)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := v.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+		if !rec.Msg.AuthenticatedData {
+			t.Fatalf("Expected AD bit to be set")
+		}
+	}
+	// The first query needs the DNSKEYs of example.org and sub.example.org and the DS of sub.example.org,
+	// the second one is answered with the cached DNSKEYs.
+	if queries != 5 {
+		t.Errorf("Expected 5 queries, got %d", queries)
+	}
+}
+
+// newValidate returns a Validate that has example.org. as its trust anchor, and that validates the zones
+// served by the file plugin below it.
+func newValidate(t *testing.T) *Validate {
+	now := time.Now()
+	incep, expir := now.Add(-1*time.Hour), now.Add(time.Hour)
+
+	sub, subKey := sign(t, "sub.example.org.", []string{"www.sub.example.org. IN A 127.0.0.2"}, incep, expir)
+	bogus, bogusKey := sign(t, "bogus.example.org.", []string{"www.bogus.example.org. IN A 127.0.0.4"}, incep, expir)
+	for _, r := range bogus {
+		if a, ok := r.(*dns.A); ok {
+			a.A = a.A.To4()
+			a.A[3] = 5
+		}
+	}
+	expired, expiredKey := sign(t, "expired.example.org.", []string{"www.expired.example.org. IN A 127.0.0.6"}, incep.Add(-2*time.Hour), expir.Add(-2*time.Hour))
+	stripped, strippedKey := sign(t, "stripped.example.org.", []string{"www.stripped.example.org. IN A 127.0.0.7"}, incep, expir)
+	j := 0
+	for _, r := range stripped {
+		if r.Header().Rrtype == dns.TypeRRSIG && r.(*dns.RRSIG).TypeCovered == dns.TypeA {
+			continue
+		}
+		stripped[j] = r
+		j++
+	}
+	stripped = stripped[:j]
+	nokey, _ := sign(t, "nokey.example.org.", []string{"www.nokey.example.org. IN A 127.0.0.8"}, incep, expir)
+	_, otherKey := sign(t, "nokey.example.org.", nil, incep, expir)
+
+	parent, key := sign(t, "example.org.", []string{
+		"www.example.org. IN A 127.0.0.1",
+		"*.wild.example.org. IN TXT \"wildcard\"",
+		"sub.example.org. IN NS ns.example.org.",
+		subKey.ToDS(dns.SHA256).String(),
+		"insecure.example.org. IN NS ns.example.org.",
+		"bogus.example.org. IN NS ns.example.org.",
+		bogusKey.ToDS(dns.SHA256).String(),
+		"expired.example.org. IN NS ns.example.org.",
+		expiredKey.ToDS(dns.SHA256).String(),
+		"stripped.example.org. IN NS ns.example.org.",
+		strippedKey.ToDS(dns.SHA256).String(),
+		"nokey.example.org. IN NS ns.example.org.",
+		otherKey.ToDS(dns.SHA256).String(),
+	}, incep, expir)
+
+	insecure := unsigned(t, "insecure.example.org.", []string{"www.insecure.example.org. IN A 127.0.0.3"})
+	net := unsigned(t, "example.net.", []string{"www.example.net. IN A 127.0.0.9"})
+
+	c := chain{}
+	for _, z := range [][]dns.RR{parent, sub, bogus, expired, stripped, nokey, insecure, net} {
+		c.add(t, z)
+	}
+
+	anchors := map[string][]dns.RR{"example.org.": {key.ToDS(dns.SHA256)}}
+	return New([]string{"."}, anchors, 100, c)
+}
+
+// chain serves zones like a recursive resolver would: DS queries are answered from the parent zone.
+type chain map[string]*file.Zone
+
+func (c chain) add(t *testing.T, rrs []dns.RR) {
+	origin := rrs[0].Header().Name
+	text := ""
+	for _, r := range rrs {
+		text += r.String() + "\n"
+	}
+	z, err := file.Parse(strings.NewReader(text), origin, "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone %s: %s", origin, err)
+	}
+	c[origin] = z
+}
+
+func (c chain) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	name := r.Question[0].Name
+	if r.Question[0].Qtype == dns.TypeDS {
+		off, _ := dns.NextLabel(name, 0)
+		name = name[off:]
+	}
+	zone := ""
+	for z := range c {
+		if dns.IsSubDomain(z, name) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	f := file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{zone: c[zone]}, Names: []string{zone}}}
+	return f.ServeDNS(ctx, w, r)
+}
+
+func (c chain) Name() string { return "chain" }
+
+// sign returns the records of a signed zone for origin that holds the records in rrs, it also returns
+// the DNSKEY the zone is signed with.
+func sign(t *testing.T, origin string, rrs []string, incep, expir time.Time) ([]dns.RR, *dns.DNSKEY) {
+	key := &dns.DNSKEY{Hdr: dns.RR_Header{Name: origin, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+
+	zone := append(records(t, origin, rrs), key)
+
+	// Build the NSEC chain.
+	types := map[string][]uint16{}
+	names := []string{}
+	for _, r := range zone {
+		name := r.Header().Name
+		if _, ok := types[name]; !ok {
+			names = append(names, name)
+		}
+		types[name] = append(types[name], r.Header().Rrtype)
+	}
+	sort.Slice(names, func(i, j int) bool { return denial.Compare(names[i], names[j]) < 0 })
+	for i, name := range names {
+		bitmap := append(types[name], dns.TypeRRSIG, dns.TypeNSEC)
+		sort.Slice(bitmap, func(i, j int) bool { return bitmap[i] < bitmap[j] })
+		next := names[(i+1)%len(names)]
+		zone = append(zone, &dns.NSEC{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600},
+			NextDomain: next, TypeBitMap: dedup(bitmap)})
+	}
+
+	sets, _ := rrsets(zone)
+	for _, set := range sets {
+		hdr := set[0].Header()
+		// Delegations are not signed.
+		if hdr.Rrtype == dns.TypeNS && hdr.Name != origin {
+			continue
+		}
+		sig := &dns.RRSIG{Hdr: dns.RR_Header{Ttl: hdr.Ttl}, Algorithm: key.Algorithm, KeyTag: key.KeyTag(), SignerName: origin,
+			Inception: uint32(incep.Unix()), Expiration: uint32(expir.Unix())}
+		if err := sig.Sign(priv.(crypto.Signer), set); err != nil {
+			t.Fatalf("Failed to sign %s: %s", hdr.Name, err)
+		}
+		zone = append(zone, sig)
+	}
+	return zone, key
+}
+
+// unsigned returns the records of an unsigned zone for origin that holds the records in rrs.
+func unsigned(t *testing.T, origin string, rrs []string) []dns.RR {
+	return records(t, origin, rrs)
+}
+
+func records(t *testing.T, origin string, rrs []string) []dns.RR {
+	apex := []string{
+		origin + " 3600 IN SOA ns.example.org. hostmaster.example.org. 1 7200 3600 1209600 3600",
+		origin + " 3600 IN NS ns.example.org.",
+	}
+	zone := []dns.RR{}
+	for _, s := range append(apex, rrs...) {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %s", s, err)
+		}
+		zone = append(zone, r)
+	}
+	return zone
+}
+
+func dedup(types []uint16) []uint16 {
+	j := 0
+	for i := range types {
+		if i > 0 && types[i] == types[j-1] {
+			continue
+		}
+		types[j] = types[i]
+		j++
+	}
+	return types[:j]
+}
+
+func extendedError(m *dns.Msg) uint16 {
+	o := m.IsEdns0()
+	if o == nil {
+		return 0
+	}
+	for _, e := range o.Option {
+		if ede, ok := e.(*dns.EDNS0_EDE); ok {
+			return ede.InfoCode
+		}
+	}
+	return 0
+}
@@ -0,0 +1,532 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/denial"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// status is the security status of a response or RRset, see RFC 4035, section 4.3.
+type status int
+
+const (
+	// insecure means there is no chain of trust, either because no trust anchor covers the name or
+	// because the name is below a delegation that is provably unsigned.
+	insecure status = iota
+	// secure means there is an unbroken chain of trust from a trust anchor.
+	secure
+	// bogus means there should be a chain of trust, but it is broken.
+	bogus
+)
+
+func (s status) String() string {
+	switch s {
+	case secure:
+		return "secure"
+	case bogus:
+		return "bogus"
+	}
+	return "insecure"
+}
+
+// bogusError describes why validation failed. Code is the Extended DNS Error info code for the failure.
+type bogusError struct {
+	code uint16
+	msg  string
+}
+
+func (e *bogusError) Error() string { return e.msg }
+
+func errBogus(code uint16, format string, a ...interface{}) error {
+	return &bogusError{code: code, msg: fmt.Sprintf(format, a...)}
+}
+
+// errorCode returns the Extended DNS Error info code for err.
+func errorCode(err error) uint16 {
+	if e, ok := err.(*bogusError); ok {
+		return e.code
+	}
+	return dns.ExtendedErrorCodeDNSBogus
+}
+
+// validate returns the security status of resp, which is the reply to the request in state.
+func (v *Validate) validate(ctx context.Context, state request.Request, resp *dns.Msg) (status, error) {
+	qname, qtype := state.Name(), state.QType()
+
+	switch {
+	case resp.Rcode == dns.RcodeSuccess && len(resp.Answer) > 0:
+		st, err := v.verifySection(ctx, state, resp.Answer, 0)
+		if st != secure {
+			return st, err
+		}
+		// A wildcard expanded answer needs a proof the qname itself does not exist.
+		for _, r := range resp.Answer {
+			sig, ok := r.(*dns.RRSIG)
+			if !ok || !denial.Wildcard(sig) {
+				continue
+			}
+			if st, err := v.verifySection(ctx, state, resp.Ns, 0); st != secure || len(resp.Ns) == 0 {
+				if st == bogus {
+					return st, err
+				}
+				return bogus, errBogus(dns.ExtendedErrorCodeNSECMissing, "no proof for wildcard answer for %s", sig.Hdr.Name)
+			}
+			if !denial.NoCloserMatch(sig, resp.Ns) {
+				return bogus, errBogus(dns.ExtendedErrorCodeNSECMissing, "no proof for wildcard answer for %s", sig.Hdr.Name)
+			}
+		}
+		return secure, nil
+
+	case resp.Rcode == dns.RcodeNameError, resp.Rcode == dns.RcodeSuccess && !isDelegation(resp.Ns):
+		// A negative answer can follow a CNAME chain, the denial is for the target of that chain.
+		target := qname
+		if len(resp.Answer) > 0 {
+			st, err := v.verifySection(ctx, state, resp.Answer, 0)
+			if st != secure {
+				return st, err
+			}
+			target = chase(qname, resp.Answer)
+		}
+		if len(resp.Ns) == 0 {
+			return v.unsigned(ctx, state, target, 0)
+		}
+		st, err := v.verifySection(ctx, state, resp.Ns, 0)
+		if st != secure {
+			return st, err
+		}
+		if resp.Rcode == dns.RcodeNameError {
+			if !denial.NameError(target, resp.Ns) {
+				return bogus, errBogus(dns.ExtendedErrorCodeNSECMissing, "no proof %s does not exist", target)
+			}
+			return secure, nil
+		}
+		if !denial.NoData(target, qtype, resp.Ns) {
+			return bogus, errBogus(dns.ExtendedErrorCodeNSECMissing, "no proof %s %s does not exist", target, dns.TypeToString[qtype])
+		}
+		return secure, nil
+	}
+
+	// Referrals and errors are not validated.
+	return insecure, nil
+}
+
+// verifySection returns the security status of all RRsets in rrs. All of them must be secure for the
+// section to be secure.
+func (v *Validate) verifySection(ctx context.Context, state request.Request, rrs []dns.RR, depth int) (status, error) {
+	sets, sigs := rrsets(rrs)
+	result := secure
+	for i := range sets {
+		st, err := v.verifyRRset(ctx, state, sets[i], sigs[i], depth)
+		switch st {
+		case bogus:
+			return bogus, err
+		case insecure:
+			result = insecure
+		}
+	}
+	return result, nil
+}
+
+// verifyRRset returns the security status of rrset that is signed with sigs.
+func (v *Validate) verifyRRset(ctx context.Context, state request.Request, rrset []dns.RR, sigs []*dns.RRSIG, depth int) (status, error) {
+	hdr := rrset[0].Header()
+	if depth > maxDepth {
+		return bogus, errBogus(dns.ExtendedErrorCodeDNSSECIndeterminate, "chain of trust for %s is too long", hdr.Name)
+	}
+	if len(sigs) == 0 {
+		return v.unsigned(ctx, state, hdr.Name, depth)
+	}
+
+	err := errBogus(dns.ExtendedErrorCodeDNSBogus, "no valid RRSIG for %s %s", hdr.Name, dns.TypeToString[hdr.Rrtype])
+	for _, sig := range sigs {
+		if !dns.IsSubDomain(sig.SignerName, hdr.Name) {
+			continue
+		}
+		keys, st, kerr := v.dnskeys(ctx, state, sig.SignerName, depth+1)
+		switch st {
+		case insecure:
+			return insecure, nil
+		case bogus:
+			err = kerr
+			continue
+		}
+		if e := v.verify(sig, keys, rrset); e != nil {
+			err = e
+			continue
+		}
+		return secure, nil
+	}
+	return bogus, err
+}
+
+// verify checks sig over rrset with one of keys.
+func (v *Validate) verify(sig *dns.RRSIG, keys []dns.RR, rrset []dns.RR) error {
+	err := errBogus(dns.ExtendedErrorCodeDNSKEYMissing, "no DNSKEY with keytag %d for %s", sig.KeyTag, sig.SignerName)
+	for _, r := range keys {
+		k := r.(*dns.DNSKEY)
+		if k.Algorithm != sig.Algorithm || k.Flags&dns.ZONE == 0 || k.KeyTag() != sig.KeyTag {
+			continue
+		}
+		if e := sig.Verify(k, rrset); e != nil {
+			err = errBogus(dns.ExtendedErrorCodeDNSBogus, "RRSIG for %s %s with keytag %d: %s", sig.Hdr.Name, dns.TypeToString[sig.TypeCovered], sig.KeyTag, e)
+			continue
+		}
+		now := v.now()
+		if !sig.ValidityPeriod(now) {
+			if int64(sig.Inception) > now.Unix() {
+				return errBogus(dns.ExtendedErrorCodeSignatureNotYetValid, "RRSIG for %s %s is not yet valid", sig.Hdr.Name, dns.TypeToString[sig.TypeCovered])
+			}
+			return errBogus(dns.ExtendedErrorCodeSignatureExpired, "RRSIG for %s %s has expired", sig.Hdr.Name, dns.TypeToString[sig.TypeCovered])
+		}
+		return nil
+	}
+	return err
+}
+
+// unsigned returns the security status of the unsigned data owned by name. This is only insecure when
+// there is no trust anchor for name, or when there is a provably insecure delegation between the trust
+// anchor and name.
+func (v *Validate) unsigned(ctx context.Context, state request.Request, name string, depth int) (status, error) {
+	name = dns.CanonicalName(name)
+	anchor := v.anchor(name)
+	if anchor == "" {
+		return insecure, nil
+	}
+
+	off := dns.Split(name)
+	for i := len(off) - dns.CountLabel(anchor) - 1; i >= 0; i-- {
+		if _, st, err := v.ds(ctx, state, name[off[i]:], depth+1); st != secure {
+			return st, err
+		}
+	}
+	return bogus, errBogus(dns.ExtendedErrorCodeRRSIGsMissing, "no RRSIG for %s", name)
+}
+
+// dnskeys returns the validated DNSKEY records of zone.
+func (v *Validate) dnskeys(ctx context.Context, state request.Request, zone string, depth int) ([]dns.RR, status, error) {
+	zone = dns.CanonicalName(zone)
+	if depth > maxDepth {
+		return nil, bogus, errBogus(dns.ExtendedErrorCodeDNSSECIndeterminate, "chain of trust for %s is too long", zone)
+	}
+	if e, ok := v.get(zone, dns.TypeDNSKEY); ok {
+		return e.rrs, e.status, e.err
+	}
+
+	anchor := v.anchor(zone)
+	if anchor == "" {
+		return nil, insecure, nil
+	}
+
+	trusted := v.anchors[anchor]
+	if zone != anchor {
+		ds, st, err := v.ds(ctx, state, zone, depth)
+		if st != secure {
+			return nil, st, err
+		}
+		if len(ds) == 0 {
+			err := errBogus(dns.ExtendedErrorCodeDNSKEYMissing, "no DS for %s", zone)
+			v.set(zone, dns.TypeDNSKEY, bogus, nil, err, bogusTTL)
+			return nil, bogus, err
+		}
+		trusted = ds
+	}
+
+	resp, err := v.query(ctx, state, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, bogus, errBogus(dns.ExtendedErrorCodeDNSSECIndeterminate, "failed to get DNSKEY for %s: %s", zone, err)
+	}
+	keys, sigs := rrsetOf(resp.Answer, zone, dns.TypeDNSKEY)
+	if len(keys) == 0 {
+		err := errBogus(dns.ExtendedErrorCodeDNSKEYMissing, "no DNSKEY for %s", zone)
+		v.set(zone, dns.TypeDNSKEY, bogus, nil, err, bogusTTL)
+		return nil, bogus, err
+	}
+
+	sep := trustedKeys(keys, trusted)
+	if len(sep) == 0 {
+		// RFC 4035, section 5.2: without any supported algorithm the zone is treated as insecure.
+		if !supported(trusted) {
+			v.set(zone, dns.TypeDNSKEY, insecure, nil, nil, v.ttl(keys, nil))
+			return nil, insecure, nil
+		}
+		err := errBogus(dns.ExtendedErrorCodeDNSKEYMissing, "no DNSKEY for %s matches the DS or trust anchor", zone)
+		v.set(zone, dns.TypeDNSKEY, bogus, nil, err, bogusTTL)
+		return nil, bogus, err
+	}
+
+	err = errBogus(dns.ExtendedErrorCodeRRSIGsMissing, "no RRSIG for the DNSKEY of %s", zone)
+	for _, sig := range sigs {
+		if !strings.EqualFold(sig.SignerName, zone) {
+			continue
+		}
+		if e := v.verify(sig, sep, keys); e != nil {
+			err = e
+			continue
+		}
+		v.set(zone, dns.TypeDNSKEY, secure, keys, nil, v.ttl(keys, sig))
+		return keys, secure, nil
+	}
+	v.set(zone, dns.TypeDNSKEY, bogus, nil, err, bogusTTL)
+	return nil, bogus, err
+}
+
+// ds returns the validated DS records for name. When name provably has no DS records the status is
+// insecure if name is a delegation, and secure with no records if it is not.
+func (v *Validate) ds(ctx context.Context, state request.Request, name string, depth int) ([]dns.RR, status, error) {
+	name = dns.CanonicalName(name)
+	if e, ok := v.get(name, dns.TypeDS); ok {
+		return e.rrs, e.status, e.err
+	}
+
+	resp, err := v.query(ctx, state, name, dns.TypeDS)
+	if err != nil {
+		return nil, bogus, errBogus(dns.ExtendedErrorCodeDNSSECIndeterminate, "failed to get DS for %s: %s", name, err)
+	}
+
+	ds, sigs := rrsetOf(resp.Answer, name, dns.TypeDS)
+	if len(ds) > 0 {
+		st, err := v.verifyRRset(ctx, state, ds, sigs, depth+1)
+		switch st {
+		case secure:
+			v.set(name, dns.TypeDS, st, ds, nil, v.ttl(ds, sigs[0]))
+		case bogus:
+			v.set(name, dns.TypeDS, st, nil, err, bogusTTL)
+		}
+		return ds, st, err
+	}
+
+	if len(resp.Ns) == 0 {
+		err := errBogus(dns.ExtendedErrorCodeNSECMissing, "no proof %s has no DS", name)
+		return nil, bogus, err
+	}
+	st, err := v.verifySection(ctx, state, resp.Ns, depth+1)
+	if st != secure {
+		return nil, st, err
+	}
+
+	delegation, ok := denial.NoDS(name, resp.Ns)
+	switch {
+	case !ok:
+		err := errBogus(dns.ExtendedErrorCodeNSECMissing, "no proof %s has no DS", name)
+		v.set(name, dns.TypeDS, bogus, nil, err, bogusTTL)
+		return nil, bogus, err
+	case delegation:
+		v.set(name, dns.TypeDS, insecure, nil, nil, v.ttl(resp.Ns, nil))
+		return nil, insecure, nil
+	}
+	v.set(name, dns.TypeDS, secure, nil, nil, v.ttl(resp.Ns, nil))
+	return nil, secure, nil
+}
+
+// anchor returns the closest trust anchor for name, or the empty string if there is none.
+func (v *Validate) anchor(name string) string {
+	for {
+		if _, ok := v.anchors[name]; ok {
+			return name
+		}
+		off, end := dns.NextLabel(name, 0)
+		if end {
+			return ""
+		}
+		name = name[off:]
+	}
+}
+
+// trustedKeys returns the keys that match one of the DS or DNSKEY records in trusted.
+func trustedKeys(keys, trusted []dns.RR) []dns.RR {
+	var sep []dns.RR
+	for _, r := range keys {
+		k := r.(*dns.DNSKEY)
+		if k.Flags&dns.ZONE == 0 {
+			continue
+		}
+		for _, t := range trusted {
+			switch t := t.(type) {
+			case *dns.DS:
+				if t.KeyTag != k.KeyTag() || t.Algorithm != k.Algorithm {
+					continue
+				}
+				if ds := k.ToDS(t.DigestType); ds != nil && strings.EqualFold(ds.Digest, t.Digest) {
+					sep = append(sep, k)
+				}
+			case *dns.DNSKEY:
+				if t.Algorithm == k.Algorithm && t.PublicKey == k.PublicKey {
+					sep = append(sep, k)
+				}
+			}
+		}
+	}
+	return sep
+}
+
+// supported returns true if we can use any of the DS or DNSKEY records in trusted.
+func supported(trusted []dns.RR) bool {
+	for _, t := range trusted {
+		switch t := t.(type) {
+		case *dns.DS:
+			if _, ok := dns.HashToString[t.DigestType]; ok && t.DigestType != dns.GOST94 && algorithm(t.Algorithm) {
+				return true
+			}
+		case *dns.DNSKEY:
+			if algorithm(t.Algorithm) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func algorithm(alg uint8) bool {
+	switch alg {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512, dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519:
+		return true
+	}
+	return false
+}
+
+// rrsets groups the records in rrs in RRsets, each with the signatures covering them.
+func rrsets(rrs []dns.RR) ([][]dns.RR, [][]*dns.RRSIG) {
+	type key struct {
+		name  string
+		qtype uint16
+	}
+	index := map[key]int{}
+	sets := [][]dns.RR{}
+	sigs := [][]*dns.RRSIG{}
+
+	for _, r := range rrs {
+		if r.Header().Rrtype == dns.TypeRRSIG || r.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		k := key{dns.CanonicalName(r.Header().Name), r.Header().Rrtype}
+		i, ok := index[k]
+		if !ok {
+			i = len(sets)
+			index[k] = i
+			sets = append(sets, nil)
+			sigs = append(sigs, nil)
+		}
+		sets[i] = append(sets[i], r)
+	}
+	for _, r := range rrs {
+		sig, ok := r.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		if i, ok := index[key{dns.CanonicalName(sig.Hdr.Name), sig.TypeCovered}]; ok {
+			sigs[i] = append(sigs[i], sig)
+		}
+	}
+	return sets, sigs
+}
+
+// rrsetOf returns the RRset of type qtype owned by name in rrs, and its signatures.
+func rrsetOf(rrs []dns.RR, name string, qtype uint16) ([]dns.RR, []*dns.RRSIG) {
+	var (
+		set  []dns.RR
+		sigs []*dns.RRSIG
+	)
+	for _, r := range rrs {
+		if !strings.EqualFold(r.Header().Name, name) {
+			continue
+		}
+		if r.Header().Rrtype == qtype {
+			set = append(set, r)
+			continue
+		}
+		if sig, ok := r.(*dns.RRSIG); ok && sig.TypeCovered == qtype {
+			sigs = append(sigs, sig)
+		}
+	}
+	return set, sigs
+}
+
+// chase follows the CNAMEs in rrs starting at qname and returns the final target.
+func chase(qname string, rrs []dns.RR) string {
+	for i := 0; i < len(rrs); i++ {
+		for _, r := range rrs {
+			if c, ok := r.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, qname) {
+				qname = c.Target
+				break
+			}
+		}
+	}
+	return qname
+}
+
+func isDelegation(rrs []dns.RR) bool {
+	ns := false
+	for _, r := range rrs {
+		switch r.Header().Rrtype {
+		case dns.TypeSOA:
+			return false
+		case dns.TypeNS:
+			ns = true
+		}
+	}
+	return ns
+}
+
+// ttl returns how long the validated rrs may be cached, this is the lowest TTL in rrs, but never
+// beyond the expiration of sig.
+func (v *Validate) ttl(rrs []dns.RR, sig *dns.RRSIG) time.Duration {
+	min := uint32(maxTTL / time.Second)
+	for _, r := range rrs {
+		if r.Header().Ttl < min {
+			min = r.Header().Ttl
+		}
+	}
+	d := time.Duration(min) * time.Second
+	if sig != nil {
+		if exp := time.Unix(int64(sig.Expiration), 0).Sub(v.now()); exp < d {
+			d = exp
+		}
+	}
+	return d
+}
+
+// entry is a cached validation result for the DNSKEY or DS records of a name.
+type entry struct {
+	rrs     []dns.RR
+	status  status
+	err     error
+	expires time.Time
+}
+
+func (v *Validate) get(name string, qtype uint16) (*entry, bool) {
+	i, ok := v.cache.Get(key(name, qtype))
+	if !ok {
+		return nil, false
+	}
+	e := i.(*entry)
+	if v.now().After(e.expires) {
+		v.cache.Remove(key(name, qtype))
+		return nil, false
+	}
+	return e, true
+}
+
+func (v *Validate) set(name string, qtype uint16, st status, rrs []dns.RR, err error, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	v.cache.Add(key(name, qtype), &entry{rrs: rrs, status: st, err: err, expires: v.now().Add(ttl)})
+}
+
+func key(name string, qtype uint16) uint64 {
+	return cache.Hash([]byte(fmt.Sprintf("%s/%d", name, qtype)))
+}
+
+const (
+	maxDepth = 32
+	maxTTL   = 24 * time.Hour
+	// bogusTTL is how long a bogus DNSKEY or DS result is cached, see RFC 4035, section 4.7.
+	bogusTTL = 5 * time.Second
+)
@@ -0,0 +1,116 @@
+// Command tapread reads dnstap files written by the dnstap plugin. It prints their messages, summarizes
+// them, or replays the captured client queries against a DNS server.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/coredns/coredns/tapread/reader"
+)
+
+func main() {
+	var (
+		jsonOut = flag.Bool("json", false, "print the messages as JSON objects, one per line")
+		stats   = flag.Bool("stats", false, "print summary statistics instead of the messages")
+		top     = flag.Int("top", 10, "number of query names and clients listed with -stats, 0 lists all")
+		replay  = flag.String("replay", "", "replay the client queries to the DNS server at `address`")
+		netw    = flag.String("net", "", "protocol of replayed queries, udp or tcp; defaults to the captured protocol")
+		qps     = flag.Float64("rate", 0, "maximum number of replayed queries per second, 0 is unlimited")
+		workers = flag.Int("workers", 10, "number of concurrent replayed queries")
+		timeout = flag.Duration("timeout", 2*time.Second, "timeout for each replayed query")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] FILE...\n\nFILE can be a gzipped dnstap file, or - to read standard input.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	out := bufio.NewWriter(os.Stdout)
+	s := reader.NewStats()
+	p := &reader.Replayer{Addr: *replay, Net: *netw, Rate: *qps, Workers: *workers, Timeout: *timeout}
+	for _, name := range flag.Args() {
+		var err error
+		if *replay != "" {
+			fmt.Fprintf(out, ";; %s\n", name)
+			err = replayFile(ctx, p, name, out)
+		} else {
+			err = readFile(name, out, s, *stats, *jsonOut)
+		}
+		if err != nil {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "tapread: %s: %s\n", name, err)
+			os.Exit(1)
+		}
+	}
+	if *stats && *replay == "" {
+		s.Print(out, *top)
+	}
+	out.Flush()
+}
+
+// replayFile replays the client queries in the file name and writes the result to out.
+func replayFile(ctx context.Context, p *reader.Replayer, name string, out io.Writer) error {
+	r, err := reader.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	res, err := p.Replay(ctx, r)
+	if err != nil {
+		return err
+	}
+	res.Print(out)
+	return nil
+}
+
+// readFile reads the messages in the file name, and adds them to s or writes them to out.
+func readFile(name string, out io.Writer, s *reader.Stats, stats, jsonOut bool) error {
+	r, err := reader.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return read(r, out, s, stats, jsonOut)
+}
+
+// read reads all messages from r, and adds them to s or writes them to out.
+func read(r *reader.Reader, out io.Writer, s *reader.Stats, stats, jsonOut bool) error {
+	for {
+		d, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case stats:
+			s.Add(d)
+		case jsonOut:
+			buf, err := reader.JSON(d)
+			if err != nil {
+				continue
+			}
+			out.Write(append(buf, '\n'))
+		default:
+			if err := reader.Text(out, d); err != nil {
+				return err
+			}
+		}
+	}
+}
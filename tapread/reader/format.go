@@ -0,0 +1,160 @@
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+// Msg returns the DNS message in m, the response if there is one, or nil when m holds no DNS message
+// or it can't be unpacked.
+func Msg(m *tap.Message) *dns.Msg {
+	buf := m.GetResponseMessage()
+	if buf == nil {
+		buf = m.GetQueryMessage()
+	}
+	if buf == nil {
+		return nil
+	}
+	r := new(dns.Msg)
+	if err := r.Unpack(buf); err != nil {
+		return nil
+	}
+	return r
+}
+
+// Time returns the time of m: the response time of a response and the query time of a query.
+func Time(m *tap.Message) time.Time {
+	if m.ResponseTimeSec != nil {
+		return time.Unix(int64(m.GetResponseTimeSec()), int64(m.GetResponseTimeNsec())).UTC()
+	}
+	return time.Unix(int64(m.GetQueryTimeSec()), int64(m.GetQueryTimeNsec())).UTC()
+}
+
+// Text writes the message in d to w in the presentation format of dig, preceded by a comment line with
+// the message type, time, addresses and protocol.
+func Text(w io.Writer, d *tap.Dnstap) error {
+	m := d.GetMessage()
+	if m == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, ";; %s %s %s -> %s %s\n", m.GetType(), Time(m).Format(time.RFC3339Nano),
+		hostPort(m.GetQueryAddress(), m.GetQueryPort()), hostPort(m.GetResponseAddress(), m.GetResponsePort()), m.GetSocketProtocol())
+	if err != nil {
+		return err
+	}
+	r := Msg(m)
+	if r == nil {
+		_, err = io.WriteString(w, ";; no DNS message\n\n")
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", r)
+	return err
+}
+
+// jsonMessage is the JSON form of a dnstap message.
+type jsonMessage struct {
+	Type            string   `json:"type"`
+	Time            string   `json:"time"`
+	Identity        string   `json:"identity,omitempty"`
+	Protocol        string   `json:"protocol,omitempty"`
+	QueryAddress    string   `json:"query_address,omitempty"`
+	QueryPort       uint32   `json:"query_port,omitempty"`
+	ResponseAddress string   `json:"response_address,omitempty"`
+	ResponsePort    uint32   `json:"response_port,omitempty"`
+	Message         *jsonDNS `json:"message,omitempty"`
+}
+
+// jsonDNS is the JSON form of a DNS message.
+type jsonDNS struct {
+	ID         uint16   `json:"id"`
+	Opcode     string   `json:"opcode"`
+	Rcode      string   `json:"rcode"`
+	Flags      []string `json:"flags"`
+	Name       string   `json:"name,omitempty"`
+	Qtype      string   `json:"qtype,omitempty"`
+	Answer     []string `json:"answer,omitempty"`
+	Authority  []string `json:"authority,omitempty"`
+	Additional []string `json:"additional,omitempty"`
+}
+
+// JSON returns the message in d as a JSON object.
+func JSON(d *tap.Dnstap) ([]byte, error) {
+	m := d.GetMessage()
+	if m == nil {
+		return nil, fmt.Errorf("no message in dnstap frame of type %s", d.GetType())
+	}
+	j := jsonMessage{
+		Type:     m.GetType().String(),
+		Time:     Time(m).Format(time.RFC3339Nano),
+		Identity: string(d.GetIdentity()),
+		Protocol: m.GetSocketProtocol().String(),
+	}
+	if a := m.GetQueryAddress(); a != nil {
+		j.QueryAddress, j.QueryPort = net.IP(a).String(), m.GetQueryPort()
+	}
+	if a := m.GetResponseAddress(); a != nil {
+		j.ResponseAddress, j.ResponsePort = net.IP(a).String(), m.GetResponsePort()
+	}
+
+	if r := Msg(m); r != nil {
+		j.Message = &jsonDNS{
+			ID:         r.Id,
+			Opcode:     dns.OpcodeToString[r.Opcode],
+			Rcode:      dns.RcodeToString[r.Rcode],
+			Flags:      flags(r),
+			Answer:     rrStrings(r.Answer),
+			Authority:  rrStrings(r.Ns),
+			Additional: rrStrings(r.Extra),
+		}
+		if len(r.Question) > 0 {
+			j.Message.Name = r.Question[0].Name
+			j.Message.Qtype = dns.Type(r.Question[0].Qtype).String()
+		}
+	}
+	return json.Marshal(j)
+}
+
+// flags returns the names of the flags that are set in the header of r.
+func flags(r *dns.Msg) []string {
+	f := []string{}
+	for _, x := range []struct {
+		set  bool
+		name string
+	}{
+		{r.Response, "qr"}, {r.Authoritative, "aa"}, {r.Truncated, "tc"}, {r.RecursionDesired, "rd"},
+		{r.RecursionAvailable, "ra"}, {r.AuthenticatedData, "ad"}, {r.CheckingDisabled, "cd"},
+	} {
+		if x.set {
+			f = append(f, x.name)
+		}
+	}
+	if o := r.IsEdns0(); o != nil && o.Do() {
+		f = append(f, "do")
+	}
+	return f
+}
+
+func rrStrings(rrs []dns.RR) []string {
+	var s []string
+	for _, r := range rrs {
+		if r.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		s = append(s, r.String())
+	}
+	return s
+}
+
+func hostPort(ip []byte, port uint32) string {
+	if ip == nil {
+		return "-"
+	}
+	return net.JoinHostPort(net.IP(ip).String(), strconv.FormatUint(uint64(port), 10))
+}
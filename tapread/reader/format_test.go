@@ -0,0 +1,59 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+func TestText(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, r := exchange(1, "example.org.", dns.RcodeNameError)
+	buf := &bytes.Buffer{}
+	if err := Text(buf, tapMsg(tap.Message_CLIENT_RESPONSE, r, 40000, now)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, ";; CLIENT_RESPONSE 2021-01-02T03:04:05Z 10.0.0.1:40000 -> 10.0.0.53:0 UDP\n") {
+		t.Errorf("Unexpected first line in %q", out)
+	}
+	if !strings.Contains(out, "status: NXDOMAIN") || !strings.Contains(out, ";example.org.\tIN\t A") {
+		t.Errorf("Expected the DNS message in dig format, got %q", out)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, r := exchange(7, "example.org.", dns.RcodeSuccess)
+	r.SetEdns0(4096, true)
+	buf, err := JSON(tapMsg(tap.Message_CLIENT_RESPONSE, r, 40000, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := jsonMessage{}
+	if err := json.Unmarshal(buf, &j); err != nil {
+		t.Fatalf("Invalid JSON %s: %s", buf, err)
+	}
+	if j.Type != "CLIENT_RESPONSE" || j.Time != "2021-01-02T03:04:05Z" || j.QueryAddress != "10.0.0.1" || j.QueryPort != 40000 {
+		t.Errorf("Unexpected dnstap fields in %s", buf)
+	}
+	m := j.Message
+	if m == nil {
+		t.Fatalf("Expected a DNS message in %s", buf)
+	}
+	if m.ID != 7 || m.Rcode != "NOERROR" || m.Name != "example.org." || m.Qtype != "A" {
+		t.Errorf("Unexpected DNS fields in %s", buf)
+	}
+	if strings.Join(m.Flags, " ") != "qr rd do" {
+		t.Errorf("Expected flags qr rd do, got %v", m.Flags)
+	}
+	if len(m.Answer) != 1 || len(m.Additional) != 0 {
+		t.Errorf("Expected 1 answer and no OPT record in the additional section, got %s", buf)
+	}
+}
@@ -0,0 +1,107 @@
+// Package reader reads the dnstap files written by the dnstap plugin, formats their messages, computes
+// statistics over them and replays the captured client queries.
+package reader
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	tap "github.com/dnstap/golang-dnstap"
+	fs "github.com/farsightsec/golang-framestream"
+	"google.golang.org/protobuf/proto"
+)
+
+// Reader reads dnstap messages from a Frame Streams file.
+type Reader struct {
+	r   tap.Reader
+	buf []byte
+	c   []io.Closer
+}
+
+// maxFrameSize is the size of the largest dnstap frame that is read, larger frames are skipped.
+const maxFrameSize = 96 * 1024
+
+// New returns a Reader that reads the Frame Streams data in r.
+func New(r io.Reader) (*Reader, error) {
+	fr, err := tap.NewReader(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: fr, buf: make([]byte, maxFrameSize)}, nil
+}
+
+// Open returns a Reader for the file name. Files ending in .gz, such as rotated files compressed by the
+// dnstap plugin, are decompressed. The name "-" reads from standard input.
+func Open(name string) (*Reader, error) {
+	var (
+		in      io.Reader = os.Stdin
+		closers []io.Closer
+	)
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		in = f
+		closers = append(closers, f)
+	}
+	in = bufio.NewReader(in)
+
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		in = zr
+		closers = append([]io.Closer{zr}, closers...)
+	}
+
+	r, err := New(in)
+	if err != nil {
+		closeAll(closers)
+		return nil, err
+	}
+	r.c = closers
+	return r, nil
+}
+
+// Read returns the next dnstap message. It returns io.EOF when there are no more messages. A file that
+// ends in the middle of a frame, because it is still being written, ends there without an error.
+func (r *Reader) Read() (*tap.Dnstap, error) {
+	for {
+		n, err := r.r.ReadFrame(r.buf)
+		switch {
+		case err == nil:
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return nil, io.EOF
+		case errors.Is(err, fs.ErrDataFrameTooLarge):
+			continue
+		default:
+			return nil, err
+		}
+
+		d := new(tap.Dnstap)
+		if err := proto.Unmarshal(r.buf[:n], d); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+}
+
+// Close closes the underlying file.
+func (r *Reader) Close() error { return closeAll(r.c) }
+
+func closeAll(closers []io.Closer) error {
+	var err error
+	for _, c := range closers {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
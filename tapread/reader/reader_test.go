@@ -0,0 +1,160 @@
+package reader
+
+import (
+	"compress/gzip"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// tapMsg returns a dnstap message of type typ holding r, sent by the client 10.0.0.1 port port at t.
+func tapMsg(typ tap.Message_Type, r *dns.Msg, port uint32, t time.Time) *tap.Dnstap {
+	buf, _ := r.Pack()
+	protocol := tap.SocketProtocol_UDP
+	m := &tap.Message{
+		Type:            &typ,
+		SocketProtocol:  &protocol,
+		QueryAddress:    net.ParseIP("10.0.0.1").To4(),
+		QueryPort:       &port,
+		ResponseAddress: net.ParseIP("10.0.0.53").To4(),
+	}
+	sec, nsec := uint64(t.Unix()), uint32(t.Nanosecond())
+	if r.Response {
+		m.ResponseMessage, m.ResponseTimeSec, m.ResponseTimeNsec = buf, &sec, &nsec
+	} else {
+		m.QueryMessage, m.QueryTimeSec, m.QueryTimeNsec = buf, &sec, &nsec
+	}
+	typeMessage := tap.Dnstap_MESSAGE
+	return &tap.Dnstap{Type: &typeMessage, Message: m}
+}
+
+// exchange returns a query for qname with ID id and its response with rcode.
+func exchange(id uint16, qname string, rcode int) (*dns.Msg, *dns.Msg) {
+	q := new(dns.Msg)
+	q.SetQuestion(qname, dns.TypeA)
+	q.Id = id
+	r := new(dns.Msg)
+	r.SetRcode(q, rcode)
+	if rcode == dns.RcodeSuccess {
+		r.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.ParseIP("127.0.0.1")}}
+	}
+	return q, r
+}
+
+// writeFile writes the messages to a dnstap file name, gzipped when name ends in .gz.
+func writeFile(t *testing.T, name string, msgs []*tap.Dnstap) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out io.Writer = f
+	if filepath.Ext(name) == ".gz" {
+		zw := gzip.NewWriter(f)
+		defer zw.Close()
+		out = zw
+	}
+	w, err := tap.NewWriter(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs {
+		buf, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.WriteFrame(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+}
+
+// testMessages returns 3 queries with their responses.
+func testMessages(now time.Time) []*tap.Dnstap {
+	var msgs []*tap.Dnstap
+	for i, x := range []struct {
+		qname string
+		rcode int
+	}{{"example.org.", dns.RcodeSuccess}, {"nope.example.org.", dns.RcodeNameError}, {"example.org.", dns.RcodeSuccess}} {
+		q, r := exchange(uint16(i+1), x.qname, x.rcode)
+		t := now.Add(time.Duration(i) * time.Second)
+		resp := tapMsg(tap.Message_CLIENT_RESPONSE, r, 40000, t.Add(time.Duration(i+1)*time.Millisecond))
+		sec, nsec := uint64(t.Unix()), uint32(t.Nanosecond())
+		resp.Message.QueryTimeSec, resp.Message.QueryTimeNsec = &sec, &nsec
+		msgs = append(msgs, tapMsg(tap.Message_CLIENT_QUERY, q, 40000, t), resp)
+	}
+	return msgs
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	msgs := testMessages(time.Now())
+	for _, name := range []string{"dnstap.tap", "dnstap.tap.gz"} {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, msgs)
+
+		r, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		n := 0
+		for {
+			d, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if !proto.Equal(d, msgs[n]) {
+				t.Errorf("%s: message %d differs from the written one", name, n)
+			}
+			n++
+		}
+		r.Close()
+		if n != len(msgs) {
+			t.Errorf("%s: expected %d messages, got %d", name, len(msgs), n)
+		}
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.tap")
+	writeFile(t, path, testMessages(time.Now()))
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cut the file in the middle of the last frame, as if it is still being written.
+	if err := os.Truncate(path, fi.Size()-20); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	n := 0
+	for {
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected no error for a truncated file, got %s", err)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("Expected 5 messages, got %d", n)
+	}
+}
@@ -0,0 +1,176 @@
+package reader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
+)
+
+// Replayer sends the client queries captured in dnstap messages to a DNS server. When the captured
+// responses are present as well, the rcodes of the replies are compared with them.
+type Replayer struct {
+	Addr    string        // address of the DNS server
+	Net     string        // "udp" or "tcp", empty uses the protocol of the captured query
+	Rate    float64       // maximum number of queries per second, 0 is unlimited
+	Workers int           // number of concurrent queries, at least 1
+	Timeout time.Duration // timeout for each query
+}
+
+// Result holds the outcome of a replay.
+type Result struct {
+	Sent     int
+	Answered int
+	Errors   int
+	Rcodes   map[string]int
+	Latency  []time.Duration
+
+	// Compared is the number of replies for which the captured response was found, Mismatches is the
+	// number of those with a different rcode.
+	Compared   int
+	Mismatches int
+}
+
+// Print writes a summary of the result to w.
+func (r *Result) Print(w io.Writer) {
+	fmt.Fprintf(w, "sent: %d\nanswered: %d\nerrors: %d\n", r.Sent, r.Answered, r.Errors)
+	if r.Compared > 0 {
+		fmt.Fprintf(w, "compared: %d\nmismatches: %d\n", r.Compared, r.Mismatches)
+	}
+	printCounts(w, "rcodes", r.Rcodes, 0)
+	printLatency(w, r.Latency)
+}
+
+// job is a query to replay.
+type job struct {
+	key string
+	net string
+	msg *dns.Msg
+}
+
+// Replay reads the messages from r and replays the client queries among them, until r is exhausted
+// or ctx is canceled.
+func (p *Replayer) Replay(ctx context.Context, r *Reader) (*Result, error) {
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var limiter *rate.Limiter
+	if p.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(p.Rate), 1)
+	}
+
+	res := &Result{Rcodes: make(map[string]int)}
+	captured := map[string]int{} // rcode of the captured responses
+	replied := map[string]int{}  // rcode of the replies
+	var mu sync.Mutex
+
+	jobs := make(chan job)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				reply, rtt, err := p.exchange(j)
+				mu.Lock()
+				if err != nil {
+					res.Errors++
+				} else {
+					res.Answered++
+					res.Rcodes[dns.RcodeToString[reply.Rcode]]++
+					res.Latency = append(res.Latency, rtt)
+					replied[j.key] = reply.Rcode
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+read:
+	for {
+		var d *tap.Dnstap
+		d, err = r.Read()
+		if err != nil {
+			break
+		}
+		m := d.GetMessage()
+		if m == nil {
+			continue
+		}
+		switch m.GetType() {
+		case tap.Message_CLIENT_RESPONSE:
+			if resp := Msg(m); resp != nil && resp.Response {
+				captured[key(m, resp)] = resp.Rcode
+			}
+			continue
+		case tap.Message_CLIENT_QUERY:
+		default:
+			continue
+		}
+		q := Msg(m)
+		if q == nil || q.Response || len(q.Question) == 0 {
+			continue
+		}
+
+		if limiter != nil {
+			if err = limiter.Wait(ctx); err != nil {
+				break read
+			}
+		}
+		j := job{key: key(m, q), net: p.Net, msg: q}
+		if j.net == "" {
+			j.net = strings.ToLower(m.GetSocketProtocol().String())
+		}
+		select {
+		case jobs <- j:
+			res.Sent++
+		case <-ctx.Done():
+			err = ctx.Err()
+			break read
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for k, rcode := range replied {
+		c, ok := captured[k]
+		if !ok {
+			continue
+		}
+		res.Compared++
+		if c != rcode {
+			res.Mismatches++
+		}
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+	return res, err
+}
+
+func (p *Replayer) exchange(j job) (*dns.Msg, time.Duration, error) {
+	c := &dns.Client{Net: j.net, Timeout: p.Timeout}
+	if j.net != "tcp" {
+		c.Net = "udp"
+	}
+	return c.Exchange(j.msg, p.Addr)
+}
+
+// key identifies a query and its response: the client address, the message ID and the question.
+func key(m *tap.Message, r *dns.Msg) string {
+	q := ""
+	if len(r.Question) > 0 {
+		q = strings.ToLower(r.Question[0].Name) + " " + dns.Type(r.Question[0].Qtype).String()
+	}
+	return fmt.Sprintf("%s %d %d %s", net.IP(m.GetQueryAddress()), m.GetQueryPort(), r.Id, q)
+}
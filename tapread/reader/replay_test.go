@@ -0,0 +1,47 @@
+package reader
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+
+	"github.com/miekg/dns"
+)
+
+func TestReplay(t *testing.T) {
+	var queries int32
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&queries, 1)
+		m := new(dns.Msg)
+		m.SetReply(r) // always NOERROR, where the captured response for nope.example.org. is NXDOMAIN
+		w.WriteMsg(m)
+	})
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "dnstap.tap")
+	writeFile(t, path, testMessages(time.Now()))
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	p := &Replayer{Addr: s.Addr, Workers: 2, Timeout: time.Second}
+	res, err := p.Replay(context.TODO(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Sent != 3 || res.Answered != 3 || res.Errors != 0 || atomic.LoadInt32(&queries) != 3 {
+		t.Errorf("Expected 3 queries sent and answered, got sent %d, answered %d, errors %d", res.Sent, res.Answered, res.Errors)
+	}
+	if res.Compared != 3 || res.Mismatches != 1 {
+		t.Errorf("Expected 1 mismatch in 3 compared replies, got %d in %d", res.Mismatches, res.Compared)
+	}
+	if res.Rcodes["NOERROR"] != 3 {
+		t.Errorf("Expected 3 NOERROR replies, got %v", res.Rcodes)
+	}
+}
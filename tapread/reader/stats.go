@@ -0,0 +1,167 @@
+package reader
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+// Stats holds summary statistics of dnstap messages.
+type Stats struct {
+	Messages    int
+	First, Last time.Time
+
+	Types   map[string]int // per message type
+	Qtypes  map[string]int // per query type, counted on queries
+	Rcodes  map[string]int // per response code, counted on responses
+	Names   map[string]int // per query name, counted on queries
+	Clients map[string]int // per client address, counted on queries
+
+	// Latency holds the durations between query and response, from the responses that have both times.
+	Latency []time.Duration
+}
+
+// NewStats returns an empty Stats.
+func NewStats() *Stats {
+	return &Stats{
+		Types:   make(map[string]int),
+		Qtypes:  make(map[string]int),
+		Rcodes:  make(map[string]int),
+		Names:   make(map[string]int),
+		Clients: make(map[string]int),
+	}
+}
+
+// Add adds the message in d to the statistics.
+func (s *Stats) Add(d *tap.Dnstap) {
+	m := d.GetMessage()
+	if m == nil {
+		return
+	}
+	s.Messages++
+	s.Types[m.GetType().String()]++
+
+	t := Time(m)
+	if s.First.IsZero() || t.Before(s.First) {
+		s.First = t
+	}
+	if t.After(s.Last) {
+		s.Last = t
+	}
+
+	r := Msg(m)
+	if r == nil {
+		return
+	}
+	if !r.Response {
+		if len(r.Question) > 0 {
+			s.Qtypes[dns.Type(r.Question[0].Qtype).String()]++
+			s.Names[strings.ToLower(r.Question[0].Name)]++
+		}
+		if a := m.GetQueryAddress(); a != nil {
+			s.Clients[net.IP(a).String()]++
+		}
+		return
+	}
+	s.Rcodes[dns.RcodeToString[r.Rcode]]++
+	if m.QueryTimeSec != nil && m.ResponseTimeSec != nil {
+		q := time.Unix(int64(m.GetQueryTimeSec()), int64(m.GetQueryTimeNsec()))
+		if l := Time(m).Sub(q); l >= 0 {
+			s.Latency = append(s.Latency, l)
+		}
+	}
+}
+
+// Print writes a summary of the statistics to w, listing at most top entries of the names and clients.
+func (s *Stats) Print(w io.Writer, top int) {
+	fmt.Fprintf(w, "messages: %d\n", s.Messages)
+	if s.Messages == 0 {
+		return
+	}
+	d := s.Last.Sub(s.First)
+	fmt.Fprintf(w, "first: %s\nlast: %s\nduration: %s\n", s.First.Format(time.RFC3339Nano), s.Last.Format(time.RFC3339Nano), d)
+	if d > 0 {
+		fmt.Fprintf(w, "rate: %.1f/s\n", float64(s.Messages)/d.Seconds())
+	}
+
+	printCounts(w, "types", s.Types, 0)
+	printCounts(w, "qtypes", s.Qtypes, 0)
+	printCounts(w, "rcodes", s.Rcodes, 0)
+	printCounts(w, "names", s.Names, top)
+	printCounts(w, "clients", s.Clients, top)
+
+	printLatency(w, s.Latency)
+}
+
+// printLatency sorts the latencies and writes their percentiles to w.
+func printLatency(w io.Writer, latency []time.Duration) {
+	if len(latency) == 0 {
+		return
+	}
+	sort.Slice(latency, func(i, j int) bool { return latency[i] < latency[j] })
+	fmt.Fprintf(w, "latency:\n")
+	for _, p := range []float64{0.5, 0.9, 0.99} {
+		fmt.Fprintf(w, "  p%g %s\n", p*100, Percentile(latency, p))
+	}
+	fmt.Fprintf(w, "  max %s\n", latency[len(latency)-1])
+}
+
+// Percentile returns the latency at percentile p, between 0 and 1, of the sorted latencies.
+func Percentile(latency []time.Duration, p float64) time.Duration {
+	if len(latency) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(latency)))
+	if i >= len(latency) {
+		i = len(latency) - 1
+	}
+	return latency[i]
+}
+
+type count struct {
+	key string
+	n   int
+}
+
+// Top returns the keys of counts with the highest counts, at most n of them, or all of them when n is 0.
+func Top(counts map[string]int, n int) []string {
+	cs := sortCounts(counts)
+	if n > 0 && len(cs) > n {
+		cs = cs[:n]
+	}
+	keys := make([]string, len(cs))
+	for i := range cs {
+		keys[i] = cs[i].key
+	}
+	return keys
+}
+
+func sortCounts(counts map[string]int) []count {
+	cs := make([]count, 0, len(counts))
+	for k, n := range counts {
+		cs = append(cs, count{k, n})
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].n != cs[j].n {
+			return cs[i].n > cs[j].n
+		}
+		return cs[i].key < cs[j].key
+	})
+	return cs
+}
+
+func printCounts(w io.Writer, title string, counts map[string]int, top int) {
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, k := range Top(counts, top) {
+		fmt.Fprintf(w, "  %-40s %d\n", k, counts[k])
+	}
+}
@@ -0,0 +1,46 @@
+package reader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Now()
+	s := NewStats()
+	for _, d := range testMessages(now) {
+		s.Add(d)
+	}
+
+	if s.Messages != 6 {
+		t.Errorf("Expected 6 messages, got %d", s.Messages)
+	}
+	if s.Types["CLIENT_QUERY"] != 3 || s.Types["CLIENT_RESPONSE"] != 3 {
+		t.Errorf("Expected 3 queries and 3 responses, got %v", s.Types)
+	}
+	if s.Rcodes["NOERROR"] != 2 || s.Rcodes["NXDOMAIN"] != 1 {
+		t.Errorf("Unexpected rcodes %v", s.Rcodes)
+	}
+	if top := Top(s.Names, 1); len(top) != 1 || top[0] != "example.org." {
+		t.Errorf("Expected example.org. as the top name, got %v", top)
+	}
+	if s.Clients["10.0.0.1"] != 3 {
+		t.Errorf("Expected 3 queries from 10.0.0.1, got %v", s.Clients)
+	}
+	if d := s.Last.Sub(s.First); d != 2*time.Second+3*time.Millisecond {
+		t.Errorf("Expected a duration of 2.003s, got %s", d)
+	}
+	if len(s.Latency) != 3 {
+		t.Fatalf("Expected 3 latencies, got %d", len(s.Latency))
+	}
+
+	buf := &bytes.Buffer{}
+	s.Print(buf, 10)
+	for _, want := range []string{"messages: 6\n", "NXDOMAIN", "p50 2ms\n", "max 3ms\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in the summary:\n%s", want, buf)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestFileUpdate(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `example.org:0 {
+		tsig {
+			key ` + tsigKey + ` hmac-sha256 ` + tsigSecret + `
+		}
+		file ` + name + ` {
+			update ` + tsigKey + ` subdomain dyn.example.org. A AAAA
+		}
+		transfer {
+			to *
+		}
+	}`
+
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	c := &dns.Client{Net: "tcp", TsigSecret: map[string]string{tsigKey: tsigSecret}}
+
+	// An unsigned update is refused.
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert([]dns.RR{test.A("www.dyn.example.org. 300 IN A 192.0.2.10")})
+	r, _, err := c.Exchange(m, tcp)
+	if err != nil {
+		t.Fatalf("Expected reply, got %s", err)
+	}
+	if r.Rcode != dns.RcodeRefused {
+		t.Fatalf("Expected REFUSED for unsigned update, got %s", dns.RcodeToString[r.Rcode])
+	}
+
+	m = new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.RRsetNotUsed([]dns.RR{test.A("www.dyn.example.org. 0 IN A 127.0.0.1")})
+	m.Insert([]dns.RR{test.A("www.dyn.example.org. 300 IN A 192.0.2.10")})
+	m.SetTsig(tsigKey, dns.HmacSHA256, 300, time.Now().Unix())
+	r, _, err = c.Exchange(m, tcp)
+	if err != nil {
+		t.Fatalf("Expected reply, got %s", err)
+	}
+	if r.Rcode != dns.RcodeSuccess || r.IsTsig() == nil {
+		t.Fatalf("Expected signed NOERROR reply, got %s", r)
+	}
+
+	m = new(dns.Msg)
+	m.SetQuestion("www.dyn.example.org.", dns.TypeA)
+	r, _, err = c.Exchange(m, tcp)
+	if err != nil {
+		t.Fatalf("Expected reply, got %s", err)
+	}
+	if len(r.Answer) != 1 || r.Answer[0].(*dns.A).A.String() != "192.0.2.10" {
+		t.Fatalf("Expected updated address, got %s", r)
+	}
+
+	// The update is transferred incrementally.
+	m = new(dns.Msg)
+	m.SetIxfr("example.org.", 2015082541, "sns.dns.icann.org.", "noc.dns.icann.org.")
+	tr := new(dns.Transfer)
+	ch, err := tr.In(m, tcp)
+	if err != nil {
+		t.Fatalf("Failed to set up transfer: %s", err)
+	}
+	var rrs []dns.RR
+	for env := range ch {
+		if env.Error != nil {
+			t.Fatalf("Failed to transfer: %s", env.Error)
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	// SOA, old SOA, new SOA, added A, SOA
+	if len(rrs) != 5 || rrs[0].(*dns.SOA).Serial != 2015082542 {
+		t.Fatalf("Expected incremental transfer to serial 2015082542, got %v", rrs)
+	}
+}
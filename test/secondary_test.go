@@ -1,6 +1,8 @@
 package test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -216,3 +218,63 @@ www    IN AAAA ::1
 	}
 
 }
+
+func TestSecondaryZoneCacheFile(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `example.org:0 {
+		file ` + name + `
+		transfer {
+			to *
+		}
+	}`
+
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+
+	cache := filepath.Join(t.TempDir(), "db.example.org")
+	corefile = `example.org:0 {
+		secondary {
+			transfer from ` + tcp + `
+			cache_file ` + cache + `
+		}
+	}`
+
+	i1, _, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+
+	// Wait for the zone to be transferred and written to the cache file.
+	for j := 0; j < 50; j++ {
+		if _, err := os.Stat(cache); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	i1.Stop()
+	i.Stop()
+
+	// Without a primary the zone is loaded from the cache file.
+	i2, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i2.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+	r, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) == 0 {
+		t.Fatalf("Expected answer from cache file, got %s", r)
+	}
+}
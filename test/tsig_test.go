@@ -0,0 +1,108 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	tsigKey    = "transfer.example.org."
+	tsigSecret = "L9Fw7sAMvx6ygxjuSxGfdQ2IhfH4jbLxJ1xRM2Ma5Hg="
+)
+
+func TestSecondaryZoneTransferTsig(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `example.org:0 {
+		tsig {
+			key ` + tsigKey + ` hmac-sha256 ` + tsigSecret + `
+		}
+		file ` + name + `
+		transfer {
+			to *
+			tsig ` + tsigKey + `
+		}
+	}`
+
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	// An unsigned transfer is refused.
+	m := new(dns.Msg)
+	m.SetAxfr("example.org.")
+	tr := new(dns.Transfer)
+	c, err := tr.In(m, tcp)
+	if err != nil {
+		t.Fatalf("Failed to set up transfer: %s", err)
+	}
+	for env := range c {
+		if env.Error == nil {
+			t.Fatalf("Expected unsigned transfer to fail")
+		}
+	}
+
+	// A signed query gets a signed reply.
+	m = new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+	m.SetTsig(tsigKey, dns.HmacSHA256, 300, time.Now().Unix())
+	cl := &dns.Client{Net: "tcp", TsigSecret: map[string]string{tsigKey: tsigSecret}}
+	r, _, err := cl.Exchange(m, tcp)
+	if err != nil {
+		t.Fatalf("Expected signed reply, got %s", err)
+	}
+	if r.IsTsig() == nil || len(r.Answer) != 1 {
+		t.Fatalf("Expected signed reply with SOA, got %s", r)
+	}
+
+	// A query signed with the wrong secret fails to verify.
+	m = new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+	m.SetTsig(tsigKey, dns.HmacSHA256, 300, time.Now().Unix())
+	cl = &dns.Client{Net: "tcp", TsigSecret: map[string]string{tsigKey: "c2VjcmV0"}}
+	r, _, _ = cl.Exchange(m, tcp)
+	if r == nil || r.Rcode != dns.RcodeNotAuth {
+		t.Fatalf("Expected NOTAUTH reply for bad signature, got %v", r)
+	}
+
+	corefile = `example.org:0 {
+		tsig {
+			key ` + tsigKey + ` hmac-sha256 ` + tsigSecret + `
+		}
+		secondary {
+			transfer from ` + tcp + `
+			tsig ` + tsigKey + `
+		}
+	}`
+
+	i1, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i1.Stop()
+
+	m = new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+
+	// This is async; we need to wait for it to be transferred.
+	for i := 0; i < 20; i++ {
+		r, _ = dns.Exchange(m, udp)
+		if r != nil && len(r.Answer) != 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if r == nil || len(r.Answer) == 0 {
+		t.Fatalf("Expected answer section")
+	}
+}